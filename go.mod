@@ -3,14 +3,16 @@ module github.com/jpoz/mirra
 go 1.23.0
 
 require (
+	github.com/andybalholm/brotli v1.2.0
 	github.com/evanw/esbuild v0.25.12
 	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/sys v0.34.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/sys v0.34.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,340 @@
+// Package anonymize replaces identifying values in recordings with stable
+// pseudonyms, so recordings can be shared outside the team
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/content"
+	"github.com/jpoz/mirra/internal/detect"
+	"github.com/jpoz/mirra/internal/guardrail"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Pseudonym kinds of the built-in rules
+const (
+	KindKey   = "key"
+	KindEmail = "email"
+	KindName  = "name"
+	KindUser  = "user"
+)
+
+// privateKeyBlock matches a whole PEM private key; the secret detector only
+// matches its first line
+var privateKeyBlock = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY(?: BLOCK)?-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY(?: BLOCK)?-----`)
+
+// homeDir matches home directories on macOS, Linux and Windows, including
+// JSON-escaped Windows paths inside recorded SSE streams. The user name is
+// the first group.
+var homeDir = regexp.MustCompile(`(?:/Users/|/home/|\b[A-Za-z]:\\{1,2}Users\\{1,2})([^/\\\s"'<>:|*?\[\]]+)`)
+
+// sharedHomes are home directories that do not belong to a person
+var sharedHomes = map[string]bool{"Shared": true, "Public": true, "Default": true}
+
+// Request body fields that identify the end user
+var identifierFields = []string{"metadata", "user", "safety_identifier", "prompt_cache_key"}
+
+type rule struct {
+	kind     string
+	re       *regexp.Regexp
+	validate func(string) bool
+}
+
+// Anonymizer replaces emails, API keys, people's names, the user names in
+// home directory paths and configured patterns with pseudonyms such as
+// [EMAIL_3f9a2c1b4d5e]. The same value always gets the same pseudonym for
+// the same salt, so traffic from one person stays linkable without naming
+// them.
+type Anonymizer struct {
+	salt  []byte
+	rules []rule
+	names *regexp.Regexp
+}
+
+// New compiles the configured rules. Without a salt a random one is used,
+// making pseudonyms differ from every other export.
+func New(cfg config.AnonymizeConfig) (*Anonymizer, error) {
+	a := &Anonymizer{salt: []byte(cfg.Salt)}
+	if len(a.salt) == 0 {
+		a.salt = make([]byte, 32)
+		if _, err := rand.Read(a.salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+	}
+
+	a.rules = append(a.rules, rule{kind: KindKey, re: privateKeyBlock})
+	for _, re := range detect.SecretPatterns() {
+		a.rules = append(a.rules, rule{kind: KindKey, re: re})
+	}
+
+	for i, r := range cfg.Rules {
+		compiled := rule{kind: strings.ToLower(r.Name)}
+		var pattern string
+		switch {
+		case r.Detector != "":
+			var ok bool
+			if pattern, compiled.validate, ok = guardrail.Detector(r.Detector); !ok {
+				return nil, fmt.Errorf("anonymize rule %q: unknown detector %q", r.Name, r.Detector)
+			}
+			if compiled.kind == "" {
+				compiled.kind = r.Detector
+			}
+		case r.Pattern != "":
+			pattern = r.Pattern
+		default:
+			return nil, fmt.Errorf("anonymize rule %q: detector or pattern required", r.Name)
+		}
+		if compiled.kind == "" {
+			compiled.kind = fmt.Sprintf("pattern%d", i+1)
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("anonymize rule %q: %w", r.Name, err)
+		}
+		compiled.re = re
+		a.rules = append(a.rules, compiled)
+	}
+
+	email, _, _ := guardrail.Detector("email")
+	a.rules = append(a.rules, rule{kind: KindEmail, re: regexp.MustCompile(email)})
+
+	if len(cfg.Names) > 0 {
+		terms := make([]string, len(cfg.Names))
+		for i, name := range cfg.Names {
+			terms[i] = regexp.QuoteMeta(name)
+		}
+		a.names = regexp.MustCompile(`(?i)\b(?:` + strings.Join(terms, "|") + `)\b`)
+	}
+
+	return a, nil
+}
+
+// Pseudonym returns the token that stands for a value of a kind. Emails and
+// names are case-insensitive.
+func (a *Anonymizer) Pseudonym(kind, value string) string {
+	if kind == KindEmail || kind == KindName {
+		value = strings.ToLower(value)
+	}
+	mac := hmac.New(sha256.New, a.salt)
+	mac.Write([]byte(kind + ":" + value))
+	label := strings.ToUpper(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, kind))
+	return "[" + label + "_" + hex.EncodeToString(mac.Sum(nil))[:12] + "]"
+}
+
+// Text replaces every identifying value in s
+func (a *Anonymizer) Text(s string) string {
+	if s == "" {
+		return s
+	}
+	for _, r := range a.rules {
+		s = r.re.ReplaceAllStringFunc(s, func(match string) string {
+			if r.validate != nil && !r.validate(match) {
+				return match
+			}
+			return a.Pseudonym(r.kind, match)
+		})
+	}
+
+	// Only the user name of a home directory is replaced, keeping the path
+	s = replaceGroup(homeDir, s, func(user string) string {
+		if sharedHomes[user] {
+			return user
+		}
+		return a.Pseudonym(KindName, user)
+	})
+
+	if a.names != nil {
+		s = a.names.ReplaceAllStringFunc(s, func(match string) string {
+			return a.Pseudonym(KindName, match)
+		})
+	}
+	return s
+}
+
+// Recording anonymizes a recording in place. Credentials, cookies and
+// organization headers are dropped entirely, as are the request body fields
+// that identify the end user, raw bytes, binary payloads and finding
+// previews. Everything else that is text goes through Text, and the
+// X-Mirra-User, session, project, trace IDs and virtual key become
+// pseudonyms. Payloads must be restored from the blob store first.
+func (a *Anonymizer) Recording(rec *recorder.Recording) {
+	rec.Request.Headers = a.headers(rec.Request.Headers)
+	rec.Response.Headers = a.headers(rec.Response.Headers)
+	rec.Request.Query = a.query(rec.Request.Query)
+
+	if body, ok := rec.Request.Body.(map[string]any); ok {
+		for _, field := range identifierFields {
+			delete(body, field)
+		}
+	}
+	rec.Request.Body = a.value(rec.Request.Body)
+	rec.Response.Body = a.value(rec.Response.Body)
+	for i := range rec.Request.Multipart {
+		part := &rec.Request.Multipart[i]
+		part.Filename = a.Text(part.Filename)
+		part.Value = a.Text(part.Value)
+		dropData(part.Blob)
+	}
+
+	// Raw bytes hold everything removed above
+	rec.Request.Raw = nil
+	rec.Response.Raw = nil
+	dropData(rec.Request.Blob)
+	dropData(rec.Response.Blob)
+
+	rec.Error = a.Text(rec.Error)
+	for i, tag := range rec.Tags {
+		rec.Tags[i] = a.Text(tag)
+	}
+	rec.User = a.identifier(KindUser, rec.User)
+	rec.Session = a.identifier("session", rec.Session)
+	rec.Project = a.identifier("project", rec.Project)
+	if rec.VirtualKey != nil {
+		rec.VirtualKey = &recorder.KeyData{
+			ID:      a.identifier("key_id", rec.VirtualKey.ID),
+			Owner:   a.identifier("owner", rec.VirtualKey.Owner),
+			Project: a.identifier("project", rec.VirtualKey.Project),
+		}
+	}
+	for i := range rec.Findings {
+		rec.Findings[i].Match = ""
+	}
+}
+
+// headers returns a copy of the headers without credentials and with the
+// remaining values anonymized
+func (a *Anonymizer) headers(headers map[string][]string) map[string][]string {
+	if headers == nil {
+		return nil
+	}
+	out := make(map[string][]string, len(headers))
+	for name, values := range headers {
+		if sensitiveHeader(name) {
+			continue
+		}
+		lower := strings.ToLower(name)
+		kept := make([]string, len(values))
+		for i, v := range values {
+			switch {
+			case lower == "x-mirra-user":
+				kept[i] = a.Pseudonym(KindUser, v)
+			case strings.Contains(lower, "project"):
+				kept[i] = a.Pseudonym("project", v)
+			case strings.Contains(lower, "session"):
+				kept[i] = a.Pseudonym("session", v)
+			case lower == "sentry-trace":
+				kept[i] = a.sentryTrace(v)
+			case lower == "baggage" || lower == "traceparent" || lower == "tracestate":
+				kept[i] = a.Pseudonym("trace", v)
+			default:
+				kept[i] = a.Text(v)
+			}
+		}
+		out[name] = kept
+	}
+	return out
+}
+
+// identifier returns the pseudonym of a non-empty identifier
+func (a *Anonymizer) identifier(kind, value string) string {
+	if value == "" {
+		return ""
+	}
+	return a.Pseudonym(kind, value)
+}
+
+// sentryTrace pseudonymizes the trace and span IDs of a Sentry-Trace header,
+// keeping its trace-span-sampled form so recordings of a trace still group
+// together
+func (a *Anonymizer) sentryTrace(value string) string {
+	parts := strings.Split(value, "-")
+	for i, part := range parts {
+		switch i {
+		case 0:
+			parts[i] = a.Pseudonym("trace", part)
+		case 1:
+			parts[i] = a.Pseudonym("span", part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// query drops Gemini's ?key= and anonymizes the other parameters
+func (a *Anonymizer) query(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	query, err := url.ParseQuery(raw)
+	if err != nil {
+		return a.Text(raw)
+	}
+	query.Del("key")
+	for name, values := range query {
+		for i, v := range values {
+			values[i] = a.Text(v)
+		}
+		query[name] = values
+	}
+	return query.Encode()
+}
+
+// value anonymizes every string in a JSON value, such as a body or a
+// streamed response
+func (a *Anonymizer) value(v any) any {
+	if v == nil {
+		return nil
+	}
+	return content.WalkLeaves(v, "", func(seg content.Segment) string {
+		return a.Text(seg.Text)
+	})
+}
+
+// sensitiveHeader reports whether a header carries credentials or names the
+// account
+func sensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitive := range []string{"authorization", "api-key", "cookie", "organization"} {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropData removes the bytes of a binary payload, keeping its description
+func dropData(blob *recorder.Blob) {
+	if blob != nil {
+		blob.Data = ""
+	}
+}
+
+// replaceGroup replaces the first group of every match of re in s
+func replaceGroup(re *regexp.Regexp, s string, fn func(string) string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m[2]])
+		b.WriteString(fn(s[m[2]:m[3]]))
+		last = m[3]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
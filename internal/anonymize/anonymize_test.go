@@ -0,0 +1,165 @@
+package anonymize
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAnonymizer(t *testing.T, cfg config.AnonymizeConfig) *Anonymizer {
+	t.Helper()
+	if cfg.Salt == "" {
+		cfg.Salt = "test-salt"
+	}
+	a, err := New(cfg)
+	require.NoError(t, err)
+	return a
+}
+
+func TestAnonymizer_Pseudonym(t *testing.T) {
+	a := newAnonymizer(t, config.AnonymizeConfig{})
+	b := newAnonymizer(t, config.AnonymizeConfig{Salt: "other-salt"})
+
+	p := a.Pseudonym(KindEmail, "alice@example.com")
+	assert.Regexp(t, `^\[EMAIL_[0-9a-f]{12}\]$`, p)
+	assert.Equal(t, p, a.Pseudonym(KindEmail, "Alice@Example.com"), "emails are case-insensitive")
+	assert.NotEqual(t, p, a.Pseudonym(KindEmail, "bob@example.com"))
+	assert.NotEqual(t, p, a.Pseudonym(KindUser, "alice@example.com"), "kinds do not collide")
+	assert.NotEqual(t, p, b.Pseudonym(KindEmail, "alice@example.com"), "salts give different pseudonyms")
+}
+
+func TestAnonymizer_Text(t *testing.T) {
+	a := newAnonymizer(t, config.AnonymizeConfig{
+		Names: []string{"Alice Smith", "alice"},
+		Rules: []config.AnonymizeRule{
+			{Name: "account", Pattern: `ACCT-\d{6}`},
+			{Detector: "ssn"},
+		},
+	})
+	name := a.Pseudonym(KindName, "alice")
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"email", "mail alice@example.com now", "mail " + a.Pseudonym(KindEmail, "alice@example.com") + " now"},
+		{"api key", "key sk-ant-REDACTED", "key " + a.Pseudonym(KindKey, "sk-ant-REDACTED")},
+		{"macOS path", "open /Users/alice/src/main.go", "open /Users/" + name + "/src/main.go"},
+		{"linux path", "/home/alice/.ssh", "/home/" + name + "/.ssh"},
+		{"windows path", `C:\Users\alice\Desktop`, `C:\Users\` + name + `\Desktop`},
+		{"shared home", "/Users/Shared/data", "/Users/Shared/data"},
+		{"names", "ALICE SMITH and Alice", a.Pseudonym(KindName, "alice smith") + " and " + name},
+		{"custom pattern", "account ACCT-123456", "account " + a.Pseudonym("account", "ACCT-123456")},
+		{"detector", "ssn 123-45-6789", "ssn " + a.Pseudonym("ssn", "123-45-6789")},
+		{"nothing to replace", "just code", "just code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, a.Text(tt.in))
+		})
+	}
+}
+
+func TestNew_InvalidRules(t *testing.T) {
+	_, err := New(config.AnonymizeConfig{Rules: []config.AnonymizeRule{{Name: "x", Detector: "passport"}}})
+	assert.ErrorContains(t, err, "unknown detector")
+	_, err = New(config.AnonymizeConfig{Rules: []config.AnonymizeRule{{Name: "x", Pattern: "("}}})
+	assert.Error(t, err)
+	_, err = New(config.AnonymizeConfig{Rules: []config.AnonymizeRule{{Name: "x"}}})
+	assert.ErrorContains(t, err, "detector or pattern required")
+}
+
+func TestAnonymizer_Recording(t *testing.T) {
+	a := newAnonymizer(t, config.AnonymizeConfig{})
+	rec := &recorder.Recording{
+		User:       "alice",
+		Session:    "session-1",
+		Project:    "acme",
+		Tags:       []string{"alice@example.com", "eval"},
+		Error:      "upstream rejected alice@example.com",
+		VirtualKey: &recorder.KeyData{ID: "vk-1", Owner: "alice", Project: "acme"},
+		Findings:   []recorder.Finding{{Detector: "pii", Type: "email", Match: "al****om"}},
+		Request: recorder.RequestData{
+			Query: "key=AIzaSecret&alt=sse",
+			Headers: map[string][]string{
+				"Authorization":   {"Bearer sk-secret"},
+				"X-Api-Key":       {"sk-ant-secret"},
+				"Cookie":          {"session=1"},
+				"X-Mirra-User":    {"alice"},
+				"Anthropic-Beta":  {"tools-2024"},
+				"Sentry-Trace":    {"trace1-span1-1"},
+				"X-Session-Id":    {"session-1"},
+				"X-Goog-Api-Key":  {"AIzaSecret"},
+				"Openai-Project":  {"proj_1"},
+				"X-Forwarded-For": {"10.0.0.1"},
+			},
+			Body: map[string]any{
+				"metadata": map[string]any{"user_id": "user_hash_account_1_session_2"},
+				"user":     "alice",
+				"messages": []any{
+					map[string]any{"role": "user", "content": "I am alice@example.com, see /home/alice/notes.txt"},
+				},
+			},
+			Multipart: []recorder.MultipartPart{{Name: "file", Filename: "/Users/alice/a.wav", Blob: &recorder.Blob{SHA256: "abc", Data: "AAAA"}}},
+			Raw:       &recorder.Blob{SHA256: "def", Data: "e30="},
+		},
+		Response: recorder.ResponseData{
+			Headers: map[string][]string{"Anthropic-Organization-Id": {"org-1"}, "Set-Cookie": {"x=1"}, "Content-Type": {"application/json"}},
+			Body:    "data: {\"text\":\"Hi alice@example.com\"}\n\n",
+			Raw:     &recorder.Blob{SHA256: "ghi", Data: "e30="},
+		},
+	}
+
+	a.Recording(rec)
+
+	email := a.Pseudonym(KindEmail, "alice@example.com")
+	assert.Equal(t, a.Pseudonym(KindUser, "alice"), rec.User)
+	assert.Equal(t, a.Pseudonym("session", "session-1"), rec.Session)
+	assert.Equal(t, []string{email, "eval"}, rec.Tags)
+	assert.Equal(t, "upstream rejected "+email, rec.Error)
+	assert.Equal(t, a.Pseudonym("project", "acme"), rec.Project)
+	assert.Equal(t, &recorder.KeyData{
+		ID:      a.Pseudonym("key_id", "vk-1"),
+		Owner:   a.Pseudonym("owner", "alice"),
+		Project: a.Pseudonym("project", "acme"),
+	}, rec.VirtualKey)
+	assert.Empty(t, rec.Findings[0].Match)
+
+	assert.Equal(t, "alt=sse", rec.Request.Query)
+	assert.Equal(t, map[string][]string{
+		"X-Mirra-User":    {a.Pseudonym(KindUser, "alice")},
+		"Anthropic-Beta":  {"tools-2024"},
+		"Sentry-Trace":    {a.Pseudonym("trace", "trace1") + "-" + a.Pseudonym("span", "span1") + "-1"},
+		"X-Session-Id":    {a.Pseudonym("session", "session-1")},
+		"Openai-Project":  {a.Pseudonym("project", "proj_1")},
+		"X-Forwarded-For": {"10.0.0.1"},
+	}, rec.Request.Headers)
+	assert.Equal(t, map[string][]string{"Content-Type": {"application/json"}}, rec.Response.Headers)
+
+	body := rec.Request.Body.(map[string]any)
+	assert.NotContains(t, body, "metadata")
+	assert.NotContains(t, body, "user")
+	message := body["messages"].([]any)[0].(map[string]any)
+	assert.Equal(t, "I am "+email+", see /home/"+a.Pseudonym(KindName, "alice")+"/notes.txt", message["content"])
+	assert.Equal(t, "data: {\"text\":\"Hi "+email+"\"}\n\n", rec.Response.Body)
+
+	assert.Equal(t, "/Users/"+a.Pseudonym(KindName, "alice")+"/a.wav", rec.Request.Multipart[0].Filename)
+	assert.Empty(t, rec.Request.Multipart[0].Blob.Data)
+	assert.Nil(t, rec.Request.Raw)
+	assert.Nil(t, rec.Response.Raw)
+
+	data, err := json.Marshal(rec)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "alice")
+	assert.NotContains(t, string(data), "secret")
+	assert.NotContains(t, string(data), "acme")
+	assert.NotContains(t, string(data), "vk-1")
+	assert.NotContains(t, string(data), "trace1")
+	assert.NotContains(t, string(data), "session-1")
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// GetRecordingBlob handles GET /api/recordings/{id}/blobs/{ref}
+// ref is "request", "response", "multipart[i]" or a ".raw" body as listed by
+// Recording.Blobs.
+// The blob is served with its original content type so the UI can play or
+// display it directly.
+func (h *Handlers) GetRecordingBlob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	ref := r.PathValue("ref")
+	if id == "" || ref == "" {
+		http.Error(w, "Recording ID and blob reference required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := h.findRecordingByID(id)
+	if err != nil {
+		if err.Error() == "recording not found" {
+			http.Error(w, "Recording not found", http.StatusNotFound)
+		} else {
+			h.log.Error("Failed to find recording", "error", err)
+			http.Error(w, "Failed to read recordings", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	for _, b := range found.Blobs() {
+		if b.Ref != ref {
+			continue
+		}
+
+		data, err := h.blobs.ReadBlob(b.Blob)
+		if err != nil {
+			h.log.Error("Failed to decode blob", "id", id, "ref", ref, "error", err)
+			http.Error(w, "Failed to decode blob", http.StatusInternalServerError)
+			return
+		}
+
+		contentType := b.Blob.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if b.Filename != "" {
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": b.Filename}))
+		}
+		w.Header().Set("ETag", fmt.Sprintf("%q", b.Blob.SHA256))
+		if _, err := w.Write(data); err != nil {
+			h.log.Error("Failed to write blob", "error", err)
+		}
+		return
+	}
+
+	http.Error(w, "Blob not found", http.StatusNotFound)
+}
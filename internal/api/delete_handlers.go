@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// DeleteRecording handles DELETE /api/recordings/{id}
+// Removes the recording from its file, the index and its session group;
+// ?dryRun=true only reports what would be removed.
+func (h *Handlers) DeleteRecording(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "Recording ID required", http.StatusBadRequest)
+		return
+	}
+	if h.rec == nil {
+		http.Error(w, "Recording is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	result, err := h.rec.Delete(id, dryRun)
+	if result != nil && len(result.IDs) == 0 && err == nil {
+		http.Error(w, "Recording not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.log.Error("Failed to delete recording", "id", id, "error", err)
+		http.Error(w, "Failed to delete recording", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+	}
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/jpoz/mirra/internal/detect"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// FindingSummary is a finding together with the recording it belongs to
+type FindingSummary struct {
+	RecordingID string    `json:"recordingId"`
+	Timestamp   time.Time `json:"timestamp"`
+	Provider    string    `json:"provider"`
+	Path        string    `json:"path"`
+	recorder.Finding
+}
+
+// FindingListResponse represents the API response for listing findings
+type FindingListResponse struct {
+	Findings   []FindingSummary `json:"findings"`
+	Total      int              `json:"total"`
+	Page       int              `json:"page"`
+	Limit      int              `json:"limit"`
+	HasMore    bool             `json:"hasMore"`
+	BySeverity map[string]int   `json:"bySeverity"`
+}
+
+// ListFindings handles GET /api/findings
+// Supports filtering by detector, type, provider, minimum severity and date range.
+func (h *Handlers) ListFindings(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page := parseInt(query.Get("page"), 1)
+	limit := parseInt(query.Get("limit"), 50)
+	detector := query.Get("detector")
+	findingType := query.Get("type")
+	minSeverity := query.Get("severity")
+	filter := &recorder.Filter{
+		Provider: query.Get("provider"),
+		Project:  query.Get("project"),
+		Tags:     recorder.ParseTags(query.Get("tags")),
+	}
+
+	recordings, err := h.readAllRecordings(query.Get("from"), query.Get("to"))
+	if err != nil {
+		h.log.Error("Failed to read recordings", "error", err)
+		http.Error(w, "Failed to read recordings", http.StatusInternalServerError)
+		return
+	}
+
+	findings := make([]FindingSummary, 0)
+	bySeverity := make(map[string]int)
+	for _, rec := range recordings {
+		if !filter.Match(&rec) {
+			continue
+		}
+		for _, f := range rec.Findings {
+			if detector != "" && f.Detector != detector {
+				continue
+			}
+			if findingType != "" && f.Type != findingType {
+				continue
+			}
+			if minSeverity != "" && detect.SeverityRank(f.Severity) < detect.SeverityRank(minSeverity) {
+				continue
+			}
+
+			bySeverity[f.Severity]++
+			findings = append(findings, FindingSummary{
+				RecordingID: rec.ID,
+				Timestamp:   rec.Timestamp,
+				Provider:    rec.Provider,
+				Path:        rec.Request.Path,
+				Finding:     f,
+			})
+		}
+	}
+
+	// Newest first
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Timestamp.After(findings[j].Timestamp)
+	})
+
+	total := len(findings)
+	start := (page - 1) * limit
+	if start >= total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	response := FindingListResponse{
+		Findings:   findings[start:end],
+		Total:      total,
+		Page:       page,
+		Limit:      limit,
+		HasMore:    end < total,
+		BySeverity: bySeverity,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+	}
+}
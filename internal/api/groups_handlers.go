@@ -38,6 +38,8 @@ type SessionGroupResponse struct {
 	RequestCount   int       `json:"request_count"`
 	Providers      []string  `json:"providers"`
 	HasErrors      bool      `json:"has_errors"`
+	Project        string    `json:"project,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
 }
 
 // SessionGroupListResponse represents the API response for listing session groups
@@ -76,6 +78,8 @@ func (h *GroupHandlers) ListSessionGroups(w http.ResponseWriter, r *http.Request
 		Page:     page,
 		Limit:    limit,
 		Provider: provider,
+		Project:  query.Get("project"),
+		Tag:      query.Get("tag"),
 	}
 
 	if fromDateStr != "" {
@@ -110,6 +114,8 @@ func (h *GroupHandlers) ListSessionGroups(w http.ResponseWriter, r *http.Request
 			RequestCount:   group.RequestCount,
 			Providers:      group.Providers,
 			HasErrors:      group.HasErrors,
+			Project:        group.Project,
+			Tags:           group.Tags,
 		}
 	}
 
@@ -171,6 +177,10 @@ func (h *GroupHandlers) GetSessionGroup(w http.ResponseWriter, r *http.Request)
 			Duration:     rec.Timing.DurationMs,
 			ResponseSize: rec.ResponseSize,
 			Error:        rec.Error,
+			Tags:         rec.Tags,
+			Project:      rec.Project,
+			Session:      rec.Session,
+			User:         rec.User,
 		})
 	}
 
@@ -184,6 +194,8 @@ func (h *GroupHandlers) GetSessionGroup(w http.ResponseWriter, r *http.Request)
 			RequestCount:   group.RequestCount,
 			Providers:      group.Providers,
 			HasErrors:      group.HasErrors,
+			Project:        group.Project,
+			Tags:           group.Tags,
 		},
 		Recordings: recordings,
 	}
@@ -2,14 +2,10 @@ package api
 
 import (
 	"bufio"
-	"compress/gzip"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
-	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -40,22 +36,39 @@ type RecordingSummary struct {
 	Duration     int64     `json:"duration"`
 	ResponseSize int64     `json:"responseSize"`
 	Error        string    `json:"error,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	Project      string    `json:"project,omitempty"`
+	Session      string    `json:"session,omitempty"`
+	User         string    `json:"user,omitempty"`
 }
 
 // Handlers contains the API handler methods
 type Handlers struct {
-	cfg *config.Config
-	log *slog.Logger
-	rec *recorder.Recorder
+	cfg   *config.Config
+	log   *slog.Logger
+	rec   *recorder.Recorder
+	blobs *recorder.BlobStore
+	keys  *recorder.Keyring
 }
 
 // NewHandlers creates a new API handlers instance
 func NewHandlers(cfg *config.Config, log *slog.Logger, rec *recorder.Recorder) *Handlers {
-	return &Handlers{
-		cfg: cfg,
-		log: log,
-		rec: rec,
+	recordingsPath := cfg.Recording.Path
+	if recordingsPath == "" {
+		recordingsPath = "./recordings"
+	}
+
+	h := &Handlers{
+		cfg:   cfg,
+		log:   log,
+		rec:   rec,
+		blobs: recorder.NewBlobStore(recordingsPath),
 	}
+	if rec != nil {
+		h.keys = rec.Keyring()
+		h.blobs.SetKeyring(h.keys)
+	}
+	return h
 }
 
 // ListRecordings handles GET /api/recordings
@@ -64,10 +77,16 @@ func (h *Handlers) ListRecordings(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	page := parseInt(query.Get("page"), 1)
 	limit := parseInt(query.Get("limit"), 50)
-	provider := query.Get("provider")
 	fromDate := query.Get("from")
 	toDate := query.Get("to")
 	search := strings.TrimSpace(query.Get("search"))
+	filter := &recorder.Filter{
+		Provider: query.Get("provider"),
+		Project:  query.Get("project"),
+		Session:  query.Get("session"),
+		User:     query.Get("user"),
+		Tags:     recorder.ParseTags(query.Get("tags")),
+	}
 
 	// Read all recordings
 	recordings, err := h.readAllRecordings(fromDate, toDate)
@@ -78,7 +97,7 @@ func (h *Handlers) ListRecordings(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Filter recordings
-	filtered := h.filterRecordings(recordings, provider, search)
+	filtered := h.filterRecordings(recordings, filter, search)
 
 	// Sort by timestamp descending (newest first)
 	sort.Slice(filtered, func(i, j int) bool {
@@ -140,34 +159,15 @@ func (h *Handlers) GetRecording(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Restore large text moved to the blob store; binary blobs are served
+	// separately by GetRecordingBlob
+	if err := h.blobs.HydrateText(found); err != nil {
+		h.log.Warn("Failed to restore recording payloads", "id", id, "error", err)
+	}
+
 	// Redact sensitive data
 	redacted := h.redactRecording(*found)
 
-	// Decompress gzipped response body if needed
-	if body, ok := redacted.Response.Body.(string); ok {
-		if strings.HasPrefix(body, "base64:") {
-			decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(body, "base64:"))
-			if err == nil {
-				gr, err := gzip.NewReader(strings.NewReader(string(decoded)))
-				if err == nil {
-					decompressed, err := io.ReadAll(gr)
-					if closeErr := gr.Close(); closeErr != nil {
-						h.log.Error("Failed to close gzip reader", "error", closeErr)
-					}
-					if err == nil {
-						// Try to parse as JSON
-						var jsonBody interface{}
-						if json.Unmarshal(decompressed, &jsonBody) == nil {
-							redacted.Response.Body = jsonBody
-						} else {
-							redacted.Response.Body = string(decompressed)
-						}
-					}
-				}
-			}
-		}
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(redacted); err != nil {
 		h.log.Error("Failed to encode response", "error", err)
@@ -202,6 +202,10 @@ func (h *Handlers) ParseRecording(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.blobs.HydrateText(found); err != nil {
+		h.log.Warn("Failed to restore recording payloads", "id", id, "error", err)
+	}
+
 	// Check if this is a streaming response
 	if !found.Response.Streaming {
 		http.Error(w, "Recording is not a streaming response", http.StatusBadRequest)
@@ -293,27 +297,28 @@ func (h *Handlers) findRecordingByID(id string) (*recorder.Recording, error) {
 	// Try to extract date from ID for targeted lookup
 	date := extractDateFromID(id)
 	if date != "" {
-		// Search only the specific day's file
-		filename := fmt.Sprintf("recordings-%s.jsonl", date)
-		filePath := filepath.Join(recordingsPath, filename)
-
-		// Check if file exists
-		if _, err := os.Stat(filePath); err == nil {
+		// Search only the day's files, which may be rotated or compressed
+		files, _ := recorder.FindRecordingFiles(recordingsPath, date)
+		searched := len(files) > 0
+		for _, filePath := range files {
 			recordings, err := h.readRecordingsFromFile(filePath)
 			if err != nil {
-				h.log.Error("Failed to read recordings file", "file", filename, "error", err)
+				h.log.Error("Failed to read recordings file", "file", filepath.Base(filePath), "error", err)
 				// Fall through to full scan
-			} else {
-				// Search for matching ID in this file
-				for i := range recordings {
-					if strings.HasPrefix(recordings[i].ID, id) {
-						return &recordings[i], nil
-					}
+				searched = false
+				break
+			}
+			// Search for matching ID in this file
+			for i := range recordings {
+				if strings.HasPrefix(recordings[i].ID, id) {
+					return &recordings[i], nil
 				}
-				// Not found in expected file
-				return nil, fmt.Errorf("recording not found")
 			}
 		}
+		if searched {
+			// Not found in expected files
+			return nil, fmt.Errorf("recording not found")
+		}
 	}
 
 	// Final fallback: scan all files (for old IDs without date prefix or if other methods failed)
@@ -353,25 +358,16 @@ func (h *Handlers) readAllRecordings(fromDate, toDate string) ([]recorder.Record
 		}
 	}
 
-	// Read directory
-	entries, err := os.ReadDir(recordingsPath)
+	// List recordings files, compressed or not
+	files, err := recorder.RecordingFiles(recordingsPath)
 	if err != nil {
 		return nil, err
 	}
 
 	// Process each JSONL file
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
-			continue
-		}
-
-		// Parse date from filename (recordings-YYYY-MM-DD.jsonl)
-		parts := strings.Split(strings.TrimSuffix(entry.Name(), ".jsonl"), "-")
-		if len(parts) < 4 {
-			continue
-		}
-		fileDate := strings.Join(parts[1:], "-")
-		fileTime, err := time.Parse("2006-01-02", fileDate)
+	for _, filePath := range files {
+		// Parse date from filename (recordings-YYYY-MM-DD.jsonl[.zst])
+		fileTime, err := time.Parse("2006-01-02", recorder.RecordingFileDate(filePath))
 		if err != nil {
 			continue
 		}
@@ -385,10 +381,9 @@ func (h *Handlers) readAllRecordings(fromDate, toDate string) ([]recorder.Record
 		}
 
 		// Read file
-		filePath := filepath.Join(recordingsPath, entry.Name())
 		fileRecordings, err := h.readRecordingsFromFile(filePath)
 		if err != nil {
-			h.log.Error("Failed to read recordings file", "file", entry.Name(), "error", err)
+			h.log.Error("Failed to read recordings file", "file", filepath.Base(filePath), "error", err)
 			continue
 		}
 
@@ -398,9 +393,10 @@ func (h *Handlers) readAllRecordings(fromDate, toDate string) ([]recorder.Record
 	return recordings, nil
 }
 
-// readRecordingsFromFile reads recordings from a single JSONL file
+// readRecordingsFromFile reads recordings from a single JSONL file,
+// decompressing and decrypting it if needed
 func (h *Handlers) readRecordingsFromFile(path string) ([]recorder.Recording, error) {
-	file, err := os.Open(path)
+	file, err := recorder.OpenRecordings(path)
 	if err != nil {
 		return nil, err
 	}
@@ -424,10 +420,17 @@ func (h *Handlers) readRecordingsFromFile(path string) ([]recorder.Recording, er
 		}
 
 		var rec recorder.Recording
-		if err := json.Unmarshal(line, &rec); err != nil {
+		if err := recorder.DecodeRecording(line, &rec); err != nil {
 			h.log.Error("Failed to parse recording", "error", err)
 			continue
 		}
+		// Listing only needs the plaintext metadata, so recordings that
+		// cannot be decrypted are still returned
+		if err := h.keys.Open(&rec); err != nil {
+			h.log.Debug("Failed to decrypt recording", "id", rec.ID, "error", err)
+		} else if _, err := recorder.Upgrade(&rec); err != nil {
+			h.log.Warn("Failed to upgrade recording", "id", rec.ID, "error", err)
+		}
 
 		recordings = append(recordings, rec)
 	}
@@ -439,13 +442,13 @@ func (h *Handlers) readRecordingsFromFile(path string) ([]recorder.Recording, er
 	return recordings, nil
 }
 
-// filterRecordings filters recordings by provider and search term
-func (h *Handlers) filterRecordings(recordings []recorder.Recording, provider, search string) []recorder.Recording {
+// filterRecordings filters recordings by provider, client metadata and search term
+func (h *Handlers) filterRecordings(recordings []recorder.Recording, filter *recorder.Filter, search string) []recorder.Recording {
 	filtered := make([]recorder.Recording, 0, len(recordings))
 
 	for _, rec := range recordings {
-		// Filter by provider
-		if provider != "" && !strings.EqualFold(rec.Provider, provider) {
+		// Filter by provider, project, session, user and tags
+		if !filter.Match(&rec) {
 			continue
 		}
 
@@ -477,6 +480,10 @@ func (h *Handlers) recordingToSummary(rec recorder.Recording) RecordingSummary {
 		Duration:     rec.Timing.DurationMs,
 		ResponseSize: rec.ResponseSize,
 		Error:        rec.Error,
+		Tags:         rec.Tags,
+		Project:      rec.Project,
+		Session:      rec.Session,
+		User:         rec.User,
 	}
 }
 
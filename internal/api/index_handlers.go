@@ -0,0 +1,27 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RebuildIndexResponse represents the API response for rebuilding the index
+type RebuildIndexResponse struct {
+	Recordings int `json:"recordings"`
+}
+
+// RebuildIndex handles POST /api/index/rebuild
+// `mirra reindex` calls it when a running server holds the recordings directory.
+func (h *Handlers) RebuildIndex(w http.ResponseWriter, r *http.Request) {
+	count, err := h.rec.Reindex()
+	if err != nil {
+		h.log.Error("Failed to rebuild index", "error", err)
+		http.Error(w, "Failed to rebuild index", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(RebuildIndexResponse{Recordings: count}); err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// PruneRecordings handles POST /api/prune
+// Applies the configured retention policy now; ?dryRun=true only reports
+// what would be removed. `mirra prune` calls it when a server is running.
+func (h *Handlers) PruneRecordings(w http.ResponseWriter, r *http.Request) {
+	policy := h.cfg.Recording.Retention.Policy()
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	result, err := h.rec.Prune(policy, dryRun)
+	if err != nil {
+		h.log.Error("Failed to prune recordings", "error", err)
+		http.Error(w, "Failed to prune recordings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		h.log.Error("Failed to encode response", "error", err)
+	}
+}
@@ -0,0 +1,199 @@
+package commands
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Audit handles the "mirra audit" command
+func Audit(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("subcommand required: verify, keygen")
+	}
+
+	subcommand := args[0]
+	subArgs := args[1:]
+
+	switch subcommand {
+	case "verify":
+		return VerifyAudit(subArgs)
+	case "keygen":
+		return AuditKeygen(subArgs)
+	default:
+		return fmt.Errorf("unknown subcommand: %s", subcommand)
+	}
+}
+
+// VerifyAudit handles the "mirra audit verify" command. It checks every
+// recordings file against its audit log and reports modified, inserted and
+// deleted recordings, invalid or missing signatures, and files removed along
+// with their audit logs.
+func VerifyAudit(args []string) error {
+	fs := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	publicKey := fs.String("public-key", "", "File with the public key checkpoints are verified with (default: derived from "+recorder.AuditKeyFileEnv+")")
+	from := fs.String("from", "", "Check files from date (YYYY-MM-DD)")
+	to := fs.String("to", "", "Check files to date (YYYY-MM-DD)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var pub ed25519.PublicKey
+	if *publicKey != "" {
+		data, err := os.ReadFile(*publicKey)
+		if err != nil {
+			return fmt.Errorf("failed to read public key: %w", err)
+		}
+		if pub, err = recorder.ParseAuditPublicKey(string(data)); err != nil {
+			return err
+		}
+	} else {
+		signer, err := recorder.AuditSignerFromEnv()
+		if err != nil {
+			return err
+		}
+		if signer != nil {
+			pub = signer.PublicKey()
+		}
+	}
+
+	lock, err := recorder.LockShared(*recordingsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	files, err := recorder.RecordingFiles(*recordingsPath)
+	if err != nil {
+		return fmt.Errorf("failed to list recording files: %w", err)
+	}
+	audited, err := recorder.AuditedFiles(*recordingsPath)
+	if err != nil {
+		return fmt.Errorf("failed to list audit logs: %w", err)
+	}
+
+	// Audit logs whose file is gone are checked too, so deleted files show up
+	seen := make(map[string]bool)
+	for _, file := range files {
+		seen[strings.TrimSuffix(filepath.Base(file), recorder.CompressedExt)] = true
+	}
+	for _, file := range audited {
+		if !seen[filepath.Base(file)] {
+			files = append(files, file)
+		}
+	}
+
+	var checked, failed, unsigned int
+	for _, file := range files {
+		date := recorder.RecordingFileDate(filepath.Base(file))
+		if (*from != "" && date < *from) || (*to != "" && date > *to) {
+			continue
+		}
+
+		report, err := recorder.VerifyAudit(file, pub)
+		if err != nil {
+			fmt.Printf("✗ %s: %v\n", filepath.Base(file), err)
+			failed++
+			continue
+		}
+		checked++
+
+		if report.OK() {
+			rebuilt := ""
+			if report.Rebuilt != "" {
+				rebuilt = ", rebuilt by " + report.Rebuilt
+			}
+			fmt.Printf("✓ %s: %d entries, %d checkpoints%s\n", report.File, report.Entries, report.Checkpoints, rebuilt)
+		} else {
+			failed++
+			printAuditProblems(report)
+		}
+		if pub != nil && report.Signed < report.Entries {
+			unsigned += report.Entries - report.Signed
+		}
+	}
+
+	// Files removed along with their audit logs only show in the file log
+	report, err := recorder.VerifyAuditFiles(*recordingsPath, pub)
+	if err != nil {
+		return fmt.Errorf("failed to check audit file log: %w", err)
+	}
+	if report.OK() && report.Entries > 0 {
+		fmt.Printf("✓ %s: %d files started or removed\n", report.File, report.Entries)
+	} else if !report.OK() {
+		failed++
+		printAuditProblems(report)
+	}
+
+	fmt.Printf("\nChecked %d files, %d with problems\n", checked, failed)
+	if pub == nil {
+		fmt.Printf("Signatures not checked: pass --public-key or set %s\n", recorder.AuditKeyFileEnv)
+	} else if unsigned > 0 {
+		fmt.Printf("%d entries of the file being written are not covered by a signed checkpoint yet\n", unsigned)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files do not match their audit logs", failed)
+	}
+	return nil
+}
+
+func printAuditProblems(report *recorder.AuditReport) {
+	fmt.Printf("✗ %s: %d problems\n", report.File, len(report.Problems))
+	for _, p := range report.Problems {
+		location := ""
+		if p.Line > 0 {
+			location = fmt.Sprintf(" line %d", p.Line)
+		}
+		if p.ID != "" {
+			location += " (" + p.ID + ")"
+		}
+		fmt.Printf("    %s%s: %s\n", p.Kind, location, p.Detail)
+	}
+}
+
+// AuditKeygen handles the "mirra audit keygen" command. It writes a new
+// signing key and prints the public key to verify checkpoints with.
+func AuditKeygen(args []string) error {
+	fs := flag.NewFlagSet("audit keygen", flag.ExitOnError)
+	out := fs.String("out", "./mirra-audit.key", "File to write the signing key to")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	private, public, err := recorder.GenerateAuditKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	signer, err := recorder.NewAuditSigner(private)
+	if err != nil {
+		return err
+	}
+	// O_EXCL so an existing key is never overwritten
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create key file: %w", err)
+	}
+	if _, err := fmt.Fprintln(f, private); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := os.WriteFile(*out+".pub", []byte(public+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	fmt.Printf("✓ Signing key written to %s\n", *out)
+	fmt.Printf("  Public key (%s): %s\n", *out+".pub", public)
+	fmt.Printf("  Key ID: %s\n", signer.KeyID())
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+
+	"github.com/jpoz/mirra/internal/recorder"
 )
 
 func Clear(args []string) error {
@@ -17,6 +19,12 @@ func Clear(args []string) error {
 		return err
 	}
 
+	lock, err := recorder.LockExclusive(*recordingsPath, "clear")
+	if err != nil {
+		return fmt.Errorf("cannot clear recordings: %w", err)
+	}
+	defer lock.Unlock()
+
 	// Check if recordings directory exists
 	if _, err := os.Stat(*recordingsPath); os.IsNotExist(err) {
 		fmt.Printf("Recordings directory does not exist: %s\n", *recordingsPath)
@@ -37,11 +45,16 @@ func Clear(args []string) error {
 
 	fmt.Printf("Clearing recordings in %s...\n", *recordingsPath)
 
-	// Remove all .jsonl files
+	// Remove all .jsonl files, compressed or not
 	jsonlFiles, err := filepath.Glob(filepath.Join(*recordingsPath, "*.jsonl"))
 	if err != nil {
 		return fmt.Errorf("failed to list recording files: %w", err)
 	}
+	compressedFiles, err := filepath.Glob(filepath.Join(*recordingsPath, "*.jsonl"+recorder.CompressedExt))
+	if err != nil {
+		return fmt.Errorf("failed to list recording files: %w", err)
+	}
+	jsonlFiles = append(jsonlFiles, compressedFiles...)
 
 	removedCount := 0
 	for _, file := range jsonlFiles {
@@ -52,15 +65,21 @@ func Clear(args []string) error {
 		}
 	}
 
-	// Remove index.json
-	indexPath := filepath.Join(*recordingsPath, "index.json")
-	if _, err := os.Stat(indexPath); err == nil {
-		if err := os.Remove(indexPath); err != nil {
-			slog.Warn("failed to remove index", "error", err)
-		} else {
-			fmt.Printf("✓ Removed index\n")
+	// Remove the index snapshot and log
+	removedIndex := false
+	for _, name := range []string{"index.json", "index.log"} {
+		indexPath := filepath.Join(*recordingsPath, name)
+		if _, err := os.Stat(indexPath); err == nil {
+			if err := os.Remove(indexPath); err != nil {
+				slog.Warn("failed to remove index", "file", name, "error", err)
+			} else {
+				removedIndex = true
+			}
 		}
 	}
+	if removedIndex {
+		fmt.Printf("✓ Removed index\n")
+	}
 
 	// Remove groups directory and its contents
 	groupsPath := filepath.Join(*recordingsPath, "groups")
@@ -72,6 +91,16 @@ func Clear(args []string) error {
 		}
 	}
 
+	// Remove blob store
+	blobsPath := filepath.Join(*recordingsPath, "blobs")
+	if _, err := os.Stat(blobsPath); err == nil {
+		if err := os.RemoveAll(blobsPath); err != nil {
+			slog.Warn("failed to remove blobs directory", "error", err)
+		} else {
+			fmt.Printf("✓ Removed blobs\n")
+		}
+	}
+
 	fmt.Printf("✓ Cleared successfully!\n")
 	fmt.Printf("  Removed %d recording files\n", removedCount)
 
@@ -0,0 +1,101 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Compact handles the "mirra compact" command. It rewrites existing
+// recordings so repeated system prompts, tools and conversation history are
+// stored once in the blob store, and large payloads are moved out of line.
+// It refuses to run while a server is using the recordings directory.
+func Compact(args []string) error {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	dedupeThreshold := fs.Int("dedupe-threshold", recorder.DefaultFragmentThreshold, "Smallest prompt fragment in bytes stored once, negative disables")
+	inlineThreshold := fs.Int("inline-threshold", recorder.DefaultInlineThreshold, "Largest payload in bytes kept inline, negative disables")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	lock, err := recorder.LockExclusive(*recordingsPath, "compact")
+	if err != nil {
+		return fmt.Errorf("cannot compact recordings: %w", err)
+	}
+	defer lock.Unlock()
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+	signer, err := recorder.AuditSignerFromEnv()
+	if err != nil {
+		return err
+	}
+
+	files, err := recorder.RecordingFiles(*recordingsPath)
+	if err != nil {
+		return fmt.Errorf("failed to list recording files: %w", err)
+	}
+	if len(files) == 0 {
+		fmt.Printf("No recordings found in %s\n", *recordingsPath)
+		return nil
+	}
+
+	blobs := recorder.NewBlobStore(*recordingsPath)
+	blobs.SetKeyring(keys)
+	compact := func(rec *recorder.Recording) error {
+		// Start from the plain form so fragments hash the same as new ones
+		if err := blobs.HydrateText(rec); err != nil {
+			return err
+		}
+		if *dedupeThreshold >= 0 {
+			if err := blobs.Dedupe(rec, *dedupeThreshold); err != nil {
+				return err
+			}
+		}
+		if *inlineThreshold >= 0 {
+			if err := blobs.Externalize(rec, *inlineThreshold); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var before, after int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			before += info.Size()
+		}
+		if err := recorder.RewriteFile(file, keys, compact); err != nil {
+			return fmt.Errorf("failed to compact %s: %w", filepath.Base(file), err)
+		}
+		if err := recorder.RebuildAudit(file, signer, "compact"); err != nil {
+			return fmt.Errorf("failed to rebuild audit log of %s: %w", filepath.Base(file), err)
+		}
+		if info, err := os.Stat(file); err == nil {
+			after += info.Size()
+		}
+		fmt.Printf("✓ Compacted %s\n", filepath.Base(file))
+	}
+
+	// Offsets have changed, so the index must be rebuilt
+	idx := recorder.NewIndex(*recordingsPath)
+	if err := idx.Rebuild(); err != nil {
+		return fmt.Errorf("failed to rebuild index: %w", err)
+	}
+	if err := idx.Save(); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
+	fmt.Printf("✓ Compacted %d files: %d → %d bytes\n", len(files), before, after)
+	slog.Info("Recordings compacted", "files", len(files), "before", before, "after", after)
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package commands
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/grouping"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Delete handles the "mirra delete" command. It removes the recordings that
+// match every given filter, rewriting their files and updating the index,
+// session groups and audit logs, and removes blobs only they used. It
+// refuses to run while a server is using the recordings directory; running
+// servers delete through DELETE /api/recordings/{id}.
+func Delete(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	ids := fs.String("id", "", "Comma-separated recording IDs or ID prefixes")
+	from := fs.String("from", "", "Start date (YYYY-MM-DD)")
+	to := fs.String("to", "", "End date (YYYY-MM-DD)")
+	provider := fs.String("provider", "", "Filter by provider (claude|openai|gemini)")
+	session := fs.String("session", "", "Filter by session or trace ID of a session group")
+	project := fs.String("project", "", "Filter by X-Mirra-Project")
+	user := fs.String("user", "", "Filter by X-Mirra-User")
+	tags := fs.String("tags", "", "Filter by comma-separated X-Mirra-Tags (all must match)")
+	status := fs.String("status", "", "Filter by response status: a code, a class like 4xx or a range like 500-504")
+	dryRun := fs.Bool("dry-run", false, "Show what would be deleted without deleting it")
+	skipSealed := fs.Bool("skip-sealed", false, "Leave out encrypted recordings that cannot be decrypted instead of refusing to run")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := &recorder.Filter{
+		Provider: *provider,
+		Project:  *project,
+		User:     *user,
+		Tags:     recorder.ParseTags(*tags),
+	}
+	if *from != "" {
+		fromDate, err := time.Parse("2006-01-02", *from)
+		if err != nil {
+			return fmt.Errorf("invalid from date: %w", err)
+		}
+		filter.From = fromDate
+	}
+	if *to != "" {
+		toDate, err := time.Parse("2006-01-02", *to)
+		if err != nil {
+			return fmt.Errorf("invalid to date: %w", err)
+		}
+		filter.To = toDate.Add(24 * time.Hour) // Include the entire day
+	}
+	var lo, hi int
+	if *status != "" {
+		var err error
+		if lo, hi, err = config.ParseStatusRange(*status); err != nil {
+			return err
+		}
+	}
+	var prefixes []string
+	for _, id := range strings.Split(*ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			prefixes = append(prefixes, id)
+		}
+	}
+
+	if len(prefixes) == 0 && *session == "" && *status == "" && *from == "" && *to == "" &&
+		*provider == "" && *project == "" && *user == "" && len(filter.Tags) == 0 {
+		return fmt.Errorf("no filter given; use 'mirra clear' to delete all recordings")
+	}
+
+	match := func(rec *recorder.Recording) bool {
+		if len(prefixes) > 0 && !hasIDPrefix(rec.ID, prefixes) {
+			return false
+		}
+		if *session != "" && !grouping.InGroup(rec, *session) {
+			return false
+		}
+		if *status != "" && (rec.Response.Status < lo || rec.Response.Status > hi) {
+			return false
+		}
+		return filter.Match(rec)
+	}
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+	// Session groups are found from headers and bodies, and client metadata
+	// is sealed too, so these filters need the key of every recording
+	if *session != "" || *project != "" || *user != "" || len(filter.Tags) > 0 {
+		if err := checkSealed(*recordingsPath, keys, *skipSealed); err != nil {
+			return err
+		}
+	}
+
+	result, err := deleteRecordings(*recordingsPath, keys, match, *dryRun, "delete")
+	if err != nil {
+		var locked *recorder.LockedError
+		if errors.As(err, &locked) && locked.Owner != nil && locked.Owner.Addr != "" {
+			return fmt.Errorf("recordings are in use by the server at %s; stop it or use DELETE %s/api/recordings/{id} with the admin token", locked.Owner.Addr, locked.Owner.Addr)
+		}
+		return err
+	}
+
+	printDeleteResult(result)
+	return nil
+}
+
+// deleteRecordings deletes the recordings match selects from dir, or only
+// reports them for a dry run, holding the lock and updating the audit logs,
+// index and session groups as it goes
+func deleteRecordings(dir string, keys *recorder.Keyring, match func(*recorder.Recording) bool, dryRun bool, command string) (*recorder.DeleteResult, error) {
+	if dryRun {
+		lock, err := recorder.LockShared(dir)
+		if err != nil {
+			return nil, err
+		}
+		defer lock.Unlock()
+
+		return recorder.Delete(dir, keys, match, true)
+	}
+
+	lock, err := recorder.LockExclusive(dir, command)
+	if err != nil {
+		return nil, fmt.Errorf("cannot delete recordings: %w", err)
+	}
+	defer lock.Unlock()
+
+	signer, err := recorder.AuditSignerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := recorder.Delete(dir, keys, match, false)
+	if result != nil && len(result.Files) > 0 {
+		for _, name := range result.Files {
+			if err := recorder.RebuildAudit(filepath.Join(dir, name), signer, command); err != nil {
+				return nil, fmt.Errorf("failed to rebuild audit log of %s: %w", name, err)
+			}
+		}
+		if err := updateIndexes(dir, keys, result.Files, result.IDs); err != nil {
+			return nil, err
+		}
+	}
+	return result, err
+}
+
+// checkSealed refuses to match on headers and bodies while some encrypted
+// recordings cannot be decrypted, since they would silently never match.
+// With skip it warns how many are left out instead.
+func checkSealed(dir string, keys *recorder.Keyring, skip bool) error {
+	n, err := recorder.SealedWithoutKey(dir, keys)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	if !skip {
+		return fmt.Errorf("%d encrypted recordings cannot be decrypted and would not be matched; set %s or %s, or pass --skip-sealed to leave them out",
+			n, recorder.KeysEnv, recorder.KeyFileEnv)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: leaving out %d encrypted recordings that cannot be decrypted\n", n)
+	return nil
+}
+
+// hasIDPrefix reports whether id starts with any of the prefixes
+func hasIDPrefix(id string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func printDeleteResult(result *recorder.DeleteResult) {
+	if len(result.IDs) == 0 {
+		fmt.Println("No recordings match")
+		return
+	}
+
+	if result.DryRun {
+		for _, id := range result.IDs {
+			fmt.Printf("  %s\n", id)
+		}
+		fmt.Printf("Would delete %d recordings from %d files, %s\n", len(result.IDs), len(result.Files), formatSize(result.Bytes))
+	} else {
+		fmt.Printf("✓ Deleted %d recordings from %d files, %s\n", len(result.IDs), len(result.Files), formatSize(result.Bytes))
+		fmt.Printf("  Blobs removed: %d\n", result.Blobs)
+	}
+	if result.Undecrypted > 0 {
+		fmt.Printf("  %d encrypted recordings were matched on their plaintext metadata only; set %s or %s to match on headers and bodies\n",
+			result.Undecrypted, recorder.KeysEnv, recorder.KeyFileEnv)
+	}
+}
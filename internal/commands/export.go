@@ -7,10 +7,10 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
+	"github.com/jpoz/mirra/internal/anonymize"
+	"github.com/jpoz/mirra/internal/config"
 	"github.com/jpoz/mirra/internal/recorder"
 )
 
@@ -19,15 +19,52 @@ func Export(args []string) error {
 	from := fs.String("from", "", "Start date (YYYY-MM-DD)")
 	to := fs.String("to", "", "End date (YYYY-MM-DD)")
 	provider := fs.String("provider", "", "Filter by provider (claude|openai)")
+	project := fs.String("project", "", "Filter by X-Mirra-Project")
+	session := fs.String("session", "", "Filter by X-Mirra-Session")
+	user := fs.String("user", "", "Filter by X-Mirra-User")
+	tags := fs.String("tags", "", "Filter by comma-separated X-Mirra-Tags (all must match)")
 	output := fs.String("output", "export.jsonl", "Output file path")
+	blobRefs := fs.Bool("blob-refs", false, "Keep blob store references instead of inlining large payloads")
 	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	anonymized := fs.Bool("anonymize", false, "Replace identifying values with pseudonyms and drop credentials")
+	salt := fs.String("salt", "", "Pseudonym salt for --anonymize (default: anonymize.salt from the config, or random)")
+	configPath := fs.String("config", "", "Path to config file with anonymize rules")
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
+	// Anonymized exports are built from restored payloads; referenced blobs
+	// would still hold the original values
+	var anonymizer *anonymize.Anonymizer
+	if *anonymized {
+		if *blobRefs {
+			return fmt.Errorf("--anonymize cannot be combined with --blob-refs")
+		}
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if *salt != "" {
+			cfg.Anonymize.Salt = *salt
+		}
+		if anonymizer, err = anonymize.New(cfg.Anonymize); err != nil {
+			return err
+		}
+	}
+
+	lock, err := recorder.LockShared(*recordingsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+
 	var fromDate, toDate time.Time
-	var err error
 
 	if *from != "" {
 		fromDate, err = time.Parse("2006-01-02", *from)
@@ -46,9 +83,20 @@ func Export(args []string) error {
 		toDate = time.Now().Add(24 * time.Hour)
 	}
 
+	filter := &recorder.Filter{
+		Provider: *provider,
+		Project:  *project,
+		Session:  *session,
+		User:     *user,
+		Tags:     recorder.ParseTags(*tags),
+		To:       toDate,
+	}
+	if *from != "" {
+		filter.From = fromDate
+	}
+
 	// Find all recording files
-	pattern := filepath.Join(*recordingsPath, "recordings-*.jsonl")
-	files, err := filepath.Glob(pattern)
+	files, err := recorder.RecordingFiles(*recordingsPath)
 	if err != nil {
 		return fmt.Errorf("failed to list recordings: %w", err)
 	}
@@ -69,15 +117,13 @@ func Export(args []string) error {
 	}()
 
 	count := 0
+	blobs := recorder.NewBlobStore(*recordingsPath)
+	blobs.SetKeyring(keys)
 
 	// Process each recording file
 	for _, file := range files {
 		// Extract date from filename
-		base := filepath.Base(file)
-		datePart := strings.TrimPrefix(base, "recordings-")
-		datePart = strings.TrimSuffix(datePart, ".jsonl")
-
-		fileDate, err := time.Parse("2006-01-02", datePart)
+		fileDate, err := time.Parse("2006-01-02", recorder.RecordingFileDate(file))
 		if err != nil {
 			continue
 		}
@@ -91,7 +137,7 @@ func Export(args []string) error {
 		}
 
 		// Read and filter recordings
-		f, err := os.Open(file)
+		f, err := recorder.OpenRecordings(file)
 		if err != nil {
 			continue
 		}
@@ -104,24 +150,50 @@ func Export(args []string) error {
 
 		for scanner.Scan() {
 			var rec recorder.Recording
-			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			if err := recorder.DecodeRecording(scanner.Bytes(), &rec); err != nil {
 				continue
 			}
 
-			// Apply filters
-			if *provider != "" && rec.Provider != *provider {
+			// Exports are written decrypted. Client metadata is sealed, so
+			// recordings are opened before filtering.
+			line := scanner.Bytes()
+			sealed := rec.Sealed != nil
+			openErr := keys.Open(&rec)
+			if !filter.Match(&rec) {
 				continue
 			}
-
-			if *from != "" && rec.Timestamp.Before(fromDate) {
-				continue
+			if openErr != nil {
+				_ = f.Close()
+				return openErr
 			}
-			if rec.Timestamp.After(toDate) {
-				continue
+			upgraded := upgrade(&rec)
+			if (sealed || upgraded) && *blobRefs {
+				if line, err = json.Marshal(rec); err != nil {
+					_ = f.Close()
+					return fmt.Errorf("failed to encode recording: %w", err)
+				}
+			}
+			if !*blobRefs {
+				// Inline payloads from the blob store so the export is self-contained
+				if err := blobs.Hydrate(&rec); err != nil {
+					// Payloads left in the blob store would skip anonymizing
+					if anonymizer != nil {
+						_ = f.Close()
+						return fmt.Errorf("failed to restore payloads of %s for anonymizing: %w", rec.ID, err)
+					}
+					slog.Warn("failed to restore recording payloads", "id", rec.ID, "error", err)
+				}
+				if anonymizer != nil {
+					anonymizer.Recording(&rec)
+				}
+				if line, err = json.Marshal(rec); err != nil {
+					_ = f.Close()
+					return fmt.Errorf("failed to encode recording: %w", err)
+				}
 			}
 
 			// Write to output
-			if _, err := outFile.Write(scanner.Bytes()); err != nil {
+			if _, err := outFile.Write(line); err != nil {
 				_ = f.Close()
 				return fmt.Errorf("failed to write to output: %w", err)
 			}
@@ -0,0 +1,171 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jpoz/mirra/internal/detect"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Findings handles the "mirra findings" command
+func Findings(args []string) error {
+	fs := flag.NewFlagSet("findings", flag.ExitOnError)
+	from := fs.String("from", "", "Start date (YYYY-MM-DD)")
+	to := fs.String("to", "", "End date (YYYY-MM-DD)")
+	provider := fs.String("provider", "", "Filter by provider (claude|openai|gemini)")
+	detector := fs.String("detector", "", "Filter by detector (pii|secret|prompt_injection)")
+	severity := fs.String("severity", "", "Minimum severity (low|medium|high|critical)")
+	limit := fs.Int("limit", 50, "Number of findings to display")
+	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	lock, err := recorder.LockShared(*recordingsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+
+	var fromDate, toDate time.Time
+
+	if *from != "" {
+		fromDate, err = time.Parse("2006-01-02", *from)
+		if err != nil {
+			return fmt.Errorf("invalid from date: %w", err)
+		}
+	}
+
+	if *to != "" {
+		toDate, err = time.Parse("2006-01-02", *to)
+		if err != nil {
+			return fmt.Errorf("invalid to date: %w", err)
+		}
+		toDate = toDate.Add(24 * time.Hour) // Include the entire day
+	}
+
+	if *severity != "" && detect.SeverityRank(*severity) < 0 {
+		return fmt.Errorf("invalid severity: %s", *severity)
+	}
+
+	// Find all recording files
+	files, err := recorder.RecordingFiles(*recordingsPath)
+	if err != nil {
+		return fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("no recordings found in %s", *recordingsPath)
+	}
+
+	type row struct {
+		rec     recorder.Recording
+		finding recorder.Finding
+	}
+	var rows []row
+	counts := make(map[string]int)
+	undecrypted := 0
+
+	for _, file := range files {
+		f, err := recorder.OpenRecordings(file)
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(f)
+		// Increase buffer size to handle large recordings (default is 64KB)
+		const maxScanTokenSize = 10 * 1024 * 1024 // 10MB
+		buf := make([]byte, maxScanTokenSize)
+		scanner.Buffer(buf, maxScanTokenSize)
+
+		for scanner.Scan() {
+			var rec recorder.Recording
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				continue
+			}
+			if err := keys.Open(&rec); err != nil {
+				undecrypted++
+				continue
+			}
+			upgrade(&rec)
+			if len(rec.Findings) == 0 {
+				continue
+			}
+
+			// Apply filters
+			if *provider != "" && rec.Provider != *provider {
+				continue
+			}
+			if *from != "" && rec.Timestamp.Before(fromDate) {
+				continue
+			}
+			if *to != "" && rec.Timestamp.After(toDate) {
+				continue
+			}
+
+			for _, finding := range rec.Findings {
+				if *detector != "" && finding.Detector != *detector {
+					continue
+				}
+				if *severity != "" && detect.SeverityRank(finding.Severity) < detect.SeverityRank(*severity) {
+					continue
+				}
+				counts[finding.Severity]++
+				rows = append(rows, row{rec: rec, finding: finding})
+			}
+		}
+
+		_ = f.Close()
+	}
+
+	warnUndecrypted(undecrypted)
+	if len(rows) == 0 {
+		fmt.Println("No findings.")
+		return nil
+	}
+
+	// Most severe first, then newest
+	sort.SliceStable(rows, func(i, j int) bool {
+		ri, rj := detect.SeverityRank(rows[i].finding.Severity), detect.SeverityRank(rows[j].finding.Severity)
+		if ri != rj {
+			return ri > rj
+		}
+		return rows[i].rec.Timestamp.After(rows[j].rec.Timestamp)
+	})
+
+	fmt.Printf("Found %d findings", len(rows))
+	for _, level := range []string{"critical", "high", "medium", "low"} {
+		if counts[level] > 0 {
+			fmt.Printf(" | %s: %d", level, counts[level])
+		}
+	}
+	fmt.Print("\n\n")
+
+	for i, r := range rows {
+		if i >= *limit {
+			fmt.Printf("Showing %d of %d findings. Use --limit to see more.\n", *limit, len(rows))
+			break
+		}
+		fmt.Printf("[%s] %s/%s %s\n", strings.ToUpper(r.finding.Severity), r.finding.Detector, r.finding.Type, r.finding.Match)
+		fmt.Printf("   Recording: %s (%s %s)\n", r.rec.ID, r.rec.Provider, r.rec.Timestamp.Format("2006-01-02 15:04:05"))
+		fmt.Printf("   Location:  %s\n", r.finding.Location)
+		if r.finding.Action != "" {
+			fmt.Printf("   Action:    %s\n", r.finding.Action)
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/jpoz/mirra/internal/grouping"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Fsck handles the "mirra fsck" command. It checks recordings files for torn,
+// corrupt, oversized and duplicate lines, and the index and session groups
+// for entries that do not match the files. With --repair it quarantines bad
+// lines and rebuilds the indexes. It refuses to run while a server is using
+// the recordings directory, since lines being written look torn.
+func Fsck(args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	repair := fs.Bool("repair", false, "Quarantine bad lines and rebuild the index and session groups")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	lock, err := recorder.LockExclusive(*recordingsPath, "fsck")
+	if err != nil {
+		return fmt.Errorf("cannot check recordings: %w", err)
+	}
+	defer lock.Unlock()
+
+	report, err := recorder.Fsck(*recordingsPath)
+	if err != nil {
+		return err
+	}
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+
+	// Session groups must only reference recordings that exist
+	var sessions *grouping.SessionGroupIndex
+	if _, err := os.Stat(filepath.Join(*recordingsPath, "groups", grouping.SessionIndexFilename)); err == nil {
+		sessions = grouping.NewSessionGroupIndex(*recordingsPath)
+		sessions.SetKeyring(keys)
+		if err := sessions.Load(); err != nil {
+			return err
+		}
+		var orphans []recorder.FsckProblem
+		for id, key := range sessions.RecordingIDs() {
+			if !report.IDs[id] {
+				orphans = append(orphans, recorder.FsckProblem{Kind: "group", ID: id, Detail: fmt.Sprintf("session group %s references a recording that does not exist", key)})
+			}
+		}
+		sort.Slice(orphans, func(i, j int) bool { return orphans[i].ID < orphans[j].ID })
+		report.Problems = append(report.Problems, orphans...)
+	}
+
+	for _, p := range report.Problems {
+		location := p.File
+		if p.Line > 0 {
+			location = fmt.Sprintf("%s:%d", p.File, p.Line)
+		}
+		if p.ID != "" {
+			if location != "" {
+				location += " "
+			}
+			location += "(" + p.ID + ")"
+		}
+		if location == "" {
+			location = "index"
+		}
+		fmt.Printf("✗ %s: %s: %s\n", location, p.Kind, p.Detail)
+	}
+	fmt.Printf("\nChecked %d recordings in %d files, %d problems\n", report.Recordings, report.Files, len(report.Problems))
+
+	if report.OK() {
+		fmt.Println("✓ Recordings, index and session groups are consistent")
+		return nil
+	}
+	if !*repair {
+		return fmt.Errorf("%d problems found, run with --repair to fix them", len(report.Problems))
+	}
+
+	signer, err := recorder.AuditSignerFromEnv()
+	if err != nil {
+		return err
+	}
+
+	repaired, err := recorder.Repair(*recordingsPath, report)
+	if err != nil {
+		return err
+	}
+	for _, name := range repaired {
+		if err := recorder.RebuildAudit(filepath.Join(*recordingsPath, name), signer, "fsck"); err != nil {
+			return fmt.Errorf("failed to rebuild audit log of %s: %w", name, err)
+		}
+		fmt.Printf("✓ Repaired %s\n", name)
+	}
+
+	idx := recorder.NewIndex(*recordingsPath)
+	if err := idx.Rebuild(); err != nil {
+		return fmt.Errorf("failed to rebuild index: %w", err)
+	}
+	fmt.Println("✓ Rebuilt index")
+
+	if sessions != nil {
+		if err := sessions.Rebuild(keys); err != nil {
+			return fmt.Errorf("failed to rebuild session groups: %w", err)
+		}
+		if err := sessions.Save(); err != nil {
+			return fmt.Errorf("failed to save session groups: %w", err)
+		}
+		fmt.Println("✓ Rebuilt session groups")
+	}
+
+	if len(repaired) > 0 {
+		fmt.Printf("  Bad lines moved to %s\n", filepath.Join(*recordingsPath, recorder.QuarantineDir))
+	}
+	slog.Info("Recordings repaired", "problems", len(report.Problems), "files", len(repaired))
+	return nil
+}
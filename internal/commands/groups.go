@@ -3,9 +3,11 @@ package commands
 import (
 	"flag"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jpoz/mirra/internal/grouping"
+	"github.com/jpoz/mirra/internal/recorder"
 )
 
 // Groups handles the "mirra groups" command
@@ -34,19 +36,32 @@ func ListSessions(args []string) error {
 	fromDate := fs.String("from", "", "Filter from date (YYYY-MM-DD)")
 	toDate := fs.String("to", "", "Filter to date (YYYY-MM-DD)")
 	showErrors := fs.Bool("errors", false, "Show only groups with errors")
+	project := fs.String("project", "", "Filter by X-Mirra-Project")
+	tag := fs.String("tag", "", "Filter by X-Mirra-Tags tag")
 
 	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
 
-	// Initialize grouping manager
-	manager := grouping.NewManager(*recordingsPath, true)
+	lock, err := recorder.LockShared(*recordingsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+	manager := grouping.NewManager(*recordingsPath, true, keys)
 
 	// Parse date filters
 	opts := &grouping.ListGroupsOptions{
 		Page:     1,
 		Limit:    *limit,
 		Provider: *provider,
+		Project:  *project,
+		Tag:      *tag,
 	}
 
 	if *fromDate != "" {
@@ -93,6 +108,12 @@ func ListSessions(args []string) error {
 		}
 		fmt.Printf("   Recordings: %d\n", group.RequestCount)
 		fmt.Printf("   Providers: %v\n", group.Providers)
+		if group.Project != "" {
+			fmt.Printf("   Project: %s\n", group.Project)
+		}
+		if len(group.Tags) > 0 {
+			fmt.Printf("   Tags: %s\n", strings.Join(group.Tags, ", "))
+		}
 		fmt.Printf("   First: %s\n", group.FirstTimestamp.Format("2006-01-02 15:04:05"))
 		fmt.Printf("   Last:  %s\n", group.LastTimestamp.Format("2006-01-02 15:04:05"))
 		if group.HasErrors {
@@ -121,10 +142,19 @@ func GetSession(args []string) error {
 		return fmt.Errorf("failed to parse flags: %w", err)
 	}
 
+	lock, err := recorder.LockShared(*recordingsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
 	traceID := args[0]
 
-	// Initialize grouping manager
-	manager := grouping.NewManager(*recordingsPath, true)
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+	manager := grouping.NewManager(*recordingsPath, true, keys)
 
 	// Get session group
 	group, err := manager.GetSessionGroup(traceID)
@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jpoz/mirra/internal/keys"
+)
+
+// Keys handles the "mirra keys" command
+func Keys(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("subcommand required: create, list, revoke")
+	}
+
+	subcommand := args[0]
+	subArgs := args[1:]
+
+	switch subcommand {
+	case "create":
+		return CreateKey(subArgs)
+	case "list":
+		return ListKeys(subArgs)
+	case "revoke":
+		return RevokeKey(subArgs)
+	default:
+		return fmt.Errorf("unknown subcommand: %s", subcommand)
+	}
+}
+
+// CreateKey handles the "mirra keys create" command
+func CreateKey(args []string) error {
+	fs := flag.NewFlagSet("keys create", flag.ExitOnError)
+	owner := fs.String("owner", "", "Owner of the key (person or team)")
+	project := fs.String("project", "", "Project the key is used for")
+	providers := fs.String("providers", "", "Comma-separated providers the key may use (default: all)")
+	models := fs.String("models", "", "Comma-separated model globs the key may use, e.g. 'claude-*' (default: all)")
+	expires := fs.String("expires", "", "Expiry as a duration (720h) or date (YYYY-MM-DD)")
+	keysPath := fs.String("keys", "./mirra-keys.json", "Path to the key store")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	opts := keys.CreateOptions{
+		Owner:     *owner,
+		Project:   *project,
+		Providers: splitList(*providers),
+		Models:    splitList(*models),
+	}
+
+	if *expires != "" {
+		expiresAt, err := parseExpiry(*expires)
+		if err != nil {
+			return err
+		}
+		opts.ExpiresAt = &expiresAt
+	}
+
+	secret, key, err := keys.NewStore(*keysPath).Create(opts)
+	if err != nil {
+		return fmt.Errorf("failed to create key: %w", err)
+	}
+
+	fmt.Printf("Created key %s\n\n", key.ID)
+	fmt.Printf("  %s\n\n", secret)
+	fmt.Println("Store it now, it cannot be shown again.")
+	return nil
+}
+
+// ListKeys handles the "mirra keys list" command
+func ListKeys(args []string) error {
+	fs := flag.NewFlagSet("keys list", flag.ExitOnError)
+	keysPath := fs.String("keys", "./mirra-keys.json", "Path to the key store")
+	showAll := fs.Bool("all", false, "Include revoked and expired keys")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	list, err := keys.NewStore(*keysPath).List()
+	if err != nil {
+		return fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	now := time.Now()
+	shown := 0
+	for _, k := range list {
+		status := k.Status(now)
+		if status != "active" && !*showAll {
+			continue
+		}
+		shown++
+
+		fmt.Printf("%s  %s  [%s]\n", k.ID, k.Hint, status)
+		if k.Owner != "" || k.Project != "" {
+			fmt.Printf("   Owner: %s  Project: %s\n", orDash(k.Owner), orDash(k.Project))
+		}
+		if len(k.Providers) > 0 {
+			fmt.Printf("   Providers: %s\n", strings.Join(k.Providers, ", "))
+		}
+		if len(k.Models) > 0 {
+			fmt.Printf("   Models: %s\n", strings.Join(k.Models, ", "))
+		}
+		fmt.Printf("   Created: %s", k.CreatedAt.Format("2006-01-02 15:04"))
+		if k.ExpiresAt != nil {
+			fmt.Printf("  Expires: %s", k.ExpiresAt.Format("2006-01-02 15:04"))
+		}
+		fmt.Println()
+	}
+
+	if shown == 0 {
+		fmt.Println("No keys found.")
+	}
+	return nil
+}
+
+// RevokeKey handles the "mirra keys revoke" command
+func RevokeKey(args []string) error {
+	fs := flag.NewFlagSet("keys revoke", flag.ExitOnError)
+	keysPath := fs.String("keys", "./mirra-keys.json", "Path to the key store")
+
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags: %w", err)
+	}
+
+	if fs.NArg() < 1 {
+		return fmt.Errorf("key ID required")
+	}
+	id := fs.Arg(0)
+
+	if err := keys.NewStore(*keysPath).Revoke(id); err != nil {
+		return fmt.Errorf("failed to revoke %s: %w", id, err)
+	}
+
+	fmt.Printf("Revoked key %s\n", id)
+	return nil
+}
+
+// parseExpiry accepts a duration from now or a date
+func parseExpiry(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().UTC().Add(d), nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry: %s", s)
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Migrate handles the "mirra migrate" command. It rewrites recordings made by
+// older versions in the current schema, applying the same upgrades readers
+// apply in memory. Files with nothing to upgrade are left alone. It refuses
+// to run while a server is using the recordings directory.
+func Migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	lock, err := recorder.LockExclusive(*recordingsPath, "migrate")
+	if err != nil {
+		return fmt.Errorf("cannot migrate recordings: %w", err)
+	}
+	defer lock.Unlock()
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+	signer, err := recorder.AuditSignerFromEnv()
+	if err != nil {
+		return err
+	}
+
+	files, err := recorder.RecordingFiles(*recordingsPath)
+	if err != nil {
+		return fmt.Errorf("failed to list recording files: %w", err)
+	}
+	if len(files) == 0 {
+		fmt.Printf("No recordings found in %s\n", *recordingsPath)
+		return nil
+	}
+
+	var upgraded, failed, rewritten int
+	for _, file := range files {
+		pending, err := recorder.OutdatedRecordings(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+		}
+		if pending == 0 {
+			continue
+		}
+
+		err = recorder.RewriteFile(file, keys, func(rec *recorder.Recording) error {
+			changed, err := recorder.Upgrade(rec)
+			if err != nil {
+				// Keep what was upgraded; readers retry the rest
+				slog.Warn("Failed to upgrade recording", "id", rec.ID, "error", err)
+				failed++
+				return nil
+			}
+			if changed {
+				upgraded++
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", filepath.Base(file), err)
+		}
+		if err := recorder.RebuildAudit(file, signer, "migrate"); err != nil {
+			return fmt.Errorf("failed to rebuild audit log of %s: %w", filepath.Base(file), err)
+		}
+		rewritten++
+	}
+
+	if rewritten == 0 {
+		fmt.Printf("✓ All recordings are at schema version %d\n", recorder.SchemaVersion)
+		return nil
+	}
+
+	// Offsets have changed, so the index must be rebuilt
+	idx := recorder.NewIndex(*recordingsPath)
+	if err := idx.Rebuild(); err != nil {
+		return fmt.Errorf("failed to rebuild index: %w", err)
+	}
+	if err := idx.Save(); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
+	fmt.Printf("✓ Migrated %d files to schema version %d\n", rewritten, recorder.SchemaVersion)
+	fmt.Printf("  Upgraded recordings: %d\n", upgraded)
+	if failed > 0 {
+		fmt.Printf("  Left partly upgraded (see warnings): %d\n", failed)
+	}
+	slog.Info("Recordings migrated", "files", rewritten, "upgraded", upgraded, "failed", failed, "schema_version", recorder.SchemaVersion)
+
+	return nil
+}
+
+// upgrade brings a recording read from disk to the current schema, warning
+// when an older one cannot be upgraded, and reports whether it changed
+func upgrade(rec *recorder.Recording) bool {
+	changed, err := recorder.Upgrade(rec)
+	if err != nil {
+		slog.Warn("Failed to upgrade recording", "id", rec.ID, "error", err)
+	}
+	return changed
+}
@@ -0,0 +1,227 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/grouping"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Prune handles the "mirra prune" command. It applies the retention policy
+// from the config file, optionally overridden by flags. When a server holds
+// the recordings directory it is asked to prune with its own policy.
+func Prune(args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to config file")
+	recordingsPath := fs.String("recordings", "", "Path to recordings directory (default: from config)")
+	maxAgeDays := fs.Int("max-age-days", -1, "Remove recordings older than this many days")
+	maxSizeMB := fs.Int("max-size-mb", -1, "Remove the oldest day files until recordings fit in this many MB")
+	archivePath := fs.String("archive", "", "Move expired recordings to this directory instead of deleting them")
+	dryRun := fs.Bool("dry-run", false, "Show what would be removed without removing it")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if *recordingsPath != "" {
+		cfg.Recording.Path = *recordingsPath
+	}
+
+	retention := &cfg.Recording.Retention
+	overridden := false
+	if *maxAgeDays >= 0 {
+		retention.MaxAgeDays = *maxAgeDays
+		overridden = true
+	}
+	if *maxSizeMB >= 0 {
+		retention.MaxTotalSizeMB = *maxSizeMB
+		overridden = true
+	}
+	if *archivePath != "" {
+		retention.ArchivePath = *archivePath
+		overridden = true
+	}
+
+	policy := retention.Policy()
+	if !policy.Enabled() {
+		fmt.Println("No retention policy configured: set recording.retention in the config or pass --max-age-days or --max-size-mb")
+		return nil
+	}
+
+	keys, err := cfg.Recording.Keyring()
+	if err != nil {
+		return err
+	}
+
+	dir := cfg.Recording.Path
+	if *dryRun {
+		lock, err := recorder.LockShared(dir)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+
+		result, err := recorder.Prune(dir, keys, policy, time.Now(), true)
+		if err != nil {
+			return err
+		}
+		printPruneResult(result)
+		return nil
+	}
+
+	lock, err := recorder.LockExclusive(dir, "prune")
+	if err != nil {
+		var locked *recorder.LockedError
+		if errors.As(err, &locked) && locked.Owner != nil && locked.Owner.Addr != "" {
+			if overridden {
+				return fmt.Errorf("the server at %s prunes with its own policy; change its config or stop it to use flags", locked.Owner.Addr)
+			}
+			return pruneServer(locked.Owner.Addr, dir, cfg.AdminToken)
+		}
+		return fmt.Errorf("cannot prune recordings: %w", err)
+	}
+	defer lock.Unlock()
+
+	signer, err := cfg.Recording.AuditSigner()
+	if err != nil {
+		return err
+	}
+	result, err := recorder.Prune(dir, keys, policy, time.Now(), false)
+	if result != nil && len(result.Files) > 0 {
+		if err := updateIndexes(dir, keys, result.FileNames(), result.IDs); err != nil {
+			return err
+		}
+		if err := recorder.RebuildPrunedAudit(dir, result, signer); err != nil {
+			return fmt.Errorf("failed to rebuild audit logs: %w", err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	printPruneResult(result)
+	return nil
+}
+
+// updateIndexes brings the recording and grouping indexes in line with
+// files that had recordings removed
+func updateIndexes(dir string, keys *recorder.Keyring, files, ids []string) error {
+	idx := recorder.NewIndex(dir)
+	if err := idx.Load(); err != nil {
+		if err := idx.Rebuild(); err != nil {
+			return fmt.Errorf("failed to rebuild index: %w", err)
+		}
+	} else if err := idx.ReindexFiles(files); err != nil {
+		return fmt.Errorf("failed to update index: %w", err)
+	}
+	if err := idx.Close(); err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "groups")); err == nil {
+		manager := grouping.NewManager(dir, true, keys)
+		if err := manager.OnRecordingsRemoved(ids); err != nil {
+			return fmt.Errorf("failed to update session groups: %w", err)
+		}
+	}
+	return nil
+}
+
+// pruneServer asks the server holding the recordings directory to apply its
+// retention policy
+func pruneServer(addr, dir, token string) error {
+	fmt.Printf("Recordings are in use by the server at %s, asking it to prune...\n", addr)
+
+	resp, err := postAdmin(addr+"/api/prune", dir, token, 10*time.Minute)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server failed to prune recordings: %s", resp.Status)
+	}
+
+	var result recorder.PruneResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode server response: %w", err)
+	}
+	printPruneResult(&result)
+	return nil
+}
+
+// postAdmin calls an admin endpoint of the server holding a recordings
+// directory, with the configured admin token or else the one the server
+// wrote to the directory
+func postAdmin(url, dir, token string, timeout time.Duration) (*http.Response, error) {
+	if token == "" {
+		var err error
+		if token, err = recorder.ReadAdminToken(dir); err != nil {
+			return nil, fmt.Errorf("no admin token: set %s to the server's admin_token", config.AdminTokenEnv)
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach server: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		return nil, fmt.Errorf("server rejected the admin token: set %s to the server's admin_token", config.AdminTokenEnv)
+	}
+	return resp, nil
+}
+
+func printPruneResult(result *recorder.PruneResult) {
+	if result.Recordings == 0 {
+		fmt.Println("Nothing to prune")
+		return
+	}
+
+	verb := "Removed"
+	if result.DryRun {
+		verb = "Would remove"
+	}
+	for _, f := range result.Files {
+		action := fmt.Sprintf("%d recordings, %d kept", f.Recordings, f.Kept)
+		if f.Deleted {
+			action = fmt.Sprintf("%d recordings, whole file", f.Recordings)
+		}
+		fmt.Printf("  %s  %s (%s, by %s)\n", f.Name, action, formatSize(f.Bytes), f.Reason)
+	}
+	fmt.Printf("%s %d recordings, %s\n", verb, result.Recordings, formatSize(result.Bytes))
+	if result.Blobs > 0 {
+		fmt.Printf("Removed %d blobs only they used\n", result.Blobs)
+	}
+}
+
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
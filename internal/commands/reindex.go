@@ -1,10 +1,16 @@
 package commands
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"os"
+	"time"
 
+	"github.com/jpoz/mirra/internal/config"
 	"github.com/jpoz/mirra/internal/recorder"
 )
 
@@ -18,6 +24,17 @@ func Reindex(args []string) error {
 
 	fmt.Printf("Rebuilding index for recordings in %s...\n", *recordingsPath)
 
+	lock, err := recorder.LockWriter(*recordingsPath, recorder.LockOwner{PID: os.Getpid(), Command: "reindex", Started: time.Now()})
+	if err != nil {
+		// A running server owns the index, so ask it to rebuild instead
+		var locked *recorder.LockedError
+		if errors.As(err, &locked) && locked.Owner != nil && locked.Owner.Addr != "" {
+			return reindexServer(locked.Owner.Addr, *recordingsPath)
+		}
+		return fmt.Errorf("cannot reindex recordings: %w", err)
+	}
+	defer lock.Unlock()
+
 	// Create a new index
 	idx := recorder.NewIndex(*recordingsPath)
 
@@ -39,3 +56,31 @@ func Reindex(args []string) error {
 
 	return nil
 }
+
+// reindexServer asks the server holding the recordings directory to rebuild
+// its index
+func reindexServer(addr, dir string) error {
+	fmt.Printf("Recordings are in use by the server at %s, asking it to rebuild...\n", addr)
+
+	resp, err := postAdmin(addr+"/api/index/rebuild", dir, os.Getenv(config.AdminTokenEnv), 5*time.Minute)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server failed to rebuild index: %s", resp.Status)
+	}
+
+	var result struct {
+		Recordings int `json:"recordings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode server response: %w", err)
+	}
+
+	fmt.Printf("✓ Index rebuilt successfully!\n")
+	fmt.Printf("  Total recordings indexed: %d\n", result.Recordings)
+	slog.Info("Index rebuilt by server", "addr", addr, "recordings", result.Recordings)
+	return nil
+}
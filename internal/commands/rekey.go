@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/jpoz/mirra/internal/grouping"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Rekey handles the "mirra rekey" command. It encrypts every recording,
+// blob and the session group index with the active key from MIRRA_ENCRYPTION_KEYS or
+// MIRRA_ENCRYPTION_KEY_FILE: plain ones are sealed and ones sealed with an
+// older key have their data keys rewrapped, so the older key can then be
+// removed from the keyring. It refuses to run while a server is using the
+// recordings directory.
+func Rekey(args []string) error {
+	fs := flag.NewFlagSet("rekey", flag.ExitOnError)
+	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	generate := fs.Bool("generate-key", false, "Print a new random key and exit")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *generate {
+		key, err := recorder.GenerateKey()
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+		fmt.Println(key)
+		return nil
+	}
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		return fmt.Errorf("no encryption keys: set %s or %s", recorder.KeysEnv, recorder.KeyFileEnv)
+	}
+	signer, err := recorder.AuditSignerFromEnv()
+	if err != nil {
+		return err
+	}
+
+	lock, err := recorder.LockExclusive(*recordingsPath, "rekey")
+	if err != nil {
+		return fmt.Errorf("cannot rekey recordings: %w", err)
+	}
+	defer lock.Unlock()
+
+	files, err := recorder.RecordingFiles(*recordingsPath)
+	if err != nil {
+		return fmt.Errorf("failed to list recording files: %w", err)
+	}
+
+	recordings := 0
+	for _, file := range files {
+		n, err := recorder.RekeyFile(file, keys)
+		if err != nil {
+			return fmt.Errorf("failed to rekey %s: %w", filepath.Base(file), err)
+		}
+		if n > 0 {
+			if err := recorder.RebuildAudit(file, signer, "rekey"); err != nil {
+				return fmt.Errorf("failed to rebuild audit log of %s: %w", filepath.Base(file), err)
+			}
+			fmt.Printf("✓ Rekeyed %d recordings in %s\n", n, filepath.Base(file))
+		}
+		recordings += n
+	}
+
+	blobs := recorder.NewBlobStore(*recordingsPath)
+	blobs.SetKeyring(keys)
+	blobCount, err := blobs.Rekey()
+	if err != nil {
+		return fmt.Errorf("failed to rekey blobs: %w", err)
+	}
+
+	// Offsets have changed, so the index must be rebuilt
+	if recordings > 0 {
+		idx := recorder.NewIndex(*recordingsPath)
+		if err := idx.Rebuild(); err != nil {
+			return fmt.Errorf("failed to rebuild index: %w", err)
+		}
+		if err := idx.Save(); err != nil {
+			return fmt.Errorf("failed to save index: %w", err)
+		}
+	}
+
+	// Session groups are sealed with the active key too
+	if _, err := os.Stat(filepath.Join(*recordingsPath, "groups", grouping.SessionIndexFilename)); err == nil {
+		sessions := grouping.NewSessionGroupIndex(*recordingsPath)
+		sessions.SetKeyring(keys)
+		if err := sessions.Rebuild(keys); err != nil {
+			return fmt.Errorf("failed to rebuild session groups: %w", err)
+		}
+		if err := sessions.Save(); err != nil {
+			return fmt.Errorf("failed to save session groups: %w", err)
+		}
+	}
+
+	fmt.Printf("✓ Recordings encrypted with key %q\n", keys.ActiveID())
+	fmt.Printf("  Recordings rekeyed: %d\n", recordings)
+	fmt.Printf("  Blobs rekeyed: %d\n", blobCount)
+	slog.Info("Recordings rekeyed", "key", keys.ActiveID(), "recordings", recordings, "blobs", blobCount)
+
+	return nil
+}
+
+// warnUndecrypted notes recordings that were skipped or only partly read
+// because their key is not available
+func warnUndecrypted(n int) {
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d encrypted recordings could not be decrypted; set %s or %s\n", n, recorder.KeysEnv, recorder.KeyFileEnv)
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -17,14 +15,28 @@ func Stats(args []string) error {
 	fs := flag.NewFlagSet("stats", flag.ExitOnError)
 	from := fs.String("from", "", "Start date (YYYY-MM-DD)")
 	provider := fs.String("provider", "", "Filter by provider (claude|openai)")
+	project := fs.String("project", "", "Filter by X-Mirra-Project")
+	session := fs.String("session", "", "Filter by X-Mirra-Session")
+	user := fs.String("user", "", "Filter by X-Mirra-User")
+	tags := fs.String("tags", "", "Filter by comma-separated X-Mirra-Tags (all must match)")
 	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
+	lock, err := recorder.LockShared(*recordingsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+
 	var fromDate time.Time
-	var err error
 
 	if *from != "" {
 		fromDate, err = time.Parse("2006-01-02", *from)
@@ -33,9 +45,17 @@ func Stats(args []string) error {
 		}
 	}
 
+	filter := &recorder.Filter{
+		Provider: *provider,
+		Project:  *project,
+		Session:  *session,
+		User:     *user,
+		Tags:     recorder.ParseTags(*tags),
+		From:     fromDate,
+	}
+
 	// Find all recording files
-	pattern := filepath.Join(*recordingsPath, "recordings-*.jsonl")
-	files, err := filepath.Glob(pattern)
+	files, err := recorder.RecordingFiles(*recordingsPath)
 	if err != nil {
 		return fmt.Errorf("failed to list recordings: %w", err)
 	}
@@ -47,15 +67,12 @@ func Stats(args []string) error {
 	stats := &Statistics{
 		ByProvider: make(map[string]*ProviderStats),
 	}
+	undecrypted := 0
 
 	// Process each recording file
 	for _, file := range files {
 		// Extract date from filename
-		base := filepath.Base(file)
-		datePart := strings.TrimPrefix(base, "recordings-")
-		datePart = strings.TrimSuffix(datePart, ".jsonl")
-
-		fileDate, err := time.Parse("2006-01-02", datePart)
+		fileDate, err := time.Parse("2006-01-02", recorder.RecordingFileDate(file))
 		if err != nil {
 			continue
 		}
@@ -66,7 +83,7 @@ func Stats(args []string) error {
 		}
 
 		// Read and process recordings
-		f, err := os.Open(file)
+		f, err := recorder.OpenRecordings(file)
 		if err != nil {
 			continue
 		}
@@ -83,13 +100,16 @@ func Stats(args []string) error {
 				continue
 			}
 
-			// Apply filters
-			if *provider != "" && rec.Provider != *provider {
+			// Without the key only the plaintext metadata is counted, and
+			// filters on client metadata do not match
+			opened := keys.Open(&rec) == nil
+			if !filter.Match(&rec) {
 				continue
 			}
-
-			if *from != "" && rec.Timestamp.Before(fromDate) {
-				continue
+			if !opened {
+				undecrypted++
+			} else {
+				upgrade(&rec)
 			}
 
 			stats.addRecording(&rec)
@@ -99,6 +119,7 @@ func Stats(args []string) error {
 	}
 
 	stats.print()
+	warnUndecrypted(undecrypted)
 	return nil
 }
 
@@ -0,0 +1,347 @@
+package commands
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jpoz/mirra/internal/grouping"
+	"github.com/jpoz/mirra/internal/keys"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Subject handles the "mirra subject" command, which answers data subject
+// requests: exporting or erasing everything recorded about one person
+func Subject(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("subcommand required: export, erase, fingerprint")
+	}
+
+	subcommand := args[0]
+	subArgs := args[1:]
+
+	switch subcommand {
+	case "export":
+		return SubjectExport(subArgs)
+	case "erase":
+		return SubjectErase(subArgs)
+	case "fingerprint":
+		return SubjectFingerprint(subArgs)
+	default:
+		return fmt.Errorf("unknown subcommand: %s", subcommand)
+	}
+}
+
+// subjectManifest describes a subject export bundle
+type subjectManifest struct {
+	Subject       grouping.Subject `json:"subject"`
+	ExportedAt    time.Time        `json:"exported_at"`
+	Recordings    int              `json:"recordings"`
+	SessionGroups int              `json:"session_groups"`
+	Undecrypted   int              `json:"undecrypted,omitempty"` // encrypted recordings that could not be checked
+}
+
+// subjectFlags adds the flags that identify a subject to fs
+func subjectFlags(fs *flag.FlagSet) func() (*grouping.Subject, error) {
+	users := fs.String("user", "", "Comma-separated user IDs: X-Mirra-User, Claude metadata.user_id or its user hash or account UUID, or OpenAI user")
+	tags := fs.String("tag", "", "Comma-separated X-Mirra-Tags")
+	fingerprints := fs.String("key", "", "Comma-separated API-key fingerprints (see 'mirra subject fingerprint') or virtual key IDs")
+
+	return func() (*grouping.Subject, error) {
+		subject := &grouping.Subject{
+			UserIDs:      splitList(*users),
+			Tags:         recorder.ParseTags(*tags),
+			Fingerprints: splitList(*fingerprints),
+		}
+		if subject.Empty() {
+			return nil, fmt.Errorf("no subject given; use --user, --tag or --key")
+		}
+		return subject, nil
+	}
+}
+
+// SubjectExport handles the "mirra subject export" command. It writes every
+// recording of a subject, with payloads restored from the blob store, and the
+// session groups they belong to into a zip bundle.
+func SubjectExport(args []string) error {
+	fs := flag.NewFlagSet("subject export", flag.ExitOnError)
+	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	output := fs.String("output", "subject-export.zip", "Output bundle path")
+	skipSealed := fs.Bool("skip-sealed", false, "Leave out encrypted recordings that cannot be decrypted instead of refusing to run")
+	parseSubject := subjectFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	subject, err := parseSubject()
+	if err != nil {
+		return err
+	}
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+	if err := checkSealed(*recordingsPath, keys, *skipSealed); err != nil {
+		return err
+	}
+
+	lock, err := recorder.LockShared(*recordingsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	files, err := recorder.RecordingFiles(*recordingsPath)
+	if err != nil {
+		return fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	var sessions *grouping.SessionGroupIndex
+	if _, err := os.Stat(filepath.Join(*recordingsPath, "groups", grouping.SessionIndexFilename)); err == nil {
+		sessions = grouping.NewSessionGroupIndex(*recordingsPath)
+		sessions.SetKeyring(keys)
+		if err := sessions.Load(); err != nil {
+			return fmt.Errorf("failed to load session groups: %w", err)
+		}
+	}
+
+	outFile, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+	bundle := zip.NewWriter(outFile)
+
+	recordings, err := bundle.Create("recordings.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	blobs := recorder.NewBlobStore(*recordingsPath)
+	blobs.SetKeyring(keys)
+	manifest := subjectManifest{Subject: *subject, ExportedAt: time.Now().UTC()}
+	groups := []*grouping.SessionGroup{}
+	seen := make(map[string]bool)
+
+	for _, file := range files {
+		f, err := recorder.OpenRecordings(file)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", filepath.Base(file), err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), recorder.MaxLineSize)
+		for scanner.Scan() {
+			var rec recorder.Recording
+			if err := recorder.DecodeRecording(scanner.Bytes(), &rec); err != nil {
+				continue
+			}
+			opened := keys.Open(&rec) == nil
+			if !opened {
+				manifest.Undecrypted++
+			}
+			if !subject.Match(&rec) {
+				continue
+			}
+			if opened {
+				upgrade(&rec)
+				if err := blobs.Hydrate(&rec); err != nil {
+					slog.Warn("failed to restore recording payloads", "id", rec.ID, "error", err)
+				}
+			}
+
+			line, err := json.Marshal(rec)
+			if err != nil {
+				_ = f.Close()
+				return fmt.Errorf("failed to encode recording: %w", err)
+			}
+			if _, err := recordings.Write(append(line, '\n')); err != nil {
+				_ = f.Close()
+				return fmt.Errorf("failed to write bundle: %w", err)
+			}
+			manifest.Recordings++
+
+			if sessions != nil {
+				if group, err := sessions.GetGroupByRecordingID(rec.ID); err == nil {
+					key := group.TraceID + "/" + group.SessionID
+					if !seen[key] {
+						seen[key] = true
+						groups = append(groups, group)
+					}
+				}
+			}
+		}
+		err = scanner.Err()
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+		}
+	}
+	manifest.SessionGroups = len(groups)
+
+	for name, v := range map[string]any{"sessions.json": groups, "manifest.json": manifest} {
+		w, err := bundle.Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(v); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	if err := bundle.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	if err := outFile.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	fmt.Printf("✓ Exported %d recordings and %d session groups to %s\n", manifest.Recordings, manifest.SessionGroups, *output)
+	warnUndecrypted(manifest.Undecrypted)
+	return nil
+}
+
+// SubjectErase handles the "mirra subject erase" command. It deletes every
+// recording of a subject, along with blobs only they used, or with
+// --anonymize keeps them with the subject's identifiers removed. It refuses
+// to run while a server is using the recordings directory.
+func SubjectErase(args []string) error {
+	fs := flag.NewFlagSet("subject erase", flag.ExitOnError)
+	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	anonymize := fs.Bool("anonymize", false, "Remove the subject's identifiers instead of deleting the recordings")
+	dryRun := fs.Bool("dry-run", false, "Show what would be erased without erasing it")
+	skipSealed := fs.Bool("skip-sealed", false, "Leave out encrypted recordings that cannot be decrypted instead of refusing to run")
+	parseSubject := subjectFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	subject, err := parseSubject()
+	if err != nil {
+		return err
+	}
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+	if err := checkSealed(*recordingsPath, keys, *skipSealed); err != nil {
+		return err
+	}
+
+	if !*anonymize {
+		result, err := deleteRecordings(*recordingsPath, keys, subject.Match, *dryRun, "subject erase")
+		if err != nil {
+			return err
+		}
+		printDeleteResult(result)
+		return nil
+	}
+
+	result, err := anonymizeSubject(*recordingsPath, keys, subject, *dryRun)
+	if err != nil {
+		return err
+	}
+	if len(result.IDs) == 0 {
+		fmt.Println("No recordings match")
+		return nil
+	}
+	if result.DryRun {
+		for _, id := range result.IDs {
+			fmt.Printf("  %s\n", id)
+		}
+		fmt.Printf("Would anonymize %d recordings in %d files\n", len(result.IDs), len(result.Files))
+		return nil
+	}
+	fmt.Printf("✓ Anonymized %d recordings in %d files\n", len(result.IDs), len(result.Files))
+	fmt.Printf("  Blobs removed: %d\n", result.Blobs)
+	return nil
+}
+
+// anonymizeSubject removes a subject's identifiers from their recordings,
+// then rebuilds the audit logs, index and session groups of what changed
+func anonymizeSubject(dir string, keys *recorder.Keyring, subject *grouping.Subject, dryRun bool) (*recorder.DeleteResult, error) {
+	if dryRun {
+		lock, err := recorder.LockShared(dir)
+		if err != nil {
+			return nil, err
+		}
+		defer lock.Unlock()
+
+		return recorder.Scrub(dir, keys, subject.Match, subject.Anonymize, true)
+	}
+
+	lock, err := recorder.LockExclusive(dir, "subject erase")
+	if err != nil {
+		return nil, fmt.Errorf("cannot anonymize recordings: %w", err)
+	}
+	defer lock.Unlock()
+
+	signer, err := recorder.AuditSignerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := recorder.Scrub(dir, keys, subject.Match, subject.Anonymize, false)
+	if result == nil || len(result.Files) == 0 {
+		return result, err
+	}
+	for _, name := range result.Files {
+		if err := recorder.RebuildAudit(filepath.Join(dir, name), signer, "subject erase"); err != nil {
+			return nil, fmt.Errorf("failed to rebuild audit log of %s: %w", name, err)
+		}
+	}
+	if err := updateIndexes(dir, keys, result.Files, nil); err != nil {
+		return nil, err
+	}
+
+	// Session groups keep the subject's tags, so they are rebuilt
+	if _, statErr := os.Stat(filepath.Join(dir, "groups", grouping.SessionIndexFilename)); statErr == nil {
+		sessions := grouping.NewSessionGroupIndex(dir)
+		sessions.SetKeyring(keys)
+		if err := sessions.Rebuild(keys); err != nil {
+			return nil, fmt.Errorf("failed to rebuild session groups: %w", err)
+		}
+		if err := sessions.Save(); err != nil {
+			return nil, fmt.Errorf("failed to save session groups: %w", err)
+		}
+	}
+	return result, err
+}
+
+// SubjectFingerprint handles the "mirra subject fingerprint" command. It
+// reads an API key from stdin, so it stays out of shell history, and prints
+// the fingerprint to pass to --key.
+func SubjectFingerprint(args []string) error {
+	fs := flag.NewFlagSet("subject fingerprint", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read API key: %w", err)
+		}
+		return fmt.Errorf("no API key on stdin")
+	}
+	secret := strings.TrimSpace(scanner.Text())
+	if secret == "" {
+		return fmt.Errorf("no API key on stdin")
+	}
+	if keys.IsVirtual(secret) {
+		return fmt.Errorf("virtual keys are recorded redacted; pass the key ID from 'mirra keys list' to --key instead")
+	}
+
+	fmt.Println(keys.Fingerprint(secret))
+	return nil
+}
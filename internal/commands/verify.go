@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Verify handles the "mirra verify" command. It checks that every raw body
+// matches its hash and that the parsed body stored next to it is what the
+// raw bytes parse to.
+func Verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
+	from := fs.String("from", "", "Start date (YYYY-MM-DD)")
+	to := fs.String("to", "", "End date (YYYY-MM-DD)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	lock, err := recorder.LockShared(*recordingsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+
+	files, err := recorder.RecordingFiles(*recordingsPath)
+	if err != nil {
+		return fmt.Errorf("failed to list recording files: %w", err)
+	}
+
+	blobs := recorder.NewBlobStore(*recordingsPath)
+	blobs.SetKeyring(keys)
+	var checked, withoutRaw, failed int
+
+	for _, file := range files {
+		date := recorder.RecordingFileDate(file)
+		if (*from != "" && date < *from) || (*to != "" && date > *to) {
+			continue
+		}
+
+		f, err := recorder.OpenRecordings(file)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", filepath.Base(file), err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		// Increase buffer size to handle large recordings (default is 64KB)
+		buf := make([]byte, 0, 64*1024)
+		scanner.Buffer(buf, 10*1024*1024)
+
+		lineNum := 0
+		for scanner.Scan() {
+			lineNum++
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			var rec recorder.Recording
+			if err := recorder.DecodeRecording(scanner.Bytes(), &rec); err != nil {
+				fmt.Printf("✗ %s:%d: %v\n", filepath.Base(file), lineNum, err)
+				failed++
+				continue
+			}
+			if err := keys.Open(&rec); err != nil {
+				fmt.Printf("✗ %s: %v\n", rec.ID, err)
+				failed++
+				continue
+			}
+
+			checked++
+			if rec.Request.Raw == nil && rec.Response.Raw == nil {
+				withoutRaw++
+			}
+			if problems := blobs.Verify(&rec); len(problems) > 0 {
+				failed++
+				for _, problem := range problems {
+					fmt.Printf("✗ %s: %s\n", rec.ID, problem)
+				}
+			}
+		}
+
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+		}
+	}
+
+	fmt.Printf("\nChecked %d recordings\n", checked)
+	if withoutRaw > 0 {
+		fmt.Printf("  Without raw bodies (recorded by an older version): %d\n", withoutRaw)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d recordings failed verification", failed)
+	}
+	fmt.Println("✓ All raw bodies match their hashes and parsed bodies")
+	return nil
+}
@@ -2,13 +2,10 @@ package commands
 
 import (
 	"bufio"
-	"bytes"
-	"compress/gzip"
-	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io"
+	"mime"
 	"os"
 	"path/filepath"
 	"strings"
@@ -22,14 +19,25 @@ func View(args []string) error {
 	fs := flag.NewFlagSet("view", flag.ExitOnError)
 	recordingsPath := fs.String("recordings", "./recordings", "Path to recordings directory")
 	parsed := fs.Bool("parsed", false, "Parse streaming SSE responses and show reconstructed output")
+	saveBlobs := fs.String("save-blobs", "", "Directory to save binary content (uploads, audio, images) to")
 
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
+	lock, err := recorder.LockShared(*recordingsPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	keys, err := recorder.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+
 	// Find all recording files
-	pattern := filepath.Join(*recordingsPath, "recordings-*.jsonl")
-	files, err := filepath.Glob(pattern)
+	files, err := recorder.RecordingFiles(*recordingsPath)
 	if err != nil {
 		return fmt.Errorf("failed to list recordings: %w", err)
 	}
@@ -45,8 +53,11 @@ func View(args []string) error {
 		if err != nil {
 			return err
 		}
+		if err := hydrate(*recordingsPath, keys, lastRecording); err != nil {
+			return err
+		}
 		printRecording(lastRecording, *parsed)
-		return nil
+		return saveRecordingBlobs(lastRecording, *saveBlobs)
 	}
 
 	recordingID := fs.Arg(0)
@@ -54,7 +65,7 @@ func View(args []string) error {
 	// Search for the recording (supports partial UUID matching)
 	var matches []recorder.Recording
 	for _, file := range files {
-		f, err := os.Open(file)
+		f, err := recorder.OpenRecordings(file)
 		if err != nil {
 			continue
 		}
@@ -67,7 +78,7 @@ func View(args []string) error {
 
 		for scanner.Scan() {
 			var rec recorder.Recording
-			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			if err := recorder.DecodeRecording(scanner.Bytes(), &rec); err != nil {
 				continue
 			}
 
@@ -92,15 +103,18 @@ func View(args []string) error {
 		return fmt.Errorf("please provide more characters to uniquely identify the recording")
 	}
 
+	if err := hydrate(*recordingsPath, keys, &matches[0]); err != nil {
+		return err
+	}
 	printRecording(&matches[0], *parsed)
-	return nil
+	return saveRecordingBlobs(&matches[0], *saveBlobs)
 }
 
 func findLastRecording(files []string) (*recorder.Recording, error) {
 	var lastRecording *recorder.Recording
 
 	for _, file := range files {
-		f, err := os.Open(file)
+		f, err := recorder.OpenRecordings(file)
 		if err != nil {
 			continue
 		}
@@ -113,7 +127,7 @@ func findLastRecording(files []string) (*recorder.Recording, error) {
 
 		for scanner.Scan() {
 			var rec recorder.Recording
-			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			if err := recorder.DecodeRecording(scanner.Bytes(), &rec); err != nil {
 				continue
 			}
 
@@ -169,6 +183,21 @@ func printRecording(rec *recorder.Recording, useParsed bool) {
 		}
 	}
 
+	if len(rec.Request.Multipart) > 0 {
+		fmt.Println("Multipart:")
+		for _, part := range rec.Request.Multipart {
+			if part.Blob != nil {
+				fmt.Printf("  %s: %s\n", part.Name, describeBlob(part.Blob, part.Filename))
+			} else {
+				fmt.Printf("  %s: %s\n", part.Name, part.Value)
+			}
+		}
+	}
+
+	if rec.Request.Blob != nil {
+		fmt.Printf("Body: %s\n", describeBlob(rec.Request.Blob, ""))
+	}
+
 	fmt.Println("\n--- Response ---")
 	fmt.Printf("Status: %d\n", rec.Response.Status)
 	fmt.Printf("Streaming: %t\n", rec.Response.Streaming)
@@ -182,18 +211,23 @@ func printRecording(rec *recorder.Recording, useParsed bool) {
 		}
 	}
 
+	if rec.Response.Blob != nil {
+		fmt.Printf("Body: %s\n", describeBlob(rec.Response.Blob, ""))
+	}
+
+	if rec.Response.Encoding != "" {
+		fmt.Printf("Encoding: %s (body shown decoded)\n", rec.Response.Encoding)
+	}
+
 	if rec.Response.Body != nil {
 		fmt.Println("Body:")
 
-		// Check if response is gzipped
-		isGzipped := isGzipEncoded(rec.Response.Headers)
-
-		if rec.Response.Streaming {
+		if bodyStr, ok := rec.Response.Body.(string); ok && strings.HasPrefix(bodyStr, recorder.LegacyEncodedPrefix) {
+			fmt.Println("  [Encoded body from an older version, run 'mirra migrate' to decode it]")
+		} else if rec.Response.Streaming {
 			// Handle streaming SSE format
 			if bodyStr, ok := rec.Response.Body.(string); ok {
-				if isGzipped {
-					printGzippedBody(bodyStr)
-				} else if useParsed {
+				if useParsed {
 					printParsedSSEBody(bodyStr, rec.Provider)
 				} else {
 					printSSEBody(bodyStr)
@@ -203,9 +237,7 @@ func printRecording(rec *recorder.Recording, useParsed bool) {
 			}
 		} else {
 			// Handle regular JSON responses
-			if bodyStr, ok := rec.Response.Body.(string); ok && isGzipped {
-				printGzippedBody(bodyStr)
-			} else if bodyBytes, err := json.MarshalIndent(rec.Response.Body, "  ", "  "); err == nil {
+			if bodyBytes, err := json.MarshalIndent(rec.Response.Body, "  ", "  "); err == nil {
 				fmt.Println(string(bodyBytes))
 			} else {
 				fmt.Printf("%v\n", rec.Response.Body)
@@ -214,6 +246,66 @@ func printRecording(rec *recorder.Recording, useParsed bool) {
 	}
 }
 
+// hydrate decrypts a recording, upgrades it to the current schema and
+// restores payloads that were moved to the blob store
+func hydrate(recordingsPath string, keys *recorder.Keyring, rec *recorder.Recording) error {
+	if err := keys.Open(rec); err != nil {
+		return err
+	}
+	upgrade(rec)
+	blobs := recorder.NewBlobStore(recordingsPath)
+	blobs.SetKeyring(keys)
+	if err := blobs.Hydrate(rec); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	return nil
+}
+
+// describeBlob summarizes binary content in one line
+func describeBlob(blob *recorder.Blob, filename string) string {
+	desc := fmt.Sprintf("[binary %s, %d bytes, sha256 %s]", blob.ContentType, blob.Size, blob.SHA256[:12])
+	if filename != "" {
+		desc = filename + " " + desc
+	}
+	return desc
+}
+
+// saveRecordingBlobs writes each blob in the recording to dir
+func saveRecordingBlobs(rec *recorder.Recording, dir string) error {
+	blobs := rec.Blobs()
+	if dir == "" || len(blobs) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	fmt.Println()
+	for _, b := range blobs {
+		data, err := b.Blob.Bytes()
+		if err != nil {
+			return err
+		}
+
+		name := b.Filename
+		if name == "" {
+			ext := ""
+			if exts, _ := mime.ExtensionsByType(b.Blob.ContentType); len(exts) > 0 {
+				ext = exts[0]
+			}
+			name = strings.NewReplacer("[", "-", "]", "").Replace(b.Ref) + ext
+		}
+		path := filepath.Join(dir, rec.ID+"-"+filepath.Base(name))
+
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("failed to save blob: %w", err)
+		}
+		fmt.Printf("Saved %s to %s\n", b.Ref, path)
+	}
+	return nil
+}
+
 // redactSensitiveQueryParams redacts sensitive query parameters like API keys
 func redactSensitiveQueryParams(query string) string {
 	// Split by & to get individual params
@@ -354,80 +446,3 @@ func printSSEEvent(eventType, data string) {
 		fmt.Printf("    %s\n", line)
 	}
 }
-
-// isGzipEncoded checks if the response headers indicate gzip encoding
-func isGzipEncoded(headers map[string][]string) bool {
-	if encodings, ok := headers["Content-Encoding"]; ok {
-		for _, encoding := range encodings {
-			if strings.Contains(strings.ToLower(encoding), "gzip") {
-				return true
-			}
-		}
-	}
-	return false
-}
-
-// printGzippedBody displays both the gzipped and decompressed content
-func printGzippedBody(gzippedBody string) {
-	var gzipBytes []byte
-
-	// Check if body is base64-encoded (stored with "base64:" prefix)
-	if strings.HasPrefix(gzippedBody, "base64:") {
-		encoded := strings.TrimPrefix(gzippedBody, "base64:")
-		decoded, err := base64.StdEncoding.DecodeString(encoded)
-		if err != nil {
-			fmt.Printf("\n  [Failed to decode base64: %v]\n", err)
-			return
-		}
-		gzipBytes = decoded
-	} else {
-		// Legacy: stored as raw string (may be corrupted)
-		gzipBytes = []byte(gzippedBody)
-	}
-
-	// Show original gzipped content (first 100 bytes for brevity)
-	fmt.Println("\n  [Gzipped Content - showing first 100 bytes]")
-	preview := gzipBytes
-	if len(preview) > 100 {
-		preview = preview[:100]
-	}
-	fmt.Printf("  %q...\n", preview)
-
-	// Attempt to decompress
-	decompressed, err := decompressGzip(gzipBytes)
-	if err != nil {
-		fmt.Printf("\n  [Failed to decompress: %v]\n", err)
-		return
-	}
-
-	fmt.Println("\n  [Decompressed Content]")
-	// Try to parse decompressed content as JSON
-	var jsonData interface{}
-	if err := json.Unmarshal(decompressed, &jsonData); err == nil {
-		if formatted, err := json.MarshalIndent(jsonData, "  ", "  "); err == nil {
-			fmt.Println(string(formatted))
-			return
-		}
-	}
-
-	// If not JSON or parsing failed, print as plain text
-	fmt.Println(string(decompressed))
-}
-
-// decompressGzip decompresses gzip-compressed data
-func decompressGzip(data []byte) ([]byte, error) {
-	reader, err := gzip.NewReader(bytes.NewReader(data))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
-	}
-	defer func() {
-		_ = reader.Close()
-	}()
-
-	decompressed, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read decompressed data: %w", err)
-	}
-
-	return decompressed, nil
-}
@@ -2,22 +2,202 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpoz/mirra/internal/recorder"
 )
 
 type Config struct {
-	Port      int                 `json:"port"`
-	Recording RecordingConfig     `json:"recording"`
-	Logging   LoggingConfig       `json:"logging"`
-	Providers map[string]Provider `json:"providers"`
+	Port       int                 `json:"port"`
+	Recording  RecordingConfig     `json:"recording"`
+	Logging    LoggingConfig       `json:"logging"`
+	Providers  map[string]Provider `json:"providers"`
+	Chaos      ChaosConfig         `json:"chaos"`
+	Guardrails GuardrailConfig     `json:"guardrails"`
+	Detection  DetectionConfig     `json:"detection"`
+	Keys       KeysConfig          `json:"keys"`
+	Anonymize  AnonymizeConfig     `json:"anonymize"`
+
+	// AdminToken authenticates the admin endpoints that delete, prune and
+	// reindex recordings. Without one the server generates a token and
+	// writes it to the recordings directory for local commands.
+	AdminToken string `json:"admin_token"`
 }
 
 type RecordingConfig struct {
-	Enabled bool   `json:"enabled"`
-	Storage string `json:"storage"`
-	Path    string `json:"path"`
-	Format  string `json:"format"`
+	Enabled         bool   `json:"enabled"`
+	Storage         string `json:"storage"`
+	Path            string `json:"path"`
+	Format          string `json:"format"`
+	InlineThreshold int    `json:"inline_threshold"` // bytes; larger payloads go to the blob store, negative disables
+	DedupeThreshold int    `json:"dedupe_threshold"` // bytes; smallest prompt fragment stored once, negative disables
+	QueueSize       int    `json:"queue_size"`       // recordings buffered for the writer
+	QueuePolicy     string `json:"queue_policy"`     // "drop", "block" or "spill" when the queue is full
+	Fsync           string `json:"fsync"`            // "always", "interval" or "never"
+	FsyncIntervalMs int    `json:"fsync_interval_ms"`
+	CompressAfter   int    `json:"compress_after_days"` // day files older than this are zstd compressed, 0 disables
+	Rotation        string `json:"rotation"`            // "daily" or "hourly"
+	MaxFileSizeMB   int    `json:"max_file_size_mb"`    // start a new file once this size is reached, 0 disables
+	Timezone        string `json:"timezone"`            // names files and ID date prefixes, e.g. "UTC" or "Europe/Berlin"
+
+	// EncryptionKeyFile holds the keys recordings are encrypted with; see
+	// recorder.ParseKeyring. Keys can also be given in MIRRA_ENCRYPTION_KEYS.
+	EncryptionKeyFile string `json:"encryption_key_file"`
+
+	// Audit chains the hash of every recording in an audit log per file.
+	// AuditKeyFile holds the Ed25519 key that signs checkpoints of the
+	// chain; setting it enables Audit.
+	Audit        bool   `json:"audit"`
+	AuditKeyFile string `json:"audit_key_file"`
+
+	Retention RetentionConfig `json:"retention"`
+
+	// Rules decide per request whether it is recorded fully, without its
+	// bodies, or not at all. The first matching rule wins and requests no
+	// rule matches are recorded fully. Failed requests are always recorded
+	// fully while RecordErrors is set.
+	Rules        []RecordingRule `json:"rules"`
+	RecordErrors bool            `json:"record_errors"`
+}
+
+// Recording rule actions
+const (
+	RecordFull     = "record"
+	RecordMetadata = "metadata"
+	RecordSkip     = "skip"
+)
+
+// RecordingRule matches requests and decides how they are recorded.
+// Empty matchers match everything.
+type RecordingRule struct {
+	Name       string            `json:"name"`
+	Provider   string            `json:"provider,omitempty"`
+	Method     string            `json:"method,omitempty"`
+	Path       string            `json:"path,omitempty"`        // glob, "*" matches any characters
+	Model      string            `json:"model,omitempty"`       // glob
+	Status     string            `json:"status,omitempty"`      // "200", "4xx" or "500-599"
+	Headers    map[string]string `json:"headers,omitempty"`     // globs
+	SampleRate float64           `json:"sample_rate,omitempty"` // fraction of matches recorded with Action, the rest are skipped; 0 = all
+
+	Action string `json:"action"` // "record", "metadata" or "skip"
+}
+
+// ParseStatusRange parses a status matcher: a code such as "404", a class
+// such as "4xx", or an inclusive range such as "500-599"
+func ParseStatusRange(s string) (lo, hi int, err error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") {
+		class, err := strconv.Atoi(s[:1])
+		if err != nil || class < 1 || class > 5 {
+			return 0, 0, fmt.Errorf("invalid status class %q", s)
+		}
+		return class * 100, class*100 + 99, nil
+	}
+	from, to, isRange := strings.Cut(s, "-")
+	if lo, err = strconv.Atoi(strings.TrimSpace(from)); err != nil {
+		return 0, 0, fmt.Errorf("invalid status %q", s)
+	}
+	hi = lo
+	if isRange {
+		if hi, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || hi < lo {
+			return 0, 0, fmt.Errorf("invalid status range %q", s)
+		}
+	}
+	return lo, hi, nil
+}
+
+// ValidateRules checks the recording rules' actions, status matchers and
+// sample rates
+func (c RecordingConfig) ValidateRules() error {
+	for i, rule := range c.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		switch rule.Action {
+		case RecordFull, RecordMetadata, RecordSkip:
+		default:
+			return fmt.Errorf("recording rule %s: unknown action %q, expected record, metadata or skip", name, rule.Action)
+		}
+		if rule.Status != "" {
+			if _, _, err := ParseStatusRange(rule.Status); err != nil {
+				return fmt.Errorf("recording rule %s: %w", name, err)
+			}
+		}
+		if rule.SampleRate < 0 || rule.SampleRate > 1 {
+			return fmt.Errorf("recording rule %s: sample_rate must be between 0 and 1", name)
+		}
+	}
+	return nil
+}
+
+// RotationPolicy converts the configuration to the recorder's file rotation
+func (c RecordingConfig) RotationPolicy() (recorder.Rotation, error) {
+	period, err := recorder.ParseRotationPeriod(c.Rotation)
+	if err != nil {
+		return recorder.Rotation{}, err
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return recorder.Rotation{}, fmt.Errorf("invalid recording timezone: %w", err)
+	}
+	return recorder.Rotation{
+		Period:   period,
+		MaxSize:  int64(c.MaxFileSizeMB) * 1024 * 1024,
+		Location: loc,
+	}, nil
+}
+
+// Keyring loads the keys recordings are encrypted with, or returns nil if
+// encryption is not configured. Keys given in MIRRA_ENCRYPTION_KEYS take
+// precedence over the key file.
+func (c RecordingConfig) Keyring() (*recorder.Keyring, error) {
+	if c.EncryptionKeyFile == "" || os.Getenv(recorder.KeysEnv) != "" {
+		return recorder.KeyringFromEnv()
+	}
+	return recorder.LoadKeyring(c.EncryptionKeyFile)
+}
+
+// AuditSigner loads the key audit checkpoints are signed with, or returns
+// nil if none is configured
+func (c RecordingConfig) AuditSigner() (*recorder.AuditSigner, error) {
+	if c.AuditKeyFile == "" {
+		return nil, nil
+	}
+	return recorder.LoadAuditSigner(c.AuditKeyFile)
+}
+
+// RetentionConfig configures how long recordings are kept. Zero values keep
+// recordings forever.
+type RetentionConfig struct {
+	MaxAgeDays      int            `json:"max_age_days"`
+	MaxTotalSizeMB  int            `json:"max_total_size_mb"`  // oldest day files are removed first
+	ErrorMaxAgeDays int            `json:"error_max_age_days"` // failed requests are kept this long when it is longer
+	Providers       map[string]int `json:"providers"`          // max age in days per provider
+	ArchivePath     string         `json:"archive_path"`       // move expired recordings here instead of deleting them
+	IntervalMinutes int            `json:"interval_minutes"`   // how often the server prunes
+}
+
+// Policy converts the configuration to the recorder's retention policy
+func (c RetentionConfig) Policy() recorder.RetentionPolicy {
+	const day = 24 * time.Hour
+	policy := recorder.RetentionPolicy{
+		MaxAge:       time.Duration(c.MaxAgeDays) * day,
+		MaxTotalSize: int64(c.MaxTotalSizeMB) * 1024 * 1024,
+		ErrorMaxAge:  time.Duration(c.ErrorMaxAgeDays) * day,
+		ArchiveDir:   c.ArchivePath,
+	}
+	if len(c.Providers) > 0 {
+		policy.ProviderMaxAge = make(map[string]time.Duration, len(c.Providers))
+		for provider, days := range c.Providers {
+			policy.ProviderMaxAge[provider] = time.Duration(days) * day
+		}
+	}
+	return policy
 }
 
 type LoggingConfig struct {
@@ -27,16 +207,108 @@ type LoggingConfig struct {
 
 type Provider struct {
 	UpstreamURL string `json:"upstream_url"`
+	APIKey      string `json:"api_key,omitempty"` // real key substituted for virtual keys
 }
 
+// KeysConfig configures mirra-issued virtual API keys
+type KeysConfig struct {
+	Path     string `json:"path"`     // key store file
+	Required bool   `json:"required"` // reject requests without a virtual key
+}
+
+// GuardrailConfig configures checks applied to requests before forwarding
+type GuardrailConfig struct {
+	PII PIIConfig `json:"pii"`
+}
+
+// PIIConfig configures PII detection in outgoing message text.
+// When enabled without rules, the built-in detectors mask their matches.
+type PIIConfig struct {
+	Enabled bool      `json:"enabled"`
+	Rules   []PIIRule `json:"rules"`
+}
+
+// PIIRule is a single PII detector and the policy applied to its matches
+type PIIRule struct {
+	Name       string   `json:"name"`
+	Detector   string   `json:"detector,omitempty"`   // built-in: "email", "phone", "credit_card", "ssn"
+	Pattern    string   `json:"pattern,omitempty"`    // custom regular expression
+	Dictionary []string `json:"dictionary,omitempty"` // case-insensitive terms
+	Policy     string   `json:"policy"`               // "allow", "mask" or "block"
+	Severity   string   `json:"severity,omitempty"`
+}
+
+// DetectionConfig configures the secret-leak and prompt-injection
+// detectors that run over recorded traffic
+type DetectionConfig struct {
+	Enabled           bool     `json:"enabled"`
+	InjectionPatterns []string `json:"injection_patterns,omitempty"` // extra regular expressions
+}
+
+// AnonymizeConfig configures "mirra export --anonymize". Emails, API keys
+// and the user names in home directory paths are always replaced.
+type AnonymizeConfig struct {
+	Salt  string          `json:"salt,omitempty"`  // keeps pseudonyms stable across exports; random per export when empty
+	Names []string        `json:"names,omitempty"` // people's names, matched as case-insensitive words
+	Rules []AnonymizeRule `json:"rules,omitempty"`
+}
+
+// AnonymizeRule replaces the matches of a built-in PII detector or a pattern
+// with pseudonyms
+type AnonymizeRule struct {
+	Name     string `json:"name"`               // labels pseudonyms, e.g. "account" gives [ACCOUNT_…]
+	Detector string `json:"detector,omitempty"` // built-in: "phone", "credit_card", "ssn"
+	Pattern  string `json:"pattern,omitempty"`  // regular expression
+}
+
+// ChaosConfig configures fault injection for client resilience testing
+type ChaosConfig struct {
+	Enabled bool        `json:"enabled"`
+	Rules   []FaultRule `json:"rules"`
+}
+
+// FaultRule describes a fault to inject into matching requests.
+// Empty matchers match everything; a rule can also be selected explicitly
+// by sending its name in the X-Mirra-Fault request header.
+type FaultRule struct {
+	Name        string            `json:"name"`
+	Provider    string            `json:"provider,omitempty"`
+	Path        string            `json:"path,omitempty"`  // glob, "*" matches any characters
+	Model       string            `json:"model,omitempty"` // glob
+	Headers     map[string]string `json:"headers,omitempty"`
+	Probability float64           `json:"probability,omitempty"` // 0 or 1 = always
+
+	Type        string `json:"type"`                   // "latency", "error", "cut_stream", "stall_stream", "malformed_sse"
+	LatencyMs   int    `json:"latency_ms,omitempty"`   // added before forwarding, for any fault type
+	Status      int    `json:"status,omitempty"`       // for "error": 429, 500, 529, ...
+	AfterEvents int    `json:"after_events,omitempty"` // for stream faults
+	StallMs     int    `json:"stall_ms,omitempty"`     // for "stall_stream", 0 = until the client gives up
+}
+
+// AdminTokenEnv sets the admin token, for the server and for commands that
+// call its admin endpoints
+const AdminTokenEnv = "MIRRA_ADMIN_TOKEN"
+
 func Load(path string) (*Config, error) {
 	cfg := &Config{
 		Port: 4567,
 		Recording: RecordingConfig{
-			Enabled: true,
-			Storage: "file",
-			Path:    "./recordings",
-			Format:  "jsonl",
+			Enabled:         true,
+			Storage:         "file",
+			Path:            "./recordings",
+			Format:          "jsonl",
+			InlineThreshold: 16 * 1024,
+			DedupeThreshold: 1024,
+			QueueSize:       100,
+			QueuePolicy:     "spill",
+			Fsync:           "interval",
+			FsyncIntervalMs: 1000,
+			Rotation:        "daily",
+			Timezone:        "UTC",
+			RecordErrors:    true,
+			Retention: RetentionConfig{
+				IntervalMinutes: 60,
+			},
 		},
 		Logging: LoggingConfig{
 			Format: "pretty",
@@ -47,6 +319,12 @@ func Load(path string) (*Config, error) {
 			"openai": {UpstreamURL: "https://api.openai.com"},
 			"gemini": {UpstreamURL: "https://generativelanguage.googleapis.com"},
 		},
+		Detection: DetectionConfig{
+			Enabled: true,
+		},
+		Keys: KeysConfig{
+			Path: "./mirra-keys.json",
+		},
 	}
 
 	if path != "" {
@@ -75,25 +353,139 @@ func Load(path string) (*Config, error) {
 		cfg.Recording.Path = recordingPath
 	}
 
-	if claudeUpstream := os.Getenv("MIRRA_CLAUDE_UPSTREAM"); claudeUpstream != "" {
-		if cfg.Providers == nil {
-			cfg.Providers = make(map[string]Provider)
+	if threshold := os.Getenv("MIRRA_INLINE_THRESHOLD"); threshold != "" {
+		if n, err := strconv.Atoi(threshold); err == nil {
+			cfg.Recording.InlineThreshold = n
 		}
-		cfg.Providers["claude"] = Provider{UpstreamURL: claudeUpstream}
 	}
 
-	if openaiUpstream := os.Getenv("MIRRA_OPENAI_UPSTREAM"); openaiUpstream != "" {
-		if cfg.Providers == nil {
-			cfg.Providers = make(map[string]Provider)
+	if threshold := os.Getenv("MIRRA_DEDUPE_THRESHOLD"); threshold != "" {
+		if n, err := strconv.Atoi(threshold); err == nil {
+			cfg.Recording.DedupeThreshold = n
 		}
-		cfg.Providers["openai"] = Provider{UpstreamURL: openaiUpstream}
 	}
 
-	if geminiUpstream := os.Getenv("MIRRA_GEMINI_UPSTREAM"); geminiUpstream != "" {
-		if cfg.Providers == nil {
-			cfg.Providers = make(map[string]Provider)
+	if size := os.Getenv("MIRRA_QUEUE_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			cfg.Recording.QueueSize = n
+		}
+	}
+
+	if policy := os.Getenv("MIRRA_QUEUE_POLICY"); policy != "" {
+		cfg.Recording.QueuePolicy = policy
+	}
+
+	if fsync := os.Getenv("MIRRA_FSYNC"); fsync != "" {
+		cfg.Recording.Fsync = fsync
+	}
+
+	if interval := os.Getenv("MIRRA_FSYNC_INTERVAL_MS"); interval != "" {
+		if n, err := strconv.Atoi(interval); err == nil {
+			cfg.Recording.FsyncIntervalMs = n
+		}
+	}
+
+	if rotation := os.Getenv("MIRRA_ROTATION"); rotation != "" {
+		cfg.Recording.Rotation = rotation
+	}
+
+	if size := os.Getenv("MIRRA_MAX_FILE_SIZE_MB"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			cfg.Recording.MaxFileSizeMB = n
+		}
+	}
+
+	if keyFile := os.Getenv(recorder.KeyFileEnv); keyFile != "" {
+		cfg.Recording.EncryptionKeyFile = keyFile
+	}
+
+	if audit := os.Getenv("MIRRA_AUDIT"); audit != "" {
+		cfg.Recording.Audit = audit == "true"
+	}
+
+	if keyFile := os.Getenv(recorder.AuditKeyFileEnv); keyFile != "" {
+		cfg.Recording.AuditKeyFile = keyFile
+	}
+
+	if recordErrors := os.Getenv("MIRRA_RECORD_ERRORS"); recordErrors != "" {
+		cfg.Recording.RecordErrors = recordErrors == "true"
+	}
+
+	if tz := os.Getenv("MIRRA_TIMEZONE"); tz != "" {
+		cfg.Recording.Timezone = tz
+	}
+
+	if days := os.Getenv("MIRRA_COMPRESS_AFTER_DAYS"); days != "" {
+		if n, err := strconv.Atoi(days); err == nil {
+			cfg.Recording.CompressAfter = n
+		}
+	}
+
+	if days := os.Getenv("MIRRA_RETENTION_MAX_AGE_DAYS"); days != "" {
+		if n, err := strconv.Atoi(days); err == nil {
+			cfg.Recording.Retention.MaxAgeDays = n
+		}
+	}
+
+	if size := os.Getenv("MIRRA_RETENTION_MAX_SIZE_MB"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			cfg.Recording.Retention.MaxTotalSizeMB = n
 		}
-		cfg.Providers["gemini"] = Provider{UpstreamURL: geminiUpstream}
+	}
+
+	if archive := os.Getenv("MIRRA_RETENTION_ARCHIVE_PATH"); archive != "" {
+		cfg.Recording.Retention.ArchivePath = archive
+	}
+
+	if claudeUpstream := os.Getenv("MIRRA_CLAUDE_UPSTREAM"); claudeUpstream != "" {
+		updateProvider(cfg, "claude", func(p *Provider) { p.UpstreamURL = claudeUpstream })
+	}
+
+	if claudeKey := os.Getenv("MIRRA_CLAUDE_API_KEY"); claudeKey != "" {
+		updateProvider(cfg, "claude", func(p *Provider) { p.APIKey = claudeKey })
+	}
+
+	if openaiUpstream := os.Getenv("MIRRA_OPENAI_UPSTREAM"); openaiUpstream != "" {
+		updateProvider(cfg, "openai", func(p *Provider) { p.UpstreamURL = openaiUpstream })
+	}
+
+	if openaiKey := os.Getenv("MIRRA_OPENAI_API_KEY"); openaiKey != "" {
+		updateProvider(cfg, "openai", func(p *Provider) { p.APIKey = openaiKey })
+	}
+
+	if geminiUpstream := os.Getenv("MIRRA_GEMINI_UPSTREAM"); geminiUpstream != "" {
+		updateProvider(cfg, "gemini", func(p *Provider) { p.UpstreamURL = geminiUpstream })
+	}
+
+	if geminiKey := os.Getenv("MIRRA_GEMINI_API_KEY"); geminiKey != "" {
+		updateProvider(cfg, "gemini", func(p *Provider) { p.APIKey = geminiKey })
+	}
+
+	if chaos := os.Getenv("MIRRA_CHAOS_ENABLED"); chaos != "" {
+		cfg.Chaos.Enabled = chaos == "true"
+	}
+
+	if pii := os.Getenv("MIRRA_PII_GUARDRAIL"); pii != "" {
+		cfg.Guardrails.PII.Enabled = pii == "true"
+	}
+
+	if detection := os.Getenv("MIRRA_DETECTION_ENABLED"); detection != "" {
+		cfg.Detection.Enabled = detection == "true"
+	}
+
+	if keysPath := os.Getenv("MIRRA_KEYS_PATH"); keysPath != "" {
+		cfg.Keys.Path = keysPath
+	}
+
+	if required := os.Getenv("MIRRA_REQUIRE_VIRTUAL_KEYS"); required != "" {
+		cfg.Keys.Required = required == "true"
+	}
+
+	if token := os.Getenv(AdminTokenEnv); token != "" {
+		cfg.AdminToken = token
+	}
+	if salt := os.Getenv("MIRRA_ANONYMIZE_SALT"); salt != "" {
+		cfg.Anonymize.Salt = salt
 	}
 
 	if logLevel := os.Getenv("LOG_LEVEL"); logLevel != "" {
@@ -106,3 +498,13 @@ func Load(path string) (*Config, error) {
 
 	return cfg, nil
 }
+
+// updateProvider modifies a provider entry, creating it if needed
+func updateProvider(cfg *Config, name string, update func(*Provider)) {
+	if cfg.Providers == nil {
+		cfg.Providers = make(map[string]Provider)
+	}
+	p := cfg.Providers[name]
+	update(&p)
+	cfg.Providers[name] = p
+}
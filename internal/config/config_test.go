@@ -4,7 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/jpoz/mirra/internal/recorder"
 	"github.com/jpoz/mirra/internal/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -19,6 +21,17 @@ func TestLoad_DefaultConfig(t *testing.T) {
 	assert.Equal(t, "file", cfg.Recording.Storage)
 	assert.Equal(t, "./recordings", cfg.Recording.Path)
 	assert.Equal(t, "jsonl", cfg.Recording.Format)
+	assert.Equal(t, 16*1024, cfg.Recording.InlineThreshold)
+	assert.Equal(t, 1024, cfg.Recording.DedupeThreshold)
+	assert.Equal(t, 100, cfg.Recording.QueueSize)
+	assert.Equal(t, "spill", cfg.Recording.QueuePolicy)
+	assert.Equal(t, "interval", cfg.Recording.Fsync)
+	assert.Equal(t, 0, cfg.Recording.CompressAfter)
+	assert.Equal(t, "daily", cfg.Recording.Rotation)
+	assert.Equal(t, "UTC", cfg.Recording.Timezone)
+	assert.Equal(t, 60, cfg.Recording.Retention.IntervalMinutes)
+	assert.False(t, cfg.Recording.Retention.Policy().Enabled())
+	assert.True(t, cfg.Detection.Enabled)
 	assert.Equal(t, "pretty", cfg.Logging.Format)
 	assert.Equal(t, "info", cfg.Logging.Level)
 	assert.Equal(t, "https://api.anthropic.com", cfg.Providers["claude"].UpstreamURL)
@@ -123,6 +136,28 @@ func TestLoad_EnvironmentVariables(t *testing.T) {
 				assert.Equal(t, "/custom/path", cfg.Recording.Path)
 			},
 		},
+		{
+			name: "MIRRA_COMPRESS_AFTER_DAYS",
+			envVars: map[string]string{
+				"MIRRA_COMPRESS_AFTER_DAYS": "7",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, 7, cfg.Recording.CompressAfter)
+			},
+		},
+		{
+			name: "MIRRA_ROTATION",
+			envVars: map[string]string{
+				"MIRRA_ROTATION":         "hourly",
+				"MIRRA_MAX_FILE_SIZE_MB": "256",
+				"MIRRA_TIMEZONE":         "Europe/Berlin",
+			},
+			validate: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "hourly", cfg.Recording.Rotation)
+				assert.Equal(t, 256, cfg.Recording.MaxFileSizeMB)
+				assert.Equal(t, "Europe/Berlin", cfg.Recording.Timezone)
+			},
+		},
 		{
 			name: "MIRRA_CLAUDE_UPSTREAM",
 			envVars: map[string]string{
@@ -286,3 +321,120 @@ func TestLoad_CustomProviders(t *testing.T) {
 	assert.Equal(t, "https://custom-openai.example.com", cfg.Providers["openai"].UpstreamURL)
 	assert.Equal(t, "https://custom-gemini.example.com", cfg.Providers["gemini"].UpstreamURL)
 }
+
+func TestLoad_Retention(t *testing.T) {
+	tempDir, cleanup := testutil.TempDir(t)
+	defer cleanup()
+
+	configPath := filepath.Join(tempDir, "config.json")
+	testutil.WriteJSONFile(t, configPath, map[string]interface{}{
+		"recording": map[string]interface{}{
+			"retention": map[string]interface{}{
+				"max_age_days":       30,
+				"error_max_age_days": 90,
+				"providers":          map[string]interface{}{"openai": 7},
+			},
+		},
+	})
+	t.Setenv("MIRRA_RETENTION_MAX_SIZE_MB", "512")
+
+	cfg, err := Load(configPath)
+	require.NoError(t, err)
+
+	policy := cfg.Recording.Retention.Policy()
+	assert.True(t, policy.Enabled())
+	assert.Equal(t, 30*24*time.Hour, policy.MaxAge)
+	assert.Equal(t, 90*24*time.Hour, policy.ErrorMaxAge)
+	assert.Equal(t, 7*24*time.Hour, policy.ProviderMaxAge["openai"])
+	assert.Equal(t, int64(512*1024*1024), policy.MaxTotalSize)
+}
+
+func TestRecordingConfig_RotationPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      RecordingConfig
+		period   recorder.RotationPeriod
+		maxSize  int64
+		location string
+		wantErr  bool
+	}{
+		{
+			name:     "default",
+			cfg:      RecordingConfig{},
+			period:   recorder.RotateDaily,
+			location: "UTC",
+		},
+		{
+			name:     "hourly by size",
+			cfg:      RecordingConfig{Rotation: "hourly", MaxFileSizeMB: 64, Timezone: "America/New_York"},
+			period:   recorder.RotateHourly,
+			maxSize:  64 * 1024 * 1024,
+			location: "America/New_York",
+		},
+		{
+			name:    "unknown rotation",
+			cfg:     RecordingConfig{Rotation: "weekly"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown timezone",
+			cfg:     RecordingConfig{Timezone: "Mars/Olympus"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rotation, err := tt.cfg.RotationPolicy()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.period, rotation.Period)
+			assert.Equal(t, tt.maxSize, rotation.MaxSize)
+			assert.Equal(t, tt.location, rotation.Location.String())
+		})
+	}
+}
+
+func TestParseStatusRange(t *testing.T) {
+	tests := []struct {
+		s       string
+		lo, hi  int
+		wantErr bool
+	}{
+		{s: "404", lo: 404, hi: 404},
+		{s: "4xx", lo: 400, hi: 499},
+		{s: "5XX", lo: 500, hi: 599},
+		{s: "500-504", lo: 500, hi: 504},
+		{s: "504-500", wantErr: true},
+		{s: "9xx", wantErr: true},
+		{s: "ok", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			lo, hi, err := ParseStatusRange(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.lo, lo)
+			assert.Equal(t, tt.hi, hi)
+		})
+	}
+}
+
+func TestRecordingConfig_ValidateRules(t *testing.T) {
+	valid := RecordingConfig{Rules: []RecordingRule{
+		{Name: "models", Method: "GET", Path: "/v1/models", Action: RecordSkip},
+		{Name: "embeddings", Path: "/v1/embeddings", Status: "2xx", SampleRate: 0.1, Action: RecordMetadata},
+	}}
+	assert.NoError(t, valid.ValidateRules())
+
+	assert.ErrorContains(t, RecordingConfig{Rules: []RecordingRule{{Action: "drop"}}}.ValidateRules(), "#1")
+	assert.ErrorContains(t, RecordingConfig{Rules: []RecordingRule{{Name: "bad", Status: "2yy", Action: RecordSkip}}}.ValidateRules(), "bad")
+	assert.Error(t, RecordingConfig{Rules: []RecordingRule{{SampleRate: 2, Action: RecordFull}}}.ValidateRules())
+}
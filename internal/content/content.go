@@ -0,0 +1,211 @@
+package content
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Segment kinds
+const (
+	KindText       = "text"
+	KindToolResult = "tool_result"
+)
+
+// Segment is a piece of message text found in a request body
+type Segment struct {
+	Location string // e.g. "messages[2].content[0].text"
+	Role     string // "system", "user", "assistant", "tool", ... when known
+	Kind     string // KindText or KindToolResult
+	Text     string
+}
+
+// WalkFunc is called for each text segment. Returning a different string
+// replaces the segment's text in the body.
+type WalkFunc func(seg Segment) string
+
+// Walk visits the message text of a Claude, OpenAI or Gemini request body.
+// The schemas use distinct top-level keys, so no provider hint is needed:
+//   - Claude: system, messages[].content (string or text/tool_result blocks)
+//   - OpenAI: messages[].content, prompt, input, instructions
+//   - Gemini: contents[].parts[].text, systemInstruction, functionResponse
+//
+// The body is modified in place when fn returns replacement text.
+func Walk(body any, fn WalkFunc) {
+	bodyMap, ok := body.(map[string]any)
+	if !ok {
+		return
+	}
+
+	// Claude system prompt (string or blocks)
+	if system, ok := bodyMap["system"]; ok {
+		bodyMap["system"] = walkContent(system, "system", "system", KindText, fn)
+	}
+
+	// OpenAI Responses API instructions
+	if instructions, ok := bodyMap["instructions"].(string); ok {
+		bodyMap["instructions"] = fn(Segment{Location: "instructions", Role: "system", Kind: KindText, Text: instructions})
+	}
+
+	// Claude and OpenAI chat messages
+	if messages, ok := bodyMap["messages"].([]any); ok {
+		for i, msg := range messages {
+			walkMessage(msg, fmt.Sprintf("messages[%d]", i), fn)
+		}
+	}
+
+	// Legacy completions prompt and embeddings/Responses input
+	for _, key := range []string{"prompt", "input"} {
+		switch v := bodyMap[key].(type) {
+		case string:
+			bodyMap[key] = fn(Segment{Location: key, Role: "user", Kind: KindText, Text: v})
+		case []any:
+			for i, item := range v {
+				loc := fmt.Sprintf("%s[%d]", key, i)
+				if s, ok := item.(string); ok {
+					v[i] = fn(Segment{Location: loc, Role: "user", Kind: KindText, Text: s})
+				} else {
+					walkMessage(item, loc, fn)
+				}
+			}
+		}
+	}
+
+	// Gemini contents and system instruction
+	if contents, ok := bodyMap["contents"].([]any); ok {
+		for i, c := range contents {
+			cMap, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			role, _ := cMap["role"].(string)
+			walkParts(cMap["parts"], fmt.Sprintf("contents[%d].parts", i), role, fn)
+		}
+	}
+	for _, key := range []string{"systemInstruction", "system_instruction"} {
+		if si, ok := bodyMap[key].(map[string]any); ok {
+			walkParts(si["parts"], key+".parts", "system", fn)
+		}
+	}
+}
+
+// WalkLeaves visits every string value in an arbitrary JSON value, such as
+// a response body. Returning a different string replaces the value.
+func WalkLeaves(v any, loc string, fn WalkFunc) any {
+	return walkLeaves(v, loc, "", KindText, fn)
+}
+
+// Preview redacts a matched value for storage, keeping only its edges
+func Preview(match string) string {
+	runes := []rune(match)
+	if len(runes) <= 6 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:2]) + strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-2:])
+}
+
+// walkMessage handles a chat message or Responses API input item
+func walkMessage(msg any, loc string, fn WalkFunc) {
+	msgMap, ok := msg.(map[string]any)
+	if !ok {
+		return
+	}
+
+	role, _ := msgMap["role"].(string)
+	kind := KindText
+	if role == "tool" || role == "function" {
+		kind = KindToolResult
+	}
+
+	if c, ok := msgMap["content"]; ok {
+		msgMap["content"] = walkContent(c, loc+".content", role, kind, fn)
+	}
+
+	// Responses API function call output items
+	if output, ok := msgMap["output"]; ok && msgMap["type"] == "function_call_output" {
+		msgMap["output"] = walkLeaves(output, loc+".output", "tool", KindToolResult, fn)
+	}
+}
+
+// walkContent handles a content field that is either a string or a list of
+// typed blocks
+func walkContent(c any, loc, role, kind string, fn WalkFunc) any {
+	switch v := c.(type) {
+	case string:
+		return fn(Segment{Location: loc, Role: role, Kind: kind, Text: v})
+	case []any:
+		for i, block := range v {
+			blockLoc := fmt.Sprintf("%s[%d]", loc, i)
+			blockMap, ok := block.(map[string]any)
+			if !ok {
+				if s, ok := block.(string); ok {
+					v[i] = fn(Segment{Location: blockLoc, Role: role, Kind: kind, Text: s})
+				}
+				continue
+			}
+
+			switch blockMap["type"] {
+			case "tool_result":
+				if inner, ok := blockMap["content"]; ok {
+					blockMap["content"] = walkContent(inner, blockLoc+".content", role, KindToolResult, fn)
+				}
+			default:
+				if text, ok := blockMap["text"].(string); ok {
+					blockMap["text"] = fn(Segment{Location: blockLoc + ".text", Role: role, Kind: kind, Text: text})
+				}
+			}
+		}
+		return v
+	}
+	return c
+}
+
+// walkParts handles Gemini parts arrays
+func walkParts(parts any, loc, role string, fn WalkFunc) {
+	partList, ok := parts.([]any)
+	if !ok {
+		return
+	}
+
+	for i, part := range partList {
+		partMap, ok := part.(map[string]any)
+		if !ok {
+			continue
+		}
+		partLoc := fmt.Sprintf("%s[%d]", loc, i)
+
+		if text, ok := partMap["text"].(string); ok {
+			partMap["text"] = fn(Segment{Location: partLoc + ".text", Role: role, Kind: KindText, Text: text})
+		}
+		for _, key := range []string{"functionResponse", "function_response"} {
+			if fr, ok := partMap[key].(map[string]any); ok {
+				if resp, ok := fr["response"]; ok {
+					fr["response"] = walkLeaves(resp, partLoc+"."+key+".response", "tool", KindToolResult, fn)
+				}
+			}
+		}
+	}
+}
+
+// walkLeaves visits every string value in an arbitrary JSON value
+func walkLeaves(v any, loc, role, kind string, fn WalkFunc) any {
+	switch val := v.(type) {
+	case string:
+		return fn(Segment{Location: loc, Role: role, Kind: kind, Text: val})
+	case []any:
+		for i, item := range val {
+			val[i] = walkLeaves(item, fmt.Sprintf("%s[%d]", loc, i), role, kind, fn)
+		}
+	case map[string]any:
+		// Sorted keys keep segment order (and placeholder numbering) stable
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			val[k] = walkLeaves(val[k], loc+"."+k, role, kind, fn)
+		}
+	}
+	return v
+}
@@ -0,0 +1,170 @@
+package detect
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jpoz/mirra/internal/content"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Severities, lowest first
+var severities = []string{"low", "medium", "high", "critical"}
+
+// SeverityRank orders severities; unknown values rank lowest
+func SeverityRank(severity string) int {
+	for i, s := range severities {
+		if strings.EqualFold(s, severity) {
+			return i
+		}
+	}
+	return -1
+}
+
+// pattern is a single detector
+type pattern struct {
+	name     string
+	severity string
+	re       *regexp.Regexp
+}
+
+// secretPatterns find credentials pasted into prompts or echoed by models
+var secretPatterns = []pattern{
+	{name: "private_key", severity: "critical", re: regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{name: "aws_access_key", severity: "critical", re: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{name: "aws_secret_key", severity: "critical", re: regexp.MustCompile(`(?i)aws_?secret_?access_?key\s*[=:]\s*["']?[A-Za-z0-9/+=]{40}\b`)},
+	{name: "gcp_service_account", severity: "critical", re: regexp.MustCompile(`"type"\s*:\s*"service_account"`)},
+	{name: "google_api_key", severity: "high", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{name: "azure_storage_key", severity: "critical", re: regexp.MustCompile(`AccountKey=[A-Za-z0-9+/]{86}==`)},
+	{name: "anthropic_api_key", severity: "high", re: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{name: "openai_api_key", severity: "high", re: regexp.MustCompile(`\bsk-(?:proj-|svcacct-|admin-)?[A-Za-z0-9_-]{20,}T3BlbkFJ[A-Za-z0-9_-]{20,}|\bsk-(?:proj|svcacct|admin)-[A-Za-z0-9_-]{40,}`)},
+	{name: "github_token", severity: "high", re: regexp.MustCompile(`\b(?:ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36}\b|\bgithub_pat_[A-Za-z0-9_]{60,}`)},
+	{name: "slack_token", severity: "high", re: regexp.MustCompile(`\bxox[abpors]-[A-Za-z0-9-]{10,}`)},
+	{name: "stripe_key", severity: "high", re: regexp.MustCompile(`\b[rs]k_live_[A-Za-z0-9]{20,}`)},
+	{name: "jwt", severity: "medium", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{name: "generic_secret", severity: "medium", re: regexp.MustCompile(`(?im)^\s*(?:export\s+)?[A-Z0-9_]*(?:SECRET|TOKEN|PASSWORD|API_KEY|PRIVATE_KEY)[A-Z0-9_]*\s*=\s*["']?[^\s"']{8,}`)},
+}
+
+// injectionPatterns find known prompt-injection phrasing in tool results
+var injectionPatterns = []pattern{
+	{name: "ignore_instructions", re: regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget|override)\b.{0,30}\b(?:previous|prior|above|earlier|all|any|your)\b.{0,20}\b(?:instructions?|prompts?|rules|directions|guidelines)\b`)},
+	{name: "role_override", re: regexp.MustCompile(`(?i)\byou are (?:now|no longer)\b|\bact as (?:an? )?(?:unrestricted|jailbroken|developer mode)\b|\bDAN mode\b`)},
+	{name: "new_instructions", re: regexp.MustCompile(`(?i)\b(?:new|updated|real|actual) (?:system )?instructions?\s*:`)},
+	{name: "system_prompt_exfiltration", re: regexp.MustCompile(`(?i)\b(?:reveal|print|repeat|output|show)\b.{0,20}\b(?:system prompt|your instructions|initial prompt)\b`)},
+	{name: "fake_chat_markup", re: regexp.MustCompile(`<\|im_start\|>|<\|im_end\|>|\[/?INST\]|<\|system\|>|</?system>|\n\s*(?:Human|Assistant|System):\s`)},
+	{name: "tool_hijack", re: regexp.MustCompile(`(?i)\b(?:call|invoke|run|execute)\b.{0,20}\b(?:the )?(?:tool|function|command)\b.{0,40}\b(?:without|do not|don't)\b.{0,20}\b(?:ask|confirm|tell)`)},
+}
+
+// SecretPatterns returns the secret detectors' patterns, for callers that
+// replace secrets rather than report them
+func SecretPatterns() []*regexp.Regexp {
+	res := make([]*regexp.Regexp, len(secretPatterns))
+	for i, p := range secretPatterns {
+		res[i] = p.re
+	}
+	return res
+}
+
+// Scanner runs secret-leak and prompt-injection detectors over recordings.
+// It satisfies recorder.Scanner and runs on the recorder's worker, off the
+// request path.
+type Scanner struct {
+	secrets    []pattern
+	injections []pattern
+}
+
+// NewScanner creates a scanner with the built-in detectors plus any extra
+// prompt-injection patterns
+func NewScanner(extraInjectionPatterns []string) (*Scanner, error) {
+	s := &Scanner{
+		secrets:    secretPatterns,
+		injections: append([]pattern{}, injectionPatterns...),
+	}
+
+	for i, expr := range extraInjectionPatterns {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid injection pattern %d: %w", i, err)
+		}
+		s.injections = append(s.injections, pattern{name: "custom", re: re})
+	}
+
+	return s, nil
+}
+
+// Scan returns findings for the recording's request and response content
+func (s *Scanner) Scan(rec *recorder.Recording) []recorder.Finding {
+	var findings []recorder.Finding
+
+	// Request message text: secrets anywhere, injections only in tool results
+	content.Walk(rec.Request.Body, func(seg content.Segment) string {
+		loc := "request." + seg.Location
+		findings = append(findings, s.scanSecrets(seg.Text, loc)...)
+		if seg.Kind == content.KindToolResult {
+			findings = append(findings, s.scanInjections(seg.Text, loc)...)
+		}
+		return seg.Text
+	})
+
+	// Model output: streamed bodies are SSE strings, others are JSON
+	switch body := rec.Response.Body.(type) {
+	case string:
+		findings = append(findings, s.scanSecrets(body, "response.body")...)
+	case nil:
+	default:
+		content.WalkLeaves(body, "response.body", func(seg content.Segment) string {
+			findings = append(findings, s.scanSecrets(seg.Text, seg.Location)...)
+			return seg.Text
+		})
+	}
+
+	return findings
+}
+
+func (s *Scanner) scanSecrets(text, loc string) []recorder.Finding {
+	var findings []recorder.Finding
+	for _, p := range s.secrets {
+		for _, match := range p.re.FindAllString(text, -1) {
+			findings = append(findings, recorder.Finding{
+				Detector: "secret",
+				Type:     p.name,
+				Severity: p.severity,
+				Location: loc,
+				Match:    content.Preview(match),
+			})
+		}
+	}
+	return findings
+}
+
+func (s *Scanner) scanInjections(text, loc string) []recorder.Finding {
+	var findings []recorder.Finding
+	for _, p := range s.injections {
+		// One finding per pattern per segment is enough to flag it
+		if match := p.re.FindString(text); match != "" {
+			findings = append(findings, recorder.Finding{
+				Detector: "prompt_injection",
+				Type:     p.name,
+				Severity: "high",
+				Location: loc,
+				Match:    truncate(match, 80),
+			})
+		}
+	}
+	return findings
+}
+
+// truncate shortens injection matches; unlike secrets they are safe to keep
+func truncate(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) <= n {
+		return s
+	}
+	// Cut on a rune boundary so the match stays valid UTF-8
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "…"
+}
@@ -27,14 +27,28 @@ func extractTraceID(rec *recorder.Recording) string {
 	return ""
 }
 
-// extractSessionID extracts the session UUID from request body metadata
+// extractSessionID returns the client-supplied X-Mirra-Session, or extracts
+// the session UUID from request body metadata
 // Format: "user_{hash}_account_{uuid}_session_{uuid}" -> returns session UUID
 func extractSessionID(rec *recorder.Recording) string {
+	if rec == nil {
+		return ""
+	}
+	if rec.Session != "" {
+		return rec.Session
+	}
+
+	_, _, session := parseClaudeUserID(claudeUserID(rec))
+	return session
+}
+
+// claudeUserID returns body.metadata.user_id, which Claude Code sets on
+// every request
+func claudeUserID(rec *recorder.Recording) string {
 	if rec == nil || rec.Request.Body == nil {
 		return ""
 	}
 
-	// Navigate: body.metadata.user_id
 	bodyMap, ok := rec.Request.Body.(map[string]interface{})
 	if !ok {
 		return ""
@@ -45,24 +59,30 @@ func extractSessionID(rec *recorder.Recording) string {
 		return ""
 	}
 
-	userID, ok := metadata["user_id"].(string)
-	if !ok {
-		return ""
-	}
+	userID, _ := metadata["user_id"].(string)
+	return userID
+}
 
-	// Parse: "user_..._session_{uuid}"
-	parts := strings.Split(userID, "_session_")
-	if len(parts) == 2 && parts[1] != "" {
-		return parts[1]
+// parseClaudeUserID splits a Claude user_id into its parts
+// Format: "user_{hash}_account_{uuid}_session_{uuid}"
+func parseClaudeUserID(userID string) (user, account, session string) {
+	rest, session, _ := strings.Cut(userID, "_session_")
+	rest, account, _ = strings.Cut(rest, "_account_")
+	if strings.HasPrefix(rest, "user_") {
+		user = strings.TrimPrefix(rest, "user_")
 	}
-
-	return ""
+	return user, account, session
 }
 
 // extractGroupKey returns the primary grouping key for a recording
-// Priority: 1. Sentry-Trace ID, 2. Session ID
+// Priority: 1. X-Mirra-Session, 2. Sentry-Trace ID, 3. Session ID
 // Returns the key and a boolean indicating if it's a trace ID (true) or session ID (false)
 func extractGroupKey(rec *recorder.Recording) (string, bool) {
+	// An explicit client session always wins
+	if rec != nil && rec.Session != "" {
+		return rec.Session, false
+	}
+
 	traceID := extractTraceID(rec)
 	if traceID != "" {
 		return traceID, true
@@ -76,6 +96,12 @@ func extractGroupKey(rec *recorder.Recording) (string, bool) {
 	return "", false
 }
 
+// InGroup reports whether a recording belongs to the session group with the
+// given trace or session ID. Unlike the session index it has no size limit.
+func InGroup(rec *recorder.Recording, key string) bool {
+	return key != "" && (extractTraceID(rec) == key || extractSessionID(rec) == key)
+}
+
 // containsString checks if a string slice contains a value
 func containsString(slice []string, value string) bool {
 	for _, item := range slice {
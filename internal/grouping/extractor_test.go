@@ -184,6 +184,19 @@ func TestExtractGroupKey(t *testing.T) {
 			wantKey:       "session456",
 			wantIsTraceID: false,
 		},
+		{
+			name: "client session overrides trace id",
+			rec: &recorder.Recording{
+				Session: "nightly-eval-42",
+				Request: recorder.RequestData{
+					Headers: map[string][]string{
+						"Sentry-Trace": {"trace123-span456"},
+					},
+				},
+			},
+			wantKey:       "nightly-eval-42",
+			wantIsTraceID: false,
+		},
 		{
 			name: "no identifiers",
 			rec: &recorder.Recording{
@@ -297,3 +310,24 @@ func TestSessionGroupIndex_AddRecording(t *testing.T) {
 		t.Errorf("RequestCount = %v, want 2", group.RequestCount)
 	}
 }
+
+func TestInGroup(t *testing.T) {
+	rec := &recorder.Recording{
+		Request: recorder.RequestData{
+			Headers: map[string][]string{
+				"Sentry-Trace": {"trace123-span456"},
+			},
+			Body: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"user_id": "user_abc_account_def_session_session456",
+				},
+			},
+		},
+	}
+
+	for key, want := range map[string]bool{"trace123": true, "session456": true, "other": false, "": false} {
+		if got := InGroup(rec, key); got != want {
+			t.Errorf("InGroup(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
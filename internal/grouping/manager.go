@@ -17,8 +17,9 @@ type Manager struct {
 	mu             sync.RWMutex
 }
 
-// NewManager creates a new grouping manager
-func NewManager(recordingsPath string, enabled bool) *Manager {
+// NewManager creates a new grouping manager. With keys, the indexes are
+// encrypted like the recordings.
+func NewManager(recordingsPath string, enabled bool, keys *recorder.Keyring) *Manager {
 	m := &Manager{
 		recordingsPath: recordingsPath,
 		enabled:        enabled,
@@ -26,6 +27,7 @@ func NewManager(recordingsPath string, enabled bool) *Manager {
 
 	if enabled {
 		m.sessions = NewSessionGroupIndex(recordingsPath)
+		m.sessions.SetKeyring(keys)
 
 		// Load existing index
 		if err := m.sessions.Load(); err != nil {
@@ -61,6 +63,22 @@ func (m *Manager) OnRecordingWrite(rec *recorder.Recording) error {
 	return nil
 }
 
+// OnRecordingsRemoved is called after recordings are deleted, for example
+// by retention, and saves the updated indexes
+func (m *Manager) OnRecordingsRemoved(ids []string) error {
+	if !m.enabled {
+		return nil
+	}
+
+	if m.sessions.RemoveRecordings(ids) == 0 {
+		return nil
+	}
+	if err := m.sessions.Save(); err != nil {
+		return fmt.Errorf("failed to save session index: %w", err)
+	}
+	return nil
+}
+
 // GetSessionGroup returns a session group by trace ID
 func (m *Manager) GetSessionGroup(traceID string) (*SessionGroup, error) {
 	if !m.enabled {
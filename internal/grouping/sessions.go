@@ -1,6 +1,7 @@
 package grouping
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"log/slog"
@@ -30,6 +31,8 @@ type SessionGroupIndex struct {
 	byRecordingID map[string]string // recording_id -> group_key
 
 	path      string
+	keys      *recorder.Keyring
+	sealed    bool // loaded from a file that could not be decrypted
 	mu        sync.RWMutex
 	dirty     bool
 	lastSave  time.Time
@@ -54,7 +57,15 @@ func NewSessionGroupIndex(recordingsPath string) *SessionGroupIndex {
 	}
 }
 
-// Load reads the session index from disk
+// SetKeyring encrypts the index with the keys recordings are sealed with,
+// since groups carry the projects, tags and session IDs sealing hides. Set
+// it before Load.
+func (idx *SessionGroupIndex) SetKeyring(keys *recorder.Keyring) {
+	idx.keys = keys
+}
+
+// Load reads the session index from disk. An encrypted index that cannot be
+// decrypted is an error, and is never overwritten by Save.
 func (idx *SessionGroupIndex) Load() error {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
@@ -67,6 +78,10 @@ func (idx *SessionGroupIndex) Load() error {
 		}
 		return fmt.Errorf("failed to read session index: %w", err)
 	}
+	if data, err = idx.keys.OpenIndex(data, SessionIndexFilename); err != nil {
+		idx.sealed = true
+		return fmt.Errorf("failed to decrypt session index: %w", err)
+	}
 
 	var loaded SessionGroupIndex
 	if err := json.Unmarshal(data, &loaded); err != nil {
@@ -118,12 +133,20 @@ func (idx *SessionGroupIndex) Save() error {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
+	if idx.sealed {
+		return fmt.Errorf("session index could not be decrypted, refusing to overwrite it")
+	}
 	idx.GeneratedAt = time.Now()
 
 	data, err := json.MarshalIndent(idx, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal session index: %w", err)
 	}
+	if idx.keys != nil {
+		if data, err = idx.keys.SealIndex(data, SessionIndexFilename); err != nil {
+			return fmt.Errorf("failed to encrypt session index: %w", err)
+		}
+	}
 
 	// Atomic write: write to temp file, then rename
 	tempPath := idx.path + ".tmp"
@@ -201,6 +224,15 @@ func (idx *SessionGroupIndex) AddRecording(rec *recorder.Recording) error {
 		group.HasErrors = true
 	}
 
+	if group.Project == "" {
+		group.Project = rec.Project
+	}
+	for _, tag := range rec.Tags {
+		if !containsString(group.Tags, tag) {
+			group.Tags = append(group.Tags, tag)
+		}
+	}
+
 	// Update lookup map
 	idx.byRecordingID[rec.ID] = groupKey
 
@@ -210,6 +242,113 @@ func (idx *SessionGroupIndex) AddRecording(rec *recorder.Recording) error {
 	return nil
 }
 
+// RemoveRecordings drops recordings from their groups, deleting groups that
+// become empty. Timestamps, providers and the error flag of the remaining
+// groups are left as they were.
+func (idx *SessionGroupIndex) RemoveRecordings(ids []string) int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	removed := 0
+	for _, id := range ids {
+		groupKey, ok := idx.byRecordingID[id]
+		if !ok {
+			continue
+		}
+		delete(idx.byRecordingID, id)
+		removed++
+
+		group, ok := idx.Groups[groupKey]
+		if !ok {
+			continue
+		}
+		for i, recID := range group.RecordingIDs {
+			if recID == id {
+				group.RecordingIDs = append(group.RecordingIDs[:i], group.RecordingIDs[i+1:]...)
+				break
+			}
+		}
+		group.RequestCount = len(group.RecordingIDs)
+
+		if len(group.RecordingIDs) == 0 {
+			delete(idx.Groups, groupKey)
+			if group.SessionID != "" && idx.bySessionID[group.SessionID] == group {
+				delete(idx.bySessionID, group.SessionID)
+			}
+			idx.TotalGroups--
+		}
+	}
+
+	if removed > 0 {
+		idx.dirty = true
+	}
+	return removed
+}
+
+// RecordingIDs returns the key of the group each indexed recording is in
+func (idx *SessionGroupIndex) RecordingIDs() map[string]string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	ids := make(map[string]string, len(idx.byRecordingID))
+	for id, key := range idx.byRecordingID {
+		ids[id] = key
+	}
+	return ids
+}
+
+// Rebuild regroups every recording in the recordings directory from scratch.
+// Encrypted recordings are opened with keys; without their key they are
+// grouped by their plaintext metadata only. Call Save to persist the result.
+func (idx *SessionGroupIndex) Rebuild(keys *recorder.Keyring) error {
+	recordingsPath := filepath.Dir(filepath.Dir(idx.path))
+	files, err := recorder.RecordingFiles(recordingsPath)
+	if err != nil {
+		return fmt.Errorf("failed to list recording files: %w", err)
+	}
+
+	idx.mu.Lock()
+	idx.Groups = make(map[string]*SessionGroup)
+	idx.bySessionID = make(map[string]*SessionGroup)
+	idx.byRecordingID = make(map[string]string)
+	idx.TotalGroups = 0
+	idx.dirty = true
+	idx.sealed = false
+	idx.mu.Unlock()
+
+	blobs := recorder.NewBlobStore(recordingsPath)
+	blobs.SetKeyring(keys)
+	for _, file := range files {
+		f, err := recorder.OpenRecordings(file)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", filepath.Base(file), err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), recorder.MaxLineSize)
+		for scanner.Scan() {
+			var rec recorder.Recording
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				continue
+			}
+			if err := keys.Open(&rec); err == nil {
+				// Session IDs can be in deduplicated request bodies
+				_ = blobs.HydrateText(&rec)
+			}
+			if err := idx.AddRecording(&rec); err != nil {
+				slog.Debug("failed to add recording to session index", "recording_id", rec.ID, "error", err)
+			}
+		}
+
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+		}
+	}
+	return nil
+}
+
 // GetGroupByTraceID returns a session group by trace ID
 func (idx *SessionGroupIndex) GetGroupByTraceID(traceID string) (*SessionGroup, error) {
 	idx.mu.RLock()
@@ -275,6 +414,12 @@ func (idx *SessionGroupIndex) ListGroups(opts *ListGroupsOptions) ([]*SessionGro
 		if opts.HasErrors != nil && group.HasErrors != *opts.HasErrors {
 			continue
 		}
+		if opts.Project != "" && group.Project != opts.Project {
+			continue
+		}
+		if opts.Tag != "" && !containsString(group.Tags, opts.Tag) {
+			continue
+		}
 
 		filtered = append(filtered, group)
 	}
@@ -334,4 +479,6 @@ type ListGroupsOptions struct {
 	ToDate    *time.Time
 	Provider  string
 	HasErrors *bool
+	Project   string
+	Tag       string
 }
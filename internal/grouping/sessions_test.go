@@ -0,0 +1,93 @@
+package grouping
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jpoz/mirra/internal/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionGroupIndex_RemoveRecordings(t *testing.T) {
+	idx := NewSessionGroupIndex(t.TempDir())
+
+	add := func(id, session string) {
+		require.NoError(t, idx.AddRecording(&recorder.Recording{ID: id, Session: session, Timestamp: time.Now()}))
+	}
+	add("rec-1", "session-a")
+	add("rec-2", "session-a")
+	add("rec-3", "session-b")
+
+	assert.Equal(t, 2, idx.RemoveRecordings([]string{"rec-1", "rec-3", "unknown"}))
+
+	group, err := idx.GetGroupBySessionID("session-a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rec-2"}, group.RecordingIDs)
+	assert.Equal(t, 1, group.RequestCount)
+
+	// Emptied groups are deleted
+	_, err = idx.GetGroupBySessionID("session-b")
+	assert.Error(t, err)
+	_, err = idx.GetGroupByRecordingID("rec-3")
+	assert.Error(t, err)
+	assert.Equal(t, 1, idx.TotalGroups)
+}
+
+func TestSessionGroupIndex_Rebuild(t *testing.T) {
+	dir := t.TempDir()
+	lines := `{"id":"20250101-a","session":"session-a","provider":"claude"}
+{"id":"20250101-b","provider":"openai","request":{"headers":{"Sentry-Trace":["trace1-span"]}}}
+{"id":"20250101-c","session":"session-a","provider":"openai"}
+{"id":"20250101-d","provider":"claude"}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "recordings-2025-01-01.jsonl"), []byte(lines), 0644))
+
+	idx := NewSessionGroupIndex(dir)
+	require.NoError(t, idx.AddRecording(&recorder.Recording{ID: "gone", Session: "session-x"}))
+	require.NoError(t, idx.Rebuild(nil))
+
+	assert.Equal(t, map[string]string{"20250101-a": "session-a", "20250101-b": "trace1", "20250101-c": "session-a"}, idx.RecordingIDs())
+	assert.Equal(t, 2, idx.TotalGroups)
+	group, err := idx.GetGroupBySessionID("session-a")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"claude", "openai"}, group.Providers)
+	_, err = idx.GetGroupBySessionID("session-x")
+	assert.Error(t, err)
+}
+
+func TestSessionGroupIndex_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	keys, err := recorder.ParseKeyring("k1:" + base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	require.NoError(t, err)
+
+	idx := NewSessionGroupIndex(dir)
+	idx.SetKeyring(keys)
+	require.NoError(t, idx.AddRecording(&recorder.Recording{ID: "rec-1", Session: "secret-session", Project: "secret-project", Tags: []string{"secret-tag"}, Timestamp: time.Now()}))
+	require.NoError(t, idx.Save())
+
+	data, err := os.ReadFile(filepath.Join(dir, "groups", SessionIndexFilename))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	assert.NotContains(t, string(data), "rec-1")
+
+	loaded := NewSessionGroupIndex(dir)
+	loaded.SetKeyring(keys)
+	require.NoError(t, loaded.Load())
+	group, err := loaded.GetGroupBySessionID("secret-session")
+	require.NoError(t, err)
+	assert.Equal(t, "secret-project", group.Project)
+	assert.Equal(t, []string{"secret-tag"}, group.Tags)
+
+	// Without the key the index is neither read nor overwritten
+	locked := NewSessionGroupIndex(dir)
+	assert.ErrorIs(t, locked.Load(), recorder.ErrNoKey)
+	require.NoError(t, locked.AddRecording(&recorder.Recording{ID: "rec-2", Session: "other", Timestamp: time.Now()}))
+	assert.Error(t, locked.Save())
+	after, err := os.ReadFile(filepath.Join(dir, "groups", SessionIndexFilename))
+	require.NoError(t, err)
+	assert.Equal(t, data, after)
+}
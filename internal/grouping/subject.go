@@ -0,0 +1,153 @@
+package grouping
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/jpoz/mirra/internal/keys"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// ErasedValue replaces identifiers removed from anonymized recordings
+const ErasedValue = "erased"
+
+// Headers that carry API keys
+var keyHeaders = []string{"X-Api-Key", "Authorization", "X-Goog-Api-Key"}
+
+// Subject identifies the person a data subject request is about. A
+// recording belongs to the subject if it matches any identifier.
+type Subject struct {
+	UserIDs      []string `json:"user_ids,omitempty"` // see UserIDs
+	Tags         []string `json:"tags,omitempty"`
+	Fingerprints []string `json:"fingerprints,omitempty"` // API-key fingerprints (see keys.Fingerprint) or virtual key IDs
+}
+
+// Empty reports whether the subject has no identifiers
+func (s *Subject) Empty() bool {
+	return len(s.UserIDs) == 0 && len(s.Tags) == 0 && len(s.Fingerprints) == 0
+}
+
+// Match reports whether a recording belongs to the subject. Sealed
+// recordings must be opened first or only virtual key IDs can match.
+func (s *Subject) Match(rec *recorder.Recording) bool {
+	for _, id := range UserIDs(rec) {
+		if containsString(s.UserIDs, id) {
+			return true
+		}
+	}
+	for _, tag := range rec.Tags {
+		if containsString(s.Tags, tag) {
+			return true
+		}
+	}
+	if rec.VirtualKey != nil && containsString(s.Fingerprints, rec.VirtualKey.ID) {
+		return true
+	}
+	for _, fp := range keyFingerprints(rec) {
+		if containsString(s.Fingerprints, fp) {
+			return true
+		}
+	}
+	return false
+}
+
+// Anonymize removes the identifiers of the person behind a recording: the
+// X-Mirra-User, the subject's tags, the user and account parts of a Claude
+// user_id, OpenAI's user field, API keys and the virtual key owner. The
+// session part of a user_id is kept so session groups stay intact. Raw
+// request bytes are dropped since they hold the same identifiers.
+func (s *Subject) Anonymize(rec *recorder.Recording) {
+	rec.User = ""
+	var tags []string
+	for _, tag := range rec.Tags {
+		if !containsString(s.Tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	rec.Tags = tags
+	if rec.VirtualKey != nil {
+		rec.VirtualKey.Owner = ""
+	}
+
+	for name := range rec.Request.Headers {
+		for _, keyHeader := range keyHeaders {
+			if strings.EqualFold(name, keyHeader) {
+				delete(rec.Request.Headers, name)
+			}
+		}
+	}
+	if rec.Request.Query != "" {
+		if query, err := url.ParseQuery(rec.Request.Query); err == nil && query.Has("key") {
+			query.Del("key")
+			rec.Request.Query = query.Encode()
+		}
+	}
+	rec.Request.Raw = nil
+
+	body, ok := rec.Request.Body.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if _, ok := body["user"].(string); ok {
+		delete(body, "user")
+	}
+	if userID := claudeUserID(rec); userID != "" {
+		metadata := body["metadata"].(map[string]interface{})
+		if _, _, session := parseClaudeUserID(userID); session != "" {
+			metadata["user_id"] = "user_" + ErasedValue + "_account_" + ErasedValue + "_session_" + session
+		} else {
+			delete(metadata, "user_id")
+		}
+	}
+}
+
+// UserIDs returns the identifiers of the end user behind a request: the
+// X-Mirra-User, a Claude metadata.user_id along with its user hash and
+// account UUID, and OpenAI's user field
+func UserIDs(rec *recorder.Recording) []string {
+	var ids []string
+	if rec.User != "" {
+		ids = append(ids, rec.User)
+	}
+	if userID := claudeUserID(rec); userID != "" {
+		ids = append(ids, userID)
+		user, account, _ := parseClaudeUserID(userID)
+		if user != "" {
+			ids = append(ids, user)
+		}
+		if account != "" {
+			ids = append(ids, account)
+		}
+	}
+	if body, ok := rec.Request.Body.(map[string]interface{}); ok {
+		if user, ok := body["user"].(string); ok && user != "" {
+			ids = append(ids, user)
+		}
+	}
+	return ids
+}
+
+// keyFingerprints returns the fingerprints of the API keys a request was
+// sent with. Virtual keys are recorded redacted and match by key ID instead.
+func keyFingerprints(rec *recorder.Recording) []string {
+	var fps []string
+	for name, values := range rec.Request.Headers {
+		for _, keyHeader := range keyHeaders {
+			if !strings.EqualFold(name, keyHeader) {
+				continue
+			}
+			for _, value := range values {
+				value = strings.TrimSpace(strings.TrimPrefix(value, "Bearer "))
+				if value != "" && !keys.IsVirtual(value) {
+					fps = append(fps, keys.Fingerprint(value))
+				}
+			}
+		}
+	}
+	if query, err := url.ParseQuery(rec.Request.Query); err == nil {
+		if value := query.Get("key"); value != "" && !keys.IsVirtual(value) {
+			fps = append(fps, keys.Fingerprint(value))
+		}
+	}
+	return fps
+}
@@ -0,0 +1,80 @@
+package grouping
+
+import (
+	"testing"
+
+	"github.com/jpoz/mirra/internal/keys"
+	"github.com/jpoz/mirra/internal/recorder"
+	"github.com/stretchr/testify/assert"
+)
+
+func claudeRecording(userID string) *recorder.Recording {
+	return &recorder.Recording{
+		Request: recorder.RequestData{
+			Headers: map[string][]string{"X-Api-Key": {"sk-ant-secret"}},
+			Body: map[string]interface{}{
+				"metadata": map[string]interface{}{"user_id": userID},
+			},
+			Raw: &recorder.Blob{SHA256: "abc"},
+		},
+		Tags: []string{"alice", "eval"},
+		User: "alice@example.com",
+	}
+}
+
+func TestUserIDs(t *testing.T) {
+	rec := claudeRecording("user_hash1_account_acct-1_session_sess-1")
+	assert.Equal(t, []string{"alice@example.com", "user_hash1_account_acct-1_session_sess-1", "hash1", "acct-1"}, UserIDs(rec))
+
+	openai := &recorder.Recording{Request: recorder.RequestData{Body: map[string]interface{}{"user": "user-42"}}}
+	assert.Equal(t, []string{"user-42"}, UserIDs(openai))
+}
+
+func TestSubject_Match(t *testing.T) {
+	rec := claudeRecording("user_hash1_account_acct-1_session_sess-1")
+	rec.Request.Query = "key=gemini-secret"
+	rec.VirtualKey = &recorder.KeyData{ID: "vk-1"}
+
+	tests := []struct {
+		name    string
+		subject Subject
+		want    bool
+	}{
+		{"user hash", Subject{UserIDs: []string{"hash1"}}, true},
+		{"account", Subject{UserIDs: []string{"acct-1"}}, true},
+		{"mirra user", Subject{UserIDs: []string{"alice@example.com"}}, true},
+		{"session is not a user", Subject{UserIDs: []string{"sess-1"}}, false},
+		{"tag", Subject{Tags: []string{"alice"}}, true},
+		{"header key", Subject{Fingerprints: []string{keys.Fingerprint("sk-ant-secret")}}, true},
+		{"query key", Subject{Fingerprints: []string{keys.Fingerprint("gemini-secret")}}, true},
+		{"virtual key", Subject{Fingerprints: []string{"vk-1"}}, true},
+		{"someone else", Subject{UserIDs: []string{"bob"}, Tags: []string{"bob"}, Fingerprints: []string{"0123"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.subject.Match(rec))
+		})
+	}
+}
+
+func TestSubject_Anonymize(t *testing.T) {
+	subject := &Subject{UserIDs: []string{"hash1"}, Tags: []string{"alice"}}
+	rec := claudeRecording("user_hash1_account_acct-1_session_sess-1")
+	rec.Request.Query = "key=gemini-secret&alt=sse"
+	rec.VirtualKey = &recorder.KeyData{ID: "vk-1", Owner: "alice"}
+	key := extractSessionID(rec)
+
+	subject.Anonymize(rec)
+
+	assert.False(t, subject.Match(rec))
+	assert.Empty(t, rec.User)
+	assert.Equal(t, []string{"eval"}, rec.Tags)
+	assert.Empty(t, rec.Request.Headers)
+	assert.Equal(t, "alt=sse", rec.Request.Query)
+	assert.Nil(t, rec.Request.Raw)
+	assert.Equal(t, "vk-1", rec.VirtualKey.ID)
+	assert.Empty(t, rec.VirtualKey.Owner)
+	assert.Equal(t, "user_erased_account_erased_session_sess-1", claudeUserID(rec))
+	assert.Equal(t, key, extractSessionID(rec), "session groups are kept")
+}
@@ -26,6 +26,8 @@ type SessionGroup struct {
 	RequestCount   int       `json:"request_count"`
 	Providers      []string  `json:"providers"`
 	HasErrors      bool      `json:"has_errors"`
+	Project        string    `json:"project,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
 }
 
 // SimilarityOptions configures similarity search behavior
@@ -0,0 +1,292 @@
+package guardrail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/content"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Policies
+const (
+	PolicyAllow = "allow"
+	PolicyMask  = "mask"
+	PolicyBlock = "block"
+)
+
+// builtinDetectors maps detector names to their pattern and default severity
+var builtinDetectors = map[string]struct {
+	pattern  string
+	severity string
+	validate func(string) bool
+}{
+	"email":       {pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, severity: "medium"},
+	"phone":       {pattern: `(?:\+\d{1,3}[\s.-]?)?\(?\b\d{3}\)?[\s.-]\d{3}[\s.-]\d{4}\b|\+\d{8,15}\b`, severity: "medium"},
+	"credit_card": {pattern: `\b(?:\d[ -]?){12,18}\d\b`, severity: "high", validate: luhnValid},
+	"ssn":         {pattern: `\b\d{3}-\d{2}-\d{4}\b`, severity: "high", validate: ssnValid},
+}
+
+// Detector returns the pattern of a built-in detector and the check its
+// matches must pass, if any
+func Detector(name string) (pattern string, validate func(string) bool, ok bool) {
+	builtin, ok := builtinDetectors[name]
+	return builtin.pattern, builtin.validate, ok
+}
+
+var nonAlnum = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// defaultRules is used when PII scanning is enabled without explicit rules
+var defaultRules = []config.PIIRule{
+	{Detector: "email", Policy: PolicyMask},
+	{Detector: "credit_card", Policy: PolicyMask},
+	{Detector: "ssn", Policy: PolicyMask},
+	{Detector: "phone", Policy: PolicyMask},
+}
+
+type piiRule struct {
+	name     string
+	policy   string
+	severity string
+	re       *regexp.Regexp
+	validate func(string) bool
+}
+
+// PIIScanner finds PII in request message text and applies per-rule policies
+type PIIScanner struct {
+	rules []piiRule
+}
+
+// NewPIIScanner compiles the configured rules
+func NewPIIScanner(cfg config.PIIConfig) (*PIIScanner, error) {
+	rules := cfg.Rules
+	if len(rules) == 0 {
+		rules = defaultRules
+	}
+
+	s := &PIIScanner{}
+	for _, rule := range rules {
+		compiled := piiRule{
+			name:     rule.Name,
+			policy:   rule.Policy,
+			severity: rule.Severity,
+		}
+		if compiled.policy == "" {
+			compiled.policy = PolicyMask
+		}
+		if compiled.policy != PolicyAllow && compiled.policy != PolicyMask && compiled.policy != PolicyBlock {
+			return nil, fmt.Errorf("pii rule %q: unknown policy %q", rule.Name, rule.Policy)
+		}
+
+		var pattern string
+		switch {
+		case rule.Detector != "":
+			builtin, ok := builtinDetectors[rule.Detector]
+			if !ok {
+				return nil, fmt.Errorf("pii rule %q: unknown detector %q", rule.Name, rule.Detector)
+			}
+			pattern = builtin.pattern
+			compiled.validate = builtin.validate
+			if compiled.name == "" {
+				compiled.name = rule.Detector
+			}
+			if compiled.severity == "" {
+				compiled.severity = builtin.severity
+			}
+		case rule.Pattern != "":
+			pattern = rule.Pattern
+		case len(rule.Dictionary) > 0:
+			terms := make([]string, len(rule.Dictionary))
+			for i, term := range rule.Dictionary {
+				terms[i] = regexp.QuoteMeta(term)
+			}
+			pattern = `(?i)\b(?:` + strings.Join(terms, "|") + `)\b`
+		default:
+			return nil, fmt.Errorf("pii rule %q: detector, pattern or dictionary required", rule.Name)
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pii rule %q: %w", rule.Name, err)
+		}
+		compiled.re = re
+
+		if compiled.name == "" {
+			compiled.name = "custom"
+		}
+		if compiled.severity == "" {
+			compiled.severity = "medium"
+		}
+		s.rules = append(s.rules, compiled)
+	}
+
+	return s, nil
+}
+
+// Result is the outcome of scanning a request body
+type Result struct {
+	Findings  []recorder.Finding
+	Blocked   bool
+	BlockedBy string
+	Masked    bool
+
+	// placeholder -> original value, used to restore responses
+	placeholders map[string]string
+	// original value -> placeholder, so repeated values share a placeholder
+	byValue map[string]string
+	counts  map[string]int
+}
+
+// Scan checks every message text segment of the body. Masked and blocked
+// values are replaced in place with placeholders such as [PII_EMAIL_1]; the
+// same value always gets the same placeholder within a request.
+func (s *PIIScanner) Scan(body any) *Result {
+	result := newResult()
+	content.Walk(body, func(seg content.Segment) string {
+		return s.scanText(result, "request."+seg.Location, seg.Text)
+	})
+	return result
+}
+
+// ScanMultipart checks the text fields of a multipart upload, masking values
+// in place like Scan. File parts are not scanned.
+func (s *PIIScanner) ScanMultipart(parts []recorder.MultipartPart) *Result {
+	result := newResult()
+	for i := range parts {
+		if parts[i].Blob == nil && parts[i].Value != "" {
+			parts[i].Value = s.scanText(result, "request.multipart."+parts[i].Name, parts[i].Value)
+		}
+	}
+	return result
+}
+
+func newResult() *Result {
+	return &Result{
+		placeholders: make(map[string]string),
+		byValue:      make(map[string]string),
+		counts:       make(map[string]int),
+	}
+}
+
+// scanText applies every rule to one piece of text and returns it with
+// masked values replaced
+func (s *PIIScanner) scanText(result *Result, loc, text string) string {
+	for _, rule := range s.rules {
+		text = rule.re.ReplaceAllStringFunc(text, func(match string) string {
+			if rule.validate != nil && !rule.validate(match) {
+				return match
+			}
+			finding := recorder.Finding{
+				Detector: "pii",
+				Type:     rule.name,
+				Severity: rule.severity,
+				Location: loc,
+				Match:    content.Preview(match),
+			}
+
+			switch rule.policy {
+			case PolicyBlock:
+				finding.Action = "blocked"
+				result.Findings = append(result.Findings, finding)
+				if !result.Blocked {
+					result.Blocked = true
+					result.BlockedBy = rule.name
+				}
+				// Blocked requests are never forwarded, but they are recorded
+				return result.placeholderFor(rule.name, match)
+			case PolicyMask:
+				finding.Action = "masked"
+				result.Findings = append(result.Findings, finding)
+				result.Masked = true
+				return result.placeholderFor(rule.name, match)
+			default:
+				finding.Action = "allowed"
+				result.Findings = append(result.Findings, finding)
+				return match
+			}
+		})
+	}
+	return text
+}
+
+func (r *Result) placeholderFor(ruleName, value string) string {
+	if placeholder, ok := r.byValue[value]; ok {
+		return placeholder
+	}
+
+	r.counts[ruleName]++
+	label := strings.ToUpper(nonAlnum.ReplaceAllString(ruleName, "_"))
+	placeholder := fmt.Sprintf("[PII_%s_%d]", label, r.counts[ruleName])
+	r.byValue[value] = placeholder
+	r.placeholders[placeholder] = value
+	return placeholder
+}
+
+// Restore replaces placeholders in response bytes with the original values.
+// Responses are JSON or SSE carrying JSON, so values are JSON-escaped.
+// Placeholders split across stream chunks are not restored.
+func (r *Result) Restore(data []byte) []byte {
+	if r == nil || len(r.placeholders) == 0 || !bytes.Contains(data, []byte("[PII_")) {
+		return data
+	}
+
+	// Longest placeholders first so [PII_EMAIL_1] never clobbers [PII_EMAIL_10]
+	placeholders := make([]string, 0, len(r.placeholders))
+	for p := range r.placeholders {
+		placeholders = append(placeholders, p)
+	}
+	sort.Slice(placeholders, func(i, j int) bool { return len(placeholders[i]) > len(placeholders[j]) })
+
+	for _, placeholder := range placeholders {
+		escaped, _ := json.Marshal(r.placeholders[placeholder])
+		data = bytes.ReplaceAll(data, []byte(placeholder), escaped[1:len(escaped)-1])
+	}
+	return data
+}
+
+// luhnValid checks a credit card number candidate with the Luhn algorithm
+func luhnValid(s string) bool {
+	var digits []int
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// ssnValid rejects SSN candidates with area, group or serial numbers that
+// are never issued
+func ssnValid(s string) bool {
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return false
+	}
+	area, group, serial := parts[0], parts[1], parts[2]
+	if area == "000" || area == "666" || area[0] == '9' {
+		return false
+	}
+	return group != "00" && serial != "0000"
+}
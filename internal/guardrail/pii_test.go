@@ -0,0 +1,163 @@
+package guardrail
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseBody(t *testing.T, s string) any {
+	t.Helper()
+	var body any
+	require.NoError(t, json.Unmarshal([]byte(s), &body))
+	return body
+}
+
+func TestPIIScanner_MaskAcrossSchemas(t *testing.T) {
+	scanner, err := NewPIIScanner(config.PIIConfig{Enabled: true})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		body     string
+		location string
+	}{
+		{
+			name:     "claude string content",
+			body:     `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"Email me at jane.doe@example.com"}]}`,
+			location: "request.messages[0].content",
+		},
+		{
+			name:     "claude blocks and system",
+			body:     `{"system":[{"type":"text","text":"Agent for jane.doe@example.com"}],"messages":[]}`,
+			location: "request.system[0].text",
+		},
+		{
+			name:     "openai content parts",
+			body:     `{"messages":[{"role":"user","content":[{"type":"text","text":"I am jane.doe@example.com"}]}]}`,
+			location: "request.messages[0].content[0].text",
+		},
+		{
+			name:     "gemini parts",
+			body:     `{"contents":[{"role":"user","parts":[{"text":"reach jane.doe@example.com"}]}]}`,
+			location: "request.contents[0].parts[0].text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := parseBody(t, tt.body)
+			result := scanner.Scan(body)
+
+			require.Len(t, result.Findings, 1)
+			assert.Equal(t, "email", result.Findings[0].Type)
+			assert.Equal(t, "masked", result.Findings[0].Action)
+			assert.Equal(t, tt.location, result.Findings[0].Location)
+			assert.NotContains(t, result.Findings[0].Match, "jane.doe@example.com")
+			assert.True(t, result.Masked)
+
+			masked, err := json.Marshal(body)
+			require.NoError(t, err)
+			assert.NotContains(t, string(masked), "jane.doe@example.com")
+			assert.Contains(t, string(masked), "[PII_EMAIL_1]")
+
+			restored := result.Restore([]byte(`{"text":"Sure, [PII_EMAIL_1]"}`))
+			assert.Equal(t, `{"text":"Sure, jane.doe@example.com"}`, string(restored))
+		})
+	}
+}
+
+func TestPIIScanner_BuiltinDetectors(t *testing.T) {
+	scanner, err := NewPIIScanner(config.PIIConfig{Enabled: true})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "credit card", text: "card 4111 1111 1111 1111 exp 12/29", want: []string{"credit_card"}},
+		{name: "invalid luhn", text: "order 4111 1111 1111 1112", want: nil},
+		{name: "ssn", text: "ssn 123-45-6789", want: []string{"ssn"}},
+		{name: "invalid ssn", text: "ref 000-12-3456", want: nil},
+		{name: "phone", text: "call (415) 555-0132", want: []string{"phone"}},
+		{name: "several", text: "a@b.io and 415-555-0132", want: []string{"email", "phone"}},
+		{name: "clean", text: "the answer is 42", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := map[string]any{"messages": []any{map[string]any{"role": "user", "content": tt.text}}}
+			result := scanner.Scan(body)
+
+			var got []string
+			for _, f := range result.Findings {
+				got = append(got, f.Type)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPIIScanner_Policies(t *testing.T) {
+	scanner, err := NewPIIScanner(config.PIIConfig{
+		Enabled: true,
+		Rules: []config.PIIRule{
+			{Detector: "email", Policy: PolicyAllow},
+			{Name: "employee_id", Pattern: `EMP-\d{6}`, Policy: PolicyMask},
+			{Name: "codename", Dictionary: []string{"Project Falcon"}, Policy: PolicyBlock},
+		},
+	})
+	require.NoError(t, err)
+
+	t.Run("allow and mask", func(t *testing.T) {
+		body := parseBody(t, `{"messages":[{"role":"user","content":"ops@example.com owns EMP-123456 and EMP-123456"}]}`)
+		result := scanner.Scan(body)
+
+		assert.False(t, result.Blocked)
+		require.Len(t, result.Findings, 3)
+		assert.Equal(t, "allowed", result.Findings[0].Action)
+		assert.Equal(t, "masked", result.Findings[1].Action)
+
+		msg := body.(map[string]any)["messages"].([]any)[0].(map[string]any)
+		assert.Equal(t, "ops@example.com owns [PII_EMPLOYEE_ID_1] and [PII_EMPLOYEE_ID_1]", msg["content"])
+	})
+
+	t.Run("block", func(t *testing.T) {
+		body := parseBody(t, `{"contents":[{"parts":[{"text":"status of project falcon?"}]}]}`)
+		result := scanner.Scan(body)
+
+		assert.True(t, result.Blocked)
+		assert.Equal(t, "codename", result.BlockedBy)
+		assert.Equal(t, "blocked", result.Findings[0].Action)
+
+		parts := body.(map[string]any)["contents"].([]any)[0].(map[string]any)["parts"].([]any)
+		assert.Equal(t, "status of [PII_CODENAME_1]?", parts[0].(map[string]any)["text"])
+	})
+
+	t.Run("tool results", func(t *testing.T) {
+		body := parseBody(t, `{"messages":[{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"EMP-654321"}]}]}`)
+		result := scanner.Scan(body)
+		require.Len(t, result.Findings, 1)
+		assert.Equal(t, "request.messages[0].content[0].content", result.Findings[0].Location)
+	})
+}
+
+func TestNewPIIScanner_InvalidRules(t *testing.T) {
+	_, err := NewPIIScanner(config.PIIConfig{Rules: []config.PIIRule{{Detector: "passport"}}})
+	assert.Error(t, err)
+
+	_, err = NewPIIScanner(config.PIIConfig{Rules: []config.PIIRule{{Pattern: "(", Policy: PolicyMask}}})
+	assert.Error(t, err)
+
+	_, err = NewPIIScanner(config.PIIConfig{Rules: []config.PIIRule{{Detector: "email", Policy: "redact"}}})
+	assert.Error(t, err)
+}
+
+func TestRestore_NilResult(t *testing.T) {
+	var r *Result
+	assert.Equal(t, []byte("[PII_EMAIL_1]"), r.Restore([]byte("[PII_EMAIL_1]")))
+}
@@ -0,0 +1,314 @@
+package keys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix marks keys issued by mirra
+const Prefix = "mirra-sk-"
+
+var (
+	ErrUnknownKey         = errors.New("invalid API key")
+	ErrRevoked            = errors.New("API key has been revoked")
+	ErrExpired            = errors.New("API key has expired")
+	ErrProviderNotAllowed = errors.New("API key is not allowed to use this provider")
+	ErrModelNotAllowed    = errors.New("API key is not allowed to use this model")
+	ErrNotFound           = errors.New("key not found")
+)
+
+// Key is a virtual API key. Only the SHA-256 hash of the secret is stored.
+type Key struct {
+	ID        string     `json:"id"`
+	Hash      string     `json:"hash"`
+	Hint      string     `json:"hint"` // first characters of the secret, for display
+	Owner     string     `json:"owner,omitempty"`
+	Project   string     `json:"project,omitempty"`
+	Providers []string   `json:"providers,omitempty"` // empty = all providers
+	Models    []string   `json:"models,omitempty"`    // globs, empty = all models
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Status describes whether the key can currently be used
+func (k *Key) Status(now time.Time) string {
+	switch {
+	case k.RevokedAt != nil:
+		return "revoked"
+	case k.ExpiresAt != nil && now.After(*k.ExpiresAt):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+// Allows reports whether the key may call the provider and model. A key
+// restricted to models cannot call endpoints that do not name one, since
+// the restriction could not be checked.
+func (k *Key) Allows(provider, model string) error {
+	if len(k.Providers) > 0 && !contains(k.Providers, provider) {
+		return ErrProviderNotAllowed
+	}
+	if len(k.Models) > 0 {
+		for _, pattern := range k.Models {
+			if ok, _ := path.Match(pattern, model); ok {
+				return nil
+			}
+		}
+		return ErrModelNotAllowed
+	}
+	return nil
+}
+
+// CreateOptions configures a new virtual key
+type CreateOptions struct {
+	Owner     string
+	Project   string
+	Providers []string
+	Models    []string
+	ExpiresAt *time.Time
+}
+
+// IsVirtual reports whether a presented credential is a mirra-issued key
+func IsVirtual(secret string) bool {
+	return strings.HasPrefix(secret, Prefix)
+}
+
+// Redact shortens a secret to a safe hint such as "mirra-sk-3f9a…"
+func Redact(secret string) string {
+	n := len(Prefix) + 4
+	if len(secret) <= n {
+		return secret
+	}
+	return secret[:n] + "…"
+}
+
+// Fingerprint identifies an API key without revealing it: the first 16 hex
+// digits of its SHA-256 hash
+func Fingerprint(secret string) string {
+	return hash(secret)[:16]
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// storeFile is the on-disk format of the key store
+type storeFile struct {
+	Keys []*Key `json:"keys"`
+}
+
+// Store holds virtual keys in a JSON file. The file is re-read when it
+// changes, so keys created or revoked with the CLI apply to a running proxy.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	keys    []*Key
+	byHash  map[string]*Key
+	modTime time.Time
+	size    int64
+}
+
+// NewStore creates a store backed by the file at path. A missing file is an
+// empty store.
+func NewStore(path string) *Store {
+	return &Store{
+		path:   path,
+		byHash: make(map[string]*Key),
+	}
+}
+
+// reload re-reads the file if it changed since the last read.
+// Caller must hold s.mu.
+func (s *Store) reload() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.keys = nil
+		s.byHash = make(map[string]*Key)
+		s.modTime = time.Time{}
+		s.size = 0
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat key store: %w", err)
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read key store: %w", err)
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse key store: %w", err)
+	}
+
+	s.keys = file.Keys
+	s.byHash = make(map[string]*Key, len(file.Keys))
+	for _, k := range file.Keys {
+		s.byHash[k.Hash] = k
+	}
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
+
+// save writes the store atomically. Caller must hold s.mu.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(storeFile{Keys: s.keys}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode key store: %w", err)
+	}
+
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create key store directory: %w", err)
+		}
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write key store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace key store: %w", err)
+	}
+
+	// Force the next reload to pick up our own write
+	s.modTime = time.Time{}
+	return nil
+}
+
+// Create issues a new key and returns its secret. The secret is not stored
+// and cannot be shown again.
+func (s *Store) Create(opts CreateOptions) (string, *Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return "", nil, err
+	}
+
+	random := make([]byte, 24)
+	if _, err := rand.Read(random); err != nil {
+		return "", nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	secret := Prefix + hex.EncodeToString(random)
+
+	// The ID is shown and recorded, so it shares no bytes with the secret
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("failed to generate key ID: %w", err)
+	}
+
+	key := &Key{
+		ID:        "vk_" + hex.EncodeToString(id),
+		Hash:      hash(secret),
+		Hint:      Redact(secret),
+		Owner:     opts.Owner,
+		Project:   opts.Project,
+		Providers: opts.Providers,
+		Models:    opts.Models,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: opts.ExpiresAt,
+	}
+
+	s.keys = append(s.keys, key)
+	if err := s.save(); err != nil {
+		return "", nil, err
+	}
+
+	return secret, key, nil
+}
+
+// List returns all keys, including revoked and expired ones
+func (s *Store) List() ([]Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	list := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, *k)
+	}
+	return list, nil
+}
+
+// Revoke marks a key as revoked. The key stays in the store so recordings
+// attributed to it remain identifiable.
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	for _, k := range s.keys {
+		if k.ID == id {
+			if k.RevokedAt == nil {
+				now := time.Now().UTC()
+				k.RevokedAt = &now
+			}
+			return s.save()
+		}
+	}
+	return ErrNotFound
+}
+
+// Authenticate looks up a presented secret and checks that it is usable
+// for the provider and model
+func (s *Store) Authenticate(secret, provider, model string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	k, ok := s.byHash[hash(secret)]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	switch k.Status(time.Now()) {
+	case "revoked":
+		return nil, ErrRevoked
+	case "expired":
+		return nil, ErrExpired
+	}
+
+	if err := k.Allows(provider, model); err != nil {
+		return nil, err
+	}
+
+	key := *k
+	return &key, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
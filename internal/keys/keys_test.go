@@ -0,0 +1,112 @@
+package keys
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore_CreateAndAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	store := NewStore(path)
+
+	secret, key, err := store.Create(CreateOptions{
+		Owner:     "alice",
+		Project:   "search",
+		Providers: []string{"claude"},
+		Models:    []string{"claude-sonnet-*"},
+	})
+	require.NoError(t, err)
+	assert.True(t, IsVirtual(secret))
+	assert.Equal(t, Redact(secret), key.Hint)
+	assert.NotContains(t, secret, strings.TrimPrefix(key.ID, "vk_"))
+
+	// Only the hash is persisted
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), secret)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	tests := []struct {
+		name     string
+		secret   string
+		provider string
+		model    string
+		wantErr  error
+	}{
+		{name: "allowed", secret: secret, provider: "claude", model: "claude-sonnet-4"},
+		{name: "no model", secret: secret, provider: "claude", wantErr: ErrModelNotAllowed},
+		{name: "unknown key", secret: Prefix + "nope", provider: "claude", wantErr: ErrUnknownKey},
+		{name: "provider not allowed", secret: secret, provider: "openai", model: "gpt-4o", wantErr: ErrProviderNotAllowed},
+		{name: "model not allowed", secret: secret, provider: "claude", model: "claude-opus-4", wantErr: ErrModelNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.Authenticate(tt.secret, tt.provider, tt.model)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, got.ID)
+			assert.Equal(t, "alice", got.Owner)
+		})
+	}
+}
+
+func TestStore_RevokeAndExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	server := NewStore(path)
+
+	past := time.Now().Add(-time.Hour)
+	expired, _, err := server.Create(CreateOptions{ExpiresAt: &past})
+	require.NoError(t, err)
+	_, err = server.Authenticate(expired, "openai", "")
+	assert.ErrorIs(t, err, ErrExpired)
+
+	secret, key, err := server.Create(CreateOptions{})
+	require.NoError(t, err)
+	_, err = server.Authenticate(secret, "openai", "")
+	require.NoError(t, err)
+
+	// A second store, like the CLI, revokes the key; the first picks it up
+	cli := NewStore(path)
+	require.NoError(t, cli.Revoke(key.ID))
+	assert.ErrorIs(t, cli.Revoke("vk_missing"), ErrNotFound)
+
+	_, err = server.Authenticate(secret, "openai", "")
+	assert.ErrorIs(t, err, ErrRevoked)
+
+	list, err := server.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "revoked", list[1].Status(time.Now()))
+}
+
+func TestStore_MissingFile(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "missing.json"))
+
+	list, err := store.List()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	_, err = store.Authenticate(Prefix+"abc", "claude", "")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+}
+
+func TestFingerprint(t *testing.T) {
+	fp := Fingerprint("sk-ant-secret")
+	assert.Len(t, fp, 16)
+	assert.Equal(t, fp, Fingerprint("sk-ant-secret"))
+	assert.NotEqual(t, fp, Fingerprint("sk-ant-other"))
+	assert.NotContains(t, fp, "secret")
+}
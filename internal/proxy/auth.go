@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jpoz/mirra/internal/keys"
+)
+
+// Headers that carry API keys, in the order providers use them
+var keyHeaders = []string{"X-Api-Key", "Authorization", "X-Goog-Api-Key"}
+
+// virtualKeyFrom returns the mirra-issued key presented by the client, if any.
+// Claude uses x-api-key, OpenAI uses Authorization: Bearer and Gemini uses
+// x-goog-api-key or the ?key= query parameter.
+func virtualKeyFrom(r *http.Request) string {
+	for _, name := range keyHeaders {
+		value := strings.TrimSpace(r.Header.Get(name))
+		if name == "Authorization" {
+			value = strings.TrimSpace(strings.TrimPrefix(value, "Bearer "))
+		}
+		if keys.IsVirtual(value) {
+			return value
+		}
+	}
+	if value := r.URL.Query().Get("key"); keys.IsVirtual(value) {
+		return value
+	}
+	return ""
+}
+
+// replaceKey returns copies of the headers and raw query with every
+// occurrence of the virtual key replaced, keeping the location the client
+// used
+func replaceKey(header http.Header, rawQuery, virtual, replacement string) (http.Header, string) {
+	out := header.Clone()
+	for _, name := range keyHeaders {
+		values := out[name]
+		for i, v := range values {
+			values[i] = strings.ReplaceAll(v, virtual, replacement)
+		}
+	}
+
+	if rawQuery != "" {
+		query, err := url.ParseQuery(rawQuery)
+		if err == nil && query.Get("key") == virtual {
+			query.Set("key", replacement)
+			rawQuery = query.Encode()
+		}
+	}
+
+	return out, rawQuery
+}
+
+// virtualKeyStatus maps key store errors to HTTP statuses
+func virtualKeyStatus(err error) int {
+	switch {
+	case errors.Is(err, keys.ErrProviderNotAllowed), errors.Is(err, keys.ErrModelNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, keys.ErrUnknownKey), errors.Is(err, keys.ErrRevoked), errors.Is(err, keys.ErrExpired):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
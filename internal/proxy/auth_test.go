@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/keys"
+	"github.com/jpoz/mirra/internal/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVirtualKeyFrom(t *testing.T) {
+	secret := keys.Prefix + "abc123"
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		target string
+	}{
+		{name: "x-api-key", header: "x-api-key", value: secret, target: "/v1/messages"},
+		{name: "bearer", header: "Authorization", value: "Bearer " + secret, target: "/v1/chat/completions"},
+		{name: "goog header", header: "x-goog-api-key", value: secret, target: "/v1beta/models/gemini-pro:generateContent"},
+		{name: "query", target: "/v1beta/models/gemini-pro:generateContent?key=" + secret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			assert.Equal(t, secret, virtualKeyFrom(r))
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	r.Header.Set("x-api-key", "sk-ant-real")
+	assert.Empty(t, virtualKeyFrom(r))
+}
+
+func TestHandle_VirtualKeySubstitution(t *testing.T) {
+	var upstreamHeader http.Header
+	var upstreamQuery string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeader = r.Header.Clone()
+		upstreamQuery = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	store := keys.NewStore(filepath.Join(dir, "keys.json"))
+	secret, key, err := store.Create(keys.CreateOptions{Owner: "alice", Project: "search", Providers: []string{"claude", "gemini"}})
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		Keys: config.KeysConfig{Path: filepath.Join(dir, "keys.json")},
+		Providers: map[string]config.Provider{
+			"claude": {UpstreamURL: upstream.URL, APIKey: "sk-ant-real"},
+			"gemini": {UpstreamURL: upstream.URL, APIKey: "AIza-real"},
+			"openai": {UpstreamURL: upstream.URL, APIKey: "sk-real"},
+		},
+	}
+	rec := recorder.New(true, filepath.Join(dir, "recordings"))
+	p := New(cfg, rec)
+
+	t.Run("header", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+		r.Header.Set("x-api-key", secret)
+		w := httptest.NewRecorder()
+		p.Handle(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "sk-ant-real", upstreamHeader.Get("x-api-key"))
+	})
+
+	t.Run("query", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/v1beta/models/gemini-pro:generateContent?alt=sse&key="+secret, strings.NewReader(`{}`))
+		w := httptest.NewRecorder()
+		p.Handle(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, upstreamQuery, "key=AIza-real")
+		assert.NotContains(t, upstreamQuery, secret)
+	})
+
+	t.Run("provider not allowed", func(t *testing.T) {
+		upstreamHeader = nil
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+		r.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		p.Handle(w, r)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Nil(t, upstreamHeader)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{}`))
+		r.Header.Set("x-api-key", keys.Prefix+"unknown")
+		w := httptest.NewRecorder()
+		p.Handle(w, r)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "authentication_error")
+	})
+
+	require.NoError(t, rec.Close())
+
+	// Recordings are attributed to the key and never contain a secret
+	files, err := filepath.Glob(filepath.Join(dir, "recordings", "recordings-*.jsonl"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	assert.NotContains(t, string(data), secret)
+	assert.NotContains(t, string(data), "sk-ant-real")
+	assert.NotContains(t, string(data), "AIza-real")
+
+	first := strings.SplitN(string(data), "\n", 2)[0]
+	var recording recorder.Recording
+	require.NoError(t, json.Unmarshal([]byte(first), &recording))
+	require.NotNil(t, recording.VirtualKey)
+	assert.Equal(t, key.ID, recording.VirtualKey.ID)
+	assert.Equal(t, "alice", recording.VirtualKey.Owner)
+	assert.Equal(t, []string{keys.Redact(secret)}, recording.Request.Headers["X-Api-Key"])
+}
+
+func TestHandle_VirtualKeyRequired(t *testing.T) {
+	cfg := &config.Config{
+		Keys:      config.KeysConfig{Path: filepath.Join(t.TempDir(), "keys.json"), Required: true},
+		Providers: map[string]config.Provider{"openai": {UpstreamURL: "http://127.0.0.1:0"}},
+	}
+	p := New(cfg, recorder.New(false, t.TempDir()))
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`))
+	r.Header.Set("Authorization", "Bearer sk-real")
+	w := httptest.NewRecorder()
+	p.Handle(w, r)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Content types that are always stored as blobs, even when they happen to
+// be valid UTF-8
+var binaryContentTypes = []string{"audio/", "image/", "video/", "application/octet-stream", "application/pdf", "application/zip"}
+
+// isBinary reports whether a body should be recorded as a blob
+func isBinary(contentType string, data []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, prefix := range binaryContentTypes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return !utf8.Valid(data)
+}
+
+// captureBody converts a request or response body for recording: JSON is
+// parsed, binary content becomes a blob and anything else is kept as text
+func captureBody(contentType string, data []byte) (any, *recorder.Blob) {
+	if jsonBody, err := recorder.ParseJSON(data); err == nil {
+		return jsonBody, nil
+	}
+	if isBinary(contentType, data) {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		return nil, recorder.NewBlob(mediaType, data)
+	}
+	return string(data), nil
+}
+
+// captureEncodedBody decodes a body sent with a Content-Encoding before
+// capturing it. The returned encoding is recorded alongside the body; if
+// decoding fails the bytes are kept as sent in an octet-stream blob.
+func captureEncodedBody(contentType, encoding string, data []byte) (any, *recorder.Blob, string) {
+	if encoding == "" || strings.EqualFold(encoding, "identity") {
+		body, blob := captureBody(contentType, data)
+		return body, blob, ""
+	}
+
+	decoded, err := recorder.DecodeContent(encoding, data)
+	if err != nil {
+		slog.Warn("failed to decode body, recording it as sent", "encoding", encoding, "error", err)
+		return nil, recorder.NewBlob("application/octet-stream", data), encoding
+	}
+	body, blob := captureBody(contentType, decoded)
+	return body, blob, encoding
+}
+
+// rawBlob keeps the exact bytes a body was captured from, unless the
+// captured blob already holds them
+func rawBlob(contentType string, data []byte, captured *recorder.Blob) *recorder.Blob {
+	raw := recorder.NewBlob(contentType, data)
+	if captured != nil && captured.SHA256 == raw.SHA256 {
+		return nil
+	}
+	return raw
+}
+
+// parseMultipart splits a multipart/form-data body into parts. It returns
+// an error if the body is not multipart.
+func parseMultipart(contentType string, data []byte) ([]recorder.MultipartPart, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return nil, errors.New("not a multipart body")
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(data), params["boundary"])
+	var parts []recorder.MultipartPart
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+
+		mp := recorder.MultipartPart{
+			Name:        part.FormName(),
+			Filename:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+		}
+		if mp.Filename != "" || isBinary(mp.ContentType, content) {
+			blobType := mp.ContentType
+			if blobType == "" {
+				blobType = mime.TypeByExtension(filepath.Ext(mp.Filename))
+			}
+			mp.Blob = recorder.NewBlob(blobType, content)
+		} else {
+			mp.Value = string(content)
+		}
+		parts = append(parts, mp)
+	}
+
+	return parts, nil
+}
+
+// encodeMultipart writes parts back into a multipart body with the boundary
+// of contentType, so a masked upload keeps the client's Content-Type
+func encodeMultipart(contentType string, parts []recorder.MultipartPart) ([]byte, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.SetBoundary(params["boundary"]); err != nil {
+		return nil, err
+	}
+	for _, p := range parts {
+		header := make(textproto.MIMEHeader)
+		disposition := map[string]string{"name": p.Name}
+		if p.Filename != "" {
+			disposition["filename"] = p.Filename
+		}
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", disposition))
+		if p.ContentType != "" {
+			header.Set("Content-Type", p.ContentType)
+		}
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+
+		content := []byte(p.Value)
+		if p.Blob != nil {
+			if content, err = p.Blob.Bytes(); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// multipartFields returns the text fields of a multipart body, so helpers
+// that read JSON bodies (such as requestModel) also work for uploads
+func multipartFields(parts []recorder.MultipartPart) map[string]any {
+	fields := make(map[string]any)
+	for _, p := range parts {
+		if p.Blob == nil {
+			fields[p.Name] = p.Value
+		}
+	}
+	return fields
+}
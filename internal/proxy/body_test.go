@@ -0,0 +1,255 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/recorder"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func multipartBody(t *testing.T) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	require.NoError(t, mw.WriteField("model", "whisper-1"))
+	fw, err := mw.CreateFormFile("file", "speech.mp3")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte{0xff, 0xfb, 0x90, 0x00})
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+	return mw.FormDataContentType(), buf.Bytes()
+}
+
+func TestParseMultipart(t *testing.T) {
+	contentType, body := multipartBody(t)
+
+	parts, err := parseMultipart(contentType, body)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+
+	assert.Equal(t, "model", parts[0].Name)
+	assert.Equal(t, "whisper-1", parts[0].Value)
+	assert.Nil(t, parts[0].Blob)
+
+	assert.Equal(t, "file", parts[1].Name)
+	assert.Equal(t, "speech.mp3", parts[1].Filename)
+	require.NotNil(t, parts[1].Blob)
+	assert.Equal(t, int64(4), parts[1].Blob.Size)
+	data, err := parts[1].Blob.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xff, 0xfb, 0x90, 0x00}, data)
+
+	assert.Equal(t, map[string]any{"model": "whisper-1"}, multipartFields(parts))
+
+	_, err = parseMultipart("application/json", []byte(`{}`))
+	assert.Error(t, err)
+}
+
+func TestCaptureBody(t *testing.T) {
+	// Numbers keep their exact text, so large integers survive re-encoding
+	body, blob := captureBody("application/json", []byte(`{"a":1,"id":12345678901234567890}`))
+	assert.Equal(t, map[string]any{"a": json.Number("1"), "id": json.Number("12345678901234567890")}, body)
+	assert.Nil(t, blob)
+	encoded, err := json.Marshal(body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1,"id":12345678901234567890}`, string(encoded))
+
+	body, blob = captureBody("text/plain", []byte("hello"))
+	assert.Equal(t, "hello", body)
+	assert.Nil(t, blob)
+
+	body, blob = captureBody("audio/mpeg", []byte("ID3"))
+	assert.Nil(t, body)
+	require.NotNil(t, blob)
+	assert.Equal(t, "audio/mpeg", blob.ContentType)
+
+	body, blob = captureBody("", []byte{0x89, 'P', 'N', 'G', 0xff})
+	assert.Nil(t, body)
+	assert.NotNil(t, blob)
+}
+
+func TestIdentifyRequestProvider(t *testing.T) {
+	p := New(&config.Config{}, nil)
+
+	tests := []struct {
+		name     string
+		target   string
+		headers  map[string]string
+		expected string
+	}{
+		{name: "openai files bearer", target: "/v1/files", headers: map[string]string{"Authorization": "Bearer sk-test"}, expected: "openai"},
+		{name: "openai upload multipart", target: "/v1/files", headers: map[string]string{"Content-Type": "multipart/form-data; boundary=x"}, expected: "openai"},
+		{name: "openai batches", target: "/v1/batches/batch_1", headers: map[string]string{"OpenAI-Project": "proj"}, expected: "openai"},
+		{name: "gemini files header", target: "/v1/files", headers: map[string]string{"x-goog-api-key": "AIza"}, expected: "gemini"},
+		{name: "gemini files query", target: "/v1/files?key=AIza", expected: "gemini"},
+		{name: "claude files", target: "/v1/files", headers: map[string]string{"x-api-key": "sk-ant", "anthropic-version": "2023-06-01"}, expected: "claude"},
+		{name: "no signals keeps path default", target: "/v1/files", expected: "gemini"},
+		{name: "unshared path ignores headers", target: "/v1beta/files", headers: map[string]string{"Authorization": "Bearer x"}, expected: "gemini"},
+		{name: "vector store files", target: "/v1/vector_stores/vs_1/files", expected: "openai"},
+		{name: "audio speech", target: "/v1/audio/speech", expected: "openai"},
+		{name: "images", target: "/v1/images/generations", expected: "openai"},
+		{name: "threads", target: "/v1/threads/thread_1/messages", expected: "openai"},
+		{name: "moderations", target: "/v1/moderations", expected: "openai"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.expected, p.identifyRequestProvider(r))
+		})
+	}
+}
+
+func TestHandle_RecordsMultipartAndBinary(t *testing.T) {
+	var upstreamBody []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamBody, _ = io.ReadAll(r.Body)
+		if r.URL.Path == "/v1/audio/speech" {
+			w.Header().Set("Content-Type", "audio/mpeg")
+			_, _ = w.Write([]byte{0xff, 0xf3, 0x44, 0xc4})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"text":"hello"}`))
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	rec := recorder.New(true, dir)
+	cfg := &config.Config{Providers: map[string]config.Provider{"openai": {UpstreamURL: upstream.URL}}}
+	p := New(cfg, rec)
+
+	contentType, body := multipartBody(t)
+	r := httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", bytes.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	p.Handle(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, body, upstreamBody, "multipart body must be forwarded unchanged")
+
+	r = httptest.NewRequest(http.MethodPost, "/v1/audio/speech", strings.NewReader(`{"model":"tts-1","input":"hi"}`))
+	w = httptest.NewRecorder()
+	p.Handle(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []byte{0xff, 0xf3, 0x44, 0xc4}, w.Body.Bytes())
+
+	require.NoError(t, rec.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "recordings-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	recordings := readRecordings(t, files[0])
+	require.Len(t, recordings, 2)
+
+	transcription := recordings[0]
+	assert.Nil(t, transcription.Request.Body)
+	require.Len(t, transcription.Request.Multipart, 2)
+	assert.Equal(t, "speech.mp3", transcription.Request.Multipart[1].Filename)
+
+	speech := recordings[1]
+	assert.Nil(t, speech.Response.Body)
+	require.NotNil(t, speech.Response.Blob)
+	assert.Equal(t, "audio/mpeg", speech.Response.Blob.ContentType)
+	assert.Nil(t, speech.Response.Raw, "the response blob already holds the raw bytes")
+	require.NotNil(t, speech.Request.Raw)
+	assert.Equal(t, []recorder.BlobRef{
+		{Ref: "request.raw", Blob: speech.Request.Raw},
+		{Ref: "response", Blob: speech.Response.Blob},
+	}, speech.Blobs())
+}
+
+func TestHandle_RecordsDecodedBody(t *testing.T) {
+	payload := []byte(`{"id":"msg_1","content":[{"type":"text","text":"hello"}]}`)
+	encoded := map[string][]byte{}
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		var buf bytes.Buffer
+		var zw io.WriteCloser
+		switch encoding {
+		case "gzip":
+			zw = gzip.NewWriter(&buf)
+		case "br":
+			zw = brotli.NewWriter(&buf)
+		case "zstd":
+			enc, err := zstd.NewWriter(&buf)
+			require.NoError(t, err)
+			zw = enc
+		}
+		_, err := zw.Write(payload)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		encoded[encoding] = buf.Bytes()
+	}
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", encoding)
+		_, _ = w.Write(encoded[encoding])
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	rec := recorder.New(true, dir)
+	cfg := &config.Config{Providers: map[string]config.Provider{"claude": {UpstreamURL: upstream.URL}}}
+	p := New(cfg, rec)
+
+	encodings := []string{"gzip", "br", "zstd"}
+	for _, encoding := range encodings {
+		r := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4"}`))
+		r.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		p.Handle(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, encoded[encoding], w.Body.Bytes(), "client must receive the bytes as sent")
+	}
+	require.NoError(t, rec.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "recordings-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	recordings := readRecordings(t, files[0])
+	require.Len(t, recordings, len(encodings))
+
+	for i, encoding := range encodings {
+		got := recordings[i].Response
+		assert.Equal(t, encoding, got.Encoding)
+		assert.Nil(t, got.Blob)
+		require.NotNil(t, got.Raw)
+		assert.Equal(t, int64(len(encoded[encoding])), got.Raw.Size)
+		assert.Empty(t, recorder.NewBlobStore(dir).Verify(&recordings[i]))
+		body, err := json.Marshal(got.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(payload), string(body))
+	}
+}
+
+func readRecordings(t *testing.T, path string) []recorder.Recording {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var recordings []recorder.Recording
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var rec recorder.Recording
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		recordings = append(recordings, rec)
+	}
+	return recordings
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// providerErrorBody builds an error body shaped like the given provider's
+// own error responses so SDK error handling and retry logic behave as they
+// would against the real API.
+func providerErrorBody(provider string, status int, message string) []byte {
+	if message == "" {
+		message = defaultErrorMessage(provider, status)
+	}
+
+	var body any
+	switch provider {
+	case "claude":
+		body = map[string]any{
+			"type": "error",
+			"error": map[string]any{
+				"type":    claudeErrorType(status),
+				"message": message,
+			},
+		}
+	case "gemini":
+		body = map[string]any{
+			"error": map[string]any{
+				"code":    status,
+				"message": message,
+				"status":  geminiErrorStatus(status),
+			},
+		}
+	default:
+		// OpenAI shape, also used for unknown providers
+		var code any
+		if status == http.StatusTooManyRequests {
+			code = "rate_limit_exceeded"
+		}
+		body = map[string]any{
+			"error": map[string]any{
+				"message": message,
+				"type":    openaiErrorType(status),
+				"param":   nil,
+				"code":    code,
+			},
+		}
+	}
+
+	data, _ := json.Marshal(body)
+	return data
+}
+
+// writeProviderError writes a provider-shaped JSON error response
+func writeProviderError(w http.ResponseWriter, provider string, status int, message string) []byte {
+	body := providerErrorBody(provider, status, message)
+	w.Header().Set("Content-Type", "application/json")
+	if status == http.StatusTooManyRequests || status == 529 || status == http.StatusServiceUnavailable {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+	return body
+}
+
+// writeRecordedError writes a provider-shaped error for a request the proxy
+// rejects itself and records it as the response
+func writeRecordedError(w http.ResponseWriter, rec *recorder.Recording, provider string, status int, message string) {
+	body := writeProviderError(w, provider, status, message)
+	rec.Response.Status = status
+	rec.Response.Headers = w.Header().Clone()
+	rec.ResponseSize = int64(len(body))
+
+	var jsonBody any
+	if err := json.Unmarshal(body, &jsonBody); err == nil {
+		rec.Response.Body = jsonBody
+	}
+}
+
+func defaultErrorMessage(provider string, status int) string {
+	switch status {
+	case http.StatusTooManyRequests:
+		if provider == "gemini" {
+			return "Resource has been exhausted (e.g. check quota)."
+		}
+		return "Rate limit exceeded. Please retry after a short wait."
+	case 529:
+		return "Overloaded"
+	case http.StatusServiceUnavailable:
+		return "The service is currently unavailable."
+	case http.StatusInternalServerError:
+		if provider == "openai" {
+			return "The server had an error while processing your request. Sorry about that!"
+		}
+		return "Internal server error"
+	}
+	return fmt.Sprintf("%d %s", status, http.StatusText(status))
+}
+
+func claudeErrorType(status int) string {
+	switch {
+	case status == http.StatusBadRequest:
+		return "invalid_request_error"
+	case status == http.StatusUnauthorized:
+		return "authentication_error"
+	case status == http.StatusForbidden:
+		return "permission_error"
+	case status == http.StatusNotFound:
+		return "not_found_error"
+	case status == http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status == 529:
+		return "overloaded_error"
+	default:
+		return "api_error"
+	}
+}
+
+func openaiErrorType(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "requests"
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "invalid_request_error"
+	case status >= 500:
+		return "server_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+func geminiErrorStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable, 529:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	default:
+		return "INTERNAL"
+	}
+}
@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// faultHeader lets a client request a fault by rule name or inline spec
+// (e.g. "error:429", "cut_stream:3"). It is never forwarded upstream.
+const faultHeader = "X-Mirra-Fault"
+
+const (
+	faultLatency      = "latency"
+	faultError        = "error"
+	faultCutStream    = "cut_stream"
+	faultStallStream  = "stall_stream"
+	faultMalformedSSE = "malformed_sse"
+)
+
+// malformedSSELine is injected by the malformed_sse fault. It looks like the
+// start of a data event but the JSON payload is truncated.
+const malformedSSELine = `data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"`
+
+// selectFault picks the fault to inject into a request, if any.
+// An X-Mirra-Fault header naming a rule (or carrying an inline spec) wins
+// over the configured matchers and ignores the rule's probability.
+func (p *Proxy) selectFault(r *http.Request, provider, model string) *config.FaultRule {
+	if !p.cfg.Chaos.Enabled {
+		return nil
+	}
+
+	if requested := r.Header.Get(faultHeader); requested != "" {
+		for _, rule := range p.cfg.Chaos.Rules {
+			if rule.Name == requested {
+				return &rule
+			}
+		}
+		if rule, ok := parseFaultSpec(requested); ok {
+			return &rule
+		}
+	}
+
+	for _, rule := range p.cfg.Chaos.Rules {
+		if !faultMatches(rule, r, provider, model) {
+			continue
+		}
+		if rule.Probability > 0 && rule.Probability < 1 && rand.Float64() >= rule.Probability {
+			continue
+		}
+		return &rule
+	}
+
+	return nil
+}
+
+// faultMatches checks the rule's provider, path, model and header matchers
+func faultMatches(rule config.FaultRule, r *http.Request, provider, model string) bool {
+	if rule.Provider != "" && !strings.EqualFold(rule.Provider, provider) {
+		return false
+	}
+	if rule.Path != "" && !globMatch(rule.Path, r.URL.Path) {
+		return false
+	}
+	if rule.Model != "" && !globMatch(rule.Model, model) {
+		return false
+	}
+	for key, want := range rule.Headers {
+		if !globMatch(want, r.Header.Get(key)) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseFaultSpec parses an inline fault spec of the form "type[:arg]".
+// The argument is the status for errors, milliseconds for latency, and the
+// number of events sent before stream faults trigger.
+func parseFaultSpec(spec string) (config.FaultRule, bool) {
+	faultType, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	n, err := strconv.Atoi(arg)
+	if arg != "" && err != nil {
+		return config.FaultRule{}, false
+	}
+
+	rule := config.FaultRule{Name: spec, Type: faultType}
+	switch faultType {
+	case faultLatency:
+		rule.LatencyMs = n
+	case faultError:
+		rule.Status = n
+	case faultCutStream, faultStallStream, faultMalformedSSE:
+		rule.AfterEvents = n
+	default:
+		return config.FaultRule{}, false
+	}
+	return rule, true
+}
+
+// globMatch matches s against a pattern where "*" matches any run of
+// characters (including "/") and "?" matches a single character
+func globMatch(pattern, s string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern == s
+	}
+
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = strings.ReplaceAll(regexp.QuoteMeta(part), `\?`, ".")
+	}
+
+	matched, err := regexp.MatchString("^"+strings.Join(parts, ".*")+"$", s)
+	return err == nil && matched
+}
+
+// faultData converts a rule into the data stored on the recording
+func faultData(rule *config.FaultRule) *recorder.FaultData {
+	return &recorder.FaultData{
+		Rule:        rule.Name,
+		Type:        rule.Type,
+		Status:      rule.Status,
+		LatencyMs:   rule.LatencyMs,
+		AfterEvents: rule.AfterEvents,
+	}
+}
+
+// injectLatency sleeps for the rule's latency, returning early if the client
+// goes away
+func injectLatency(ctx context.Context, rule *config.FaultRule) {
+	if rule.LatencyMs <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(time.Duration(rule.LatencyMs) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// isStreamFault reports whether the rule only applies to streaming responses
+func isStreamFault(rule *config.FaultRule) bool {
+	switch rule.Type {
+	case faultCutStream, faultStallStream, faultMalformedSSE:
+		return true
+	}
+	return false
+}
+
+// applyStreamFault injects a stream fault once the configured number of
+// events has been sent. It returns true when the stream should end.
+func applyStreamFault(ctx context.Context, w http.ResponseWriter, flusher http.Flusher, rule *config.FaultRule, rec *recorder.Recording, accumulated *bytes.Buffer) bool {
+	rec.Fault = faultData(rule)
+	slog.Warn("injecting stream fault", "id", rec.ID[:8], "fault", rule.Type, "after_events", rule.AfterEvents)
+
+	switch rule.Type {
+	case faultCutStream:
+		return true
+	case faultStallStream:
+		var timeout <-chan time.Time
+		if rule.StallMs > 0 {
+			timer := time.NewTimer(time.Duration(rule.StallMs) * time.Millisecond)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-timeout:
+		case <-ctx.Done():
+		}
+		return true
+	case faultMalformedSSE:
+		line := malformedSSELine + "\n\n"
+		accumulated.WriteString(line)
+		_, _ = w.Write([]byte(line))
+		flusher.Flush()
+	}
+
+	return false
+}
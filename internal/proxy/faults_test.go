@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{pattern: "*", s: "/v1/messages", want: true},
+		{pattern: "/v1/messages", s: "/v1/messages", want: true},
+		{pattern: "/v1/messages", s: "/v1/messages/batches", want: false},
+		{pattern: "/v1/*", s: "/v1/chat/completions", want: true},
+		{pattern: "*:streamGenerateContent", s: "/v1beta/models/gemini-pro:streamGenerateContent", want: true},
+		{pattern: "claude-*-sonnet*", s: "claude-3-5-sonnet-20241022", want: true},
+		{pattern: "gpt-4?", s: "gpt-4o", want: true},
+		{pattern: "gpt-4?", s: "gpt-4o-mini", want: false},
+		{pattern: "/v1/*", s: "/v2/messages", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"_"+tt.s, func(t *testing.T) {
+			assert.Equal(t, tt.want, globMatch(tt.pattern, tt.s))
+		})
+	}
+}
+
+func TestParseFaultSpec(t *testing.T) {
+	tests := []struct {
+		spec   string
+		ok     bool
+		expect config.FaultRule
+	}{
+		{spec: "error:429", ok: true, expect: config.FaultRule{Name: "error:429", Type: "error", Status: 429}},
+		{spec: "latency:1500", ok: true, expect: config.FaultRule{Name: "latency:1500", Type: "latency", LatencyMs: 1500}},
+		{spec: "cut_stream:3", ok: true, expect: config.FaultRule{Name: "cut_stream:3", Type: "cut_stream", AfterEvents: 3}},
+		{spec: "malformed_sse", ok: true, expect: config.FaultRule{Name: "malformed_sse", Type: "malformed_sse"}},
+		{spec: "error:abc", ok: false},
+		{spec: "explode", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			rule, ok := parseFaultSpec(tt.spec)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.expect, rule)
+			}
+		})
+	}
+}
+
+func TestSelectFault(t *testing.T) {
+	cfg := &config.Config{
+		Chaos: config.ChaosConfig{
+			Enabled: true,
+			Rules: []config.FaultRule{
+				{Name: "slow-gemini", Provider: "gemini", Type: "latency", LatencyMs: 10},
+				{Name: "opus-overloaded", Model: "claude-opus-*", Type: "error", Status: 529},
+				{Name: "tagged", Headers: map[string]string{"X-Test-Run": "chaos-*"}, Type: "cut_stream", AfterEvents: 2},
+			},
+		},
+	}
+	p := New(cfg, nil)
+
+	tests := []struct {
+		name     string
+		provider string
+		model    string
+		headers  map[string]string
+		want     string
+	}{
+		{name: "provider match", provider: "gemini", want: "slow-gemini"},
+		{name: "model match", provider: "claude", model: "claude-opus-4", want: "opus-overloaded"},
+		{name: "header match", provider: "openai", headers: map[string]string{"X-Test-Run": "chaos-42"}, want: "tagged"},
+		{name: "no match", provider: "openai", model: "gpt-4o", want: ""},
+		{name: "explicit rule by name", provider: "openai", headers: map[string]string{"X-Mirra-Fault": "opus-overloaded"}, want: "opus-overloaded"},
+		{name: "explicit inline spec", provider: "openai", headers: map[string]string{"X-Mirra-Fault": "error:429"}, want: "error:429"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			rule := p.selectFault(r, tt.provider, tt.model)
+			if tt.want == "" {
+				assert.Nil(t, rule)
+				return
+			}
+			require.NotNil(t, rule)
+			assert.Equal(t, tt.want, rule.Name)
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		p := New(&config.Config{Chaos: config.ChaosConfig{Rules: cfg.Chaos.Rules}}, nil)
+		r := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		r.Header.Set("X-Mirra-Fault", "error:429")
+		assert.Nil(t, p.selectFault(r, "claude", ""))
+	})
+}
+
+func TestProviderErrorBody(t *testing.T) {
+	var claude map[string]any
+	require.NoError(t, json.Unmarshal(providerErrorBody("claude", 529, ""), &claude))
+	assert.Equal(t, "error", claude["type"])
+	assert.Equal(t, "overloaded_error", claude["error"].(map[string]any)["type"])
+
+	var openai map[string]any
+	require.NoError(t, json.Unmarshal(providerErrorBody("openai", 429, ""), &openai))
+	assert.Equal(t, "rate_limit_exceeded", openai["error"].(map[string]any)["code"])
+
+	var gemini map[string]any
+	require.NoError(t, json.Unmarshal(providerErrorBody("gemini", 429, ""), &gemini))
+	assert.Equal(t, "RESOURCE_EXHAUSTED", gemini["error"].(map[string]any)["status"])
+	assert.Equal(t, float64(429), gemini["error"].(map[string]any)["code"])
+}
+
+func TestRequestModel(t *testing.T) {
+	assert.Equal(t, "claude-sonnet-4", requestModel("claude", "/v1/messages", map[string]any{"model": "claude-sonnet-4"}))
+	assert.Equal(t, "gemini-2.5-pro", requestModel("gemini", "/v1beta/models/gemini-2.5-pro:generateContent", nil))
+	assert.Equal(t, "", requestModel("openai", "/v1/models", nil))
+}
+
+func TestHandleStreaming_Faults(t *testing.T) {
+	stream := strings.Repeat("event: ping\ndata: {\"type\":\"ping\"}\n\n", 5)
+
+	tests := []struct {
+		name       string
+		rule       *config.FaultRule
+		wantEvents int
+		wantExtra  string
+	}{
+		{name: "no fault", rule: nil, wantEvents: 5},
+		{name: "cut after 2", rule: &config.FaultRule{Type: "cut_stream", AfterEvents: 2}, wantEvents: 2},
+		{name: "cut immediately", rule: &config.FaultRule{Type: "cut_stream"}, wantEvents: 0},
+		{name: "stall after 1", rule: &config.FaultRule{Type: "stall_stream", AfterEvents: 1, StallMs: 1}, wantEvents: 1},
+		{name: "malformed after 3", rule: &config.FaultRule{Type: "malformed_sse", AfterEvents: 3}, wantEvents: 5, wantExtra: malformedSSELine},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(&config.Config{}, nil)
+			w := httptest.NewRecorder()
+			rec := recorder.NewRecording("claude", http.MethodPost, "/v1/messages", "", time.Now())
+
+			handle := func() {
+				p.handleStreaming(context.Background(), w, strings.NewReader(stream), &rec, tt.rule, nil)
+			}
+			if tt.rule != nil && tt.rule.Type == "cut_stream" {
+				// net/http drops the connection without logging the panic
+				assert.PanicsWithValue(t, http.ErrAbortHandler, handle)
+			} else {
+				handle()
+			}
+
+			body, err := io.ReadAll(w.Result().Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantEvents, strings.Count(string(body), "event: ping"))
+			if tt.wantExtra != "" {
+				assert.Contains(t, string(body), tt.wantExtra)
+			}
+			if tt.rule != nil {
+				require.NotNil(t, rec.Fault)
+				assert.Equal(t, tt.rule.Type, rec.Fault.Type)
+			} else {
+				assert.Nil(t, rec.Fault)
+			}
+			assert.Equal(t, int64(len(body)), rec.ResponseSize)
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// Client metadata headers. Every X-Mirra-* header is consumed by the proxy
+// and never forwarded upstream.
+const (
+	mirraHeaderPrefix = "X-Mirra-"
+	tagsHeader        = "X-Mirra-Tags"
+	projectHeader     = "X-Mirra-Project"
+	sessionHeader     = "X-Mirra-Session"
+	userHeader        = "X-Mirra-User"
+)
+
+// isMirraHeader reports whether a request header is meant for the proxy
+func isMirraHeader(key string) bool {
+	return strings.HasPrefix(http.CanonicalHeaderKey(key), mirraHeaderPrefix)
+}
+
+// applyMetadata copies client-supplied metadata headers onto the recording
+func applyMetadata(rec *recorder.Recording, header http.Header) {
+	rec.Tags = recorder.ParseTags(strings.Join(header.Values(tagsHeader), ","))
+	rec.Project = strings.TrimSpace(header.Get(projectHeader))
+	rec.Session = strings.TrimSpace(header.Get(sessionHeader))
+	rec.User = strings.TrimSpace(header.Get(userHeader))
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyMetadata(t *testing.T) {
+	header := http.Header{}
+	header.Add("X-Mirra-Tags", "eval, nightly,,eval")
+	header.Add("X-Mirra-Tags", "smoke")
+	header.Set("X-Mirra-Project", " search ")
+	header.Set("X-Mirra-Session", "run-42")
+	header.Set("X-Mirra-User", "alice")
+
+	rec := recorder.NewRecording("claude", http.MethodPost, "/v1/messages", "", time.Now())
+	applyMetadata(&rec, header)
+
+	assert.Equal(t, []string{"eval", "nightly", "smoke"}, rec.Tags)
+	assert.Equal(t, "search", rec.Project)
+	assert.Equal(t, "run-42", rec.Session)
+	assert.Equal(t, "alice", rec.User)
+}
+
+func TestHandle_StripsMirraHeaders(t *testing.T) {
+	var upstreamHeader http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeader = r.Header.Clone()
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	cfg := &config.Config{Providers: map[string]config.Provider{"openai": {UpstreamURL: upstream.URL}}}
+	p := New(cfg, recorder.New(false, t.TempDir()))
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o"}`))
+	r.Header.Set("Authorization", "Bearer sk-test")
+	r.Header.Set("X-Mirra-Tags", "eval")
+	r.Header.Set("x-mirra-project", "search")
+	r.Header.Set("X-Mirra-Session", "run-42")
+	w := httptest.NewRecorder()
+	p.Handle(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Bearer sk-test", upstreamHeader.Get("Authorization"))
+	for key := range upstreamHeader {
+		assert.False(t, strings.HasPrefix(key, "X-Mirra-"), "forwarded %s", key)
+	}
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import "strings"
+
+// requestModel extracts the model name a request targets.
+// Claude and OpenAI carry it in the JSON body, Gemini encodes it in the
+// path (e.g. /v1beta/models/gemini-pro:generateContent).
+func requestModel(provider, path string, body any) string {
+	if bodyMap, ok := body.(map[string]any); ok {
+		if model, ok := bodyMap["model"].(string); ok && model != "" {
+			return model
+		}
+	}
+
+	if provider == "gemini" {
+		if idx := strings.Index(path, "/models/"); idx >= 0 {
+			model := path[idx+len("/models/"):]
+			if colon := strings.Index(model, ":"); colon >= 0 {
+				model = model[:colon]
+			}
+			if slash := strings.Index(model, "/"); slash >= 0 {
+				model = model[:slash]
+			}
+			return model
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/recorder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// piiProxy returns a proxy with the PII guardrail masking emails, and the
+// headers and body of the last request upstream received
+func piiProxy(t *testing.T) (*Proxy, *http.Header, *[]byte) {
+	t.Helper()
+	var header http.Header
+	var body []byte
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"text":"ok"}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfg := &config.Config{
+		Providers: map[string]config.Provider{
+			"claude": {UpstreamURL: upstream.URL},
+			"openai": {UpstreamURL: upstream.URL},
+		},
+		Guardrails: config.GuardrailConfig{PII: config.PIIConfig{Enabled: true}},
+	}
+	return New(cfg, recorder.New(false, t.TempDir())), &header, &body
+}
+
+func TestHandle_PIIMasksEncodedBody(t *testing.T) {
+	p, header, body := piiProxy(t)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(`{"messages":[{"role":"user","content":"Email jane.doe@example.com"}]}`))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/messages", &buf)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	p.Handle(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, header.Get("Content-Encoding"), "the masked body is sent as plain JSON")
+	assert.JSONEq(t, `{"messages":[{"role":"user","content":"Email [PII_EMAIL_1]"}]}`, string(*body))
+}
+
+func TestHandle_PIIMasksMultipartFields(t *testing.T) {
+	p, header, body := piiProxy(t)
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	require.NoError(t, mw.WriteField("prompt", "Transcript for jane.doe@example.com"))
+	fw, err := mw.CreateFormFile("file", "speech.mp3")
+	require.NoError(t, err)
+	_, err = fw.Write([]byte{0xff, 0xfb, 0x90, 0x00})
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", &buf)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	p.Handle(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	parts, err := parseMultipart(header.Get("Content-Type"), *body)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	assert.Equal(t, "Transcript for [PII_EMAIL_1]", parts[0].Value)
+	data, err := parts[1].Blob.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xff, 0xfb, 0x90, 0x00}, data, "files are forwarded unchanged")
+}
+
+func TestHandle_PIIBlocksUninspectableBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		encoding string
+	}{
+		{"text", "Email jane.doe@example.com", ""},
+		{"undecodable", "not gzip at all", "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _, body := piiProxy(t)
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "text/plain")
+			if tt.encoding != "" {
+				r.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			p.Handle(w, r)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Nil(t, *body, "nothing reaches upstream")
+		})
+	}
+}
+
+func TestHandle_PIIBlockedValueNotRecorded(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("blocked request reached upstream")
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	rec := recorder.New(true, dir)
+	cfg := &config.Config{
+		Providers: map[string]config.Provider{"claude": {UpstreamURL: upstream.URL}},
+		Guardrails: config.GuardrailConfig{PII: config.PIIConfig{
+			Enabled: true,
+			Rules:   []config.PIIRule{{Detector: "email", Policy: "block"}},
+		}},
+	}
+	p := New(cfg, rec)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"messages":[{"role":"user","content":"Email jane.doe@example.com"}]}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	p.Handle(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.NoError(t, rec.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "recordings-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	recordings := readRecordings(t, files[0])
+	require.Len(t, recordings, 1)
+	require.Len(t, recordings[0].Findings, 1)
+	assert.Equal(t, "blocked", recordings[0].Findings[0].Action)
+	assert.Nil(t, recordings[0].Request.Raw)
+
+	// Neither the recording nor any blob holds the blocked value
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "jane.doe", path)
+		return nil
+	})
+	require.NoError(t, err)
+}
@@ -3,7 +3,7 @@ package proxy
 import (
 	"bufio"
 	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/guardrail"
+	"github.com/jpoz/mirra/internal/keys"
 	"github.com/jpoz/mirra/internal/recorder"
 )
 
@@ -20,16 +22,53 @@ type Proxy struct {
 	cfg      *config.Config
 	client   *http.Client
 	recorder *recorder.Recorder
+	pii      *guardrail.PIIScanner
+	piiErr   error
+	keys     *keys.Store
 }
 
 func New(cfg *config.Config, rec *recorder.Recorder) *Proxy {
-	return &Proxy{
+	p := &Proxy{
 		cfg:      cfg,
 		recorder: rec,
+		keys:     keys.NewStore(cfg.Keys.Path),
 		client: &http.Client{
 			Timeout: 300 * time.Second, // Longer timeout for streaming
 		},
 	}
+
+	if cfg.Guardrails.PII.Enabled {
+		p.pii, p.piiErr = guardrail.NewPIIScanner(cfg.Guardrails.PII)
+		if p.piiErr != nil {
+			// Fail closed: a broken guardrail must not let PII through
+			slog.Error("invalid PII guardrail configuration, rejecting requests", "error", p.piiErr)
+		}
+	}
+
+	return p
+}
+
+// openaiPrefixes are OpenAI endpoints that no other provider uses. They are
+// matched before Gemini paths, since nested resources such as
+// /v1/vector_stores/{id}/files would otherwise look like Gemini file paths.
+var openaiPrefixes = []string{
+	"/v1/chat/completions",
+	"/v1/completions",
+	"/v1/embeddings",
+	"/v1/responses",
+	"/v1/audio/",
+	"/v1/images/",
+	"/v1/moderations",
+	"/v1/assistants",
+	"/v1/threads",
+	"/v1/vector_stores",
+	"/v1/fine_tuning/",
+	"/v1/uploads",
+	"/v1/realtime",
+	"/v1/evals",
+	"/v1/containers",
+	"/v1/conversations",
+	"/v1/organization/",
 }
 
 func (p *Proxy) identifyProvider(path string) string {
@@ -37,21 +76,55 @@ func (p *Proxy) identifyProvider(path string) string {
 	if strings.HasPrefix(path, "/v1/messages") || strings.HasPrefix(path, "/v1/complete") {
 		return "claude"
 	}
+	for _, prefix := range openaiPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return "openai"
+		}
+	}
 	// Gemini endpoints - check before OpenAI to avoid /v1/models conflict
 	if isGeminiPath(path) {
 		return "gemini"
 	}
-	// OpenAI endpoints
-	if strings.HasPrefix(path, "/v1/chat/completions") ||
-		strings.HasPrefix(path, "/v1/completions") ||
-		strings.HasPrefix(path, "/v1/embeddings") ||
-		strings.HasPrefix(path, "/v1/models") ||
-		strings.HasPrefix(path, "/v1/responses") {
+	// OpenAI model listing (Gemini model paths contain a colon)
+	if strings.HasPrefix(path, "/v1/models") {
 		return "openai"
 	}
 	return ""
 }
 
+// identifyRequestProvider refines identifyProvider using the request's
+// headers. /v1/files and /v1/batches exist in the Claude, OpenAI and Gemini
+// APIs, so the path alone is ambiguous.
+func (p *Proxy) identifyRequestProvider(r *http.Request) string {
+	provider := p.identifyProvider(r.URL.Path)
+	if !isSharedPath(r.URL.Path) {
+		return provider
+	}
+
+	// Gemini authenticates with x-goog-api-key or ?key=
+	if r.Header.Get("X-Goog-Api-Key") != "" || r.URL.Query().Get("key") != "" ||
+		r.Header.Get("X-Goog-Upload-Protocol") != "" {
+		return "gemini"
+	}
+	// Claude sends anthropic-version and x-api-key
+	if r.Header.Get("Anthropic-Version") != "" || r.Header.Get("X-Api-Key") != "" {
+		return "claude"
+	}
+	// OpenAI uses bearer tokens, OpenAI-* headers and multipart uploads
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") ||
+		r.Header.Get("OpenAI-Organization") != "" || r.Header.Get("OpenAI-Project") != "" ||
+		strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		return "openai"
+	}
+	return provider
+}
+
+// isSharedPath reports whether an unversioned-beta path is used by more
+// than one provider
+func isSharedPath(path string) bool {
+	return strings.HasPrefix(path, "/v1/files") || strings.HasPrefix(path, "/v1/batches")
+}
+
 // isGeminiPath checks if the path matches any Gemini API endpoint pattern.
 // Supports v1, v1beta, and v1alpha API versions.
 func isGeminiPath(path string) bool {
@@ -111,15 +184,17 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 
 	// Identify provider early - use "unknown" as fallback for recording
-	provider := p.identifyProvider(r.URL.Path)
+	provider := p.identifyRequestProvider(r)
 	recordProvider := provider
 	if recordProvider == "" {
 		recordProvider = "unknown"
 	}
 
 	// Create recording FIRST - before ANY validation or body reading
-	rec := recorder.NewRecording(recordProvider, r.Method, r.URL.Path, r.URL.RawQuery, startTime)
+	rec := p.recorder.NewRecording(recordProvider, r.Method, r.URL.Path, r.URL.RawQuery, startTime)
 	rec.Request.Headers = r.Header.Clone()
+	applyMetadata(&rec, r.Header)
+	var model string
 
 	// Ensure recording happens even on early returns (including body read failures)
 	defer func() {
@@ -147,7 +222,13 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 
 		slog.Log(r.Context(), logLevel, "request completed", logAttrs...)
 
-		// Record asynchronously
+		// Record asynchronously, as the recording rules say
+		switch p.recordAction(r, &rec, model) {
+		case config.RecordSkip:
+			return
+		case config.RecordMetadata:
+			rec.DropBodies()
+		}
 		p.recorder.Record(rec)
 	}()
 
@@ -163,15 +244,16 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 		_ = r.Body.Close()
 	}()
 
-	// Capture request body
+	// Capture request body: multipart uploads as parts, JSON parsed, binary
+	// content as a blob, anything else as a string
 	if len(bodyBytes) > 0 {
-		// Try to parse as JSON, otherwise store as string
-		var jsonBody any
-		if err := json.Unmarshal(bodyBytes, &jsonBody); err == nil {
-			rec.Request.Body = jsonBody
+		contentType := r.Header.Get("Content-Type")
+		if parts, err := parseMultipart(contentType, bodyBytes); err == nil {
+			rec.Request.Multipart = parts
 		} else {
-			rec.Request.Body = string(bodyBytes)
+			rec.Request.Body, rec.Request.Blob, rec.Request.Encoding = captureEncodedBody(contentType, r.Header.Get("Content-Encoding"), bodyBytes)
 		}
+		rec.Request.Raw = rawBlob(contentType, bodyBytes, rec.Request.Blob)
 	}
 
 	// Check if provider is known
@@ -197,10 +279,154 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	modelBody := rec.Request.Body
+	if rec.Request.Multipart != nil {
+		modelBody = multipartFields(rec.Request.Multipart)
+	}
+	model = requestModel(provider, r.URL.Path, modelBody)
+
+	// Virtual keys: swap the mirra-issued key for the real provider key,
+	// which never leaves the proxy and is never recorded
+	upstreamHeader, upstreamQuery := r.Header, r.URL.RawQuery
+	if virtual := virtualKeyFrom(r); virtual != "" {
+		rec.Request.Headers, rec.Request.Query = replaceKey(rec.Request.Headers, rec.Request.Query, virtual, keys.Redact(virtual))
+
+		key, err := p.keys.Authenticate(virtual, provider, model)
+		if err != nil {
+			status := virtualKeyStatus(err)
+			rec.Error = err.Error()
+			message := rec.Error
+			if status == http.StatusInternalServerError {
+				slog.Error("failed to check virtual key", "id", rec.ID[:8], "error", err)
+				message = "failed to check API key"
+			}
+			writeRecordedError(w, &rec, provider, status, message)
+			return
+		}
+		rec.VirtualKey = &recorder.KeyData{ID: key.ID, Owner: key.Owner, Project: key.Project}
+		if rec.Project == "" {
+			rec.Project = key.Project
+		}
+
+		if providerCfg.APIKey == "" {
+			rec.Error = fmt.Sprintf("no upstream API key configured for %s", provider)
+			writeRecordedError(w, &rec, provider, http.StatusInternalServerError, rec.Error)
+			return
+		}
+		upstreamHeader, upstreamQuery = replaceKey(r.Header, r.URL.RawQuery, virtual, providerCfg.APIKey)
+	} else if p.cfg.Keys.Required {
+		rec.Error = "a mirra virtual API key is required"
+		writeRecordedError(w, &rec, provider, http.StatusUnauthorized, rec.Error)
+		return
+	}
+
+	// PII guardrail: mask or block before anything leaves the proxy
+	var piiResult *guardrail.Result
+	if p.piiErr != nil {
+		rec.Error = "PII guardrail misconfigured"
+		rec.Response.Status = http.StatusInternalServerError
+		writeProviderError(w, provider, http.StatusInternalServerError, rec.Error)
+		return
+	}
+	if p.pii != nil && (rec.Request.Body != nil || rec.Request.Blob != nil || rec.Request.Multipart != nil) {
+		// Bodies the scanner cannot read are refused rather than forwarded
+		// unchecked: non-JSON text, binary bodies and encodings that failed
+		// to decode
+		_, isObject := rec.Request.Body.(map[string]any)
+		if rec.Request.Multipart == nil && !isObject {
+			rec.Error = "blocked by PII guardrail: request body cannot be inspected"
+			rec.Response.Status = http.StatusBadRequest
+			body := writeProviderError(w, provider, http.StatusBadRequest,
+				"Request blocked: the PII guardrail only accepts JSON and multipart request bodies")
+			rec.Response.Headers = w.Header().Clone()
+			rec.ResponseSize = int64(len(body))
+			return
+		}
+
+		if rec.Request.Multipart != nil {
+			piiResult = p.pii.ScanMultipart(rec.Request.Multipart)
+		} else {
+			piiResult = p.pii.Scan(rec.Request.Body)
+		}
+		rec.Findings = append(rec.Findings, piiResult.Findings...)
+
+		if piiResult.Blocked {
+			// The body now holds placeholders; the client's original bytes
+			// contain the values that were refused
+			rec.Request.Raw = nil
+			rec.Error = fmt.Sprintf("blocked by PII guardrail: %s", piiResult.BlockedBy)
+			rec.Response.Status = http.StatusBadRequest
+			body := writeProviderError(w, provider, http.StatusBadRequest,
+				fmt.Sprintf("Request blocked: message content contains %s data", piiResult.BlockedBy))
+			rec.Response.Headers = w.Header().Clone()
+			rec.ResponseSize = int64(len(body))
+			return
+		}
+
+		if piiResult.Masked {
+			var masked []byte
+			var err error
+			if rec.Request.Multipart != nil {
+				masked, err = encodeMultipart(r.Header.Get("Content-Type"), rec.Request.Multipart)
+			} else {
+				masked, err = json.Marshal(rec.Request.Body)
+			}
+			if err != nil {
+				rec.Error = "failed to encode masked request body"
+				rec.Response.Status = http.StatusInternalServerError
+				writeProviderError(w, provider, http.StatusInternalServerError, rec.Error)
+				return
+			}
+			bodyBytes = masked
+			// The client's original bytes contain the values that were masked
+			rec.Request.Raw = recorder.NewBlob(r.Header.Get("Content-Type"), masked)
+			rec.Request.Encoding = ""
+			// The masked body is sent unencoded
+			upstreamHeader = upstreamHeader.Clone()
+			upstreamHeader.Del("Content-Encoding")
+			upstreamHeader.Del("Content-Length")
+		} else {
+			piiResult = nil
+		}
+	}
+
+	// Chaos mode: pick a fault before contacting upstream
+	fault := p.selectFault(r, provider, model)
+	if fault != nil {
+		if fault.LatencyMs > 0 {
+			injectLatency(r.Context(), fault)
+			rec.Fault = faultData(fault)
+		}
+
+		if fault.Type == faultError {
+			status := fault.Status
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			rec.Fault = faultData(fault)
+			rec.Fault.Status = status
+			rec.Response.Status = status
+
+			body := writeProviderError(w, provider, status, "")
+			rec.Response.Headers = w.Header().Clone()
+			rec.ResponseSize = int64(len(body))
+			var jsonBody any
+			if err := json.Unmarshal(body, &jsonBody); err == nil {
+				rec.Response.Body = jsonBody
+			}
+			slog.Warn("injected error fault", "id", rec.ID[:8], "status", status, "rule", fault.Name)
+			return
+		}
+
+		if !isStreamFault(fault) {
+			fault = nil
+		}
+	}
+
 	// Create upstream request
 	upstreamURL := providerCfg.UpstreamURL + r.URL.Path
-	if r.URL.RawQuery != "" {
-		upstreamURL += "?" + r.URL.RawQuery
+	if upstreamQuery != "" {
+		upstreamURL += "?" + upstreamQuery
 	}
 
 	req, err := http.NewRequestWithContext(r.Context(), r.Method, upstreamURL, bytes.NewReader(bodyBytes))
@@ -212,7 +438,15 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Copy headers
-	for key, values := range r.Header {
+	for key, values := range upstreamHeader {
+		if isMirraHeader(key) {
+			continue
+		}
+		// Masked placeholders can only be restored in uncompressed responses;
+		// the transport negotiates and decodes gzip on its own
+		if piiResult != nil && http.CanonicalHeaderKey(key) == "Accept-Encoding" {
+			continue
+		}
 		for _, value := range values {
 			req.Header.Add(key, value)
 		}
@@ -231,6 +465,11 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 		_ = resp.Body.Close()
 	}()
 
+	// Restoring placeholders changes the body length
+	if piiResult != nil {
+		resp.Header.Del("Content-Length")
+	}
+
 	// Copy response headers
 	for key, values := range resp.Header {
 		for _, value := range values {
@@ -242,57 +481,67 @@ func (p *Proxy) Handle(w http.ResponseWriter, r *http.Request) {
 	rec.Response.Headers = resp.Header.Clone()
 
 	// Check if streaming
-	isStreaming := strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") ||
-		strings.Contains(resp.Header.Get("Content-Type"), "stream")
+	contentType := resp.Header.Get("Content-Type")
+	isStreaming := strings.Contains(contentType, "text/event-stream") ||
+		(strings.Contains(contentType, "stream") && !strings.Contains(contentType, "octet-stream"))
 	rec.Response.Streaming = isStreaming
 
 	w.WriteHeader(resp.StatusCode)
 
 	if isStreaming {
-		p.handleStreaming(w, resp.Body, &rec)
+		p.handleStreaming(r.Context(), w, resp.Body, &rec, fault, piiResult)
 	} else {
-		p.handleRegular(w, resp.Body, &rec)
+		p.handleRegular(w, resp.Body, &rec, piiResult)
 	}
 }
 
-func (p *Proxy) handleRegular(w http.ResponseWriter, body io.Reader, rec *recorder.Recording) {
+func (p *Proxy) handleRegular(w http.ResponseWriter, body io.Reader, rec *recorder.Recording, pii *guardrail.Result) {
 	var buf bytes.Buffer
-	tee := io.TeeReader(body, &buf)
 
-	if _, err := io.Copy(w, tee); err != nil {
-		slog.Error("failed to copy response", "id", rec.ID[:8], "error", err)
-		return
+	if pii != nil {
+		// Buffer the whole body so masked placeholders can be restored
+		if _, err := io.Copy(&buf, body); err != nil {
+			slog.Error("failed to read response", "id", rec.ID[:8], "error", err)
+			return
+		}
+		if _, err := w.Write(pii.Restore(buf.Bytes())); err != nil {
+			slog.Error("failed to copy response", "id", rec.ID[:8], "error", err)
+			return
+		}
+	} else {
+		tee := io.TeeReader(body, &buf)
+		if _, err := io.Copy(w, tee); err != nil {
+			slog.Error("failed to copy response", "id", rec.ID[:8], "error", err)
+			return
+		}
 	}
 
 	// Set response size
 	rec.ResponseSize = int64(buf.Len())
 
 	if buf.Len() > 0 {
-		// Check if response is gzipped
-		isGzipped := false
-		if encodings, ok := rec.Response.Headers["Content-Encoding"]; ok {
-			for _, encoding := range encodings {
-				if strings.Contains(strings.ToLower(encoding), "gzip") {
-					isGzipped = true
-					break
-				}
-			}
-		}
-
-		// Try to parse as JSON, otherwise store as string or base64
-		var jsonBody any
-		if err := json.Unmarshal(buf.Bytes(), &jsonBody); err == nil {
-			rec.Response.Body = jsonBody
-		} else if isGzipped {
-			// For gzipped content, base64 encode to preserve binary data
-			rec.Response.Body = "base64:" + base64.StdEncoding.EncodeToString(buf.Bytes())
-		} else {
-			rec.Response.Body = buf.String()
+		// The client received the bytes as sent; the recording keeps them
+		// decoded so readers never have to
+		contentType := ""
+		if values := rec.Response.Headers["Content-Type"]; len(values) > 0 {
+			contentType = values[0]
 		}
+		encoding := strings.Join(rec.Response.Headers["Content-Encoding"], ",")
+		rec.Response.Body, rec.Response.Blob, rec.Response.Encoding = captureEncodedBody(contentType, encoding, buf.Bytes())
+		rec.Response.Raw = rawBlob(contentType, buf.Bytes(), rec.Response.Blob)
 	}
 }
 
-func (p *Proxy) handleStreaming(w http.ResponseWriter, body io.Reader, rec *recorder.Recording) {
+func (p *Proxy) handleStreaming(ctx context.Context, w http.ResponseWriter, body io.Reader, rec *recorder.Recording, fault *config.FaultRule, pii *guardrail.Result) {
+	// Keep the upstream bytes exactly; the scanner below drops carriage returns
+	var raw bytes.Buffer
+	body = io.TeeReader(body, &raw)
+	defer func() {
+		if raw.Len() > 0 {
+			rec.Response.Raw = recorder.NewBlob(http.Header(rec.Response.Headers).Get("Content-Type"), raw.Bytes())
+		}
+	}()
+
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		slog.Error("response writer does not support flushing", "id", rec.ID[:8])
@@ -304,13 +553,24 @@ func (p *Proxy) handleStreaming(w http.ResponseWriter, body io.Reader, rec *reco
 	scanner := bufio.NewScanner(body)
 	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // Support large chunks
 
-	for scanner.Scan() {
+	// Track complete SSE events (terminated by a blank line) for stream faults
+	events := 0
+	inEvent := false
+	ended := false
+	if fault != nil && fault.AfterEvents <= 0 {
+		ended = applyStreamFault(ctx, w, flusher, fault, rec, &accumulated)
+		if !ended {
+			fault = nil
+		}
+	}
+
+	for !ended && scanner.Scan() {
 		line := scanner.Bytes()
 		accumulated.Write(line)
 		accumulated.WriteByte('\n')
 
 		// Write to client
-		if _, err := w.Write(line); err != nil {
+		if _, err := w.Write(pii.Restore(line)); err != nil {
 			slog.Error("failed to write streaming chunk", "id", rec.ID[:8], "error", err)
 			break
 		}
@@ -319,6 +579,21 @@ func (p *Proxy) handleStreaming(w http.ResponseWriter, body io.Reader, rec *reco
 			break
 		}
 		flusher.Flush()
+
+		if len(line) > 0 {
+			inEvent = true
+			continue
+		}
+		if inEvent {
+			inEvent = false
+			events++
+			if fault != nil && events >= fault.AfterEvents {
+				if ended = applyStreamFault(ctx, w, flusher, fault, rec, &accumulated); ended {
+					break
+				}
+				fault = nil
+			}
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -332,4 +607,10 @@ func (p *Proxy) handleStreaming(w http.ResponseWriter, body io.Reader, rec *reco
 		// Store streaming responses as string (they contain SSE format)
 		rec.Response.Body = accumulated.String()
 	}
+
+	// A cut stream drops the connection instead of ending the response
+	// cleanly, so clients see it fail midway; the recording is still saved
+	if ended && fault.Type == faultCutStream {
+		panic(http.ErrAbortHandler)
+	}
 }
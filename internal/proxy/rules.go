@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strings"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/recorder"
+)
+
+// recordAction decides how a finished request is recorded: fully, without
+// its bodies, or not at all. The first matching rule wins; failed requests
+// are recorded fully while RecordErrors is set.
+func (p *Proxy) recordAction(r *http.Request, rec *recorder.Recording, model string) string {
+	if p.cfg.Recording.RecordErrors && (rec.Error != "" || rec.Response.Status >= 400) {
+		return config.RecordFull
+	}
+
+	for _, rule := range p.cfg.Recording.Rules {
+		if !ruleMatches(rule, r, rec, model) {
+			continue
+		}
+		if rule.SampleRate > 0 && rule.SampleRate < 1 && rand.Float64() >= rule.SampleRate {
+			return config.RecordSkip
+		}
+		return rule.Action
+	}
+
+	return config.RecordFull
+}
+
+// ruleMatches checks the rule's provider, method, path, model, status and
+// header matchers
+func ruleMatches(rule config.RecordingRule, r *http.Request, rec *recorder.Recording, model string) bool {
+	if rule.Provider != "" && !strings.EqualFold(rule.Provider, rec.Provider) {
+		return false
+	}
+	if rule.Method != "" && !strings.EqualFold(rule.Method, r.Method) {
+		return false
+	}
+	if rule.Path != "" && !globMatch(rule.Path, r.URL.Path) {
+		return false
+	}
+	if rule.Model != "" && !globMatch(rule.Model, model) {
+		return false
+	}
+	if rule.Status != "" {
+		lo, hi, err := config.ParseStatusRange(rule.Status)
+		if err != nil || rec.Response.Status < lo || rec.Response.Status > hi {
+			return false
+		}
+	}
+	for key, want := range rule.Headers {
+		if !globMatch(want, r.Header.Get(key)) {
+			return false
+		}
+	}
+	return true
+}
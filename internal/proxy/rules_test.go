@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/recorder"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAction(t *testing.T) {
+	cfg := &config.Config{
+		Recording: config.RecordingConfig{
+			RecordErrors: true,
+			Rules: []config.RecordingRule{
+				{Name: "model-list", Method: "GET", Path: "/v1/models", Action: config.RecordSkip},
+				{Name: "count-tokens", Path: "*:countTokens", Action: config.RecordSkip},
+				{Name: "embeddings", Path: "/v1/embeddings", Action: config.RecordMetadata},
+				{Name: "redirects", Status: "3xx", Action: config.RecordSkip},
+				{Name: "load-test", Headers: map[string]string{"X-Mirra-Project": "load-*"}, Action: config.RecordSkip},
+				{Name: "mini", Provider: "openai", Model: "gpt-4o-mini*", Action: config.RecordMetadata},
+			},
+		},
+	}
+	p := New(cfg, nil)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		provider string
+		model    string
+		status   int
+		error    string
+		headers  map[string]string
+		want     string
+	}{
+		{name: "model listing", method: "GET", path: "/v1/models", provider: "openai", status: 200, want: config.RecordSkip},
+		{name: "model listing error", method: "GET", path: "/v1/models", provider: "openai", status: 401, want: config.RecordFull},
+		{name: "proxy error", method: "GET", path: "/v1/models", provider: "openai", error: "upstream request failed", want: config.RecordFull},
+		{name: "count tokens", method: "POST", path: "/v1beta/models/gemini-pro:countTokens", provider: "gemini", status: 200, want: config.RecordSkip},
+		{name: "embeddings", method: "POST", path: "/v1/embeddings", provider: "openai", status: 200, want: config.RecordMetadata},
+		{name: "status class", method: "POST", path: "/v1/messages", provider: "claude", status: 304, want: config.RecordSkip},
+		{name: "header", method: "POST", path: "/v1/messages", provider: "claude", status: 200, headers: map[string]string{"X-Mirra-Project": "load-test"}, want: config.RecordSkip},
+		{name: "model", method: "POST", path: "/v1/chat/completions", provider: "openai", model: "gpt-4o-mini-2024", status: 200, want: config.RecordMetadata},
+		{name: "no match", method: "POST", path: "/v1/messages", provider: "claude", model: "claude-sonnet-4", status: 200, want: config.RecordFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			rec := recorder.Recording{Provider: tt.provider, Error: tt.error, Response: recorder.ResponseData{Status: tt.status}}
+			assert.Equal(t, tt.want, p.recordAction(r, &rec, tt.model))
+		})
+	}
+
+	t.Run("errors follow rules when record_errors is off", func(t *testing.T) {
+		p := New(&config.Config{Recording: config.RecordingConfig{Rules: cfg.Recording.Rules}}, nil)
+		r := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		rec := recorder.Recording{Provider: "openai", Response: recorder.ResponseData{Status: 500}}
+		assert.Equal(t, config.RecordSkip, p.recordAction(r, &rec, ""))
+	})
+
+	t.Run("sampling", func(t *testing.T) {
+		p := New(&config.Config{Recording: config.RecordingConfig{Rules: []config.RecordingRule{
+			{Name: "sample", Path: "/v1/messages", SampleRate: 0.25, Action: config.RecordFull},
+		}}}, nil)
+		recorded := 0
+		for i := 0; i < 4000; i++ {
+			r := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+			rec := recorder.Recording{Provider: "claude", Response: recorder.ResponseData{Status: 200}}
+			if p.recordAction(r, &rec, "") == config.RecordFull {
+				recorded++
+			}
+		}
+		assert.InDelta(t, 1000, recorded, 200)
+	})
+}
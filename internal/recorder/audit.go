@@ -0,0 +1,811 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Each recordings file can have an audit log in the audit directory that
+// proves its lines were not altered. Every line's hash is chained with the
+// previous one, starting from a hash of the file name, and the chain is
+// signed at checkpoints with an Ed25519 key: when the writer syncs and when
+// it closes the file. Modifying, inserting or deleting lines breaks the
+// chain, and rewriting the chain breaks the signatures. The audit directory
+// also has a file log, chained and signed the same way, recording when each
+// audited file was started and removed, so a file cannot be deleted together
+// with its audit log unnoticed.
+
+const (
+	auditDir      = "audit"
+	auditExt      = ".audit"
+	auditFilesLog = "files.log"
+
+	// AuditKeyFileEnv names the file holding the key audit checkpoints are
+	// signed with
+	AuditKeyFileEnv = "MIRRA_AUDIT_KEY_FILE"
+)
+
+// AuditEntry is a line of an audit log: the chained hash of a recording
+// line, or a checkpoint signing the chain so far
+type AuditEntry struct {
+	Seq   int    `json:"seq"`            // recording lines so far
+	Line  string `json:"line,omitempty"` // sha256 of the recording line, empty for checkpoints
+	Chain string `json:"chain"`          // sha256 of the previous chain and the line hash
+
+	Time  *time.Time `json:"time,omitempty"`
+	KeyID string     `json:"key_id,omitempty"`
+	Sig   string     `json:"sig,omitempty"`
+
+	// A rebuilt log starts with an entry recording the chain it replaced
+	Prev    string `json:"prev,omitempty"`     // chain head of the replaced log
+	PrevSeq int    `json:"prev_seq,omitempty"` // entries in the replaced log
+	Reason  string `json:"reason,omitempty"`   // command that rewrote the file
+}
+
+func (e *AuditEntry) checkpoint() bool {
+	return e.Line == "" && !e.rebuild()
+}
+
+func (e *AuditEntry) rebuild() bool {
+	return e.Prev != ""
+}
+
+// AuditSigner signs audit checkpoints
+type AuditSigner struct {
+	key ed25519.PrivateKey
+	id  string
+}
+
+// NewAuditSigner creates a signer from a base64 encoded 32-byte Ed25519
+// seed
+func NewAuditSigner(encoded string) (*AuditSigner, error) {
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("audit key is not valid base64: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("audit key must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	return &AuditSigner{key: key, id: AuditKeyID(key.Public().(ed25519.PublicKey))}, nil
+}
+
+// LoadAuditSigner reads a signing key file written by GenerateAuditKey
+func LoadAuditSigner(path string) (*AuditSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit key: %w", err)
+	}
+	s, err := NewAuditSigner(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit key %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// AuditSignerFromEnv returns the signer in AuditKeyFileEnv's file, or nil if
+// it is not set
+func AuditSignerFromEnv() (*AuditSigner, error) {
+	if path := os.Getenv(AuditKeyFileEnv); path != "" {
+		return LoadAuditSigner(path)
+	}
+	return nil, nil
+}
+
+// PublicKey returns the key that verifies the signer's checkpoints
+func (s *AuditSigner) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// KeyID returns the ID checkpoints record the signing key by
+func (s *AuditSigner) KeyID() string {
+	return s.id
+}
+
+// GenerateAuditKey returns a new signing key and its public key, base64
+// encoded
+func GenerateAuditKey() (private, public string, err error) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Seed()), base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// ParseAuditPublicKey parses a base64 encoded Ed25519 public key
+func ParseAuditPublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("public key is not valid base64: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// AuditKeyID returns a short fingerprint of a public key
+func AuditKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// auditPath returns the audit log of a recordings file, which is the same
+// whether the file is compressed or not
+func auditPath(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), CompressedExt)
+	return filepath.Join(filepath.Dir(path), auditDir, name+auditExt)
+}
+
+// auditGenesis starts a file's chain, so lines cannot be moved between files
+func auditGenesis(name string) [32]byte {
+	return sha256.Sum256([]byte("mirra-audit\n" + strings.TrimSuffix(name, CompressedExt)))
+}
+
+func chainHash(prev [32]byte, line [32]byte) [32]byte {
+	return sha256.Sum256(append(prev[:], line[:]...))
+}
+
+// checkpointMessage is what a checkpoint's signature covers
+func checkpointMessage(name string, e *AuditEntry) []byte {
+	var signedAt string
+	if e.Time != nil {
+		signedAt = e.Time.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Appendf(nil, "mirra-audit-checkpoint\n%s\n%d\n%s\n%s", strings.TrimSuffix(name, CompressedExt), e.Seq, e.Chain, signedAt)
+}
+
+// rebuildMessage is what a rebuild entry's signature covers
+func rebuildMessage(name string, e *AuditEntry) []byte {
+	var signedAt string
+	if e.Time != nil {
+		signedAt = e.Time.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Appendf(nil, "mirra-audit-rebuild\n%s\n%d\n%s\n%s\n%s\n%s", strings.TrimSuffix(name, CompressedExt), e.PrevSeq, e.Prev, e.Chain, e.Reason, signedAt)
+}
+
+// auditLog appends to the audit log of the file the recorder is writing. It
+// is only used by the recorder's worker.
+type auditLog struct {
+	name   string // recordings file name
+	signer *AuditSigner
+	file   *os.File
+	buf    *bufio.Writer
+	seq    int
+	chain  [32]byte
+	signed int // seq at the last checkpoint
+
+	committed int64 // size of the log at the last flush
+}
+
+// openAuditLog opens the audit log of a recordings file, continuing its
+// chain. A new log for a file that already has lines starts by chaining
+// them.
+func openAuditLog(path string, signer *AuditSigner) (*auditLog, error) {
+	logPath := auditPath(path)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+
+	a := &auditLog{name: filepath.Base(path), signer: signer, chain: auditGenesis(filepath.Base(path))}
+	data, err := os.ReadFile(logPath)
+	if os.IsNotExist(err) {
+		if err := logAuditFileEvent(filepath.Dir(path), &auditFileEvent{Event: "created", File: a.name}, signer); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	entries, err := parseAuditLog[AuditEntry](data, logPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		a.seq = e.Seq
+		if e.checkpoint() {
+			a.signed = e.Seq
+		}
+		chain, err := hex.DecodeString(e.Chain)
+		if err != nil || len(chain) != 32 {
+			return nil, fmt.Errorf("corrupt audit log %s", filepath.Base(logPath))
+		}
+		a.chain = [32]byte(chain)
+	}
+
+	f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	a.file = f
+	a.buf = bufio.NewWriter(f)
+	a.committed = int64(len(data))
+
+	// New entries must start on a line of their own after a torn one
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		_ = a.buf.WriteByte('\n')
+	}
+	if len(entries) == 0 {
+		err := eachLine(path, a.add)
+		if err != nil && !os.IsNotExist(err) {
+			_ = f.Close()
+			return nil, fmt.Errorf("failed to audit existing recordings: %w", err)
+		}
+	}
+	return a, nil
+}
+
+// add chains a recording line
+func (a *auditLog) add(line []byte) error {
+	sum := sha256.Sum256(line)
+	a.chain = chainHash(a.chain, sum)
+	a.seq++
+	return a.write(&AuditEntry{Seq: a.seq, Line: hex.EncodeToString(sum[:]), Chain: hex.EncodeToString(a.chain[:])})
+}
+
+// checkpoint signs the chain if lines were added since the last checkpoint
+func (a *auditLog) checkpoint() error {
+	if a.signer == nil || a.seq == a.signed {
+		return nil
+	}
+	now := time.Now().UTC()
+	e := &AuditEntry{Seq: a.seq, Chain: hex.EncodeToString(a.chain[:]), Time: &now, KeyID: a.signer.id}
+	e.Sig = base64.StdEncoding.EncodeToString(ed25519.Sign(a.signer.key, checkpointMessage(a.name, e)))
+	if err := a.write(e); err != nil {
+		return err
+	}
+	a.signed = a.seq
+	return nil
+}
+
+func (a *auditLog) write(e *AuditEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := a.buf.Write(data); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return a.buf.WriteByte('\n')
+}
+
+func (a *auditLog) flush() error {
+	if err := a.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	info, err := a.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	a.committed = info.Size()
+	return nil
+}
+
+// sync signs a checkpoint and flushes the log to stable storage
+func (a *auditLog) sync() error {
+	if err := a.checkpoint(); err != nil {
+		return err
+	}
+	if err := a.flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *auditLog) close() error {
+	err := a.sync()
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// readAuditLog reads the entries of an audit log. A line torn by a crash at
+// the end is ignored.
+func readAuditLog(path string) ([]AuditEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseAuditLog[AuditEntry](data, path)
+}
+
+func parseAuditLog[T any](data []byte, path string) ([]T, error) {
+	var entries []T
+	lines := bytes.Split(data, []byte{'\n'})
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var e T
+		if err := json.Unmarshal(line, &e); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("corrupt audit log %s at line %d: %w", filepath.Base(path), i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// RebuildAudit replaces a recordings file's audit log with a new chain over
+// its current lines, signed by signer if it is not nil. It is used after a
+// maintenance command rewrites the file, named by reason; files without an
+// audit log are left alone. The old log must verify, with signer's key if
+// there is one, so a rebuild cannot hide tampering with the log, and the new
+// chain starts from a signed entry naming the old chain's head and the
+// reason. The log of a file that was removed is deleted, and the removal
+// recorded in the file log.
+func RebuildAudit(path string, signer *AuditSigner, reason string) error {
+	logPath := auditPath(path)
+	entries, err := readAuditLog(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	name := filepath.Base(path)
+	var pub ed25519.PublicKey
+	if signer != nil {
+		pub = signer.PublicKey()
+	}
+	report := &AuditReport{File: strings.TrimSuffix(name, CompressedExt)}
+	logged := verifyChain(report, entries, pub, false)
+	if !report.OK() {
+		return fmt.Errorf("audit log of %s does not verify, so it was not rebuilt (%s); run mirra audit verify", name, report.Problems[0].Detail)
+	}
+
+	// The replaced log's head is the last entry of its chain
+	prev := auditGenesis(name)
+	if len(entries) > 0 {
+		head, err := hex.DecodeString(entries[len(entries)-1].Chain)
+		if err != nil || len(head) != 32 {
+			return fmt.Errorf("corrupt audit log %s", filepath.Base(logPath))
+		}
+		prev = [32]byte(head)
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		removed := &auditFileEvent{Event: "removed", File: report.File, Prev: hex.EncodeToString(prev[:]), PrevSeq: len(logged), Reason: reason}
+		if err := logAuditFileEvent(filepath.Dir(path), removed, signer); err != nil {
+			return err
+		}
+		return os.Remove(logPath)
+	}
+
+	tmpPath := logPath + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create audit log: %w", err)
+	}
+	a := &auditLog{name: name, signer: signer, chain: chainHash(auditGenesis(name), prev), file: f, buf: bufio.NewWriter(f)}
+	now := time.Now().UTC()
+	start := &AuditEntry{Chain: hex.EncodeToString(a.chain[:]), Time: &now, Prev: hex.EncodeToString(prev[:]), PrevSeq: len(logged), Reason: reason}
+	if signer != nil {
+		start.KeyID = signer.id
+		start.Sig = base64.StdEncoding.EncodeToString(ed25519.Sign(signer.key, rebuildMessage(name, start)))
+	}
+	err = a.write(start)
+	if err == nil {
+		err = eachLine(path, a.add)
+	}
+	if closeErr := a.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to rebuild audit log: %w", err)
+	}
+	if err := os.Rename(tmpPath, logPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to rebuild audit log: %w", err)
+	}
+	return nil
+}
+
+// AuditReport is the result of checking a recordings file against its
+// audit log
+type AuditReport struct {
+	File        string         `json:"file"`
+	Entries     int            `json:"entries"`           // recording lines in the audit log
+	Checkpoints int            `json:"checkpoints"`       // signed checkpoints
+	Signed      int            `json:"signed"`            // entries covered by a verified checkpoint
+	Rebuilt     string         `json:"rebuilt,omitempty"` // reason the log was last rebuilt
+	Problems    []AuditProblem `json:"problems,omitempty"`
+}
+
+// AuditProblem describes one discrepancy found by VerifyAudit
+type AuditProblem struct {
+	Kind   string `json:"kind"`           // "modified", "inserted", "deleted", "log", "signature" or "missing"
+	Line   int    `json:"line,omitempty"` // recording line in the file, from 1
+	ID     string `json:"id,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// OK reports whether the file matched its audit log
+func (r *AuditReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *AuditReport) problem(kind string, line int, id, format string, args ...any) {
+	r.Problems = append(r.Problems, AuditProblem{Kind: kind, Line: line, ID: id, Detail: fmt.Sprintf(format, args...)})
+}
+
+// VerifyAudit checks a recordings file against its audit log. The chain in
+// the log is recomputed, and checkpoint signatures are checked with pub
+// when it is not nil. Lines of the file are then matched to the entries to
+// find modified, inserted and deleted recordings. The file may have been
+// compressed since, or removed, in which case every entry is reported
+// deleted. With pub, every entry must be covered by a signed checkpoint,
+// except the unsynced tail of the file being written, which is the newest
+// uncompressed one.
+func VerifyAudit(path string, pub ed25519.PublicKey) (*AuditReport, error) {
+	name := strings.TrimSuffix(filepath.Base(path), CompressedExt)
+	report := &AuditReport{File: name}
+	if _, err := os.Stat(path); os.IsNotExist(err) && !IsCompressed(path) {
+		if _, err := os.Stat(path + CompressedExt); err == nil {
+			path += CompressedExt
+		}
+	}
+
+	entries, err := readAuditLog(auditPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			report.problem("missing", 0, "", "no audit log")
+			return report, nil
+		}
+		return nil, err
+	}
+
+	active := false
+	if files, err := ListRecordingFiles(filepath.Dir(path)); err == nil && len(files) > 0 {
+		last := files[len(files)-1]
+		active = !last.Compressed && filepath.Base(last.Path) == name
+	}
+	logged := verifyChain(report, entries, pub, active)
+	report.Entries = len(logged)
+
+	// Hash the file's lines
+	type fileLine struct {
+		sum [32]byte
+		id  string
+	}
+	var lines []fileLine
+	if _, err := os.Stat(path); err == nil {
+		err := eachLine(path, func(line []byte) error {
+			var partial struct {
+				ID string `json:"id"`
+			}
+			_ = json.Unmarshal(line, &partial)
+			lines = append(lines, fileLine{sum: sha256.Sum256(line), id: partial.ID})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Match lines to entries in order. Where they differ, a line that is
+	// logged further on means entries were deleted before it, an entry that
+	// is in the file further on means lines were inserted, and otherwise
+	// the line was modified.
+	linePos := make(map[[32]byte]int, len(lines))
+	for i, l := range lines {
+		linePos[l.sum] = i
+	}
+	entryPos := make(map[[32]byte]int, len(logged))
+	for j, sum := range logged {
+		entryPos[sum] = j
+	}
+
+	i, j := 0, 0
+	for i < len(lines) && j < len(logged) {
+		if lines[i].sum == logged[j] {
+			i++
+			j++
+			continue
+		}
+		if k, ok := entryPos[lines[i].sum]; ok && k > j {
+			for ; j < k; j++ {
+				report.problem("deleted", i+1, "", "entry %d is missing before this line", j+1)
+			}
+			continue
+		}
+		if k, ok := linePos[logged[j]]; ok && k > i {
+			for ; i < k; i++ {
+				report.problem("inserted", i+1, lines[i].id, "line is not in the audit log")
+			}
+			continue
+		}
+		report.problem("modified", i+1, lines[i].id, "line does not match entry %d", j+1)
+		i++
+		j++
+	}
+	for ; j < len(logged); j++ {
+		report.problem("deleted", 0, "", "entry %d is missing at the end of the file", j+1)
+	}
+	for ; i < len(lines); i++ {
+		report.problem("inserted", i+1, lines[i].id, "line is not in the audit log")
+	}
+
+	return report, nil
+}
+
+// verifyChain recomputes the chain of an audit log's entries, checking
+// signatures with pub when it is not nil, and returns the line hashes it
+// logs. The entries are trusted only up to the first break. With pub, the
+// rebuild entry must be signed and every entry covered by a checkpoint,
+// unless tail allows entries after the last one.
+func verifyChain(report *AuditReport, entries []AuditEntry, pub ed25519.PublicKey, tail bool) [][32]byte {
+	chain := auditGenesis(report.File)
+	var logged [][32]byte
+	invalid := false
+	for i := range entries {
+		e := &entries[i]
+		if e.rebuild() {
+			prev, err := hex.DecodeString(e.Prev)
+			if i != 0 || err != nil || len(prev) != 32 {
+				report.problem("log", 0, "", "rebuild entry does not start the chain")
+				break
+			}
+			chain = chainHash(chain, [32]byte(prev))
+			if e.Chain != hex.EncodeToString(chain[:]) {
+				report.problem("log", 0, "", "rebuild entry does not start the chain")
+				break
+			}
+			report.Rebuilt = e.Reason
+			if pub == nil {
+				continue
+			}
+			if e.Sig == "" {
+				report.problem("signature", 0, "", "rebuild entry by %s is not signed", e.Reason)
+				invalid = true
+			} else if !verifySignature(pub, e.KeyID, e.Sig, rebuildMessage(report.File, e)) {
+				report.problem("signature", 0, "", "rebuild entry has an invalid signature (key %s)", e.KeyID)
+				invalid = true
+			}
+			continue
+		}
+		if e.checkpoint() {
+			if e.Seq != len(logged) || e.Chain != hex.EncodeToString(chain[:]) {
+				report.problem("log", 0, "", "checkpoint at entry %d does not match the chain", e.Seq)
+				break
+			}
+			report.Checkpoints++
+			if pub == nil {
+				continue
+			}
+			if !verifySignature(pub, e.KeyID, e.Sig, checkpointMessage(report.File, e)) {
+				report.problem("signature", 0, "", "checkpoint at entry %d has an invalid signature (key %s)", e.Seq, e.KeyID)
+				invalid = true
+				continue
+			}
+			report.Signed = e.Seq
+			continue
+		}
+
+		line, err := hex.DecodeString(e.Line)
+		if err != nil || len(line) != 32 || e.Seq != len(logged)+1 {
+			report.problem("log", 0, "", "entry %d is malformed", len(logged)+1)
+			break
+		}
+		chain = chainHash(chain, [32]byte(line))
+		if e.Chain != hex.EncodeToString(chain[:]) {
+			report.problem("log", 0, "", "entry %d does not match the chain", e.Seq)
+			break
+		}
+		logged = append(logged, [32]byte(line))
+	}
+	// Entries after a checkpoint with a bad signature are reported with it
+	if pub != nil && !tail && !invalid && report.Signed < len(logged) {
+		report.problem("signature", 0, "", "entries %d to %d are not covered by a signed checkpoint", report.Signed+1, len(logged))
+	}
+	return logged
+}
+
+// verifySignature checks a base64 encoded signature made with pub
+func verifySignature(pub ed25519.PublicKey, keyID, encoded string, message []byte) bool {
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	return err == nil && keyID == AuditKeyID(pub) && ed25519.Verify(pub, message, sig)
+}
+
+// AuditedFiles returns the recordings files that have audit logs, including
+// ones that no longer exist, by their uncompressed names
+func AuditedFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, auditDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), auditExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	return files, nil
+}
+
+// auditFileEvent is a line of the file log: an audited file was started, or
+// removed by a command
+type auditFileEvent struct {
+	Event   string     `json:"event"`              // "created" or "removed"
+	File    string     `json:"file"`               // recordings file name, uncompressed
+	Prev    string     `json:"prev,omitempty"`     // chain head of the removed file's log
+	PrevSeq int        `json:"prev_seq,omitempty"` // entries in the removed file's log
+	Reason  string     `json:"reason,omitempty"`   // command that removed the file
+	Chain   string     `json:"chain"`              // sha256 of the previous chain and the event
+	Time    *time.Time `json:"time,omitempty"`
+	KeyID   string     `json:"key_id,omitempty"`
+	Sig     string     `json:"sig,omitempty"`
+}
+
+// auditFilesGenesis starts the file log's chain
+var auditFilesGenesis = sha256.Sum256([]byte("mirra-audit-files"))
+
+// message is what the event's chain hash covers
+func (e *auditFileEvent) message() []byte {
+	var at string
+	if e.Time != nil {
+		at = e.Time.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Appendf(nil, "mirra-audit-file\n%s\n%s\n%d\n%s\n%s\n%s", e.Event, e.File, e.PrevSeq, e.Prev, e.Reason, at)
+}
+
+// signed is what the event's signature covers
+func (e *auditFileEvent) signed() []byte {
+	return append(e.message(), "\n"+e.Chain...)
+}
+
+// logAuditFileEvent appends an event to the file log of a recordings
+// directory, chained to the last one and signed by signer if it is not nil
+func logAuditFileEvent(dir string, e *auditFileEvent, signer *AuditSigner) error {
+	path := filepath.Join(dir, auditDir, auditFilesLog)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read audit file log: %w", err)
+	}
+	events, err := parseAuditLog[auditFileEvent](data, path)
+	if err != nil {
+		return err
+	}
+	chain := auditFilesGenesis
+	if len(events) > 0 {
+		head, err := hex.DecodeString(events[len(events)-1].Chain)
+		if err != nil || len(head) != 32 {
+			return fmt.Errorf("corrupt audit file log %s", path)
+		}
+		chain = [32]byte(head)
+	}
+
+	now := time.Now().UTC()
+	e.Time = &now
+	chain = chainHash(chain, sha256.Sum256(e.message()))
+	e.Chain = hex.EncodeToString(chain[:])
+	if signer != nil {
+		e.KeyID = signer.id
+		e.Sig = base64.StdEncoding.EncodeToString(ed25519.Sign(signer.key, e.signed()))
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// A line torn by a crash is ended first
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		line = append([]byte{'\n'}, line...)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file log: %w", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write audit file log: %w", err)
+	}
+	return nil
+}
+
+// VerifyAuditFiles checks the file log of a recordings directory: its chain,
+// its signatures with pub when it is not nil, and that every audited file it
+// records as started still has an audit log unless it records the file's
+// removal
+func VerifyAuditFiles(dir string, pub ed25519.PublicKey) (*AuditReport, error) {
+	path := filepath.Join(dir, auditDir, auditFilesLog)
+	report := &AuditReport{File: auditFilesLog}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		audited, err := AuditedFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		if len(audited) > 0 {
+			report.problem("missing", 0, "", "no audit file log")
+		}
+		return report, nil
+	}
+	events, err := parseAuditLog[auditFileEvent](data, path)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := auditFilesGenesis
+	live := make(map[string]bool)
+	for i := range events {
+		e := &events[i]
+		chain = chainHash(chain, sha256.Sum256(e.message()))
+		if e.Chain != hex.EncodeToString(chain[:]) || (e.Event != "created" && e.Event != "removed") {
+			report.problem("log", 0, "", "entry %d does not match the chain", i+1)
+			break
+		}
+		report.Entries++
+		live[e.File] = e.Event == "created"
+		if pub == nil {
+			continue
+		}
+		switch {
+		case e.Sig == "":
+			report.problem("signature", 0, "", "entry %d (%s %s) is not signed", i+1, e.Event, e.File)
+		case !verifySignature(pub, e.KeyID, e.Sig, e.signed()):
+			report.problem("signature", 0, "", "entry %d (%s %s) has an invalid signature (key %s)", i+1, e.Event, e.File, e.KeyID)
+		default:
+			report.Signed++
+		}
+	}
+
+	names := make([]string, 0, len(live))
+	for name, ok := range live {
+		if ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := os.Stat(auditPath(filepath.Join(dir, name))); os.IsNotExist(err) {
+			report.problem("missing", 0, "", "audit log of %s was removed without a removal entry", name)
+		}
+	}
+	return report, nil
+}
+
+// RebuildPrunedAudit rebuilds the audit logs of the files Prune changed, and
+// removes those of files it deleted, recording their removal
+func RebuildPrunedAudit(dir string, result *PruneResult, signer *AuditSigner) error {
+	for _, name := range result.FileNames() {
+		if err := RebuildAudit(filepath.Join(dir, name), signer, "prune"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
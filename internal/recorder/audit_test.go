@@ -0,0 +1,296 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAuditSigner(t *testing.T) *AuditSigner {
+	t.Helper()
+	private, _, err := GenerateAuditKey()
+	require.NoError(t, err)
+	signer, err := NewAuditSigner(private)
+	require.NoError(t, err)
+	return signer
+}
+
+// writeAudited records n recordings with audit logging and returns the file
+func writeAudited(t *testing.T, dir string, signer *AuditSigner, n int) string {
+	t.Helper()
+	r := NewWithOptions(true, dir, Options{Fsync: FsyncAlways, Audit: true, AuditSigner: signer})
+	for i := 0; i < n; i++ {
+		r.Record(Recording{ID: fmt.Sprintf("20250101-%04d", i), Timestamp: time.Date(2025, 1, 1, 12, 0, i, 0, time.UTC), Provider: "claude"})
+	}
+	require.NoError(t, r.Close())
+	return filepath.Join(dir, "recordings-2025-01-01.jsonl")
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func writeLines(t *testing.T, path string, lines []string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+}
+
+func problemKinds(report *AuditReport) []string {
+	var kinds []string
+	for _, p := range report.Problems {
+		kinds = append(kinds, fmt.Sprintf("%s:%d", p.Kind, p.Line))
+	}
+	return kinds
+}
+
+func TestAudit_VerifyUntouched(t *testing.T) {
+	signer := testAuditSigner(t)
+	path := writeAudited(t, t.TempDir(), signer, 5)
+
+	report, err := VerifyAudit(path, signer.PublicKey())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+	assert.Equal(t, 5, report.Entries)
+	assert.Equal(t, 5, report.Signed)
+	assert.Equal(t, 1, report.Checkpoints)
+
+	// Another key does not verify the checkpoints
+	report, err = VerifyAudit(path, testAuditSigner(t).PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"signature:0"}, problemKinds(report))
+	assert.Zero(t, report.Signed)
+}
+
+func TestAudit_ContinuesChainAcrossRestarts(t *testing.T) {
+	dir := t.TempDir()
+	signer := testAuditSigner(t)
+	writeAudited(t, dir, signer, 2)
+
+	r := NewWithOptions(true, dir, Options{Fsync: FsyncAlways, AuditSigner: signer})
+	r.Record(Recording{ID: "20250101-late", Timestamp: time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC)})
+	require.NoError(t, r.Close())
+
+	report, err := VerifyAudit(filepath.Join(dir, "recordings-2025-01-01.jsonl"), signer.PublicKey())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+	assert.Equal(t, 3, report.Signed)
+	assert.Equal(t, 2, report.Checkpoints)
+}
+
+func TestAudit_DetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func([]string) []string
+		want   []string
+	}{
+		{
+			name: "modified",
+			tamper: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "claude", "openai", 1)
+				return lines
+			},
+			want: []string{"modified:2"},
+		},
+		{
+			name: "inserted",
+			tamper: func(lines []string) []string {
+				return append(lines[:2], append([]string{`{"id":"20250101-fake"}`}, lines[2:]...)...)
+			},
+			want: []string{"inserted:3"},
+		},
+		{
+			name: "deleted",
+			tamper: func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			want: []string{"deleted:2"},
+		},
+		{
+			name: "truncated",
+			tamper: func(lines []string) []string {
+				return lines[:3]
+			},
+			want: []string{"deleted:0", "deleted:0"},
+		},
+		{
+			name: "appended",
+			tamper: func(lines []string) []string {
+				return append(lines, `{"id":"20250101-fake"}`)
+			},
+			want: []string{"inserted:6"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := testAuditSigner(t)
+			path := writeAudited(t, t.TempDir(), signer, 5)
+			writeLines(t, path, tt.tamper(readLines(t, path)))
+
+			report, err := VerifyAudit(path, signer.PublicKey())
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, problemKinds(report))
+		})
+	}
+}
+
+func TestAudit_DetectsRewrittenLog(t *testing.T) {
+	signer := testAuditSigner(t)
+	path := writeAudited(t, t.TempDir(), signer, 3)
+
+	// Rewriting the chain to match a modified file breaks the signature
+	lines := readLines(t, path)
+	lines[0] = strings.Replace(lines[0], "claude", "openai", 1)
+	writeLines(t, path, lines)
+	require.NoError(t, RebuildAudit(path, nil, "compact"))
+	log := readLines(t, auditPath(path))
+	original := readLines(t, auditPath(writeAudited(t, t.TempDir(), signer, 3)))
+	writeLines(t, auditPath(path), append(log, original[len(original)-1]))
+
+	report, err := VerifyAudit(path, signer.PublicKey())
+	require.NoError(t, err)
+	assert.NotEmpty(t, report.Problems)
+	assert.Zero(t, report.Signed)
+}
+
+func TestAudit_DeletedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeAudited(t, dir, nil, 3)
+	require.NoError(t, os.Remove(path))
+
+	files, err := AuditedFiles(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{path}, files)
+
+	report, err := VerifyAudit(path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deleted:0", "deleted:0", "deleted:0"}, problemKinds(report))
+}
+
+func TestRebuildAudit(t *testing.T) {
+	dir := t.TempDir()
+	signer := testAuditSigner(t)
+	path := writeAudited(t, dir, signer, 3)
+
+	require.NoError(t, RewriteFile(path, nil, func(rec *Recording) error {
+		rec.Project = "search"
+		return nil
+	}))
+	report, err := VerifyAudit(path, signer.PublicKey())
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+
+	require.NoError(t, RebuildAudit(path, signer, "compact"))
+	report, err = VerifyAudit(path, signer.PublicKey())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+	assert.Equal(t, 3, report.Signed)
+	assert.Equal(t, "compact", report.Rebuilt)
+
+	// The new log carries on from the old one's head
+	require.NoError(t, RebuildAudit(path, signer, "migrate"))
+	report, err = VerifyAudit(path, signer.PublicKey())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+	assert.Equal(t, "migrate", report.Rebuilt)
+
+	// Compressed files keep their audit log
+	compressed, err := CompressFile(dir, filepath.Base(path))
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(path))
+	report, err = VerifyAudit(filepath.Join(dir, compressed), signer.PublicKey())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+
+	// Files without an audit log are left alone
+	plain := filepath.Join(dir, "recordings-2025-01-02.jsonl")
+	writeLines(t, plain, []string{`{"id":"x"}`})
+	require.NoError(t, RebuildAudit(plain, signer, "compact"))
+	_, err = os.Stat(auditPath(plain))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRebuildAudit_RefusesBrokenLog(t *testing.T) {
+	signer := testAuditSigner(t)
+	path := writeAudited(t, t.TempDir(), signer, 3)
+
+	// A log signed by another key is not re-signed
+	assert.ErrorContains(t, RebuildAudit(path, testAuditSigner(t), "compact"), "does not verify")
+
+	// Nor is a broken chain, even without a key
+	log := readLines(t, auditPath(path))
+	writeLines(t, auditPath(path), append(log[:1], log[2:]...))
+	before := readLines(t, auditPath(path))
+	assert.ErrorContains(t, RebuildAudit(path, nil, "compact"), "does not verify")
+	assert.Equal(t, before, readLines(t, auditPath(path)))
+}
+
+func TestAudit_RequiresSignatures(t *testing.T) {
+	dir := t.TempDir()
+	signer := testAuditSigner(t)
+	path := writeAudited(t, dir, nil, 2)
+
+	// The unsynced tail of the file being written may be unsigned
+	report, err := VerifyAudit(path, signer.PublicKey())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+
+	// Once a newer file is started, it may not
+	writeLines(t, filepath.Join(dir, "recordings-2025-01-02.jsonl"), []string{`{"id":"20250102-0000"}`})
+	report, err = VerifyAudit(path, signer.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"signature:0"}, problemKinds(report))
+	assert.Contains(t, report.Problems[0].Detail, "not covered")
+
+	// Nor may a rebuild entry
+	require.NoError(t, RebuildAudit(path, nil, "compact"))
+	report, err = VerifyAudit(path, signer.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"signature:0"}, problemKinds(report))
+	assert.Contains(t, report.Problems[0].Detail, "not signed")
+}
+
+func TestAudit_FileLog(t *testing.T) {
+	dir := t.TempDir()
+	signer := testAuditSigner(t)
+	path := writeAudited(t, dir, signer, 2)
+
+	report, err := VerifyAuditFiles(dir, signer.PublicKey())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+	assert.Equal(t, 1, report.Entries)
+
+	// A file removed by a command has a signed removal entry
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, RebuildAudit(path, signer, "prune"))
+	_, err = os.Stat(auditPath(path))
+	assert.True(t, os.IsNotExist(err))
+	report, err = VerifyAuditFiles(dir, signer.PublicKey())
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+	assert.Equal(t, 2, report.Entries)
+
+	// One deleted together with its audit log is detected
+	path = writeAudited(t, dir, signer, 1)
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, os.Remove(auditPath(path)))
+	report, err = VerifyAuditFiles(dir, signer.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"missing:0"}, problemKinds(report))
+
+	// As is removing the file log while other files are audited
+	require.NoError(t, os.Remove(filepath.Join(dir, auditDir, auditFilesLog)))
+	require.NoError(t, os.WriteFile(auditPath(filepath.Join(dir, "recordings-2025-01-02.jsonl")), nil, 0644))
+	report, err = VerifyAuditFiles(dir, signer.PublicKey())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"missing:0"}, problemKinds(report))
+}
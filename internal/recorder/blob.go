@@ -0,0 +1,77 @@
+package recorder
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// Blob holds binary content such as uploaded files, generated images or
+// synthesized audio
+type Blob struct {
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	Data        string `json:"data,omitempty"` // base64
+}
+
+// NewBlob wraps binary data
+func NewBlob(contentType string, data []byte) *Blob {
+	sum := sha256.Sum256(data)
+	return &Blob{
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		Data:        base64.StdEncoding.EncodeToString(data),
+	}
+}
+
+// Bytes decodes the blob's content
+func (b *Blob) Bytes() ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(b.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode blob: %w", err)
+	}
+	return data, nil
+}
+
+// MultipartPart is one part of a multipart/form-data request. Text fields
+// keep their value; file fields are stored as blobs.
+type MultipartPart struct {
+	Name        string `json:"name"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Value       string `json:"value,omitempty"`
+	Blob        *Blob  `json:"blob,omitempty"`
+}
+
+// BlobRef locates a blob within a recording
+type BlobRef struct {
+	Ref      string // "request", "request.raw", "response", "response.raw" or "multipart[i]"
+	Filename string // original upload filename, if any
+	Blob     *Blob
+}
+
+// Blobs lists every blob in the recording
+func (rec *Recording) Blobs() []BlobRef {
+	var refs []BlobRef
+	if rec.Request.Blob != nil {
+		refs = append(refs, BlobRef{Ref: "request", Blob: rec.Request.Blob})
+	}
+	if rec.Request.Raw != nil {
+		refs = append(refs, BlobRef{Ref: "request.raw", Blob: rec.Request.Raw})
+	}
+	for i, part := range rec.Request.Multipart {
+		if part.Blob != nil {
+			refs = append(refs, BlobRef{Ref: fmt.Sprintf("multipart[%d]", i), Filename: part.Filename, Blob: part.Blob})
+		}
+	}
+	if rec.Response.Blob != nil {
+		refs = append(refs, BlobRef{Ref: "response", Blob: rec.Response.Blob})
+	}
+	if rec.Response.Raw != nil {
+		refs = append(refs, BlobRef{Ref: "response.raw", Blob: rec.Response.Raw})
+	}
+	return refs
+}
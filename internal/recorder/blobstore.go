@@ -0,0 +1,279 @@
+package recorder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobMarker prefixes a string value that was moved to the blob store.
+// The full value is BlobMarker followed by the content's SHA-256 in hex.
+const BlobMarker = "mirra-blob:sha256:"
+
+// DefaultInlineThreshold is the largest value, in bytes, kept inline in a
+// recording before it is moved to the blob store
+const DefaultInlineThreshold = 16 * 1024
+
+// BlobStore is a content-addressed store for large and binary payloads,
+// kept under the recordings directory. Identical content is stored once.
+type BlobStore struct {
+	dir  string
+	keys *Keyring
+}
+
+// NewBlobStore creates a blob store in the recordings directory
+func NewBlobStore(recordingsPath string) *BlobStore {
+	return &BlobStore{dir: filepath.Join(recordingsPath, "blobs")}
+}
+
+// SetKeyring encrypts new blobs with the keyring's active key and decrypts
+// encrypted blobs when they are read
+func (s *BlobStore) SetKeyring(keys *Keyring) {
+	s.keys = keys
+}
+
+// Path returns the file that holds the blob with the given hash
+func (s *BlobStore) Path(sum string) string {
+	if len(sum) < 2 {
+		return filepath.Join(s.dir, sum)
+	}
+	return filepath.Join(s.dir, sum[:2], sum)
+}
+
+// Put stores data and returns its SHA-256. Storing existing content is a
+// no-op.
+func (s *BlobStore) Put(data []byte) (string, error) {
+	digest := sha256.Sum256(data)
+	sum := hex.EncodeToString(digest[:])
+	path := s.Path(sum)
+
+	if _, err := os.Stat(path); err == nil {
+		return sum, nil
+	}
+
+	if s.keys != nil {
+		var err error
+		if data, err = s.keys.sealBlob(data, sum); err != nil {
+			return "", fmt.Errorf("failed to encrypt blob: %w", err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	if err := writeBlobFile(path, data); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// writeBlobFile writes to a temporary file first so readers never see
+// partial blobs
+func writeBlobFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+	return nil
+}
+
+// Get reads a blob, decrypting it if needed, and verifies its hash
+func (s *BlobStore) Get(sum string) ([]byte, error) {
+	data, err := os.ReadFile(s.Path(sum))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", sum, err)
+	}
+	if isSealedBlob(data) {
+		if data, err = s.keys.openBlob(data, sum); err != nil {
+			return nil, err
+		}
+	}
+
+	digest := sha256.Sum256(data)
+	if hex.EncodeToString(digest[:]) != sum {
+		return nil, fmt.Errorf("blob %s is corrupt", sum)
+	}
+	return data, nil
+}
+
+// Rekey encrypts every blob with the keyring's active key, rewrapping the
+// data keys of blobs encrypted with another key, and returns how many blobs
+// changed
+func (s *BlobStore) Rekey() (int, error) {
+	if s.keys == nil {
+		return 0, errors.New("no keyring set")
+	}
+
+	count := 0
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == s.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.Contains(d.Name(), ".tmp-") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read blob %s: %w", d.Name(), err)
+		}
+		rekeyed, err := s.keys.rekeyBlob(data, d.Name())
+		if err != nil || rekeyed == nil {
+			return err
+		}
+		if err := writeBlobFile(path, rekeyed); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// ReadBlob returns a blob's content, whether inline or in the store
+func (s *BlobStore) ReadBlob(b *Blob) ([]byte, error) {
+	if b.Data != "" || b.Size == 0 {
+		return b.Bytes()
+	}
+	return s.Get(b.SHA256)
+}
+
+// Externalize moves blobs and string values larger than threshold bytes
+// out of the recording and into the store. Values that fail to store stay
+// inline, so no content is lost; the first error is returned.
+func (s *BlobStore) Externalize(rec *Recording, threshold int) error {
+	var firstErr error
+	keep := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	str := func(v string) string {
+		if len(v) <= threshold || strings.HasPrefix(v, BlobMarker) {
+			return v
+		}
+		sum, err := s.Put([]byte(v))
+		if err != nil {
+			keep(err)
+			return v
+		}
+		return BlobMarker + sum
+	}
+
+	rec.Request.Body = mapStrings(rec.Request.Body, str)
+	rec.Response.Body = mapStrings(rec.Response.Body, str)
+	for i := range rec.Request.Multipart {
+		rec.Request.Multipart[i].Value = str(rec.Request.Multipart[i].Value)
+	}
+
+	for _, ref := range rec.Blobs() {
+		b := ref.Blob
+		if b.Data == "" || b.Size <= int64(threshold) {
+			continue
+		}
+		data, err := b.Bytes()
+		if err != nil {
+			keep(err)
+			continue
+		}
+		if _, err := s.Put(data); err != nil {
+			keep(err)
+			continue
+		}
+		b.Data = ""
+	}
+
+	return firstErr
+}
+
+// HydrateText restores deduplicated fragments and externalized string
+// values. Blobs stay in the store and can be read with ReadBlob.
+func (s *BlobStore) HydrateText(rec *Recording) error {
+	// Fragments are resolved first since they may contain string markers
+	body, firstErr := s.resolveFragments(rec.Request.Body)
+	rec.Request.Body = body
+
+	str := func(v string) string {
+		sum, ok := strings.CutPrefix(v, BlobMarker)
+		if !ok {
+			return v
+		}
+		data, err := s.Get(sum)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return v
+		}
+		return string(data)
+	}
+
+	rec.Request.Body = mapStrings(rec.Request.Body, str)
+	rec.Response.Body = mapStrings(rec.Response.Body, str)
+	for i := range rec.Request.Multipart {
+		rec.Request.Multipart[i].Value = str(rec.Request.Multipart[i].Value)
+	}
+
+	return firstErr
+}
+
+// Hydrate restores a recording to its fully inline form, as if it had been
+// written without a blob store
+func (s *BlobStore) Hydrate(rec *Recording) error {
+	firstErr := s.HydrateText(rec)
+
+	for _, ref := range rec.Blobs() {
+		b := ref.Blob
+		if b.Data != "" || b.Size == 0 {
+			continue
+		}
+		data, err := s.Get(b.SHA256)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		b.Data = NewBlob(b.ContentType, data).Data
+	}
+
+	return firstErr
+}
+
+// mapStrings applies fn to every string in a decoded JSON value. Maps and
+// slices are modified in place.
+func mapStrings(v any, fn func(string) string) any {
+	switch val := v.(type) {
+	case string:
+		return fn(val)
+	case []any:
+		for i, item := range val {
+			val[i] = mapStrings(item, fn)
+		}
+	case map[string]any:
+		for k, item := range val {
+			val[k] = mapStrings(item, fn)
+		}
+	}
+	return v
+}
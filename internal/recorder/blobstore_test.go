@@ -0,0 +1,98 @@
+package recorder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobStore_PutGet(t *testing.T) {
+	store := NewBlobStore(t.TempDir())
+
+	sum, err := store.Put([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sum)
+
+	// Identical content is stored once
+	again, err := store.Put([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, sum, again)
+
+	data, err := store.Get(sum)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	require.NoError(t, os.WriteFile(store.Path(sum), []byte("tampered"), 0644))
+	_, err = store.Get(sum)
+	assert.ErrorContains(t, err, "corrupt")
+}
+
+func TestBlobStore_ExternalizeAndHydrate(t *testing.T) {
+	dir := t.TempDir()
+	store := NewBlobStore(dir)
+
+	image := strings.Repeat("iVBORw0KGgo", 100)
+	audio := make([]byte, 2048)
+	for i := range audio {
+		audio[i] = byte(i)
+	}
+
+	rec := &Recording{
+		ID: "20250101-abc",
+		Request: RequestData{
+			Body: map[string]any{
+				"model": "claude-sonnet-4",
+				"messages": []any{
+					map[string]any{"role": "user", "content": []any{
+						map[string]any{"type": "image", "source": map[string]any{"data": image}},
+						map[string]any{"type": "text", "text": "describe this"},
+					}},
+				},
+			},
+		},
+		Response: ResponseData{Blob: NewBlob("audio/mpeg", audio)},
+	}
+	original, err := json.Marshal(rec)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Externalize(rec, 512))
+
+	stored, err := json.Marshal(rec)
+	require.NoError(t, err)
+	assert.Less(t, len(stored), 1024)
+	assert.NotContains(t, string(stored), image)
+	assert.Contains(t, string(stored), BlobMarker)
+	assert.Contains(t, string(stored), "describe this")
+	assert.Empty(t, rec.Response.Blob.Data)
+
+	data, err := store.ReadBlob(rec.Response.Blob)
+	require.NoError(t, err)
+	assert.Equal(t, audio, data)
+
+	// Round trip through JSON, as readers do
+	var read Recording
+	require.NoError(t, json.Unmarshal(stored, &read))
+	require.NoError(t, store.Hydrate(&read))
+	restored, err := json.Marshal(&read)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(original), string(restored))
+
+	entries, err := filepath.Glob(filepath.Join(dir, "blobs", "*", "*"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestBlobStore_HydrateMissing(t *testing.T) {
+	store := NewBlobStore(t.TempDir())
+	marker := BlobMarker + strings.Repeat("0", 64)
+	rec := &Recording{Request: RequestData{Body: map[string]any{"system": marker}}}
+
+	err := store.HydrateText(rec)
+	assert.Error(t, err)
+	assert.Equal(t, marker, rec.Request.Body.(map[string]any)["system"])
+}
@@ -0,0 +1,495 @@
+package recorder
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Recordings can be encrypted at rest with envelope encryption. Each
+// recording's payload is sealed with AES-256-GCM under a fresh data key,
+// which is stored next to it wrapped by a key-encryption key from the
+// keyring. The key ID is kept with the wrapped key, so keys can be rotated
+// by adding a new active key and rewrapping data keys with mirra rekey.
+
+const (
+	// KeysEnv holds a keyring inline, as KeyFileEnv's file would
+	KeysEnv = "MIRRA_ENCRYPTION_KEYS"
+	// KeyFileEnv names a keyring file
+	KeyFileEnv = "MIRRA_ENCRYPTION_KEY_FILE"
+)
+
+// ErrNoKey is returned when reading encrypted data without its key
+var ErrNoKey = errors.New("recording is encrypted and its key is not available")
+
+// blobMagic starts blob files encrypted by a keyring
+var blobMagic = []byte("MIRRAEN1")
+
+// Keyring holds the keys recordings are encrypted with. New recordings use
+// the active key; the others are kept to read older ones.
+type Keyring struct {
+	active string
+	ids    []string
+	aeads  map[string]cipher.AEAD
+}
+
+// ParseKeyring parses keys written as id:base64-key, one per line or
+// separated by commas. The first key is the active one. Keys are 32 bytes;
+// blank lines and lines starting with # are ignored.
+func ParseKeyring(text string) (*Keyring, error) {
+	k := &Keyring{aeads: make(map[string]cipher.AEAD)}
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ',' }) {
+		field = strings.TrimSpace(field)
+		if field == "" || strings.HasPrefix(field, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(field, ":")
+		if !ok || id == "" {
+			return nil, errors.New("keys must be written as id:base64-key")
+		}
+		if _, exists := k.aeads[id]; exists {
+			return nil, fmt.Errorf("duplicate key %q", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not valid base64: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", id, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if k.active == "" {
+			k.active = id
+		}
+		k.ids = append(k.ids, id)
+		k.aeads[id] = aead
+	}
+	if k.active == "" {
+		return nil, errors.New("no encryption keys found")
+	}
+	return k, nil
+}
+
+// LoadKeyring reads a keyring file
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	k, err := ParseKeyring(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	return k, nil
+}
+
+// KeyringFromEnv returns the keyring given by KeysEnv or KeyFileEnv, or nil
+// if neither is set
+func KeyringFromEnv() (*Keyring, error) {
+	if keys := os.Getenv(KeysEnv); keys != "" {
+		k, err := ParseKeyring(keys)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", KeysEnv, err)
+		}
+		return k, nil
+	}
+	if path := os.Getenv(KeyFileEnv); path != "" {
+		return LoadKeyring(path)
+	}
+	return nil, nil
+}
+
+// GenerateKey returns a new random key, base64 encoded for a keyring
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ActiveID returns the ID of the key new recordings are encrypted with
+func (k *Keyring) ActiveID() string {
+	return k.active
+}
+
+// IDs returns the IDs of every key, active first
+func (k *Keyring) IDs() []string {
+	return k.ids
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals data with AEAD, prefixing the random nonce
+func encrypt(aead cipher.AEAD, data, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, aad), nil
+}
+
+// decrypt opens data sealed by encrypt
+func decrypt(aead cipher.AEAD, data, aad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+}
+
+// seal encrypts data under a new data key and returns the ciphertext and
+// the data key wrapped with the active key
+func (k *Keyring) seal(data, aad []byte) (wrapped, ciphertext []byte, err error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ciphertext, err = encrypt(aead, data, aad); err != nil {
+		return nil, nil, err
+	}
+	if wrapped, err = encrypt(k.aeads[k.active], dataKey, []byte(k.active)); err != nil {
+		return nil, nil, err
+	}
+	return wrapped, ciphertext, nil
+}
+
+// unwrap returns the data key wrapped with a key
+func (k *Keyring) unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	kek, ok := k.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: key %q is not in the keyring", ErrNoKey, keyID)
+	}
+	dataKey, err := decrypt(kek, wrapped, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with key %q: %w", keyID, err)
+	}
+	return dataKey, nil
+}
+
+// open decrypts data sealed by seal
+func (k *Keyring) open(keyID string, wrapped, ciphertext, aad []byte) ([]byte, error) {
+	dataKey, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decrypt(aead, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return data, nil
+}
+
+// rewrap wraps a data key with the active key instead
+func (k *Keyring) rewrap(keyID string, wrapped []byte) ([]byte, error) {
+	dataKey, err := k.unwrap(keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return encrypt(k.aeads[k.active], dataKey, []byte(k.active))
+}
+
+// Sealed is the encrypted part of a recording
+type Sealed struct {
+	KeyID string `json:"kid"`
+	Key   []byte `json:"key"`  // data key, wrapped with the key-encryption key
+	Data  []byte `json:"data"` // sealed payload
+}
+
+// sealedPayload is what Seal encrypts: everything but the metadata used to
+// index and list recordings
+type sealedPayload struct {
+	Request  RequestData  `json:"request"`
+	Response ResponseData `json:"response"`
+	Findings []Finding    `json:"findings,omitempty"`
+
+	// Fields that identify who made the request. Recordings sealed before
+	// they were moved here keep them in plaintext.
+	Error      string   `json:"error,omitempty"`
+	VirtualKey *KeyData `json:"virtualKey,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Project    string   `json:"project,omitempty"`
+	Session    string   `json:"session,omitempty"`
+	User       string   `json:"user,omitempty"`
+}
+
+// sealedError stands in for the error of a sealed recording, so retention
+// and listings can tell failed requests apart without the key
+const sealedError = "encrypted"
+
+// Seal encrypts a recording's headers, bodies, findings, error and the
+// fields naming who made it (X-Mirra-* metadata and the virtual key's owner
+// and project) with the active key. The ID, timestamp, provider, method,
+// path, status, timing and virtual key ID stay readable. Sealing a sealed
+// recording does nothing.
+func (k *Keyring) Seal(rec *Recording) error {
+	if rec.Sealed != nil {
+		return nil
+	}
+	payload, err := json.Marshal(sealedPayload{
+		Request:    rec.Request,
+		Response:   rec.Response,
+		Findings:   rec.Findings,
+		Error:      rec.Error,
+		VirtualKey: rec.VirtualKey,
+		Tags:       rec.Tags,
+		Project:    rec.Project,
+		Session:    rec.Session,
+		User:       rec.User,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	wrapped, data, err := k.seal(payload, []byte(rec.ID))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt recording %s: %w", rec.ID, err)
+	}
+
+	rec.Request = RequestData{Method: rec.Request.Method, Path: rec.Request.Path}
+	rec.Response = ResponseData{Status: rec.Response.Status, Streaming: rec.Response.Streaming}
+	rec.Findings = nil
+	if rec.Error != "" {
+		rec.Error = sealedError
+	}
+	// The virtual key ID is random and names no one
+	if rec.VirtualKey != nil {
+		rec.VirtualKey = &KeyData{ID: rec.VirtualKey.ID}
+	}
+	rec.Tags, rec.Project, rec.Session, rec.User = nil, "", "", ""
+	rec.Sealed = &Sealed{KeyID: k.active, Key: wrapped, Data: data}
+	return nil
+}
+
+// Open decrypts a sealed recording in place. Plain recordings are left as
+// they are, so a nil keyring can open them; sealed ones need their key.
+func (k *Keyring) Open(rec *Recording) error {
+	if rec.Sealed == nil {
+		return nil
+	}
+	if k == nil {
+		return ErrNoKey
+	}
+	data, err := k.open(rec.Sealed.KeyID, rec.Sealed.Key, rec.Sealed.Data, []byte(rec.ID))
+	if err != nil {
+		return fmt.Errorf("failed to open recording %s: %w", rec.ID, err)
+	}
+
+	// Keep body numbers exact, as DecodeRecording does
+	var payload sealedPayload
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return fmt.Errorf("failed to parse recording %s: %w", rec.ID, err)
+	}
+	rec.Request = payload.Request
+	rec.Response = payload.Response
+	rec.Findings = payload.Findings
+	if payload.Error != "" {
+		rec.Error = payload.Error
+	}
+	if payload.VirtualKey != nil {
+		rec.VirtualKey = payload.VirtualKey
+	}
+	if payload.Tags != nil {
+		rec.Tags = payload.Tags
+	}
+	if payload.Project != "" {
+		rec.Project = payload.Project
+	}
+	if payload.Session != "" {
+		rec.Session = payload.Session
+	}
+	if payload.User != "" {
+		rec.User = payload.User
+	}
+	rec.Sealed = nil
+	return nil
+}
+
+// plainIdentity reports whether a sealed recording still has fields that
+// identify who made the request in plaintext, as recordings sealed before
+// they were moved into the payload do
+func plainIdentity(rec *Recording) bool {
+	return rec.Sealed != nil && (rec.User != "" || rec.Session != "" || rec.Project != "" || len(rec.Tags) > 0 ||
+		(rec.Error != "" && rec.Error != sealedError) || (rec.VirtualKey != nil && (rec.VirtualKey.Owner != "" || rec.VirtualKey.Project != "")))
+}
+
+// SealedWithoutKey counts the recordings in dir encrypted with a key the
+// keyring does not hold. Their headers, bodies and client metadata cannot be
+// read, so callers matching on them would silently skip these recordings.
+func SealedWithoutKey(dir string, keys *Keyring) (int, error) {
+	files, err := RecordingFiles(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list recordings: %w", err)
+	}
+	n := 0
+	for _, file := range files {
+		err := eachLine(file, func(line []byte) error {
+			var partial struct {
+				Sealed *Sealed `json:"sealed"`
+			}
+			if json.Unmarshal(line, &partial) == nil && partial.Sealed != nil {
+				if keys == nil || keys.aeads[partial.Sealed.KeyID] == nil {
+					n++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+		}
+	}
+	return n, nil
+}
+
+// Rekey seals a plain recording, or rewraps a sealed one's data key with the
+// active key, and reports whether the recording changed. Sealed recordings
+// that still name who made the request in plaintext are sealed again.
+func (k *Keyring) Rekey(rec *Recording) (bool, error) {
+	if rec.Sealed == nil {
+		return true, k.Seal(rec)
+	}
+	if plainIdentity(rec) {
+		if err := k.Open(rec); err != nil {
+			return false, fmt.Errorf("failed to rekey recording %s: %w", rec.ID, err)
+		}
+		return true, k.Seal(rec)
+	}
+	if rec.Sealed.KeyID == k.active {
+		return false, nil
+	}
+	wrapped, err := k.rewrap(rec.Sealed.KeyID, rec.Sealed.Key)
+	if err != nil {
+		return false, fmt.Errorf("failed to rekey recording %s: %w", rec.ID, err)
+	}
+	rec.Sealed.KeyID = k.active
+	rec.Sealed.Key = wrapped
+	return true, nil
+}
+
+// Encrypted blob files are blobMagic, the key ID and wrapped data key, each
+// prefixed by a 2-byte length, then the sealed content. The blob's hash is
+// bound to the content, so a blob cannot be swapped for another.
+
+func (k *Keyring) sealBlob(data []byte, sum string) ([]byte, error) {
+	wrapped, ciphertext, err := k.seal(data, []byte(sum))
+	if err != nil {
+		return nil, err
+	}
+	return encodeBlob(k.active, wrapped, ciphertext), nil
+}
+
+func encodeBlob(keyID string, wrapped, ciphertext []byte) []byte {
+	out := make([]byte, 0, len(blobMagic)+4+len(keyID)+len(wrapped)+len(ciphertext))
+	out = append(out, blobMagic...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(keyID)))
+	out = append(out, keyID...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(wrapped)))
+	out = append(out, wrapped...)
+	return append(out, ciphertext...)
+}
+
+func decodeBlob(data []byte) (keyID string, wrapped, ciphertext []byte, err error) {
+	rest := data[len(blobMagic):]
+	field := func() ([]byte, error) {
+		if len(rest) < 2 {
+			return nil, errors.New("truncated encrypted blob")
+		}
+		n := int(binary.BigEndian.Uint16(rest))
+		if len(rest) < 2+n {
+			return nil, errors.New("truncated encrypted blob")
+		}
+		value := rest[2 : 2+n]
+		rest = rest[2+n:]
+		return value, nil
+	}
+	id, err := field()
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if wrapped, err = field(); err != nil {
+		return "", nil, nil, err
+	}
+	return string(id), wrapped, rest, nil
+}
+
+// isSealedBlob reports whether a blob file was encrypted by a keyring
+func isSealedBlob(data []byte) bool {
+	return bytes.HasPrefix(data, blobMagic)
+}
+
+func (k *Keyring) openBlob(data []byte, sum string) ([]byte, error) {
+	if k == nil {
+		return nil, fmt.Errorf("blob %s: %w", sum, ErrNoKey)
+	}
+	keyID, wrapped, ciphertext, err := decodeBlob(data)
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %w", sum, err)
+	}
+	plain, err := k.open(keyID, wrapped, ciphertext, []byte(sum))
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %w", sum, err)
+	}
+	return plain, nil
+}
+
+// SealIndex encrypts an index derived from recordings, such as the session
+// groups, like a blob bound to the index's name
+func (k *Keyring) SealIndex(data []byte, name string) ([]byte, error) {
+	return k.sealBlob(data, name)
+}
+
+// OpenIndex decrypts an index sealed by SealIndex. Plain indexes are
+// returned as they are, so a nil keyring can open them.
+func (k *Keyring) OpenIndex(data []byte, name string) ([]byte, error) {
+	if !isSealedBlob(data) {
+		return data, nil
+	}
+	return k.openBlob(data, name)
+}
+
+// rekeyBlob returns a blob file sealed with the active key, or nil if it
+// already is
+func (k *Keyring) rekeyBlob(data []byte, sum string) ([]byte, error) {
+	if !isSealedBlob(data) {
+		return k.sealBlob(data, sum)
+	}
+	keyID, wrapped, ciphertext, err := decodeBlob(data)
+	if err != nil {
+		return nil, fmt.Errorf("blob %s: %w", sum, err)
+	}
+	if keyID == k.active {
+		return nil, nil
+	}
+	if wrapped, err = k.rewrap(keyID, wrapped); err != nil {
+		return nil, fmt.Errorf("blob %s: %w", sum, err)
+	}
+	return encodeBlob(k.active, wrapped, ciphertext), nil
+}
@@ -0,0 +1,187 @@
+package recorder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyring(t *testing.T, ids ...string) *Keyring {
+	t.Helper()
+	text := ""
+	for _, id := range ids {
+		text += id + ":" + mustKey(t) + "\n"
+	}
+	k, err := ParseKeyring(text)
+	require.NoError(t, err)
+	return k
+}
+
+func TestParseKeyring(t *testing.T) {
+	key := mustKey(t)
+	k, err := ParseKeyring("# keys\nnew:" + key + ", old:" + key)
+	require.NoError(t, err)
+	assert.Equal(t, "new", k.ActiveID())
+	assert.Equal(t, []string{"new", "old"}, k.IDs())
+
+	_, err = ParseKeyring("")
+	assert.Error(t, err)
+	_, err = ParseKeyring("a:" + key + "\na:" + key)
+	assert.ErrorContains(t, err, "duplicate")
+	_, err = ParseKeyring("a:c2hvcnQ=")
+	assert.ErrorContains(t, err, "32 bytes")
+}
+
+func TestKeyring_SealOpen(t *testing.T) {
+	k := testKeyring(t, "k1")
+	rec := Recording{
+		ID:       "20250101-abc",
+		Provider: "claude",
+		Request: RequestData{
+			Method:  "POST",
+			Path:    "/v1/messages",
+			Headers: map[string][]string{"Content-Type": {"application/json"}},
+			Body:    map[string]any{"max_tokens": json.Number("1024")},
+		},
+		Response:   ResponseData{Status: 200, Body: "secret answer"},
+		Findings:   []Finding{{Detector: "pii", Type: "email"}},
+		Error:      "upstream rejected alice@example.com",
+		VirtualKey: &KeyData{ID: "vk_1a2b3c4d", Owner: "alice", Project: "search"},
+		Tags:       []string{"team-alice"},
+		Project:    "search",
+		Session:    "session-alice",
+		User:       "alice",
+	}
+	original, err := json.Marshal(rec)
+	require.NoError(t, err)
+
+	require.NoError(t, k.Seal(&rec))
+	sealed, err := json.Marshal(rec)
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "secret answer")
+	assert.NotContains(t, string(sealed), "application/json")
+	assert.NotContains(t, string(sealed), "alice")
+	assert.NotContains(t, string(sealed), "search")
+	assert.Equal(t, "claude", rec.Provider)
+	assert.Equal(t, "vk_1a2b3c4d", rec.VirtualKey.ID)
+	assert.NotEmpty(t, rec.Error)
+	assert.Equal(t, "/v1/messages", rec.Request.Path)
+	assert.Equal(t, 200, rec.Response.Status)
+
+	// Without the key only the metadata is readable
+	var nokey *Keyring
+	assert.ErrorIs(t, nokey.Open(&rec), ErrNoKey)
+	assert.ErrorIs(t, testKeyring(t, "k2").Open(&rec), ErrNoKey)
+
+	require.NoError(t, k.Open(&rec))
+	opened, err := json.Marshal(rec)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(original), string(opened))
+}
+
+func TestKeyring_Rekey(t *testing.T) {
+	oldKey := mustKey(t)
+	old, err := ParseKeyring("old:" + oldKey)
+	require.NoError(t, err)
+	rec := Recording{ID: "20250101-abc", Response: ResponseData{Status: 200, Body: "answer"}}
+	require.NoError(t, old.Seal(&rec))
+
+	// The new key is active and the old one is kept to read older recordings
+	rotated, err := ParseKeyring("new:" + mustKey(t) + "\nold:" + oldKey)
+	require.NoError(t, err)
+
+	changed, err := rotated.Rekey(&rec)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "new", rec.Sealed.KeyID)
+
+	changed, err = rotated.Rekey(&rec)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	require.NoError(t, rotated.Open(&rec))
+	assert.Equal(t, "answer", rec.Response.Body)
+
+	// Recordings sealed with client metadata in plaintext are sealed again
+	rec.Sealed = nil
+	require.NoError(t, rotated.Seal(&rec))
+	rec.User = "alice"
+	changed, err = rotated.Rekey(&rec)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Empty(t, rec.User)
+	require.NoError(t, rotated.Open(&rec))
+	assert.Equal(t, "alice", rec.User)
+}
+
+func TestRekeyFile(t *testing.T) {
+	k := testKeyring(t, "k1")
+	path := filepath.Join(t.TempDir(), "2025-01-01.jsonl")
+	content := `{"id":"a","provider":"claude","response":{"status":200,"body":"one"}}
+not json
+{"id":"b","provider":"openai","response":{"status":500,"body":"two"}}
+`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	n, err := RekeyFile(path, k)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"one"`)
+	assert.Contains(t, string(data), "not json")
+
+	// Already encrypted with the active key, so nothing changes
+	n, err = RekeyFile(path, k)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	var ids []string
+	require.NoError(t, RewriteFile(path, k, func(rec *Recording) error {
+		ids = append(ids, rec.ID+"="+rec.Response.Body.(string))
+		return nil
+	}))
+	assert.Equal(t, []string{"a=one", "b=two"}, ids)
+}
+
+func TestBlobStore_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	k := testKeyring(t, "k1")
+	store := NewBlobStore(dir)
+	store.SetKeyring(k)
+
+	sum, err := store.Put([]byte("hello"))
+	require.NoError(t, err)
+	raw, err := os.ReadFile(store.Path(sum))
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "hello")
+
+	data, err := store.Get(sum)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	_, err = NewBlobStore(dir).Get(sum)
+	assert.ErrorIs(t, err, ErrNoKey)
+
+	// Plain blobs are still readable and get encrypted by Rekey
+	plain, err := NewBlobStore(dir).Put([]byte("plain"))
+	require.NoError(t, err)
+	n, err := store.Rekey()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	data, err = store.Get(plain)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(data))
+}
+
+func mustKey(t *testing.T) string {
+	t.Helper()
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	return key
+}
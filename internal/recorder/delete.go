@@ -0,0 +1,489 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// DeleteResult describes recordings removed, or that would be removed, by
+// Delete
+type DeleteResult struct {
+	DryRun      bool     `json:"dryRun"`
+	IDs         []string `json:"ids"`
+	Files       []string `json:"files"` // files rewritten or removed
+	Bytes       int64    `json:"bytes"`
+	Blobs       int      `json:"blobs"`                 // blob store entries only deleted recordings used
+	Undecrypted int      `json:"undecrypted,omitempty"` // encrypted recordings matched on plaintext metadata only
+}
+
+// blobHashPattern finds anything that can name a blob: string markers,
+// fragment references and blob hashes
+var blobHashPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// Delete removes the recordings match selects from the files in dir, along
+// with blobs no remaining recording uses. Encrypted recordings are opened
+// with keys before matching; without their key only the plaintext metadata
+// can match, and their blobs are kept. Files are rewritten in place, so
+// callers must stop writing to them first and reindex the changed files
+// afterwards.
+func Delete(dir string, keys *Keyring, match func(*Recording) bool, dryRun bool) (*DeleteResult, error) {
+	files, err := RecordingFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	result := &DeleteResult{DryRun: dryRun, IDs: []string{}, Files: []string{}}
+	candidates := make(map[string]bool)
+	// selected decodes a line and reports whether match selects it and
+	// whether it could be decrypted. Lines that cannot be parsed are kept.
+	selected := func(line []byte) (rec Recording, opened, ok bool) {
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return rec, false, false
+		}
+		opened = keys.Open(&rec) == nil
+		return rec, opened, match(&rec)
+	}
+
+	for _, file := range files {
+		var deleted, kept int
+		err := eachLine(file, func(line []byte) error {
+			rec, opened, ok := selected(line)
+			if !ok {
+				kept++
+				return nil
+			}
+			deleted++
+			result.IDs = append(result.IDs, rec.ID)
+			result.Bytes += int64(len(line)) + 1
+			if !opened {
+				result.Undecrypted++
+				return nil
+			}
+			for _, sum := range blobHashes(&rec) {
+				candidates[sum] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+		}
+		if deleted == 0 {
+			continue
+		}
+		result.Files = append(result.Files, filepath.Base(file))
+		if dryRun {
+			continue
+		}
+		if kept == 0 {
+			if err := os.Remove(file); err != nil {
+				return result, fmt.Errorf("failed to delete %s: %w", filepath.Base(file), err)
+			}
+			continue
+		}
+		err = rewriteLines(file, func(line []byte) ([]byte, error) {
+			if _, _, ok := selected(line); ok {
+				return nil, nil
+			}
+			return line, nil
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to rewrite %s: %w", filepath.Base(file), err)
+		}
+	}
+	if !dryRun && len(candidates) > 0 {
+		removed, err := removeUnusedBlobs(dir, keys, candidates)
+		result.Blobs = removed
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if !dryRun && len(result.IDs) > 0 {
+		slog.Info("deleted recordings", "recordings", len(result.IDs), "bytes", result.Bytes, "files", len(result.Files), "blobs", result.Blobs)
+	}
+	return result, nil
+}
+
+// Scrub rewrites the recordings match selects with fn, in the files that
+// hold one, and removes blobs only their old versions used. It returns the
+// same result as Delete, with Bytes left at 0. Nothing is changed if a
+// selected recording cannot be decrypted, since fn could not reach its
+// request and response. Like Delete, callers must stop writing first and
+// reindex the changed files afterwards.
+func Scrub(dir string, keys *Keyring, match func(*Recording) bool, fn func(*Recording), dryRun bool) (*DeleteResult, error) {
+	files, err := RecordingFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	result := &DeleteResult{DryRun: dryRun, IDs: []string{}, Files: []string{}}
+	candidates := make(map[string]bool)
+	var changed []string
+	for _, file := range files {
+		found := false
+		err := eachLine(file, func(line []byte) error {
+			var rec Recording
+			if json.Unmarshal(line, &rec) != nil {
+				return nil
+			}
+			opened := keys.Open(&rec) == nil
+			if !match(&rec) {
+				return nil
+			}
+			if !opened {
+				return fmt.Errorf("recording %s cannot be decrypted; set %s or %s", rec.ID, KeysEnv, KeyFileEnv)
+			}
+			found = true
+			result.IDs = append(result.IDs, rec.ID)
+			for _, sum := range blobHashes(&rec) {
+				candidates[sum] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(file), err)
+		}
+		if found {
+			result.Files = append(result.Files, filepath.Base(file))
+			changed = append(changed, file)
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	for _, file := range changed {
+		err := RewriteFile(file, keys, func(rec *Recording) error {
+			if match(rec) {
+				fn(rec)
+			}
+			return nil
+		})
+		if err != nil {
+			return result, fmt.Errorf("failed to rewrite %s: %w", filepath.Base(file), err)
+		}
+	}
+	if len(candidates) > 0 {
+		removed, err := removeUnusedBlobs(dir, keys, candidates)
+		result.Blobs = removed
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if len(result.IDs) > 0 {
+		slog.Info("scrubbed recordings", "recordings", len(result.IDs), "files", len(result.Files), "blobs", result.Blobs)
+	}
+	return result, nil
+}
+
+// blobHashes returns every hash in an opened recording that may name a blob
+func blobHashes(rec *Recording) []string {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil
+	}
+	return blobHashPattern.FindAllString(string(data), -1)
+}
+
+// removeUnusedBlobs deletes the candidate blobs, and blobs only they
+// reference, that no recording left in dir or its quarantine uses. Nothing
+// is deleted if a remaining recording cannot be decrypted.
+func removeUnusedBlobs(dir string, keys *Keyring, candidates map[string]bool) (int, error) {
+	usage := newBlobUsage(dir, keys, candidates, nil)
+	if err := usage.scan(); err != nil {
+		return 0, err
+	}
+	return usage.remove()
+}
+
+// blobUsage finds which candidate blobs, and blobs only they reference, the
+// recordings in a directory still use. It can scan again to catch up on
+// lines appended since, so the bulk of the work can happen while the writer
+// keeps running.
+type blobUsage struct {
+	dir        string
+	keys       *Keyring
+	blobs      *BlobStore
+	candidates map[string]bool
+	used       map[string]bool
+	skip       map[string]bool  // recordings being deleted
+	scanned    map[string]int64 // bytes of each file already scanned
+	archive    string           // retention archive whose recordings also count
+}
+
+func newBlobUsage(dir string, keys *Keyring, candidates, skip map[string]bool) *blobUsage {
+	u := &blobUsage{
+		dir:        dir,
+		keys:       keys,
+		blobs:      NewBlobStore(dir),
+		candidates: candidates,
+		used:       make(map[string]bool),
+		skip:       skip,
+		scanned:    make(map[string]int64),
+	}
+	u.blobs.SetKeyring(keys)
+	for sum := range candidates {
+		u.expand(sum, candidates)
+	}
+	return u
+}
+
+// expand adds the blobs a fragment references to into
+func (u *blobUsage) expand(sum string, into map[string]bool) {
+	data, err := u.blobs.Get(sum)
+	if err != nil || len(data) == 0 || (data[0] != '{' && data[0] != '[' && data[0] != '"') {
+		return
+	}
+	for _, ref := range blobHashPattern.FindAllString(string(data), -1) {
+		if !into[ref] {
+			into[ref] = true
+			u.expand(ref, into)
+		}
+	}
+}
+
+// scan reads the lines not scanned yet. Recording files only grow while
+// the writer runs, so a plain file is read from where the last scan
+// stopped; compressed files are never appended to and are read once.
+func (u *blobUsage) scan() error {
+	files, err := RecordingFiles(u.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list recordings: %w", err)
+	}
+	if quarantined, err := filepath.Glob(filepath.Join(u.dir, QuarantineDir, "*.jsonl")); err == nil {
+		files = append(files, quarantined...)
+	}
+	if u.archive != "" {
+		if archived, err := filepath.Glob(filepath.Join(u.archive, "*.jsonl")); err == nil {
+			files = append(files, archived...)
+		}
+	}
+
+	for _, file := range files {
+		from, seen := u.scanned[file]
+		if seen && IsCompressed(file) {
+			continue
+		}
+		if IsCompressed(file) {
+			err = eachLine(file, u.check)
+		} else {
+			from, err = eachLineFrom(file, from, u.check)
+		}
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("kept the blobs of deleted recordings: %w", err)
+		}
+		u.scanned[file] = from
+	}
+	return nil
+}
+
+// check marks the candidates a line uses
+func (u *blobUsage) check(line []byte) error {
+	id, refs, err := lineBlobs(line, u.keys)
+	if u.skip[id] {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, sum := range refs {
+		if u.candidates[sum] && !u.used[sum] {
+			u.used[sum] = true
+			u.expand(sum, u.used)
+		}
+	}
+	return nil
+}
+
+// lineBlobs returns the ID of a recordings line and every hash in it that
+// may name a blob, opening it with keys if it is encrypted
+func lineBlobs(line []byte, keys *Keyring) (string, []string, error) {
+	refs := blobHashPattern.FindAllString(string(line), -1)
+	var rec Recording
+	if json.Unmarshal(line, &rec) != nil {
+		return "", refs, nil
+	}
+	if rec.Sealed != nil {
+		if err := keys.Open(&rec); err != nil {
+			return rec.ID, nil, fmt.Errorf("recording %s cannot be decrypted, so its blobs are unknown: %w", rec.ID, err)
+		}
+		refs = blobHashes(&rec)
+	}
+	return rec.ID, refs, nil
+}
+
+// remove deletes the candidates no scanned line uses
+func (u *blobUsage) remove() (int, error) {
+	removed := 0
+	for sum := range u.candidates {
+		if u.used[sum] {
+			continue
+		}
+		err := os.Remove(u.blobs.Path(sum))
+		if err == nil {
+			removed++
+		} else if !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to delete blob %s: %w", sum, err)
+		}
+	}
+	return removed, nil
+}
+
+// eachLineFrom calls fn for every complete line of a plain file from an
+// offset, and returns the offset after the last one. A line still being
+// written is left for the next call.
+func eachLineFrom(path string, offset int64, fn func([]byte) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return offset, err
+	}
+	// The file was rewritten since
+	if info.Size() < offset {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+		if line = line[:len(line)-1]; len(line) > 0 {
+			if err := fn(line); err != nil {
+				return offset, err
+			}
+		}
+	}
+}
+
+// Delete removes one recording while the server keeps running. The
+// recording is found through the index and the blobs it used are checked
+// before taking the writer lock, which is held only to catch up on new
+// lines and to rewrite and swap the recording's file.
+func (r *Recorder) Delete(id string, dryRun bool) (*DeleteResult, error) {
+	if !r.enabled {
+		return nil, fmt.Errorf("recording is disabled")
+	}
+
+	result := &DeleteResult{DryRun: dryRun, IDs: []string{}, Files: []string{}}
+	entry, found := r.index.Get(id)
+	if !found {
+		return result, nil
+	}
+	line, err := r.index.readLine(entry)
+	if os.IsNotExist(err) {
+		// The file was compressed since the lookup
+		if entry, found = r.index.Get(id); found {
+			line, err = r.index.readLine(entry)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording %s: %w", id, err)
+	}
+	var rec Recording
+	if err := json.Unmarshal(line, &rec); err != nil || rec.ID != id {
+		return nil, fmt.Errorf("index entry of recording %s is out of date; run mirra reindex", id)
+	}
+
+	result.IDs = append(result.IDs, id)
+	result.Files = append(result.Files, entry.Filename)
+	result.Bytes = entry.Length + 1
+	opened := r.keys.Open(&rec) == nil
+	if !opened {
+		result.Undecrypted = 1
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	// Blobs of a recording that cannot be opened are kept
+	var usage *blobUsage
+	var usageErr error
+	if hashes := blobHashes(&rec); opened && len(hashes) > 0 {
+		candidates := make(map[string]bool, len(hashes))
+		for _, sum := range hashes {
+			candidates[sum] = true
+		}
+		usage = newBlobUsage(r.path, r.keys, candidates, map[string]bool{id: true})
+		if usageErr = usage.scan(); usageErr != nil {
+			usage = nil
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The recording may have moved, such as to a compressed file, meanwhile
+	if entry, found = r.index.Get(id); !found {
+		return &DeleteResult{IDs: []string{}, Files: []string{}}, nil
+	}
+	result.Files[0] = entry.Filename
+	if usage != nil {
+		if usageErr = usage.scan(); usageErr != nil {
+			usage = nil
+		}
+	}
+
+	// The active file may be rewritten, so the writer reopens it afterwards
+	if err := r.out.close(); err != nil {
+		return nil, err
+	}
+	file := filepath.Join(r.path, entry.Filename)
+	kept := 0
+	err = rewriteLines(file, func(line []byte) ([]byte, error) {
+		var partial struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(line, &partial) == nil && partial.ID == id {
+			return nil, nil
+		}
+		kept++
+		return line, nil
+	})
+	if err == nil && kept == 0 {
+		err = os.Remove(file)
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to rewrite %s: %w", entry.Filename, err)
+	}
+
+	if usage != nil {
+		result.Blobs, usageErr = usage.remove()
+	}
+	if err := RebuildAudit(file, r.out.signer, "delete"); err != nil {
+		slog.Error("failed to rebuild audit log after deleting", "file", entry.Filename, "error", err)
+	}
+	if err := r.index.ReindexFiles(result.Files); err != nil {
+		slog.Error("failed to update index after deleting", "error", err)
+	}
+	if r.groupManager != nil {
+		if err := r.groupManager.OnRecordingsRemoved(result.IDs); err != nil {
+			slog.Error("failed to update grouping indexes after deleting", "error", err)
+		}
+	}
+	slog.Info("deleted recording", "id", id, "bytes", result.Bytes, "blobs", result.Blobs)
+	return result, usageErr
+}
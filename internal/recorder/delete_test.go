@@ -0,0 +1,193 @@
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func blobCount(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := filepath.Glob(filepath.Join(dir, "blobs", "*", "*"))
+	require.NoError(t, err)
+	return len(entries)
+}
+
+func TestRecorder_Delete(t *testing.T) {
+	dir := t.TempDir()
+	r := NewWithOptions(true, dir, Options{Fsync: FsyncAlways})
+	groups := &fakeGroups{}
+	r.SetGroupManager(groups)
+
+	// Both turns share the system prompt and tools; each has its own message
+	day := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"20250101-a", "20250101-b"} {
+		rec := agentTurn([]any{map[string]any{"role": "user", "content": strings.Repeat(id, 200)}})
+		rec.ID = id
+		rec.Timestamp = day.Add(time.Duration(i) * time.Second)
+		r.Record(*rec)
+	}
+	r.Record(Recording{ID: "20250102-c", Timestamp: day.Add(24 * time.Hour)})
+	require.Eventually(t, func() bool { return r.GetIndex().Size() == 3 }, time.Second, time.Millisecond)
+	require.Equal(t, 4, blobCount(t, dir))
+
+	// A dry run changes nothing
+	result, err := r.Delete("20250101-a", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20250101-a"}, result.IDs)
+	assert.Len(t, readLines(t, filepath.Join(dir, "recordings-2025-01-01.jsonl")), 2)
+
+	result, err = r.Delete("20250101-missing", false)
+	require.NoError(t, err)
+	assert.Empty(t, result.IDs)
+
+	result, err = r.Delete("20250101-a", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"recordings-2025-01-01.jsonl"}, result.Files)
+
+	// Only the deleted turn's own message is removed from the blob store
+	assert.Equal(t, 1, result.Blobs)
+	assert.Equal(t, 3, blobCount(t, dir))
+
+	result, err = r.Delete("20250102-c", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"recordings-2025-01-02.jsonl"}, result.Files)
+	assert.Equal(t, []string{"20250101-a", "20250102-c"}, groups.removed)
+
+	// The emptied file is gone and writing continues with a correct index
+	files, err := RecordingFiles(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "recordings-2025-01-01.jsonl")}, files)
+	r.Record(Recording{ID: "20250101-d", Timestamp: day.Add(time.Hour)})
+	require.NoError(t, r.Close())
+
+	idx := r.GetIndex()
+	assert.Equal(t, 2, idx.Size())
+	_, found := idx.Get("20250101-a")
+	assert.False(t, found)
+	rec, err := idx.ReadRecording("20250101-b")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rec.Request.Body.(map[string]any)["system"].(string), "You are a helpful coding agent."))
+	_, err = idx.ReadRecording("20250101-d")
+	require.NoError(t, err)
+}
+
+func TestDelete_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	keys := testKeyring(t, "k1")
+	r := NewWithOptions(true, dir, Options{Fsync: FsyncAlways})
+	r.SetKeyring(keys)
+	rec := agentTurn([]any{map[string]any{"role": "user", "content": strings.Repeat("secret ", 200)}})
+	rec.Timestamp = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	rec.Request.Headers = map[string][]string{"Sentry-Trace": {"trace1-span"}}
+	r.Record(*rec)
+	require.NoError(t, r.Close())
+
+	// Headers are sealed, so only the key can match them
+	n, err := SealedWithoutKey(dir, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = SealedWithoutKey(dir, testKeyring(t, "k2"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = SealedWithoutKey(dir, keys)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	byTrace := func(rec *Recording) bool { return len(rec.Request.Headers["Sentry-Trace"]) > 0 }
+	result, err := Delete(dir, nil, byTrace, true)
+	require.NoError(t, err)
+	assert.Empty(t, result.IDs)
+
+	result, err = Delete(dir, keys, byTrace, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20250101-abc"}, result.IDs)
+	assert.Zero(t, result.Undecrypted)
+	assert.Zero(t, blobCount(t, dir))
+}
+
+func TestScrub(t *testing.T) {
+	dir := t.TempDir()
+	r := NewWithOptions(true, dir, Options{Fsync: FsyncAlways})
+	day := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"20250101-a", "20250101-b"} {
+		rec := agentTurn([]any{map[string]any{"role": "user", "content": strings.Repeat(id, 200)}})
+		rec.ID = id
+		rec.Timestamp = day.Add(time.Duration(i) * time.Second)
+		rec.User = "user-" + id
+		r.Record(*rec)
+	}
+	require.NoError(t, r.Close())
+	require.Equal(t, 4, blobCount(t, dir))
+
+	byID := func(rec *Recording) bool { return rec.ID == "20250101-a" }
+	dropMessages := func(rec *Recording) {
+		rec.User = ""
+		delete(rec.Request.Body.(map[string]any), "messages")
+	}
+
+	result, err := Scrub(dir, nil, byID, dropMessages, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20250101-a"}, result.IDs)
+	assert.Equal(t, 4, blobCount(t, dir))
+
+	result, err = Scrub(dir, nil, byID, dropMessages, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"recordings-2025-01-01.jsonl"}, result.Files)
+	assert.Equal(t, 1, result.Blobs)
+	assert.Equal(t, 3, blobCount(t, dir))
+
+	lines := readLines(t, filepath.Join(dir, "recordings-2025-01-01.jsonl"))
+	require.Len(t, lines, 2)
+	assert.NotContains(t, lines[0], "user-20250101-a")
+	assert.NotContains(t, lines[0], "messages")
+	assert.Contains(t, lines[1], "user-20250101-b")
+}
+
+func TestScrub_Undecrypted(t *testing.T) {
+	dir := t.TempDir()
+	r := NewWithOptions(true, dir, Options{Fsync: FsyncAlways})
+	r.SetKeyring(testKeyring(t, "k1"))
+	r.Record(Recording{ID: "20250101-a", Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), VirtualKey: &KeyData{ID: "vk_1", Owner: "alice"}})
+	require.NoError(t, r.Close())
+	before := readLines(t, filepath.Join(dir, "recordings-2025-01-01.jsonl"))
+
+	// The key ID matches in plaintext, but the body cannot be scrubbed
+	byKey := func(rec *Recording) bool { return rec.VirtualKey != nil && rec.VirtualKey.ID == "vk_1" }
+	_, err := Scrub(dir, nil, byKey, func(*Recording) {}, false)
+	assert.ErrorContains(t, err, "cannot be decrypted")
+	assert.Equal(t, before, readLines(t, filepath.Join(dir, "recordings-2025-01-01.jsonl")))
+}
+
+func TestEachLineFrom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recordings-2025-01-01.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("a\n\nb\npart"), 0644))
+
+	var lines []string
+	collect := func(line []byte) error {
+		lines = append(lines, string(line))
+		return nil
+	}
+
+	// The line still being written is left for the next call
+	offset, err := eachLineFrom(path, 0, collect)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), offset)
+	assert.Equal(t, []string{"a", "b"}, lines)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("ial\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	offset, err = eachLineFrom(path, offset, collect)
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), offset)
+	assert.Equal(t, []string{"a", "b", "partial"}, lines)
+}
@@ -0,0 +1,106 @@
+package recorder
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// LegacyEncodedPrefix marks a response body stored by older versions as the
+// base64 of the still-encoded bytes
+const LegacyEncodedPrefix = "base64:"
+
+// DecodeContent reverses a Content-Encoding header value such as "gzip" or
+// "deflate, br". Encodings are undone in reverse order of application.
+func DecodeContent(encoding string, data []byte) ([]byte, error) {
+	codings := strings.Split(encoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+
+		var r io.Reader
+		var err error
+		switch coding {
+		case "", "identity":
+			continue
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(bytes.NewReader(data))
+		case "deflate":
+			// Servers disagree on whether deflate means zlib or raw deflate
+			r, err = zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				r, err = flate.NewReader(bytes.NewReader(data)), nil
+			}
+		case "br":
+			r = brotli.NewReader(bytes.NewReader(data))
+		case "zstd":
+			var dec *zstd.Decoder
+			dec, err = zstd.NewReader(bytes.NewReader(data))
+			if err == nil {
+				defer dec.Close()
+				r = dec
+			}
+		default:
+			return nil, fmt.Errorf("unsupported content encoding: %s", coding)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", coding, err)
+		}
+
+		if data, err = io.ReadAll(r); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", coding, err)
+		}
+	}
+	return data, nil
+}
+
+// DecodeLegacyBody converts a response body stored with LegacyEncodedPrefix
+// to the decoded form written by current versions. It reports whether the
+// recording changed.
+func DecodeLegacyBody(rec *Recording) (bool, error) {
+	body, ok := rec.Response.Body.(string)
+	if !ok || !strings.HasPrefix(body, LegacyEncodedPrefix) {
+		return false, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(body, LegacyEncodedPrefix))
+	if err != nil {
+		return false, fmt.Errorf("failed to decode base64 body: %w", err)
+	}
+
+	// Older versions only stored gzip this way
+	encoding := "gzip"
+	if values := rec.Response.Headers["Content-Encoding"]; len(values) > 0 {
+		encoding = strings.Join(values, ",")
+	}
+	data, err := DecodeContent(encoding, raw)
+	if err != nil {
+		return false, err
+	}
+
+	rec.Response.Encoding = encoding
+	var jsonBody any
+	switch {
+	case json.Unmarshal(data, &jsonBody) == nil:
+		rec.Response.Body = jsonBody
+	case utf8.Valid(data):
+		rec.Response.Body = string(data)
+	default:
+		contentType := ""
+		if values := rec.Response.Headers["Content-Type"]; len(values) > 0 {
+			contentType = values[0]
+		}
+		rec.Response.Body = nil
+		rec.Response.Blob = NewBlob(contentType, data)
+	}
+	return true, nil
+}
@@ -0,0 +1,94 @@
+package recorder
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"io"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encode(t *testing.T, coding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		require.NoError(t, err)
+		w = fw
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		enc, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+		w = enc
+	}
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestDecodeContent(t *testing.T) {
+	payload := []byte(`{"type":"message","content":"hello"}`)
+
+	tests := []struct {
+		name     string
+		encoding string
+		data     []byte
+	}{
+		{name: "identity", encoding: "identity", data: payload},
+		{name: "gzip", encoding: "gzip", data: encode(t, "gzip", payload)},
+		{name: "x-gzip", encoding: "X-Gzip", data: encode(t, "gzip", payload)},
+		{name: "deflate", encoding: "deflate", data: encode(t, "deflate", payload)},
+		{name: "raw deflate", encoding: "deflate", data: encode(t, "raw-deflate", payload)},
+		{name: "br", encoding: "br", data: encode(t, "br", payload)},
+		{name: "zstd", encoding: "zstd", data: encode(t, "zstd", payload)},
+		{name: "stacked", encoding: "gzip, br", data: encode(t, "br", encode(t, "gzip", payload))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeContent(tt.encoding, tt.data)
+			require.NoError(t, err)
+			assert.Equal(t, payload, got)
+		})
+	}
+
+	_, err := DecodeContent("compress", payload)
+	assert.ErrorContains(t, err, "unsupported")
+
+	_, err = DecodeContent("gzip", payload)
+	assert.Error(t, err)
+}
+
+func TestDecodeLegacyBody(t *testing.T) {
+	gzipped := encode(t, "gzip", []byte(`{"id":"msg_1"}`))
+	rec := &Recording{Response: ResponseData{
+		Headers: map[string][]string{"Content-Encoding": {"gzip"}},
+		Body:    LegacyEncodedPrefix + base64.StdEncoding.EncodeToString(gzipped),
+	}}
+
+	changed, err := DecodeLegacyBody(rec)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, map[string]any{"id": "msg_1"}, rec.Response.Body)
+	assert.Equal(t, "gzip", rec.Response.Encoding)
+
+	// Already decoded bodies are left alone
+	changed, err = DecodeLegacyBody(rec)
+	require.NoError(t, err)
+	assert.False(t, changed)
+}
@@ -0,0 +1,403 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	recordingsPrefix = "recordings-"
+	recordingsExt    = ".jsonl"
+	// CompressedExt is appended to day files compressed by CompressFile
+	CompressedExt = ".zst"
+)
+
+// IsCompressed reports whether a recordings file is zstd compressed
+func IsCompressed(name string) bool {
+	return strings.HasSuffix(name, CompressedExt)
+}
+
+// RecordingFile describes a recordings file from its name, which has the
+// form recordings-YYYY-MM-DD[-HH][.N].jsonl[.zst]
+type RecordingFile struct {
+	Path       string
+	Date       string // YYYY-MM-DD
+	Hour       int    // -1 for daily files
+	Seq        int    // 0 for the first file of a period
+	Compressed bool
+}
+
+// ParseRecordingFile parses a recordings file name, reporting false if it
+// is not one
+func ParseRecordingFile(path string) (RecordingFile, bool) {
+	file := RecordingFile{Path: path, Hour: -1, Compressed: IsCompressed(path)}
+
+	name := strings.TrimSuffix(filepath.Base(path), CompressedExt)
+	if !strings.HasPrefix(name, recordingsPrefix) || !strings.HasSuffix(name, recordingsExt) {
+		return file, false
+	}
+	name = strings.TrimSuffix(strings.TrimPrefix(name, recordingsPrefix), recordingsExt)
+
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		seq, err := strconv.Atoi(name[i+1:])
+		if err != nil || seq < 1 {
+			return file, false
+		}
+		file.Seq = seq
+		name = name[:i]
+	}
+	if len(name) == len("2006-01-02-15") {
+		hour, err := strconv.Atoi(name[11:])
+		if err != nil || name[10] != '-' || hour < 0 || hour > 23 {
+			return file, false
+		}
+		file.Hour = hour
+		name = name[:10]
+	}
+	if _, err := time.Parse("2006-01-02", name); err != nil {
+		return file, false
+	}
+	file.Date = name
+	return file, true
+}
+
+// less orders files by the period they cover, then by sequence
+func (f RecordingFile) less(other RecordingFile) bool {
+	if f.Date != other.Date {
+		return f.Date < other.Date
+	}
+	if f.Hour != other.Hour {
+		return f.Hour < other.Hour
+	}
+	return f.Seq < other.Seq
+}
+
+// period returns the period the file covers, as passed to recordingsName
+func (f RecordingFile) period() string {
+	if f.Hour < 0 {
+		return f.Date
+	}
+	return fmt.Sprintf("%s-%02d", f.Date, f.Hour)
+}
+
+// RecordingFileDate returns the day in a recordings file name, or "" if the
+// name is not a recordings file
+func RecordingFileDate(name string) string {
+	file, ok := ParseRecordingFile(name)
+	if !ok {
+		return ""
+	}
+	return file.Date
+}
+
+// recordingsName returns the name of a recordings file for a period, such
+// as "2025-01-02" or "2025-01-02-15", and sequence number
+func recordingsName(period string, seq int) string {
+	if seq == 0 {
+		return recordingsPrefix + period + recordingsExt
+	}
+	return fmt.Sprintf("%s%s.%d%s", recordingsPrefix, period, seq, recordingsExt)
+}
+
+// ListRecordingFiles returns the recordings files in a directory, oldest
+// first, compressed or not. If a compression was interrupted and a file
+// exists in both forms, the uncompressed one is returned.
+func ListRecordingFiles(dir string) ([]RecordingFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	byName := make(map[string]RecordingFile)
+	for _, entry := range entries {
+		file, ok := ParseRecordingFile(filepath.Join(dir, entry.Name()))
+		if entry.IsDir() || !ok {
+			continue
+		}
+		key := strings.TrimSuffix(entry.Name(), CompressedExt)
+		if existing, ok := byName[key]; ok && !existing.Compressed {
+			continue
+		}
+		byName[key] = file
+	}
+
+	files := make([]RecordingFile, 0, len(byName))
+	for _, file := range byName {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].less(files[j]) })
+	return files, nil
+}
+
+// RecordingFiles returns the paths of the recordings files in a directory,
+// oldest first, as ListRecordingFiles does
+func RecordingFiles(dir string) ([]string, error) {
+	files, err := ListRecordingFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+	return paths, nil
+}
+
+// FindRecordingFiles returns the paths of the recordings files for a day,
+// oldest first
+func FindRecordingFiles(dir, date string) ([]string, error) {
+	files, err := ListRecordingFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, file := range files {
+		if file.Date == date {
+			paths = append(paths, file.Path)
+		}
+	}
+	return paths, nil
+}
+
+// OpenRecordings opens a recordings file for reading lines, decompressing
+// it if needed
+func OpenRecordings(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !IsCompressed(path) {
+		return f, nil
+	}
+
+	table, err := readSeekTable(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	dec, err := zstd.NewReader(io.NewSectionReader(f, 0, table.dataSize), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &compressedReader{dec: dec, file: f}, nil
+}
+
+type compressedReader struct {
+	dec  *zstd.Decoder
+	file *os.File
+}
+
+func (r *compressedReader) Read(p []byte) (int, error) {
+	return r.dec.Read(p)
+}
+
+func (r *compressedReader) Close() error {
+	r.dec.Close()
+	return r.file.Close()
+}
+
+// lineWriter writes lines to a new recordings file, plain or compressed
+type lineWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+	zst  *seekableWriter
+}
+
+// createRecordings creates a recordings file, compressed if compress is set
+func createRecordings(path string, compress bool) (*lineWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	lw := &lineWriter{file: f, buf: bufio.NewWriterSize(f, 256*1024)}
+	if compress {
+		if lw.zst, err = newSeekableWriter(lw.buf); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return lw, nil
+}
+
+func (lw *lineWriter) WriteLine(line []byte) error {
+	if lw.zst != nil {
+		return lw.zst.WriteLine(line)
+	}
+	if _, err := lw.buf.Write(line); err != nil {
+		return err
+	}
+	return lw.buf.WriteByte('\n')
+}
+
+// Close finishes the file and syncs it to disk
+func (lw *lineWriter) Close() error {
+	var err error
+	if lw.zst != nil {
+		err = lw.zst.Close()
+	}
+	if err == nil {
+		err = lw.buf.Flush()
+	}
+	if err == nil {
+		err = lw.file.Sync()
+	}
+	if closeErr := lw.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Abort closes and removes an unfinished file
+func (lw *lineWriter) Abort() {
+	lw.file.Close()
+	os.Remove(lw.file.Name())
+}
+
+// CompressFile compresses a day file into the seekable zstd format and
+// returns the new name. Lines are copied verbatim, blank ones included, so
+// offsets are the same in both forms and index entries only need the new
+// name. The original is left for the caller to remove once the index points
+// at the compressed file.
+func CompressFile(dir, name string) (string, error) {
+	tmpPath, _, err := compressTemp(dir, name)
+	if err != nil {
+		return "", err
+	}
+	return finishCompressed(dir, name, tmpPath)
+}
+
+// compressTemp writes the compressed form of a file to a temporary file next
+// to it, and returns its path and how many bytes of the original it holds
+func compressTemp(dir, name string) (string, int64, error) {
+	compressed := name + CompressedExt
+	tmpPath := filepath.Join(dir, compressed+".tmp")
+
+	in, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer in.Close()
+
+	out, err := createRecordings(tmpPath, true)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create %s: %w", compressed, err)
+	}
+	reader := bufio.NewReaderSize(in, 64*1024)
+	var size int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		size += int64(len(line))
+		if len(line) > 0 {
+			if err := out.WriteLine(bytes.TrimSuffix(line, []byte{'\n'})); err != nil {
+				out.Abort()
+				return "", 0, fmt.Errorf("failed to compress %s: %w", name, err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			out.Abort()
+			return "", 0, fmt.Errorf("failed to compress %s: %w", name, err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", 0, fmt.Errorf("failed to write %s: %w", compressed, err)
+	}
+	return tmpPath, size, nil
+}
+
+// finishCompressed moves a file written by compressTemp into place
+func finishCompressed(dir, name, tmpPath string) (string, error) {
+	compressed := name + CompressedExt
+	if err := os.Rename(tmpPath, filepath.Join(dir, compressed)); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to rename %s: %w", compressed, err)
+	}
+	return compressed, nil
+}
+
+// CompressOld compresses day files older than the given number of days,
+// counted in the rotation's timezone, and points the index at them. Files
+// are compressed while the writer keeps running, then swapped in under the
+// writer lock only if the writer is not using them and has not appended to
+// them since; a file that changed is compressed again on the next run.
+func (r *Recorder) CompressOld(days int) (int, error) {
+	if !r.enabled || days < 1 {
+		return 0, nil
+	}
+
+	files, err := RecordingFiles(r.path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list recordings: %w", err)
+	}
+	cutoff := time.Now().In(r.rotation.location()).AddDate(0, 0, -days).Format("2006-01-02")
+
+	count := 0
+	for _, file := range files {
+		name := filepath.Base(file)
+		date := RecordingFileDate(name)
+		if IsCompressed(name) || date >= cutoff {
+			continue
+		}
+
+		tmpPath, size, err := compressTemp(r.path, name)
+		if err != nil {
+			return count, err
+		}
+		swapped, err := r.swapCompressed(name, tmpPath, size)
+		if err != nil {
+			return count, err
+		}
+		if swapped {
+			count++
+		}
+	}
+
+	if count > 0 {
+		slog.Info("compressed recordings files", "files", count)
+	}
+	return count, nil
+}
+
+// swapCompressed replaces a file with its compressed form holding size
+// bytes of it, unless the writer is using the file or has appended to it
+func (r *Recorder) swapCompressed(name, tmpPath string, size int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file := filepath.Join(r.path, name)
+	info, err := os.Stat(file)
+	if name == r.out.name || err != nil || info.Size() != size {
+		os.Remove(tmpPath)
+		return false, nil
+	}
+
+	compressed, err := finishCompressed(r.path, name, tmpPath)
+	if err != nil {
+		return false, err
+	}
+	if err := r.index.RenameFile(name, compressed); err != nil {
+		return false, fmt.Errorf("failed to update index: %w", err)
+	}
+	if err := os.Remove(file); err != nil {
+		slog.Warn("failed to remove compressed recordings file", "file", name, "error", err)
+	}
+	return true, nil
+}
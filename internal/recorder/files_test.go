@@ -0,0 +1,201 @@
+package recorder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressFile(t *testing.T) {
+	dir := t.TempDir()
+	name := "recordings-2025-01-01.jsonl"
+
+	// Enough data for several frames
+	padding := strings.Repeat("x", 1000)
+	var plain bytes.Buffer
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&plain, `{"id":"20250101-%04d","provider":"claude","error":%q}`+"\n", i, padding)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), plain.Bytes(), 0644))
+
+	idx := NewIndex(dir)
+	require.NoError(t, idx.Rebuild())
+	before, found := idx.Get("20250101-2999")
+	require.True(t, found)
+
+	compressed, err := CompressFile(dir, name)
+	require.NoError(t, err)
+	assert.Equal(t, name+CompressedExt, compressed)
+
+	f, err := os.Open(filepath.Join(dir, compressed))
+	require.NoError(t, err)
+	table, err := readSeekTable(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Greater(t, len(table.frames), 1)
+
+	// Any zstd decoder reads the file, skipping the seek table
+	raw, err := os.ReadFile(filepath.Join(dir, compressed))
+	require.NoError(t, err)
+	dec, err := zstd.NewReader(bytes.NewReader(raw))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(dec)
+	dec.Close()
+	require.NoError(t, err)
+	assert.Equal(t, plain.Bytes(), decoded)
+
+	rc, err := OpenRecordings(filepath.Join(dir, compressed))
+	require.NoError(t, err)
+	decoded, err = io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, plain.Bytes(), decoded)
+
+	// Offsets are unchanged, so renaming the file in the index is enough
+	require.NoError(t, idx.RenameFile(name, compressed))
+	require.NoError(t, os.Remove(filepath.Join(dir, name)))
+	for _, id := range []string{"20250101-0000", "20250101-1500", "20250101-2999"} {
+		rec, err := idx.ReadRecording(id)
+		require.NoError(t, err, id)
+		assert.Equal(t, id, rec.ID)
+	}
+
+	// Rebuilding from the compressed file gives the same entries
+	idx = NewIndex(dir)
+	require.NoError(t, idx.Rebuild())
+	assert.Equal(t, 3000, idx.Size())
+	after, found := idx.Get("20250101-2999")
+	require.True(t, found)
+	assert.Equal(t, compressed, after.Filename)
+	assert.Equal(t, before.Offset, after.Offset)
+	assert.Equal(t, before.Length, after.Length)
+}
+
+func TestRecordingFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"recordings-2025-01-02.jsonl.zst",
+		"recordings-2025-01-01.jsonl",
+		"recordings-2025-01-03.2.jsonl",
+		"recordings-2025-01-03.10.jsonl",
+		"recordings-2025-01-03.jsonl",
+		"recordings-2025-01-03.jsonl.zst", // interrupted compression
+		"recordings-2025-01-04-09.jsonl",
+		"recordings-2025-01-04-23.1.jsonl.zst",
+		"recordings-2025-01-04-23.jsonl",
+		"recordings-2025-01-05-24.jsonl",
+		"recordings-2025-01-05.0.jsonl",
+		"recordings-2025-01-05.jsonl.tmp",
+		"index.json",
+		"spill.jsonl",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	files, err := RecordingFiles(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f))
+	}
+	assert.Equal(t, []string{
+		"recordings-2025-01-01.jsonl",
+		"recordings-2025-01-02.jsonl.zst",
+		"recordings-2025-01-03.jsonl",
+		"recordings-2025-01-03.2.jsonl",
+		"recordings-2025-01-03.10.jsonl",
+		"recordings-2025-01-04-09.jsonl",
+		"recordings-2025-01-04-23.jsonl",
+		"recordings-2025-01-04-23.1.jsonl.zst",
+	}, names)
+
+	found, err := FindRecordingFiles(dir, "2025-01-04")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "recordings-2025-01-04-09.jsonl"),
+		filepath.Join(dir, "recordings-2025-01-04-23.jsonl"),
+		filepath.Join(dir, "recordings-2025-01-04-23.1.jsonl.zst"),
+	}, found)
+	assert.Equal(t, "2025-01-04", RecordingFileDate("recordings-2025-01-04-23.1.jsonl.zst"))
+
+	files, err = RecordingFiles(filepath.Join(dir, "missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestCompressFile_KeepsOffsets(t *testing.T) {
+	dir := t.TempDir()
+	name := "recordings-2025-01-01.jsonl"
+	plain := "{\"id\":\"20250101-a\"}\n\n  \n{\"id\":\"20250101-b\"}\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(plain), 0644))
+
+	idx := NewIndex(dir)
+	require.NoError(t, idx.Rebuild())
+	compressed, err := CompressFile(dir, name)
+	require.NoError(t, err)
+	require.NoError(t, idx.RenameFile(name, compressed))
+	require.NoError(t, os.Remove(filepath.Join(dir, name)))
+
+	// Blank lines are kept, so the index still finds lines after them
+	rec, err := idx.ReadRecording("20250101-b")
+	require.NoError(t, err)
+	assert.Equal(t, "20250101-b", rec.ID)
+
+	rc, err := OpenRecordings(filepath.Join(dir, compressed))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, plain, string(decoded))
+}
+
+func TestRecorder_CompressOld(t *testing.T) {
+	dir := t.TempDir()
+	r := New(true, dir)
+
+	writeDay(t, dir, "2020-01-01", Recording{ID: "ancient", Timestamp: time.Now().AddDate(-5, 0, 0)}, Recording{ID: "old", Timestamp: time.Now().AddDate(0, 0, -10)})
+	require.NoError(t, r.GetIndex().Rebuild())
+	r.Record(Recording{ID: "fresh", Timestamp: time.Now()})
+	require.Eventually(t, func() bool { return r.GetIndex().Size() == 3 }, time.Second, time.Millisecond)
+
+	count, err := r.CompressOld(1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoFileExists(t, filepath.Join(dir, "recordings-2020-01-01.jsonl"))
+	assert.FileExists(t, filepath.Join(dir, "recordings-2020-01-01.jsonl.zst"))
+
+	rec, err := r.GetIndex().ReadRecording("old")
+	require.NoError(t, err)
+	assert.Equal(t, "old", rec.ID)
+
+	// Retention rewrites compressed files in place
+	result, err := r.Prune(RetentionPolicy{MaxAge: 365 * 24 * time.Hour}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ancient"}, result.IDs)
+	rec, err = r.GetIndex().ReadRecording("old")
+	require.NoError(t, err)
+	assert.Equal(t, "old", rec.ID)
+
+	r.Record(Recording{ID: "fresh-2", Timestamp: time.Now()})
+	require.NoError(t, r.Close())
+
+	// Nothing else is old enough
+	count, err = r.CompressOld(1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	idx := NewIndex(dir)
+	require.NoError(t, idx.Load())
+	assert.Equal(t, 3, idx.Size())
+	_, found := idx.Get("ancient")
+	assert.False(t, found)
+}
@@ -0,0 +1,67 @@
+package recorder
+
+import (
+	"strings"
+	"time"
+)
+
+// Filter selects recordings by provider, client metadata and time range.
+// Empty fields match everything; all listed tags must be present.
+type Filter struct {
+	Provider string
+	Project  string
+	Session  string
+	User     string
+	Tags     []string
+	From     time.Time // inclusive, zero = no lower bound
+	To       time.Time // exclusive, zero = no upper bound
+}
+
+// Match reports whether the recording passes the filter
+func (f *Filter) Match(rec *Recording) bool {
+	if f.Provider != "" && !strings.EqualFold(rec.Provider, f.Provider) {
+		return false
+	}
+	if f.Project != "" && rec.Project != f.Project {
+		return false
+	}
+	if f.Session != "" && rec.Session != f.Session {
+		return false
+	}
+	if f.User != "" && rec.User != f.User {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !hasTag(rec.Tags, tag) {
+			return false
+		}
+	}
+	if !f.From.IsZero() && rec.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !rec.Timestamp.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// ParseTags splits a comma-separated tag list, trimming blanks and duplicates
+func ParseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !hasTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
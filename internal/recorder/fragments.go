@@ -0,0 +1,121 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// FragmentKey marks a JSON value that was moved to the blob store. The value
+// is replaced by an object with this single key whose value is the SHA-256 of
+// the value's JSON encoding.
+const FragmentKey = "$mirra_fragment"
+
+// DefaultFragmentThreshold is the smallest encoded fragment, in bytes, that
+// is deduplicated
+const DefaultFragmentThreshold = 1024
+
+// Request fields that usually repeat verbatim across calls: system prompts
+// and tool definitions (Gemini nests functionDeclarations under tools)
+var fragmentFields = []string{"system", "systemInstruction", "system_instruction", "instructions", "tools", "functions"}
+
+// Request fields holding the conversation. Each message is stored as its own
+// fragment, so the history shared by successive turns is stored once.
+var messageFields = []string{"messages", "contents", "input"}
+
+// Dedupe moves system prompts, tool definitions and conversation messages
+// whose JSON encoding is at least threshold bytes into the store, replacing
+// them with fragment references. Values that fail to store stay inline; the
+// first error is returned.
+func (s *BlobStore) Dedupe(rec *Recording, threshold int) error {
+	body, ok := rec.Request.Body.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	var firstErr error
+	fragment := func(v any) any {
+		if _, ok := fragmentRef(v); ok {
+			return v
+		}
+		data, err := json.Marshal(v)
+		if err != nil || len(data) < threshold {
+			return v
+		}
+		sum, err := s.Put(data)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return v
+		}
+		return map[string]any{FragmentKey: sum}
+	}
+
+	for _, field := range fragmentFields {
+		if v, ok := body[field]; ok {
+			body[field] = fragment(v)
+		}
+	}
+	for _, field := range messageFields {
+		if list, ok := body[field].([]any); ok {
+			for i := range list {
+				list[i] = fragment(list[i])
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// resolveFragments replaces fragment references in a decoded JSON value with
+// their content. Maps and slices are modified in place.
+func (s *BlobStore) resolveFragments(v any) (any, error) {
+	var firstErr error
+	keep := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		if sum, ok := fragmentRef(val); ok {
+			data, err := s.Get(sum)
+			if err != nil {
+				return v, err
+			}
+			content, err := ParseJSON(data)
+			if err != nil {
+				return v, fmt.Errorf("failed to decode fragment %s: %w", sum, err)
+			}
+			return content, nil
+		}
+		for k, item := range val {
+			resolved, err := s.resolveFragments(item)
+			if err != nil {
+				keep(err)
+			}
+			val[k] = resolved
+		}
+	case []any:
+		for i, item := range val {
+			resolved, err := s.resolveFragments(item)
+			if err != nil {
+				keep(err)
+			}
+			val[i] = resolved
+		}
+	}
+
+	return v, firstErr
+}
+
+// fragmentRef returns the hash a fragment reference points to
+func fragmentRef(v any) (string, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return "", false
+	}
+	sum, ok := m[FragmentKey].(string)
+	return sum, ok
+}
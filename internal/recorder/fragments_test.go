@@ -0,0 +1,82 @@
+package recorder
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func agentTurn(history []any) *Recording {
+	return &Recording{
+		ID: "20250101-abc",
+		Request: RequestData{
+			Body: map[string]any{
+				"model":  "claude-sonnet-4",
+				"system": strings.Repeat("You are a helpful coding agent. ", 64),
+				"tools": []any{
+					map[string]any{"name": "read_file", "description": strings.Repeat("Reads a file. ", 100)},
+				},
+				"messages": history,
+			},
+		},
+	}
+}
+
+func TestBlobStore_Dedupe(t *testing.T) {
+	dir := t.TempDir()
+	store := NewBlobStore(dir)
+
+	longMessage := map[string]any{"role": "user", "content": strings.Repeat("Fix the failing test. ", 100)}
+	shortMessage := map[string]any{"role": "assistant", "content": "ok"}
+
+	first := agentTurn([]any{longMessage})
+	require.NoError(t, store.Dedupe(first, 1024))
+	body := first.Request.Body.(map[string]any)
+	for _, field := range []string{"system", "tools"} {
+		_, ok := fragmentRef(body[field])
+		assert.True(t, ok, field)
+	}
+	assert.Equal(t, "claude-sonnet-4", body["model"])
+
+	// The next turn shares the system prompt, tools and first message
+	second := agentTurn([]any{longMessage, shortMessage})
+	original, err := json.Marshal(second)
+	require.NoError(t, err)
+	require.NoError(t, store.Dedupe(second, 1024))
+
+	stored, err := json.Marshal(second)
+	require.NoError(t, err)
+	assert.Less(t, len(stored), 1024)
+	assert.Contains(t, string(stored), `"content":"ok"`)
+
+	entries, err := filepath.Glob(filepath.Join(dir, "blobs", "*", "*"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	var read Recording
+	require.NoError(t, json.Unmarshal(stored, &read))
+	require.NoError(t, store.HydrateText(&read))
+	restored, err := json.Marshal(&read)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(original), string(restored))
+}
+
+func TestIndex_ReadRecordingHydratesFragments(t *testing.T) {
+	dir := t.TempDir()
+	rec := New(true, dir)
+	rec.Record(*agentTurn([]any{map[string]any{"role": "user", "content": "hi"}}))
+	require.NoError(t, rec.Close())
+
+	idx := NewIndex(dir)
+	require.NoError(t, idx.Rebuild())
+
+	read, err := idx.ReadRecording("20250101-abc")
+	require.NoError(t, err)
+	body := read.Request.Body.(map[string]any)
+	assert.True(t, strings.HasPrefix(body["system"].(string), "You are a helpful coding agent."))
+	assert.Len(t, body["tools"], 1)
+}
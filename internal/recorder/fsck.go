@@ -0,0 +1,332 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MaxLineSize is the longest recording line the line scanners in readers
+// accept; longer lines stop them reading the rest of the file
+const MaxLineSize = 10 * 1024 * 1024
+
+// QuarantineDir is where fsck moves lines it removes from recordings files
+const QuarantineDir = "quarantine"
+
+// FsckProblem is something wrong with a recordings file or the index
+type FsckProblem struct {
+	Kind   string `json:"kind"` // truncated, corrupt, oversized, duplicate, unterminated or index
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"` // 0 for problems with the index
+	ID     string `json:"id,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// quarantined reports whether repairing the problem moves its line out of
+// the file
+func (p FsckProblem) quarantined() bool {
+	switch p.Kind {
+	case "truncated", "corrupt", "oversized", "duplicate":
+		return true
+	}
+	return false
+}
+
+// FsckReport is the result of checking a recordings directory
+type FsckReport struct {
+	Files      int
+	Recordings int
+	Problems   []FsckProblem
+
+	// IDs holds every recording that is kept by a repair, so references
+	// to other recordings can be found
+	IDs map[string]bool
+}
+
+// OK reports whether no problems were found
+func (r *FsckReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Fsck checks every recordings file in dir for lines torn by a crash, lines
+// that are not recordings, lines too long for readers and duplicate IDs, and
+// checks the index against the files. It only reads; see Repair.
+func Fsck(dir string) (*FsckReport, error) {
+	files, err := RecordingFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recording files: %w", err)
+	}
+
+	report := &FsckReport{IDs: make(map[string]bool)}
+	found := make(map[string]IndexEntry)
+	first := make(map[string]string) // ID -> where it was first seen
+
+	for _, file := range files {
+		name := filepath.Base(file)
+		report.Files++
+		err := eachFileLine(file, func(num int, offset int64, line []byte, terminated bool) {
+			problem := FsckProblem{File: name, Line: num}
+			if len(line) > MaxLineSize {
+				problem.Kind = "oversized"
+				problem.Detail = fmt.Sprintf("line is %d bytes, readers accept at most %d", len(line), MaxLineSize)
+				report.Problems = append(report.Problems, problem)
+				return
+			}
+
+			var partial struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(line, &partial); err != nil || partial.ID == "" {
+				problem.Kind = "corrupt"
+				problem.Detail = "not a recording"
+				if err != nil {
+					problem.Detail = err.Error()
+				}
+				if !terminated {
+					problem.Kind = "truncated"
+					problem.Detail = fmt.Sprintf("last line is incomplete (%d bytes)", len(line))
+				}
+				report.Problems = append(report.Problems, problem)
+				return
+			}
+			problem.ID = partial.ID
+
+			if where, ok := first[partial.ID]; ok {
+				problem.Kind = "duplicate"
+				problem.Detail = "first recorded at " + where
+				report.Problems = append(report.Problems, problem)
+				return
+			}
+			if !terminated {
+				// Readers that index skip it until a newline follows
+				problem.Kind = "unterminated"
+				problem.Detail = "last line has no newline"
+				report.Problems = append(report.Problems, problem)
+			}
+
+			first[partial.ID] = fmt.Sprintf("%s:%d", name, num)
+			found[partial.ID] = IndexEntry{ID: partial.ID, Filename: name, Offset: offset, Length: int64(len(line))}
+			report.IDs[partial.ID] = true
+			report.Recordings++
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+
+	report.Problems = append(report.Problems, checkIndex(dir, found)...)
+	return report, nil
+}
+
+// checkIndex compares the saved index with the recordings found in the files
+func checkIndex(dir string, found map[string]IndexEntry) []FsckProblem {
+	entries, err := readIndexEntries(dir)
+	if err != nil {
+		return []FsckProblem{{Kind: "index", Detail: err.Error()}}
+	}
+
+	var problems []FsckProblem
+	for id, entry := range entries {
+		want, ok := found[id]
+		switch {
+		case !ok:
+			problems = append(problems, FsckProblem{Kind: "index", ID: id, Detail: fmt.Sprintf("indexed in %s but not in any file", entry.Filename)})
+		case entry.Filename != want.Filename || entry.Offset != want.Offset || entry.Length != want.Length:
+			problems = append(problems, FsckProblem{Kind: "index", ID: id, Detail: fmt.Sprintf("indexed at %s offset %d length %d, found at %s offset %d length %d",
+				entry.Filename, entry.Offset, entry.Length, want.Filename, want.Offset, want.Length)})
+		}
+	}
+	for id, entry := range found {
+		if _, ok := entries[id]; !ok {
+			problems = append(problems, FsckProblem{Kind: "index", File: entry.Filename, ID: id, Detail: "not in the index"})
+		}
+	}
+
+	// Map order is random
+	sort.Slice(problems, func(i, j int) bool { return problems[i].ID < problems[j].ID })
+	return problems
+}
+
+// readIndexEntries reads the index snapshot and log the way Load does, but
+// without repairing the log or indexing new lines
+func readIndexEntries(dir string) (map[string]IndexEntry, error) {
+	entries := make(map[string]IndexEntry)
+
+	data, err := os.ReadFile(filepath.Join(dir, indexSnapshotFile))
+	if err == nil {
+		var snapshot []IndexEntry
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", indexSnapshotFile, err)
+		}
+		for _, entry := range snapshot {
+			entries[entry.ID] = entry
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", indexSnapshotFile, err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, indexLogFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", indexLogFile, err)
+	}
+	// A torn last entry is ignored, as Load does
+	for _, line := range bytes.Split(data[:bytes.LastIndexByte(data, '\n')+1], []byte{'\n'}) {
+		var entry IndexEntry
+		if len(line) > 0 && json.Unmarshal(line, &entry) == nil {
+			entries[entry.ID] = entry
+		}
+	}
+	return entries, nil
+}
+
+// Repair rewrites the files with problems, moving lines that are not usable
+// recordings to the quarantine directory and ending every line with a
+// newline. It returns the names of the files it rewrote; the index and
+// audit logs of those files must be rebuilt afterwards.
+func Repair(dir string, report *FsckReport) ([]string, error) {
+	bad := make(map[string]map[int]bool)
+	for _, p := range report.Problems {
+		if p.File == "" || (!p.quarantined() && p.Kind != "unterminated") {
+			continue
+		}
+		if bad[p.File] == nil {
+			bad[p.File] = make(map[int]bool)
+		}
+		bad[p.File][p.Line] = p.quarantined()
+	}
+
+	var names []string
+	for name := range bad {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := repairFile(dir, name, bad[name]); err != nil {
+			return nil, fmt.Errorf("failed to repair %s: %w", name, err)
+		}
+	}
+	return names, nil
+}
+
+// repairFile rewrites a file without the lines marked for quarantine,
+// appending those to the file's quarantine file
+func repairFile(dir, name string, lines map[int]bool) error {
+	path := filepath.Join(dir, name)
+
+	tmpPath := path + ".tmp"
+	out, err := createRecordings(tmpPath, IsCompressed(path))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	done := false
+	defer func() {
+		if !done {
+			out.Abort()
+		}
+	}()
+
+	var quarantined bytes.Buffer
+	var writeErr error
+	err = eachFileLine(path, func(num int, _ int64, line []byte, _ bool) {
+		if writeErr != nil {
+			return
+		}
+		if lines[num] {
+			quarantined.Write(line)
+			quarantined.WriteByte('\n')
+			return
+		}
+		writeErr = out.WriteLine(line)
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// Quarantined lines are kept before the file that held them is replaced
+	if quarantined.Len() > 0 {
+		if err := appendQuarantine(dir, name, quarantined.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	done = true
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// appendQuarantine adds lines removed from a recordings file to its
+// quarantine file
+func appendQuarantine(dir, name string, data []byte) error {
+	qdir := filepath.Join(dir, QuarantineDir)
+	if err := os.MkdirAll(qdir, 0755); err != nil {
+		return fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(qdir, strings.TrimSuffix(name, CompressedExt)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open quarantine file: %w", err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	return nil
+}
+
+// eachFileLine calls fn with every non-empty line of a plain or compressed
+// recordings file, however long, along with its 1-based line number, its
+// offset and whether it ends with a newline
+func eachFileLine(path string, fn func(num int, offset int64, line []byte, terminated bool)) error {
+	f, err := OpenRecordings(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	var offset int64
+	num := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			num++
+			terminated := line[len(line)-1] == '\n'
+			content := line
+			if terminated {
+				content = line[:len(line)-1]
+			}
+			if len(content) > 0 {
+				fn(num, offset, content, terminated)
+			}
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
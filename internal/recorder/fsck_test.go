@@ -0,0 +1,105 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fsckKinds(report *FsckReport) []string {
+	var kinds []string
+	for _, p := range report.Problems {
+		if p.Line > 0 {
+			kinds = append(kinds, fmt.Sprintf("%s:%d", p.Kind, p.Line))
+		} else {
+			kinds = append(kinds, p.Kind+":"+p.ID)
+		}
+	}
+	return kinds
+}
+
+func writeRecordings(t *testing.T, dir string, n int) string {
+	t.Helper()
+	r := NewWithOptions(true, dir, Options{Fsync: FsyncAlways})
+	for i := 0; i < n; i++ {
+		r.Record(Recording{ID: fmt.Sprintf("20250101-%d", i), Timestamp: time.Date(2025, 1, 1, 12, 0, i, 0, time.UTC), Provider: "claude"})
+	}
+	require.NoError(t, r.Close())
+	return filepath.Join(dir, "recordings-2025-01-01.jsonl")
+}
+
+func TestFsck_Clean(t *testing.T) {
+	dir := t.TempDir()
+	writeRecordings(t, dir, 3)
+
+	report, err := Fsck(dir)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+	assert.Equal(t, 1, report.Files)
+	assert.Equal(t, 3, report.Recordings)
+}
+
+func TestFsck_Repair(t *testing.T) {
+	dir := t.TempDir()
+	path := writeRecordings(t, dir, 3)
+
+	lines := readLines(t, path)
+	big := fmt.Sprintf(`{"id":"20250101-big","body":"%s"}`, strings.Repeat("x", MaxLineSize))
+	torn := `{"id":"20250101-torn","prov`
+	content := strings.Join([]string{lines[0], "not json", lines[1], lines[0], big, lines[2], torn}, "\n")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	report, err := Fsck(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"corrupt:2", "duplicate:4", "oversized:5", "truncated:7",
+		"index:20250101-1", "index:20250101-2",
+	}, fsckKinds(report))
+	assert.Equal(t, map[string]bool{"20250101-0": true, "20250101-1": true, "20250101-2": true}, report.IDs)
+
+	repaired, err := Repair(dir, report)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"recordings-2025-01-01.jsonl"}, repaired)
+	assert.Equal(t, lines, readLines(t, path))
+	assert.Equal(t, []string{"not json", lines[0], big, torn}, readLines(t, filepath.Join(dir, QuarantineDir, "recordings-2025-01-01.jsonl")))
+
+	require.NoError(t, NewIndex(dir).Rebuild())
+	report, err = Fsck(dir)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), report.Problems)
+}
+
+func TestFsck_UnterminatedAndStaleIndex(t *testing.T) {
+	dir := t.TempDir()
+	path := writeRecordings(t, dir, 2)
+
+	// A complete recording missing its newline, and an index entry for a
+	// recording that is gone
+	lines := readLines(t, path)
+	require.NoError(t, os.WriteFile(path, []byte(lines[0]+"\n"+lines[1]), 0644))
+	idx := NewIndex(dir)
+	require.NoError(t, idx.Load())
+	idx.Add(IndexEntry{ID: "20250101-gone", Filename: "recordings-2025-01-01.jsonl"})
+	require.NoError(t, idx.Close())
+
+	report, err := Fsck(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"unterminated:2", "index:20250101-gone"}, fsckKinds(report))
+
+	repaired, err := Repair(dir, report)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"recordings-2025-01-01.jsonl"}, repaired)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, lines[0]+"\n"+lines[1]+"\n", string(data))
+
+	// Nothing needed quarantining
+	_, err = os.Stat(filepath.Join(dir, QuarantineDir))
+	assert.True(t, os.IsNotExist(err))
+}
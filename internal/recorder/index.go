@@ -2,12 +2,14 @@ package recorder
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -23,12 +25,35 @@ type IndexEntry struct {
 	Provider  string    `json:"provider"`
 }
 
-// Index manages an in-memory map of recording IDs to their file locations
+const (
+	indexSnapshotFile = "index.json"
+	indexLogFile      = "index.log"
+
+	// compactAfter is how many logged entries trigger a new snapshot
+	compactAfter = 10000
+	// recentLimit is how many new IDs are kept unsorted before they are
+	// merged into the sorted list
+	recentLimit = 1024
+)
+
+// Index manages an in-memory map of recording IDs to their file locations.
+// It is persisted as a snapshot (index.json) plus an append-only log
+// (index.log) of entries added since, so every Add survives a crash and
+// startup only replays the log.
 type Index struct {
 	entries map[string]IndexEntry
 	mu      sync.RWMutex
 	path    string // path to recordings directory
-	dirty   bool   // tracks if index needs to be persisted
+	dirty   bool   // tracks if the snapshot is behind the entries
+
+	log      *os.File
+	logCount int // entries in the log since the last snapshot
+
+	// IDs in order for prefix lookups; recent IDs are merged in batches
+	sorted []string
+	recent []string
+
+	keys *Keyring // decrypts recordings read by ReadRecording
 }
 
 // NewIndex creates a new index instance
@@ -39,48 +64,134 @@ func NewIndex(recordingsPath string) *Index {
 	}
 }
 
-// Load reads the index from disk
+// Load reads the snapshot, replays the log and indexes any recordings that
+// were written after the last logged entry, such as those in flight during a
+// crash
 func (idx *Index) Load() error {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
-	indexPath := filepath.Join(idx.path, "index.json")
-
-	file, err := os.Open(indexPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Index doesn't exist yet, will be built on first use
-			return nil
+	file, err := os.Open(filepath.Join(idx.path, indexSnapshotFile))
+	if err == nil {
+		var entries []IndexEntry
+		err = json.NewDecoder(file).Decode(&entries)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode index: %w", err)
+		}
+		idx.entries = make(map[string]IndexEntry, len(entries))
+		for _, entry := range entries {
+			idx.entries[entry.ID] = entry
 		}
+	} else if !os.IsNotExist(err) {
 		return fmt.Errorf("failed to open index file: %w", err)
 	}
-	defer file.Close()
 
-	var entries []IndexEntry
-	if err := json.NewDecoder(file).Decode(&entries); err != nil {
-		return fmt.Errorf("failed to decode index: %w", err)
+	replayed, err := idx.replayLog()
+	if err != nil {
+		return err
 	}
+	idx.logCount = replayed
+	idx.dirty = replayed > 0
+	idx.rebuildSorted()
 
-	// Convert slice to map
-	idx.entries = make(map[string]IndexEntry, len(entries))
-	for _, entry := range entries {
-		idx.entries[entry.ID] = entry
+	recovered, err := idx.catchUp()
+	if err != nil {
+		return err
 	}
 
-	slog.Info("Loaded recording index", "count", len(idx.entries))
+	slog.Info("Loaded recording index", "count", len(idx.entries), "replayed", replayed, "recovered", recovered)
 	return nil
 }
 
-// Save writes the index to disk
+// replayLog applies logged entries. A torn last line from a crash is cut
+// off so new entries start on a fresh line.
+func (idx *Index) replayLog() (int, error) {
+	logPath := filepath.Join(idx.path, indexLogFile)
+	data, err := os.ReadFile(logPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read index log: %w", err)
+	}
+
+	if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+		slog.Warn("Discarding torn index log entry", "bytes", len(data)-end)
+		if err := os.Truncate(logPath, int64(end)); err != nil {
+			return 0, fmt.Errorf("failed to repair index log: %w", err)
+		}
+		data = data[:end]
+	}
+
+	count := 0
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry IndexEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			slog.Warn("Skipping unreadable index log entry", "error", err)
+			continue
+		}
+		idx.entries[entry.ID] = entry
+		count++
+	}
+	return count, nil
+}
+
+// catchUp indexes lines past the last indexed recording of each file
+func (idx *Index) catchUp() (int, error) {
+	files, err := RecordingFiles(idx.path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	ends := make(map[string]int64)
+	for _, entry := range idx.entries {
+		if end := entry.Offset + entry.Length + 1; end > ends[entry.Filename] {
+			ends[entry.Filename] = end
+		}
+	}
+
+	var recovered []IndexEntry
+	for _, file := range files {
+		name := filepath.Base(file)
+		if IsCompressed(name) {
+			// Compressed files never grow
+			if ends[name] > 0 {
+				continue
+			}
+		} else if info, err := os.Stat(file); err != nil || info.Size() <= ends[name] {
+			continue
+		}
+		entries, err := scanRecordings(idx.path, name, ends[name])
+		if err != nil {
+			slog.Error("Failed to index recordings", "file", name, "error", err)
+			continue
+		}
+		recovered = append(recovered, entries...)
+	}
+
+	if len(recovered) > 0 {
+		idx.addLocked(recovered)
+	}
+	return len(recovered), nil
+}
+
+// Save writes a snapshot of the index and truncates the log it replaces
 func (idx *Index) Save() error {
-	idx.mu.RLock()
-	defer idx.mu.RUnlock()
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.saveLocked()
+}
 
+func (idx *Index) saveLocked() error {
 	if !idx.dirty {
 		return nil // No changes to persist
 	}
 
-	indexPath := filepath.Join(idx.path, "index.json")
+	indexPath := filepath.Join(idx.path, indexSnapshotFile)
 
 	// Convert map to slice for JSON encoding
 	entries := make([]IndexEntry, 0, len(idx.entries))
@@ -103,6 +214,13 @@ func (idx *Index) Save() error {
 		return fmt.Errorf("failed to encode index: %w", err)
 	}
 
+	// The log is truncated next, so the snapshot must be on disk first
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync temp index file: %w", err)
+	}
+
 	if err := tmpFile.Close(); err != nil {
 		os.Remove(tmpPath)
 		return fmt.Errorf("failed to close temp index file: %w", err)
@@ -114,17 +232,100 @@ func (idx *Index) Save() error {
 		return fmt.Errorf("failed to rename temp index file: %w", err)
 	}
 
+	// Everything in the log is now in the snapshot. Replaying a log that
+	// survives a crash here is harmless, since entries are keyed by ID.
+	if idx.log != nil {
+		idx.log.Close()
+		idx.log = nil
+	}
+	if err := os.Remove(filepath.Join(idx.path, indexLogFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to truncate index log: %w", err)
+	}
+	idx.logCount = 0
+	idx.dirty = false
+
 	slog.Info("Saved recording index", "count", len(entries))
 	return nil
 }
 
 // Add adds or updates an entry in the index
 func (idx *Index) Add(entry IndexEntry) {
+	idx.AddBatch([]IndexEntry{entry})
+}
+
+// AddBatch adds entries with a single write to the index log
+func (idx *Index) AddBatch(entries []IndexEntry) {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
+	idx.addLocked(entries)
+}
+
+func (idx *Index) addLocked(entries []IndexEntry) {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		if _, exists := idx.entries[entry.ID]; !exists {
+			idx.addID(entry.ID)
+		}
+		idx.entries[entry.ID] = entry
 
-	idx.entries[entry.ID] = entry
+		data, err := json.Marshal(entry)
+		if err != nil {
+			slog.Error("Failed to encode index entry", "id", entry.ID, "error", err)
+			continue
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
 	idx.dirty = true
+
+	if err := idx.appendLog(buf.Bytes()); err != nil {
+		slog.Error("Failed to append to index log, it will be saved on close", "error", err)
+		return
+	}
+	idx.logCount += len(entries)
+
+	if idx.logCount >= compactAfter {
+		if err := idx.saveLocked(); err != nil {
+			slog.Error("Failed to compact index", "error", err)
+		}
+	}
+}
+
+func (idx *Index) appendLog(data []byte) error {
+	if idx.log == nil {
+		f, err := os.OpenFile(filepath.Join(idx.path, indexLogFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		idx.log = f
+	}
+	_, err := idx.log.Write(data)
+	return err
+}
+
+// Sync flushes the index log to stable storage
+func (idx *Index) Sync() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.log == nil {
+		return nil
+	}
+	return idx.log.Sync()
+}
+
+// Close saves a snapshot and closes the log
+func (idx *Index) Close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	err := idx.saveLocked()
+	if idx.log != nil {
+		if closeErr := idx.log.Close(); err == nil {
+			err = closeErr
+		}
+		idx.log = nil
+	}
+	return err
 }
 
 // Get retrieves an entry from the index
@@ -136,7 +337,7 @@ func (idx *Index) Get(id string) (IndexEntry, bool) {
 	return entry, found
 }
 
-// GetByPrefix finds the first entry matching the ID prefix
+// GetByPrefix finds the entry with the smallest ID matching the prefix
 func (idx *Index) GetByPrefix(prefix string) (IndexEntry, bool) {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
@@ -146,97 +347,198 @@ func (idx *Index) GetByPrefix(prefix string) (IndexEntry, bool) {
 		return entry, true
 	}
 
-	// Search for prefix match
-	for id, entry := range idx.entries {
-		if strings.HasPrefix(id, prefix) {
-			return entry, true
+	match := ""
+	if i := sort.SearchStrings(idx.sorted, prefix); i < len(idx.sorted) && strings.HasPrefix(idx.sorted[i], prefix) {
+		match = idx.sorted[i]
+	}
+	for _, id := range idx.recent {
+		if strings.HasPrefix(id, prefix) && (match == "" || id < match) {
+			match = id
+		}
+	}
+	if match == "" {
+		return IndexEntry{}, false
+	}
+	return idx.entries[match], true
+}
+
+// addID records a new ID for prefix lookups
+func (idx *Index) addID(id string) {
+	idx.recent = append(idx.recent, id)
+	if len(idx.recent) < recentLimit {
+		return
+	}
+
+	sort.Strings(idx.recent)
+	merged := make([]string, 0, len(idx.sorted)+len(idx.recent))
+	i, j := 0, 0
+	for i < len(idx.sorted) && j < len(idx.recent) {
+		if idx.sorted[i] <= idx.recent[j] {
+			merged = append(merged, idx.sorted[i])
+			i++
+		} else {
+			merged = append(merged, idx.recent[j])
+			j++
 		}
 	}
+	merged = append(merged, idx.sorted[i:]...)
+	merged = append(merged, idx.recent[j:]...)
+	idx.sorted = merged
+	idx.recent = idx.recent[:0]
+}
 
-	return IndexEntry{}, false
+func (idx *Index) rebuildSorted() {
+	idx.sorted = make([]string, 0, len(idx.entries))
+	for id := range idx.entries {
+		idx.sorted = append(idx.sorted, id)
+	}
+	sort.Strings(idx.sorted)
+	idx.recent = nil
 }
 
-// Rebuild scans all JSONL files and rebuilds the index from scratch
+// Rebuild scans all JSONL files, rebuilds the index from scratch and saves
+// it
 func (idx *Index) Rebuild() error {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
 	slog.Info("Rebuilding recording index", "path", idx.path)
 
-	entries, err := os.ReadDir(idx.path)
+	files, err := RecordingFiles(idx.path)
 	if err != nil {
 		return fmt.Errorf("failed to read recordings directory: %w", err)
 	}
 
 	newIndex := make(map[string]IndexEntry)
-	var totalRecordings int
-
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
+	for _, file := range files {
+		entries, err := scanRecordings(idx.path, filepath.Base(file), 0)
+		if err != nil {
+			slog.Error("Failed to index recordings", "file", filepath.Base(file), "error", err)
 			continue
 		}
+		for _, entry := range entries {
+			newIndex[entry.ID] = entry
+		}
+	}
 
-		filePath := filepath.Join(idx.path, entry.Name())
-		file, err := os.Open(filePath)
-		if err != nil {
-			slog.Error("Failed to open file for indexing", "file", entry.Name(), "error", err)
+	idx.entries = newIndex
+	idx.dirty = true
+	idx.rebuildSorted()
+
+	slog.Info("Rebuilt recording index", "files", len(files), "recordings", len(newIndex))
+	return idx.saveLocked()
+}
+
+// RenameFile points entries at a file's new name, such as after
+// compression, and saves a snapshot
+func (idx *Index) RenameFile(oldName, newName string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for id, entry := range idx.entries {
+		if entry.Filename == oldName {
+			entry.Filename = newName
+			idx.entries[id] = entry
+		}
+	}
+
+	idx.dirty = true
+	return idx.saveLocked()
+}
+
+// ReindexFiles replaces the entries of files that were rewritten or deleted
+// and saves a snapshot, since the log cannot record removals
+func (idx *Index) ReindexFiles(names []string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	changed := make(map[string]bool, len(names))
+	for _, name := range names {
+		changed[name] = true
+	}
+	for id, entry := range idx.entries {
+		if changed[entry.Filename] {
+			delete(idx.entries, id)
+		}
+	}
+
+	for _, name := range names {
+		entries, err := scanRecordings(idx.path, name, 0)
+		if os.IsNotExist(err) {
 			continue
 		}
+		if err != nil {
+			return fmt.Errorf("failed to index %s: %w", name, err)
+		}
+		for _, entry := range entries {
+			idx.entries[entry.ID] = entry
+		}
+	}
+
+	idx.dirty = true
+	idx.rebuildSorted()
+	return idx.saveLocked()
+}
 
-		var offset int64
-		scanner := bufio.NewScanner(file)
-		// Increase buffer size for large recordings
-		buf := make([]byte, 0, 64*1024)
-		scanner.Buffer(buf, 10*1024*1024)
+// scanRecordings indexes the complete lines of a recordings file from the
+// given offset on. A final line without a newline is still being written
+// (or was torn by a crash) and is skipped.
+func scanRecordings(dir, name string, from int64) ([]IndexEntry, error) {
+	file, err := OpenRecordings(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
 
-		for scanner.Scan() {
-			line := scanner.Bytes()
-			if len(line) == 0 {
-				offset += int64(len(line)) + 1 // +1 for newline
-				continue
-			}
+	if seeker, ok := file.(io.Seeker); ok {
+		_, err = seeker.Seek(from, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, file, from)
+	}
+	if err != nil {
+		return nil, err
+	}
 
+	var entries []IndexEntry
+	offset := from
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+
+		length := int64(len(line)) - 1
+		if length > 0 {
 			// Parse just enough to get ID, timestamp, and provider
 			var partial struct {
 				ID        string    `json:"id"`
 				Timestamp time.Time `json:"timestamp"`
 				Provider  string    `json:"provider"`
 			}
-
 			if err := json.Unmarshal(line, &partial); err != nil {
-				slog.Error("Failed to parse recording for indexing", "file", entry.Name(), "error", err)
-				offset += int64(len(line)) + 1
-				continue
+				slog.Error("Failed to parse recording for indexing", "file", name, "offset", offset, "error", err)
+			} else {
+				entries = append(entries, IndexEntry{
+					ID:        partial.ID,
+					Filename:  name,
+					Offset:    offset,
+					Length:    length,
+					Timestamp: partial.Timestamp,
+					Provider:  partial.Provider,
+				})
 			}
-
-			indexEntry := IndexEntry{
-				ID:        partial.ID,
-				Filename:  entry.Name(),
-				Offset:    offset,
-				Length:    int64(len(line)),
-				Timestamp: partial.Timestamp,
-				Provider:  partial.Provider,
-			}
-
-			newIndex[partial.ID] = indexEntry
-			totalRecordings++
-
-			offset += int64(len(line)) + 1 // +1 for newline
-		}
-
-		file.Close()
-
-		if err := scanner.Err(); err != nil {
-			slog.Error("Scanner error while indexing", "file", entry.Name(), "error", err)
-			continue
 		}
+		offset += int64(len(line))
 	}
+}
 
-	idx.entries = newIndex
-	idx.dirty = true
-
-	slog.Info("Rebuilt recording index", "files", len(entries), "recordings", totalRecordings)
-	return nil
+// SetKeyring sets the keys ReadRecording decrypts recordings with
+func (idx *Index) SetKeyring(keys *Keyring) {
+	idx.keys = keys
 }
 
 // ReadRecording reads a specific recording from disk using the index
@@ -247,11 +549,49 @@ func (idx *Index) ReadRecording(id string) (*Recording, error) {
 		return nil, fmt.Errorf("recording not found in index")
 	}
 
-	// Open the file
+	line, err := idx.readLine(entry)
+	if os.IsNotExist(err) {
+		// The file was compressed since the lookup
+		if entry, found = idx.GetByPrefix(id); found {
+			line, err = idx.readLine(entry)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	// Parse the recording
+	var rec Recording
+	if err := DecodeRecording(line, &rec); err != nil {
+		return nil, fmt.Errorf("failed to parse recording: %w", err)
+	}
+	if err := idx.keys.Open(&rec); err != nil {
+		return nil, err
+	}
+	if _, err := Upgrade(&rec); err != nil {
+		slog.Warn("Failed to upgrade recording", "id", rec.ID, "error", err)
+	}
+
+	// Restore deduplicated fragments and large text from the blob store
+	blobs := NewBlobStore(idx.path)
+	blobs.SetKeyring(idx.keys)
+	if err := blobs.HydrateText(&rec); err != nil {
+		slog.Warn("Failed to restore recording payloads", "id", rec.ID, "error", err)
+	}
+
+	return &rec, nil
+}
+
+// readLine reads an entry's line from a plain or compressed file
+func (idx *Index) readLine(entry IndexEntry) ([]byte, error) {
 	filePath := filepath.Join(idx.path, entry.Filename)
+	if IsCompressed(entry.Filename) {
+		return readCompressedLine(filePath, entry.Offset)
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return nil, err
 	}
 	defer file.Close()
 
@@ -266,14 +606,7 @@ func (idx *Index) ReadRecording(id string) (*Recording, error) {
 	if err != nil && err != io.EOF {
 		return nil, fmt.Errorf("failed to read line: %w", err)
 	}
-
-	// Parse the recording
-	var rec Recording
-	if err := json.Unmarshal(line, &rec); err != nil {
-		return nil, fmt.Errorf("failed to parse recording: %w", err)
-	}
-
-	return &rec, nil
+	return line, nil
 }
 
 // Size returns the number of entries in the index
@@ -0,0 +1,125 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndex_SurvivesCrash(t *testing.T) {
+	dir := t.TempDir()
+
+	// Written and indexed, but the recorder is never closed
+	r := NewWithOptions(true, dir, Options{Fsync: FsyncAlways})
+	for i := 0; i < 3; i++ {
+		r.Record(Recording{ID: fmt.Sprintf("20250101-%d", i), Provider: "claude"})
+	}
+	require.Eventually(t, func() bool { return r.GetIndex().Size() == 3 }, time.Second, time.Millisecond)
+	assert.NoFileExists(t, filepath.Join(dir, indexSnapshotFile))
+
+	idx := NewIndex(dir)
+	require.NoError(t, idx.Load())
+	assert.Equal(t, 3, idx.Size())
+	rec, err := idx.ReadRecording("20250101-2")
+	require.NoError(t, err)
+	assert.Equal(t, "claude", rec.Provider)
+
+	// Closing snapshots the index and empties the log
+	require.NoError(t, r.Close())
+	assert.FileExists(t, filepath.Join(dir, indexSnapshotFile))
+	assert.NoFileExists(t, filepath.Join(dir, indexLogFile))
+
+	idx = NewIndex(dir)
+	require.NoError(t, idx.Load())
+	assert.Equal(t, 3, idx.Size())
+}
+
+func TestIndex_LoadRecovers(t *testing.T) {
+	dir := t.TempDir()
+	file := "recordings-2025-01-01.jsonl"
+	lines := []string{`{"id":"20250101-a","provider":"openai"}`, `{"id":"20250101-b","provider":"claude"}`}
+	data := strings.Join(lines, "\n") + "\n"
+
+	// The first recording was logged, the second written just before a
+	// crash, and the log ends in a torn entry
+	require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(data+`{"id":"20250101-to`), 0644))
+	logged := fmt.Sprintf(`{"id":"20250101-a","filename":%q,"offset":0,"length":%d}`, file, len(lines[0]))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, indexLogFile), []byte(logged+"\n"+`{"id":"20250`), 0644))
+
+	idx := NewIndex(dir)
+	require.NoError(t, idx.Load())
+	assert.Equal(t, 2, idx.Size())
+	rec, err := idx.ReadRecording("20250101-b")
+	require.NoError(t, err)
+	assert.Equal(t, "claude", rec.Provider)
+
+	// The recovered entry was logged and the torn entry cut off
+	log, err := os.ReadFile(filepath.Join(dir, indexLogFile))
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(log), "\n"))
+	assert.True(t, strings.HasSuffix(string(log), "\n"))
+
+	// New recordings start after the torn line
+	fw := newFileWriter(dir, FsyncNever, 0)
+	_, offset, err := fw.append("2025-01-01", []byte(`{"id":"20250101-c"}`))
+	require.NoError(t, err)
+	require.NoError(t, fw.close())
+	assert.Equal(t, int64(len(data)+len(`{"id":"20250101-to`)+1), offset)
+
+	idx = NewIndex(dir)
+	require.NoError(t, idx.Load())
+	entry, found := idx.Get("20250101-c")
+	require.True(t, found)
+	assert.Equal(t, offset, entry.Offset)
+}
+
+func TestIndex_GetByPrefix(t *testing.T) {
+	idx := NewIndex(t.TempDir())
+	defer idx.Close()
+
+	var batch []IndexEntry
+	for i := 0; i < recentLimit+10; i++ {
+		batch = append(batch, IndexEntry{ID: fmt.Sprintf("20250101-%05d", i*2)})
+	}
+	idx.AddBatch(batch)
+	idx.Add(IndexEntry{ID: "20250101-00001"})
+
+	tests := []struct {
+		prefix string
+		want   string
+		found  bool
+	}{
+		{prefix: "20250101-00004", want: "20250101-00004", found: true},
+		{prefix: "20250101-0000", want: "20250101-00000", found: true},
+		{prefix: "20250101-00001", want: "20250101-00001", found: true},
+		{prefix: "20250101-0204", want: "20250101-02040", found: true},
+		{prefix: "20250102", found: false},
+		{prefix: "20250101-00003", found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			entry, found := idx.GetByPrefix(tt.prefix)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.want, entry.ID)
+		})
+	}
+}
+
+func TestIndex_RebuildIgnoresSpill(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "recordings-2025-01-01.jsonl"), []byte(`{"id":"20250101-a"}`+"\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, spillFile), []byte(`{"id":"20250101-spilled"}`+"\n"), 0644))
+
+	idx := NewIndex(dir)
+	require.NoError(t, idx.Rebuild())
+	assert.Equal(t, 1, idx.Size())
+	_, found := idx.Get("20250101-spilled")
+	assert.False(t, found)
+}
@@ -0,0 +1,231 @@
+package recorder
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Advisory locks on the recordings directory allow one writer and many
+// readers. The running server holds the writer lock. Read-only commands
+// share the readers lock. Commands that rewrite or delete recordings hold
+// both exclusively, so they never run under a server or a reader.
+const (
+	writerLockFile  = "writer.lock"
+	readersLockFile = "readers.lock"
+)
+
+// ErrLocked is returned when another mirra process holds a conflicting lock
+var ErrLocked = errors.New("recordings directory is locked by another mirra process")
+
+// errLockHeld is returned by the platform lock functions when the lock is
+// taken
+var errLockHeld = errors.New("lock held")
+
+// LockOwner describes the process holding the writer lock
+type LockOwner struct {
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	Addr    string    `json:"addr,omitempty"` // base URL of a running server
+	Started time.Time `json:"started"`
+}
+
+// LockedError reports who holds the lock that could not be taken
+type LockedError struct {
+	Owner   *LockOwner // nil if the lock is held by readers
+	Readers bool
+}
+
+func (e *LockedError) Error() string {
+	switch {
+	case e.Readers:
+		return "recordings directory is being read by another mirra command"
+	case e.Owner == nil:
+		return ErrLocked.Error()
+	case e.Owner.Addr != "":
+		return fmt.Sprintf("recordings directory is in use by mirra %s (pid %d, %s)", e.Owner.Command, e.Owner.PID, e.Owner.Addr)
+	default:
+		return fmt.Sprintf("recordings directory is in use by mirra %s (pid %d)", e.Owner.Command, e.Owner.PID)
+	}
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+// DirLock is a held lock on a recordings directory
+type DirLock struct {
+	files []*os.File
+}
+
+// LockWriter takes the writer lock for a recorder, recording the owner so
+// other commands can find it. It fails if another writer or an exclusive
+// command holds the lock.
+func LockWriter(dir string, owner LockOwner) (*DirLock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recordings directory: %w", err)
+	}
+
+	f, err := acquire(dir, writerLockFile, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeOwner(f, owner); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &DirLock{files: []*os.File{f}}, nil
+}
+
+// LockExclusive takes the writer and readers locks, for commands that
+// rewrite or delete recordings. A missing directory is not created.
+func LockExclusive(dir, command string) (*DirLock, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return &DirLock{}, nil
+	}
+
+	writer, err := acquire(dir, writerLockFile, true)
+	if err != nil {
+		return nil, err
+	}
+	readers, err := acquire(dir, readersLockFile, true)
+	if err != nil {
+		_ = writer.Close()
+		return nil, err
+	}
+	if err := writeOwner(writer, LockOwner{PID: os.Getpid(), Command: command, Started: time.Now()}); err != nil {
+		_ = readers.Close()
+		_ = writer.Close()
+		return nil, err
+	}
+	return &DirLock{files: []*os.File{writer, readers}}, nil
+}
+
+// LockShared takes a readers lock, which only conflicts with exclusive
+// commands. A missing directory has nothing to protect and is not created.
+func LockShared(dir string) (*DirLock, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return &DirLock{}, nil
+	}
+
+	f, err := acquire(dir, readersLockFile, false)
+	if err != nil {
+		var locked *LockedError
+		if errors.As(err, &locked) {
+			// Only exclusive commands hold the readers lock exclusively
+			locked.Readers = false
+			locked.Owner, _ = ReadLockOwner(dir)
+		}
+		return nil, err
+	}
+	return &DirLock{files: []*os.File{f}}, nil
+}
+
+// Unlock releases the lock
+func (l *DirLock) Unlock() error {
+	var err error
+	for i := len(l.files) - 1; i >= 0; i-- {
+		if unlockErr := unlockFile(l.files[i]); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+		if closeErr := l.files[i].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	l.files = nil
+	return err
+}
+
+// ReadLockOwner returns the last process that took the writer lock. The
+// process may have exited since.
+func ReadLockOwner(dir string) (*LockOwner, error) {
+	data, err := os.ReadFile(filepath.Join(dir, writerLockFile))
+	if err != nil {
+		return nil, err
+	}
+	var owner LockOwner
+	if err := json.Unmarshal(data, &owner); err != nil {
+		return nil, fmt.Errorf("failed to parse lock owner: %w", err)
+	}
+	return &owner, nil
+}
+
+// adminTokenFile holds the admin token of the running server when none is
+// configured, readable only by the user running it
+const adminTokenFile = "admin.token"
+
+// NewAdminToken generates a token for the server's admin endpoints and
+// writes it to the recordings directory, so commands run by the same user
+// can ask the server to prune or reindex
+func NewAdminToken(dir string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate admin token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+	path := filepath.Join(dir, adminTokenFile)
+	// Recreated so an older file's permissions are not kept
+	_ = os.Remove(path)
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write admin token: %w", err)
+	}
+	return token, nil
+}
+
+// ReadAdminToken returns the token written by NewAdminToken
+func ReadAdminToken(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, adminTokenFile))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// RemoveAdminToken removes the token written by NewAdminToken
+func RemoveAdminToken(dir string) error {
+	err := os.Remove(filepath.Join(dir, adminTokenFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func acquire(dir, name string, exclusive bool) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := lockFile(f, exclusive); err != nil {
+		_ = f.Close()
+		if !errors.Is(err, errLockHeld) {
+			return nil, fmt.Errorf("failed to lock recordings directory: %w", err)
+		}
+		locked := &LockedError{Readers: name == readersLockFile}
+		if name == writerLockFile {
+			locked.Owner, _ = ReadLockOwner(dir)
+		}
+		return nil, locked
+	}
+	return f, nil
+}
+
+func writeOwner(f *os.File, owner LockOwner) error {
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lock owner: %w", err)
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write lock owner: %w", err)
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("failed to write lock owner: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package recorder
+
+import "os"
+
+// Platforms without file locking run without coordination
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
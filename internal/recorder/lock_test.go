@@ -0,0 +1,60 @@
+//go:build unix || windows
+
+package recorder
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirLock(t *testing.T) {
+	dir := t.TempDir()
+	owner := LockOwner{PID: os.Getpid(), Command: "start", Addr: "http://localhost:4567"}
+
+	writer, err := LockWriter(dir, owner)
+	require.NoError(t, err)
+
+	// Readers share the directory with the writer and each other
+	reader, err := LockShared(dir)
+	require.NoError(t, err)
+	other, err := LockShared(dir)
+	require.NoError(t, err)
+
+	// A second writer and exclusive commands are refused and told who holds it
+	_, err = LockWriter(dir, LockOwner{Command: "start"})
+	var locked *LockedError
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, owner.Addr, locked.Owner.Addr)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	_, err = LockExclusive(dir, "clear")
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, "start", locked.Owner.Command)
+
+	// Without the writer, readers still keep exclusive commands out
+	require.NoError(t, writer.Unlock())
+	_, err = LockExclusive(dir, "clear")
+	require.ErrorAs(t, err, &locked)
+	assert.True(t, locked.Readers)
+
+	require.NoError(t, reader.Unlock())
+	require.NoError(t, other.Unlock())
+	exclusive, err := LockExclusive(dir, "clear")
+	require.NoError(t, err)
+
+	// Now readers and writers wait for the exclusive command
+	_, err = LockShared(dir)
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, "clear", locked.Owner.Command)
+	_, err = LockWriter(dir, owner)
+	assert.True(t, errors.Is(err, ErrLocked))
+
+	require.NoError(t, exclusive.Unlock())
+	writer, err = LockWriter(dir, owner)
+	require.NoError(t, err)
+	require.NoError(t, writer.Unlock())
+}
@@ -0,0 +1,175 @@
+package recorder
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// QueuePolicy decides what Record does when the queue is full
+type QueuePolicy string
+
+const (
+	// QueueDrop discards the recording and counts it as dropped
+	QueueDrop QueuePolicy = "drop"
+	// QueueBlock waits for room, slowing the proxied response down
+	QueueBlock QueuePolicy = "block"
+	// QueueSpill appends the recording to a spill file that is written to
+	// the recordings later
+	QueueSpill QueuePolicy = "spill"
+)
+
+// DefaultQueueSize is the number of recordings buffered for the writer
+const DefaultQueueSize = 100
+
+const (
+	spillFile    = "spill.jsonl"
+	drainingFile = "spill-draining.jsonl"
+)
+
+// QueueStats counts what happened to recordings passed to Record
+type QueueStats struct {
+	Queued   int64 `json:"queued"`   // accepted into the queue
+	Dropped  int64 `json:"dropped"`  // discarded because the queue was full
+	Spilled  int64 `json:"spilled"`  // written to the spill file
+	Depth    int   `json:"depth"`    // recordings waiting in the queue now
+	Capacity int   `json:"capacity"` // queue size
+}
+
+// Stats returns the recorder's queue counters
+func (r *Recorder) Stats() QueueStats {
+	return QueueStats{
+		Queued:   r.queued.Load(),
+		Dropped:  r.dropped.Load(),
+		Spilled:  r.spilled.Load(),
+		Depth:    len(r.recordChan),
+		Capacity: cap(r.recordChan),
+	}
+}
+
+// spill appends a recording to the spill file
+func (r *Recorder) spill(rec Recording) error {
+	data, err := r.marshal(&rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recording: %w", err)
+	}
+
+	r.spillMu.Lock()
+	defer r.spillMu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(r.path, spillFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open spill file: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+
+	r.spillPending.Store(true)
+	return nil
+}
+
+// DrainSpill asks the writer to move spilled recordings into the recordings
+// files. Call it on startup, once the recorder is configured.
+func (r *Recorder) DrainSpill() {
+	if !r.enabled {
+		return
+	}
+	r.spillPending.Store(true)
+	select {
+	case r.drainChan <- struct{}{}:
+	default:
+	}
+}
+
+// drainSpill writes spilled recordings. The spill file is renamed before it
+// is read so new spills go to a fresh file; a draining file left by a crash
+// is finished first. Recordings already in the index are skipped, so a
+// drain interrupted half way never duplicates.
+func (r *Recorder) drainSpill() {
+	if !r.spillPending.Load() {
+		return
+	}
+
+	spillPath := filepath.Join(r.path, spillFile)
+	drainingPath := filepath.Join(r.path, drainingFile)
+
+	// At most two passes: a leftover draining file, then the current spill
+	for range 2 {
+		r.spillMu.Lock()
+		if _, err := os.Stat(drainingPath); os.IsNotExist(err) {
+			if err := os.Rename(spillPath, drainingPath); err != nil {
+				if !os.IsNotExist(err) {
+					slog.Error("failed to drain spill file", "error", err)
+				}
+				r.spillPending.Store(false)
+				r.spillMu.Unlock()
+				return
+			}
+		}
+		r.spillPending.Store(false)
+		r.spillMu.Unlock()
+
+		if err := r.replaySpill(drainingPath); err != nil {
+			slog.Error("failed to drain spill file", "error", err)
+			r.spillPending.Store(true)
+			return
+		}
+	}
+}
+
+// replaySpill writes every recording in a spill file, then removes it.
+// Spilled lines still carry their payloads inline, so they are read without
+// a size limit, and a line that cannot be decoded is skipped.
+func (r *Recorder) replaySpill(path string) error {
+	written := 0
+	var batch []Recording
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := r.writeBatch(batch); err != nil {
+			return fmt.Errorf("failed to write spilled recordings: %w", err)
+		}
+		written += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	err := eachLine(path, func(line []byte) error {
+		var rec Recording
+		if err := DecodeRecording(line, &rec); err != nil {
+			slog.Error("skipping unreadable spilled recording", "error", err)
+			return nil
+		}
+		if _, ok := r.index.Get(rec.ID); ok {
+			return nil
+		}
+		// Opened so it is prepared like any other recording; one that cannot
+		// be opened is written as it is
+		if err := r.keys.Open(&rec); err != nil {
+			slog.Error("failed to decrypt spilled recording", "error", err, "id", rec.ID)
+		}
+		batch = append(batch, rec)
+		if len(batch) == maxBatch {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	if written > 0 {
+		slog.Info("drained spilled recordings", "count", written)
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,144 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fillQueue holds the writer so recordings back up, records n of them and
+// waits until the worker has taken the first one
+func fillQueue(t *testing.T, r *Recorder, n int) {
+	t.Helper()
+	r.mu.Lock()
+	r.Record(Recording{ID: "20250101-0"})
+	require.Eventually(t, func() bool { return len(r.recordChan) == 0 }, time.Second, time.Millisecond)
+	for i := 1; i < n; i++ {
+		r.Record(Recording{ID: fmt.Sprintf("20250101-%d", i)})
+	}
+}
+
+func countRecordings(t *testing.T, dir string) int {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "recordings-*.jsonl"))
+	require.NoError(t, err)
+	count := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		count += strings.Count(string(data), "\n")
+	}
+	return count
+}
+
+func TestRecorder_QueuePolicies(t *testing.T) {
+	t.Run("drop", func(t *testing.T) {
+		dir := t.TempDir()
+		r := NewWithOptions(true, dir, Options{QueueSize: 2, QueuePolicy: QueueDrop})
+		fillQueue(t, r, 6)
+		r.mu.Unlock()
+		require.NoError(t, r.Close())
+
+		stats := r.Stats()
+		assert.Equal(t, int64(3), stats.Queued)
+		assert.Equal(t, int64(3), stats.Dropped)
+		assert.Equal(t, 3, countRecordings(t, dir))
+	})
+
+	t.Run("spill", func(t *testing.T) {
+		dir := t.TempDir()
+		r := NewWithOptions(true, dir, Options{QueueSize: 2, QueuePolicy: QueueSpill})
+		fillQueue(t, r, 6)
+		assert.FileExists(t, filepath.Join(dir, spillFile))
+		r.mu.Unlock()
+		require.NoError(t, r.Close())
+
+		stats := r.Stats()
+		assert.Equal(t, int64(3), stats.Spilled)
+		assert.Zero(t, stats.Dropped)
+		assert.Equal(t, 6, countRecordings(t, dir))
+		assert.NoFileExists(t, filepath.Join(dir, spillFile))
+	})
+
+	t.Run("block", func(t *testing.T) {
+		dir := t.TempDir()
+		r := NewWithOptions(true, dir, Options{QueueSize: 2, QueuePolicy: QueueBlock})
+		fillQueue(t, r, 3)
+
+		done := make(chan struct{})
+		go func() {
+			r.Record(Recording{ID: "20250101-blocked"})
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("Record returned while the queue was full")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		r.mu.Unlock()
+		<-done
+		require.NoError(t, r.Close())
+		assert.Equal(t, int64(4), r.Stats().Queued)
+		assert.Equal(t, 4, countRecordings(t, dir))
+	})
+}
+
+func TestRecorder_DrainSpillOnStartup(t *testing.T) {
+	dir := t.TempDir()
+
+	// A previous run spilled two recordings, one of which was already written
+	r := New(true, dir)
+	r.Record(Recording{ID: "20250101-written"})
+	require.NoError(t, r.Close())
+	spilled := `{"id":"20250101-written"}` + "\n" + `{"id":"20250101-spilled","request":{"body":{"n":12345678901234567890}}}` + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, drainingFile), []byte(spilled), 0644))
+
+	r = New(true, dir)
+	r.DrainSpill()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, drainingFile))
+		return os.IsNotExist(err)
+	}, time.Second, time.Millisecond)
+	require.NoError(t, r.Close())
+
+	assert.Equal(t, 2, countRecordings(t, dir))
+	read, err := r.GetIndex().ReadRecording("20250101-spilled")
+	require.NoError(t, err)
+	assert.NotNil(t, read.Request.Body)
+
+	files, err := filepath.Glob(filepath.Join(dir, "recordings-*.jsonl"))
+	require.NoError(t, err)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "12345678901234567890")
+}
+
+func TestRecorder_DrainSpillLargeAndBadLines(t *testing.T) {
+	dir := t.TempDir()
+
+	// Spilled lines keep their payloads inline, so they can be larger than
+	// any scanner buffer
+	large := `{"id":"20250101-large","request":{"body":{"text":"` + strings.Repeat("a", 11*1024*1024) + `"}}}`
+	spilled := large + "\n" + "{not json\n" + `{"id":"20250101-after"}` + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, drainingFile), []byte(spilled), 0644))
+
+	r := New(true, dir)
+	r.DrainSpill()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, drainingFile))
+		return os.IsNotExist(err)
+	}, 5*time.Second, time.Millisecond)
+	require.NoError(t, r.Close())
+
+	for _, id := range []string{"20250101-large", "20250101-after"} {
+		_, ok := r.GetIndex().Get(id)
+		assert.True(t, ok, id)
+	}
+}
@@ -0,0 +1,123 @@
+package recorder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseJSON decodes a single JSON value, keeping numbers as json.Number so
+// large integers and their formatting survive re-encoding
+func ParseJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+	return v, nil
+}
+
+// DecodeRecording parses a JSONL line like json.Unmarshal, but keeps body
+// numbers as json.Number
+func DecodeRecording(line []byte, rec *Recording) error {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	return dec.Decode(rec)
+}
+
+// Verify checks that each raw body matches its hash and that the recorded
+// body is what the raw bytes parse to. It returns one problem per mismatch.
+// The recording must be decoded with DecodeRecording so numbers compare
+// exactly.
+func (s *BlobStore) Verify(rec *Recording) []string {
+	if err := s.HydrateText(rec); err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+	check := func(side string, raw *Blob, encoding string, matches func([]byte) bool) {
+		if raw == nil {
+			return
+		}
+		data, err := s.ReadBlob(raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s raw body: %v", side, err))
+			return
+		}
+		digest := sha256.Sum256(data)
+		if hex.EncodeToString(digest[:]) != raw.SHA256 || int64(len(data)) != raw.Size {
+			problems = append(problems, fmt.Sprintf("%s raw body does not match its hash", side))
+			return
+		}
+		if matches == nil {
+			return
+		}
+
+		if encoding != "" {
+			if data, err = DecodeContent(encoding, data); err != nil {
+				problems = append(problems, fmt.Sprintf("%s raw body: %v", side, err))
+				return
+			}
+		}
+		if !matches(data) {
+			problems = append(problems, fmt.Sprintf("%s body does not match raw bytes", side))
+		}
+	}
+
+	// Uploads are recorded as parts and cannot be compared byte for byte
+	var request func([]byte) bool
+	if len(rec.Request.Multipart) == 0 {
+		request = func(data []byte) bool {
+			return s.bodyMatches(data, rec.Request.Body, rec.Request.Blob, false)
+		}
+	}
+	check("request", rec.Request.Raw, rec.Request.Encoding, request)
+
+	// Injected faults change what is recorded, so only the hash is checked
+	var response func([]byte) bool
+	if rec.Fault == nil {
+		response = func(data []byte) bool {
+			return s.bodyMatches(data, rec.Response.Body, rec.Response.Blob, rec.Response.Streaming)
+		}
+	}
+	check("response", rec.Response.Raw, rec.Response.Encoding, response)
+
+	return problems
+}
+
+// bodyMatches reports whether a recorded body is what data parses to
+func (s *BlobStore) bodyMatches(data []byte, body any, blob *Blob, streaming bool) bool {
+	if blob != nil {
+		content, err := s.ReadBlob(blob)
+		return err == nil && bytes.Equal(content, data)
+	}
+	if body == nil {
+		return len(data) == 0
+	}
+
+	if streaming {
+		// Streams are recorded line by line, each ending in a newline
+		text := strings.ReplaceAll(string(data), "\r\n", "\n")
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		return body == text
+	}
+
+	if parsed, err := ParseJSON(data); err == nil {
+		want, err1 := json.Marshal(parsed)
+		got, err2 := json.Marshal(body)
+		return err1 == nil && err2 == nil && bytes.Equal(want, got)
+	}
+	return body == string(data)
+}
@@ -0,0 +1,68 @@
+package recorder
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSON(t *testing.T) {
+	v, err := ParseJSON([]byte(` {"id": 12345678901234567890, "ratio": 1.50} `))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"id": json.Number("12345678901234567890"), "ratio": json.Number("1.50")}, v)
+
+	_, err = ParseJSON([]byte(`{"a":1} {"b":2}`))
+	assert.Error(t, err)
+}
+
+func TestBlobStore_Verify(t *testing.T) {
+	dir := t.TempDir()
+	r := New(true, dir)
+	r.SetInlineThreshold(64)
+
+	requestRaw := []byte(`{"model":"claude-sonnet-4","max_tokens":12345678901234567890,"system":"` + strings.Repeat("x", 2048) + `"}`)
+	requestBody, err := ParseJSON(requestRaw)
+	require.NoError(t, err)
+	streamRaw := []byte("event: ping\r\ndata: {}\r\n\r\n")
+
+	r.Record(Recording{
+		ID:       "20250101-abc",
+		Request:  RequestData{Body: requestBody, Raw: NewBlob("application/json", requestRaw)},
+		Response: ResponseData{Body: "event: ping\ndata: {}\n\n", Streaming: true, Raw: NewBlob("text/event-stream", streamRaw)},
+	})
+	require.NoError(t, r.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "recordings-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	line, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+
+	read := func() *Recording {
+		var rec Recording
+		require.NoError(t, DecodeRecording(line, &rec))
+		return &rec
+	}
+	store := NewBlobStore(dir)
+
+	// Deduplicated, externalized and large-number bodies still verify
+	assert.Empty(t, store.Verify(read()))
+
+	rec := read()
+	rec.Request.Body.(map[string]any)["model"] = "claude-opus-4"
+	assert.Equal(t, []string{"request body does not match raw bytes"}, store.Verify(rec))
+
+	rec = read()
+	rec.Response.Body = "event: ping\n"
+	assert.Equal(t, []string{"response body does not match raw bytes"}, store.Verify(rec))
+
+	require.NoError(t, os.WriteFile(store.Path(rec.Request.Raw.SHA256), []byte("tampered"), 0644))
+	problems := store.Verify(read())
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "request raw body")
+}
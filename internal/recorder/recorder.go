@@ -7,12 +7,15 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Recording struct {
+	SchemaVersion int `json:"schema_version"` // see SchemaVersion
+
 	ID           string       `json:"id"`
 	Timestamp    time.Time    `json:"timestamp"`
 	Provider     string       `json:"provider"`
@@ -21,6 +24,20 @@ type Recording struct {
 	ResponseSize int64        `json:"responseSize"`
 	Timing       TimingData   `json:"timing"`
 	Error        string       `json:"error,omitempty"`
+	Fault        *FaultData   `json:"fault,omitempty"`
+	Findings     []Finding    `json:"findings,omitempty"`
+	VirtualKey   *KeyData     `json:"virtualKey,omitempty"`
+	MetadataOnly bool         `json:"metadataOnly,omitempty"` // bodies were left out by a recording rule
+
+	// Client-supplied metadata from X-Mirra-* request headers
+	Tags    []string `json:"tags,omitempty"`
+	Project string   `json:"project,omitempty"`
+	Session string   `json:"session,omitempty"`
+	User    string   `json:"user,omitempty"`
+
+	// Sealed holds the request, response, findings, error and client
+	// metadata when the recording is encrypted; see Keyring.Seal
+	Sealed *Sealed `json:"sealed,omitempty"`
 }
 
 type RequestData struct {
@@ -29,6 +46,17 @@ type RequestData struct {
 	Query   string              `json:"query,omitempty"`
 	Headers map[string][]string `json:"headers"`
 	Body    interface{}         `json:"body,omitempty"`
+
+	// Multipart uploads are recorded as parts instead of Body
+	Multipart []MultipartPart `json:"multipart,omitempty"`
+	// Binary request bodies are recorded as a blob instead of Body
+	Blob *Blob `json:"blob,omitempty"`
+	// Raw holds the exact bytes Body was captured from. It is omitted when
+	// Blob already holds them.
+	Raw *Blob `json:"raw,omitempty"`
+	// Content-Encoding the body was sent with. The recorded body is decoded,
+	// unless decoding failed, in which case Blob holds the bytes as sent.
+	Encoding string `json:"encoding,omitempty"`
 }
 
 type ResponseData struct {
@@ -36,6 +64,15 @@ type ResponseData struct {
 	Headers   map[string][]string `json:"headers"`
 	Body      interface{}         `json:"body,omitempty"`
 	Streaming bool                `json:"streaming"`
+
+	// Binary responses (audio, images, files) are recorded as a blob instead of Body
+	Blob *Blob `json:"blob,omitempty"`
+	// Raw holds the exact bytes received from upstream. It is omitted when
+	// Blob already holds them.
+	Raw *Blob `json:"raw,omitempty"`
+	// Content-Encoding the body was sent with. The recorded body is decoded,
+	// unless decoding failed, in which case Blob holds the bytes as sent.
+	Encoding string `json:"encoding,omitempty"`
 }
 
 type TimingData struct {
@@ -44,31 +81,155 @@ type TimingData struct {
 	DurationMs  int64     `json:"duration_ms"`
 }
 
+// DropBodies removes the request and response bodies, keeping headers,
+// status and timing, and marks the recording as metadata only
+func (rec *Recording) DropBodies() {
+	rec.Request.Body = nil
+	rec.Request.Multipart = nil
+	rec.Request.Blob = nil
+	rec.Request.Raw = nil
+	rec.Response.Body = nil
+	rec.Response.Blob = nil
+	rec.Response.Raw = nil
+	rec.MetadataOnly = true
+}
+
+// FaultData describes a fault injected into the request by chaos mode
+type FaultData struct {
+	Rule        string `json:"rule,omitempty"`
+	Type        string `json:"type"`
+	Status      int    `json:"status,omitempty"`
+	LatencyMs   int    `json:"latency_ms,omitempty"`
+	AfterEvents int    `json:"after_events,omitempty"`
+}
+
+// KeyData attributes a recording to the virtual key that made the request
+type KeyData struct {
+	ID      string `json:"id"`
+	Owner   string `json:"owner,omitempty"`
+	Project string `json:"project,omitempty"`
+}
+
+// Finding is something a scanner detected in the request or response.
+// Match holds a redacted preview, never the raw value.
+type Finding struct {
+	Detector string `json:"detector"`         // e.g. "pii"
+	Type     string `json:"type"`             // e.g. "email", "credit_card"
+	Severity string `json:"severity"`         // "low", "medium", "high", "critical"
+	Location string `json:"location"`         // e.g. "request.messages[0].content"
+	Match    string `json:"match,omitempty"`  // redacted preview of the match
+	Action   string `json:"action,omitempty"` // "allowed", "masked", "blocked"
+}
+
 type Recorder struct {
-	enabled      bool
-	path         string
-	mu           sync.Mutex
-	recordChan   chan Recording
-	stopChan     chan struct{}
-	wg           sync.WaitGroup
-	index        *Index
-	groupManager GroupManager
+	enabled       bool
+	path          string
+	mu            sync.Mutex
+	recordChan    chan Recording
+	stopChan      chan struct{}
+	drainChan     chan struct{}
+	policy        QueuePolicy
+	out           *fileWriter
+	rotation      Rotation
+	fsyncInterval time.Duration
+	wg            sync.WaitGroup
+	index         *Index
+	groupManager  GroupManager
+	scanner       Scanner
+	blobs         *BlobStore
+	keys          *Keyring
+	inline        int // inline threshold in bytes, negative keeps everything inline
+	dedupe        int // smallest fragment in bytes to deduplicate, negative disables
+
+	closeMu      sync.RWMutex
+	closed       bool
+	spillMu      sync.Mutex
+	spillPending atomic.Bool
+	queued       atomic.Int64
+	dropped      atomic.Int64
+	spilled      atomic.Int64
 }
 
 // GroupManager is an interface for grouping recordings
 // This allows the recorder to be decoupled from the grouping implementation
 type GroupManager interface {
 	OnRecordingWrite(*Recording) error
+	OnRecordingsRemoved(ids []string) error
 	Close() error
 }
 
+// Scanner inspects a recording before it is written and returns findings.
+// It runs on the recorder's worker so detection never delays the client.
+type Scanner interface {
+	Scan(*Recording) []Finding
+}
+
+// Options configures a Recorder. Zero values use the defaults.
+type Options struct {
+	QueueSize     int
+	QueuePolicy   QueuePolicy
+	Fsync         FsyncPolicy
+	FsyncInterval time.Duration
+	Rotation      Rotation
+
+	// Audit chains every line in an audit log next to its file, and
+	// AuditSigner signs checkpoints of the chain; setting it enables Audit
+	Audit       bool
+	AuditSigner *AuditSigner
+}
+
 func New(enabled bool, path string) *Recorder {
+	return NewWithOptions(enabled, path, Options{})
+}
+
+// NewWithOptions creates a recorder with a custom queue and fsync policy
+func NewWithOptions(enabled bool, path string, opts Options) *Recorder {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	switch opts.QueuePolicy {
+	case QueueDrop, QueueBlock, QueueSpill:
+	case "":
+		opts.QueuePolicy = QueueSpill
+	default:
+		slog.Warn("unknown queue policy, spilling to disk", "policy", opts.QueuePolicy)
+		opts.QueuePolicy = QueueSpill
+	}
+
+	switch opts.Fsync {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	case "":
+		opts.Fsync = FsyncInterval
+	default:
+		slog.Warn("unknown fsync policy, syncing every interval", "policy", opts.Fsync)
+		opts.Fsync = FsyncInterval
+	}
+	if opts.FsyncInterval <= 0 {
+		opts.FsyncInterval = DefaultFsyncInterval
+	}
+	if opts.Rotation.Period != RotateHourly {
+		opts.Rotation.Period = RotateDaily
+	}
+	opts.Rotation.Location = opts.Rotation.location()
+
+	out := newFileWriter(path, opts.Fsync, opts.Rotation.MaxSize)
+	out.audit = opts.Audit || opts.AuditSigner != nil
+	out.signer = opts.AuditSigner
+
 	r := &Recorder{
-		enabled:    enabled,
-		path:       path,
-		recordChan: make(chan Recording, 100),
-		stopChan:   make(chan struct{}),
-		index:      NewIndex(path),
+		enabled:       enabled,
+		path:          path,
+		recordChan:    make(chan Recording, opts.QueueSize),
+		stopChan:      make(chan struct{}),
+		drainChan:     make(chan struct{}, 1),
+		policy:        opts.QueuePolicy,
+		out:           out,
+		rotation:      opts.Rotation,
+		fsyncInterval: opts.FsyncInterval,
+		index:         NewIndex(path),
+		blobs:         NewBlobStore(path),
+		inline:        DefaultInlineThreshold,
+		dedupe:        DefaultFragmentThreshold,
 	}
 
 	if enabled {
@@ -78,17 +239,20 @@ func New(enabled bool, path string) *Recorder {
 			return r
 		}
 
-		// Load or rebuild index
+		// Load the index, which also picks up recordings written after the
+		// last indexed one; only a corrupt snapshot needs a full rebuild
 		if err := r.index.Load(); err != nil {
 			slog.Error("failed to load index, will rebuild", "error", err)
 			if err := r.index.Rebuild(); err != nil {
 				slog.Error("failed to rebuild index", "error", err)
 			}
-		} else if r.index.Size() == 0 {
-			// Index is empty, rebuild it
-			slog.Info("index is empty, rebuilding from existing recordings")
-			if err := r.index.Rebuild(); err != nil {
-				slog.Error("failed to rebuild index", "error", err)
+		}
+
+		// Spilled recordings from a previous run are written once the
+		// recorder is idle or DrainSpill is called
+		for _, name := range []string{spillFile, drainingFile} {
+			if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+				r.spillPending.Store(true)
 			}
 		}
 
@@ -104,31 +268,82 @@ func (r *Recorder) Record(rec Recording) {
 		return
 	}
 
+	// Close waits for in-flight calls, so nothing is queued after the
+	// writer stops
+	r.closeMu.RLock()
+	defer r.closeMu.RUnlock()
+	if r.closed {
+		// Keep the recording for the next start
+		r.spillOrDrop(rec)
+		return
+	}
+
 	select {
 	case r.recordChan <- rec:
+		r.queued.Add(1)
+		return
 	default:
-		slog.Warn("recording channel full, dropping recording", "id", rec.ID)
 	}
+
+	switch r.policy {
+	case QueueBlock:
+		r.recordChan <- rec
+		r.queued.Add(1)
+	case QueueSpill:
+		r.spillOrDrop(rec)
+	default:
+		r.dropped.Add(1)
+		slog.Warn("recording queue full, dropping recording", "id", rec.ID)
+	}
+}
+
+// spillOrDrop writes a recording to the spill file, dropping it only if the
+// spill file cannot be written
+func (r *Recorder) spillOrDrop(rec Recording) {
+	if err := r.spill(rec); err != nil {
+		r.dropped.Add(1)
+		slog.Error("failed to spill recording, dropping it", "error", err, "id", rec.ID)
+		return
+	}
+	r.spilled.Add(1)
 }
 
 func (r *Recorder) worker() {
 	defer r.wg.Done()
 
+	var tick <-chan time.Time
+	if r.out.policy == FsyncInterval {
+		ticker := time.NewTicker(r.fsyncInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
 	for {
 		select {
 		case rec := <-r.recordChan:
-			if err := r.writeRecording(rec); err != nil {
-				slog.Error("failed to write recording", "error", err, "id", rec.ID)
+			r.logWriteError(r.writeBatch(r.collect(rec)))
+			// Catch up on spilled recordings once the burst is over
+			if len(r.recordChan) == 0 {
+				r.drainSpill()
 			}
+		case <-r.drainChan:
+			r.drainSpill()
+		case <-tick:
+			r.mu.Lock()
+			r.logWriteError(r.out.sync())
+			r.logWriteError(r.index.Sync())
+			r.mu.Unlock()
 		case <-r.stopChan:
 			// Drain remaining recordings
 			for {
 				select {
 				case rec := <-r.recordChan:
-					if err := r.writeRecording(rec); err != nil {
-						slog.Error("failed to write recording", "error", err, "id", rec.ID)
-					}
+					r.logWriteError(r.writeBatch(r.collect(rec)))
 				default:
+					r.drainSpill()
+					r.mu.Lock()
+					r.logWriteError(r.out.close())
+					r.mu.Unlock()
 					return
 				}
 			}
@@ -136,64 +351,179 @@ func (r *Recorder) worker() {
 	}
 }
 
-func (r *Recorder) writeRecording(rec Recording) error {
+// collect gathers recordings already waiting in the queue behind rec, so
+// they are written with a single group commit
+func (r *Recorder) collect(rec Recording) []Recording {
+	batch := []Recording{rec}
+	for len(batch) < maxBatch {
+		select {
+		case next := <-r.recordChan:
+			batch = append(batch, next)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+func (r *Recorder) logWriteError(err error) {
+	if err != nil {
+		slog.Error("failed to write recordings", "error", err)
+	}
+}
+
+// writeBatch appends recordings to the files for their timestamps and
+// commits them together.
+// Recordings are indexed only once committed, so readers never see an index
+// entry for a line that is not in the file yet.
+func (r *Recorder) writeBatch(batch []Recording) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	filename := fmt.Sprintf("recordings-%s.jsonl", time.Now().Format("2006-01-02"))
-	fullPath := filepath.Join(r.path, filename)
+	entries := make([]IndexEntry, 0, len(batch))
+	written := make([]*Recording, 0, len(batch))
+
+	for i := range batch {
+		rec := &batch[i]
+		r.prepare(rec)
+
+		data, err := r.marshal(rec)
+		if err != nil {
+			slog.Error("failed to marshal recording", "error", err, "id", rec.ID)
+			continue
+		}
+
+		// File by the timestamp the ID's date prefix was taken from, so a
+		// request finishing after midnight stays in its day's file
+		timestamp := rec.Timestamp
+		if timestamp.IsZero() {
+			timestamp = time.Now()
+		}
+		filename, offset, err := r.out.append(r.rotation.period(timestamp), data)
+		if err != nil {
+			err = fmt.Errorf("failed to write recording %s: %w", rec.ID, err)
+			return r.recoverBatch(batch[i:], entries, written, err)
+		}
 
-	// Get current file size to determine offset
-	stat, err := os.Stat(fullPath)
-	var offset int64
-	if err == nil {
-		offset = stat.Size()
+		entries = append(entries, IndexEntry{
+			ID:        rec.ID,
+			Filename:  filename,
+			Offset:    offset,
+			Length:    int64(len(data)),
+			Timestamp: rec.Timestamp,
+			Provider:  rec.Provider,
+		})
+		written = append(written, rec)
 	}
 
-	f, err := os.OpenFile(fullPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+	if err := r.out.commit(); err != nil {
+		return r.recoverBatch(nil, entries, written, err)
 	}
-	defer func() {
-		_ = f.Close()
-	}()
 
-	data, err := json.Marshal(rec)
-	if err != nil {
-		return fmt.Errorf("failed to marshal recording: %w", err)
+	return r.indexBatch(entries, written)
+}
+
+// recoverBatch keeps what it can of a batch whose write failed. Lines that
+// reached their file in full are indexed; the rest, along with the
+// recordings not written yet, go to the spill file for the next drain.
+func (r *Recorder) recoverBatch(rest []Recording, entries []IndexEntry, written []*Recording, err error) error {
+	sizes := make(map[string]int64)
+	var kept []IndexEntry
+	var keptRecs []*Recording
+	var lost []Recording
+	for i, entry := range entries {
+		size, ok := sizes[entry.Filename]
+		if !ok {
+			if info, statErr := os.Stat(filepath.Join(r.path, entry.Filename)); statErr == nil {
+				size = info.Size()
+			}
+			sizes[entry.Filename] = size
+		}
+		if entry.Offset+entry.Length < size {
+			kept = append(kept, entry)
+			keptRecs = append(keptRecs, written[i])
+		} else {
+			lost = append(lost, *written[i])
+		}
+	}
+	if indexErr := r.indexBatch(kept, keptRecs); indexErr != nil {
+		slog.Error("failed to index recordings", "error", indexErr)
 	}
 
-	length := int64(len(data))
-	if _, err := f.Write(append(data, '\n')); err != nil {
-		return fmt.Errorf("failed to write recording: %w", err)
+	for _, rec := range append(lost, rest...) {
+		r.spillOrDrop(rec)
 	}
+	return fmt.Errorf("%w; spilled %d recordings", err, len(lost)+len(rest))
+}
 
-	// Update index
-	r.index.Add(IndexEntry{
-		ID:        rec.ID,
-		Filename:  filename,
-		Offset:    offset,
-		Length:    length,
-		Timestamp: rec.Timestamp,
-		Provider:  rec.Provider,
-	})
+// indexBatch adds written recordings to the index and grouping indexes
+func (r *Recorder) indexBatch(entries []IndexEntry, written []*Recording) error {
+	r.index.AddBatch(entries)
+	if r.out.policy == FsyncAlways {
+		if err := r.index.Sync(); err != nil {
+			return fmt.Errorf("failed to sync index log: %w", err)
+		}
+	}
 
 	// Update grouping indexes if enabled
 	if r.groupManager != nil {
-		if err := r.groupManager.OnRecordingWrite(&rec); err != nil {
-			slog.Error("failed to update grouping indexes", "error", err, "id", rec.ID)
-			// Don't fail the recording write if grouping fails
+		for i, entry := range entries {
+			if err := r.groupManager.OnRecordingWrite(written[i]); err != nil {
+				slog.Error("failed to update grouping indexes", "error", err, "id", entry.ID)
+				// Don't fail the recording write if grouping fails
+			}
 		}
 	}
 
 	return nil
 }
 
+// marshal encodes a recording for the recordings file, encrypting a copy of
+// it if a keyring is set
+func (r *Recorder) marshal(rec *Recording) ([]byte, error) {
+	if r.keys == nil {
+		return json.Marshal(rec)
+	}
+	sealed := *rec
+	if err := r.keys.Seal(&sealed); err != nil {
+		return nil, err
+	}
+	return json.Marshal(&sealed)
+}
+
+// prepare adds findings and moves repeated and large payloads to the blob
+// store before a recording is written
+func (r *Recorder) prepare(rec *Recording) {
+	rec.SchemaVersion = SchemaVersion
+
+	if r.scanner != nil {
+		rec.Findings = append(rec.Findings, r.scanner.Scan(rec)...)
+	}
+
+	// Store repeated system prompts, tools and conversation history once
+	if r.dedupe >= 0 {
+		if err := r.blobs.Dedupe(rec, r.dedupe); err != nil {
+			slog.Error("failed to deduplicate fragments, keeping them inline", "error", err, "id", rec.ID)
+		}
+	}
+
+	// Move large payloads to the blob store so JSONL lines stay small
+	if r.inline >= 0 {
+		if err := r.blobs.Externalize(rec, r.inline); err != nil {
+			slog.Error("failed to externalize payloads, keeping them inline", "error", err, "id", rec.ID)
+		}
+	}
+}
+
 func (r *Recorder) Close() error {
 	if !r.enabled {
 		return nil
 	}
 
+	r.closeMu.Lock()
+	r.closed = true
+	r.closeMu.Unlock()
+
 	close(r.stopChan)
 	r.wg.Wait()
 
@@ -204,8 +534,8 @@ func (r *Recorder) Close() error {
 		}
 	}
 
-	// Save index before closing
-	if err := r.index.Save(); err != nil {
+	// Snapshot the index and close its log
+	if err := r.index.Close(); err != nil {
 		slog.Error("failed to save index", "error", err)
 		return err
 	}
@@ -213,21 +543,88 @@ func (r *Recorder) Close() error {
 	return nil
 }
 
+// Reindex rebuilds the index from the recordings files with the writer
+// paused, so a running server can be reindexed in place
+func (r *Recorder) Reindex() (int, error) {
+	if !r.enabled {
+		return 0, fmt.Errorf("recording is disabled")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.out.commit(); err != nil {
+		return 0, err
+	}
+	if err := r.index.Rebuild(); err != nil {
+		return 0, fmt.Errorf("failed to rebuild index: %w", err)
+	}
+	return r.index.Size(), nil
+}
+
 // SetGroupManager sets the group manager for this recorder
 func (r *Recorder) SetGroupManager(gm GroupManager) {
 	r.groupManager = gm
 }
 
+// SetScanner sets the scanner that adds findings to recordings
+func (r *Recorder) SetScanner(s Scanner) {
+	r.scanner = s
+}
+
+// SetInlineThreshold sets the largest payload, in bytes, kept inline in a
+// recording. Larger values go to the blob store; negative disables it.
+func (r *Recorder) SetInlineThreshold(n int) {
+	r.inline = n
+}
+
+// SetDedupeThreshold sets the smallest system prompt, tool list or message,
+// in bytes, stored once as a fragment; negative disables deduplication.
+func (r *Recorder) SetDedupeThreshold(n int) {
+	r.dedupe = n
+}
+
+// SetKeyring encrypts new recordings and blobs with the keyring's active
+// key and decrypts them when read through the index
+func (r *Recorder) SetKeyring(keys *Keyring) {
+	r.keys = keys
+	r.blobs.SetKeyring(keys)
+	r.index.SetKeyring(keys)
+}
+
+// Keyring returns the recorder's keyring, nil if recordings are not
+// encrypted
+func (r *Recorder) Keyring() *Keyring {
+	return r.keys
+}
+
+// Blobs returns the recorder's blob store
+func (r *Recorder) Blobs() *BlobStore {
+	return r.blobs
+}
+
 // GetIndex returns the recorder's index for use by API handlers
 func (r *Recorder) GetIndex() *Index {
 	return r.index
 }
 
+// NewRecording creates a recording whose ID names the day of the file it
+// will be written to, in the recorder's timezone
+func (r *Recorder) NewRecording(provider, method, path, query string, startTime time.Time) Recording {
+	return newRecording(r.rotation, provider, method, path, query, startTime)
+}
+
+// NewRecording creates a recording for a recorder with the default
+// rotation, which uses UTC
 func NewRecording(provider, method, path, query string, startTime time.Time) Recording {
+	return newRecording(Rotation{}, provider, method, path, query, startTime)
+}
+
+func newRecording(rotation Rotation, provider, method, path, query string, startTime time.Time) Recording {
 	// Generate timestamp-prefixed ID for efficient file-based lookups
 	// Format: YYYYMMDD-{uuid} allows us to determine which day's file to search
 	timestamp := time.Now()
-	datePrefix := timestamp.Format("20060102")
+	datePrefix := rotation.idPrefix(timestamp)
 	id := fmt.Sprintf("%s-%s", datePrefix, uuid.New().String())
 
 	return Recording{
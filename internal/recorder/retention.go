@@ -0,0 +1,416 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy decides how long recordings are kept. Zero values keep
+// recordings forever.
+type RetentionPolicy struct {
+	MaxAge         time.Duration
+	MaxTotalSize   int64                    // bytes across all recordings files
+	ErrorMaxAge    time.Duration            // failed requests are kept this long when it is longer
+	ProviderMaxAge map[string]time.Duration // overrides MaxAge
+	ArchiveDir     string                   // expired recordings are moved here instead of deleted
+}
+
+// Enabled reports whether the policy can expire anything
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxTotalSize > 0 || len(p.ProviderMaxAge) > 0
+}
+
+// maxAge returns how long a recording is kept, 0 meaning forever
+func (p RetentionPolicy) maxAge(provider string, failed bool) time.Duration {
+	age := p.MaxAge
+	if override, ok := p.ProviderMaxAge[provider]; ok {
+		age = override
+	}
+	if failed && age > 0 && p.ErrorMaxAge > age {
+		age = p.ErrorMaxAge
+	}
+	return age
+}
+
+// PruneResult describes recordings removed, or that would be removed, by
+// Prune
+type PruneResult struct {
+	DryRun     bool         `json:"dryRun"`
+	Files      []PrunedFile `json:"files"`
+	Recordings int          `json:"recordings"`
+	Bytes      int64        `json:"bytes"`
+	Blobs      int          `json:"blobs"` // blob store entries only removed recordings used
+	IDs        []string     `json:"-"`     // removed recordings, filled in when not a dry run
+}
+
+// PrunedFile describes what was removed from one recordings file
+type PrunedFile struct {
+	Name       string `json:"name"`
+	Recordings int    `json:"recordings"` // expired recordings
+	Kept       int    `json:"kept"`
+	Bytes      int64  `json:"bytes"`
+	Deleted    bool   `json:"deleted"` // the whole file went
+	Reason     string `json:"reason"`  // "age" or "size"
+}
+
+// FileNames returns the files Prune changed
+func (r *PruneResult) FileNames() []string {
+	names := make([]string, len(r.Files))
+	for i, f := range r.Files {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// retentionRecord is the part of a recording retention looks at
+type retentionRecord struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Provider  string    `json:"provider"`
+	Error     string    `json:"error"`
+	Response  struct {
+		Status int `json:"status"`
+	} `json:"response"`
+}
+
+// expired reports whether a recordings line is past its retention. Lines
+// that cannot be parsed are kept.
+func (p RetentionPolicy) expired(line []byte, now time.Time) (string, bool) {
+	var rec retentionRecord
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return "", false
+	}
+	age := p.maxAge(rec.Provider, rec.Error != "" || rec.Response.Status >= 400)
+	return rec.ID, age > 0 && now.Sub(rec.Timestamp) > age
+}
+
+// Prune removes recordings past the policy's age limits, then whole day
+// files, oldest first, until the total size fits. The newest file is never
+// removed for size. Blobs count toward the size while a kept recording uses
+// them, and those only removed recordings used are deleted afterwards,
+// unless an archived one still does. Encrypted recordings are opened with
+// keys to find their blobs. Files are rewritten in place, so callers must
+// stop writing to them first and reindex the changed files afterwards.
+func Prune(dir string, keys *Keyring, policy RetentionPolicy, now time.Time, dryRun bool) (*PruneResult, error) {
+	result := &PruneResult{DryRun: dryRun}
+	if !policy.Enabled() {
+		return result, nil
+	}
+
+	files, err := RecordingFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recordings: %w", err)
+	}
+
+	// Plan: count expired recordings and what is left
+	plans := make([]PrunedFile, len(files))
+	kept := make([]int64, len(files))
+	var total int64
+	var blobs *blobSizes
+	if policy.MaxTotalSize > 0 {
+		blobs = newBlobSizes(dir, keys, len(files))
+	}
+	for i, file := range files {
+		plans[i].Name = filepath.Base(file)
+		err := eachLine(file, func(line []byte) error {
+			if _, expired := policy.expired(line, now); expired {
+				plans[i].Recordings++
+				plans[i].Bytes += int64(len(line)) + 1
+			} else {
+				plans[i].Kept++
+				kept[i] += int64(len(line)) + 1
+				if blobs != nil {
+					blobs.add(i, line)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", plans[i].Name, err)
+		}
+		if plans[i].Recordings > 0 {
+			plans[i].Reason = "age"
+		}
+		total += kept[i]
+	}
+
+	if policy.MaxTotalSize > 0 {
+		total += blobs.total
+		for i := 0; i < len(plans)-1 && total > policy.MaxTotalSize; i++ {
+			if plans[i].Kept == 0 {
+				continue
+			}
+			plans[i].Recordings += plans[i].Kept
+			plans[i].Bytes += kept[i]
+			plans[i].Kept = 0
+			plans[i].Reason = "size"
+			total -= kept[i] + blobs.release(i)
+		}
+	}
+
+	candidates := make(map[string]bool)
+	for i, plan := range plans {
+		if plan.Recordings == 0 {
+			continue
+		}
+		plan.Deleted = plan.Kept == 0
+		if !dryRun {
+			ids, err := pruneFile(files[i], keys, policy, now, plan.Deleted, candidates)
+			if err != nil {
+				return result, fmt.Errorf("failed to prune %s: %w", plan.Name, err)
+			}
+			result.IDs = append(result.IDs, ids...)
+		}
+		result.Files = append(result.Files, plan)
+		result.Recordings += plan.Recordings
+		result.Bytes += plan.Bytes
+	}
+
+	// Archived recordings still use their blobs
+	if !dryRun && len(candidates) > 0 {
+		usage := newBlobUsage(dir, keys, candidates, nil)
+		usage.archive = policy.ArchiveDir
+		err := usage.scan()
+		if err == nil {
+			result.Blobs, err = usage.remove()
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if !dryRun && result.Recordings > 0 {
+		slog.Info("pruned recordings", "recordings", result.Recordings, "bytes", result.Bytes, "files", len(result.Files), "blobs", result.Blobs)
+	}
+	return result, nil
+}
+
+// pruneFile removes expired lines from a file, or the whole file, moving
+// them to the archive if one is configured, and returns the removed IDs.
+// The blobs removed lines use are added to candidates; those of encrypted
+// lines keys cannot open are not, so they are kept.
+func pruneFile(path string, keys *Keyring, policy RetentionPolicy, now time.Time, whole bool, candidates map[string]bool) ([]string, error) {
+	var archive *lineWriter
+	var archivePath string
+	if policy.ArchiveDir != "" {
+		if err := os.MkdirAll(policy.ArchiveDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create archive directory: %w", err)
+		}
+		// Archived lines are appended to the day's file, uncompressed
+		archivePath = filepath.Join(policy.ArchiveDir, strings.TrimSuffix(filepath.Base(path), CompressedExt))
+		f, err := os.OpenFile(archivePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open archive: %w", err)
+		}
+		archive = &lineWriter{file: f, buf: bufio.NewWriter(f)}
+	}
+
+	// Kept lines go to a new file in the same format
+	var out *lineWriter
+	tmpPath := path + ".tmp"
+	if !whole {
+		var err error
+		if out, err = createRecordings(tmpPath, IsCompressed(path)); err != nil {
+			if archive != nil {
+				archive.file.Close()
+			}
+			return nil, fmt.Errorf("failed to create temp file: %w", err)
+		}
+	}
+
+	var ids []string
+	err := eachLine(path, func(line []byte) error {
+		id, expired := policy.expired(line, now)
+		if !expired && !whole {
+			return out.WriteLine(line)
+		}
+		if id != "" {
+			ids = append(ids, id)
+		}
+		if _, refs, err := lineBlobs(line, keys); err == nil {
+			for _, sum := range refs {
+				candidates[sum] = true
+			}
+		}
+		if archive != nil {
+			return archive.WriteLine(line)
+		}
+		return nil
+	})
+	if archive != nil {
+		if closeErr := archive.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		if out != nil {
+			out.Abort()
+		}
+		return nil, err
+	}
+
+	if whole {
+		return ids, os.Remove(path)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	return ids, nil
+}
+
+// blobSizes attributes the blob store's size to the recordings files whose
+// lines use each blob, so Prune knows what removing a file frees
+type blobSizes struct {
+	usage    *blobUsage
+	files    []map[string]bool // blobs each file uses
+	users    map[string]int    // files using each blob
+	size     map[string]int64
+	expanded map[string]map[string]bool // blobs each fragment references
+	total    int64                      // bytes of the blobs in use
+}
+
+func newBlobSizes(dir string, keys *Keyring, files int) *blobSizes {
+	s := &blobSizes{
+		usage:    newBlobUsage(dir, keys, nil, nil),
+		files:    make([]map[string]bool, files),
+		users:    make(map[string]int),
+		size:     make(map[string]int64),
+		expanded: make(map[string]map[string]bool),
+	}
+	for i := range s.files {
+		s.files[i] = make(map[string]bool)
+	}
+	return s
+}
+
+// add counts the blobs a line of a file uses. Encrypted lines keys cannot
+// open count for none.
+func (s *blobSizes) add(file int, line []byte) {
+	_, refs, err := lineBlobs(line, s.usage.keys)
+	if err != nil {
+		return
+	}
+	for _, sum := range refs {
+		if s.files[file][sum] {
+			continue
+		}
+		refs, ok := s.expanded[sum]
+		if !ok {
+			refs = map[string]bool{sum: true}
+			s.usage.expand(sum, refs)
+			s.expanded[sum] = refs
+		}
+		for ref := range refs {
+			s.use(file, ref)
+		}
+	}
+}
+
+func (s *blobSizes) use(file int, sum string) {
+	if s.files[file][sum] {
+		return
+	}
+	size, ok := s.size[sum]
+	if !ok {
+		if info, err := os.Stat(s.usage.blobs.Path(sum)); err == nil {
+			size = info.Size()
+		}
+		s.size[sum] = size
+	}
+	if size == 0 {
+		return
+	}
+	s.files[file][sum] = true
+	if s.users[sum]++; s.users[sum] == 1 {
+		s.total += size
+	}
+}
+
+// release drops a file's use of its blobs and returns the bytes of those no
+// other file uses
+func (s *blobSizes) release(file int) int64 {
+	var freed int64
+	for sum := range s.files[file] {
+		if s.users[sum]--; s.users[sum] == 0 {
+			freed += s.size[sum]
+		}
+	}
+	s.total -= freed
+	return freed
+}
+
+// eachLine calls fn with every non-empty line of a recordings file, without
+// the newline
+func eachLine(path string, fn func([]byte) error) error {
+	f, err := OpenRecordings(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			line = line[:len(line)-1]
+		}
+		if len(line) > 0 {
+			if fnErr := fn(line); fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Prune applies a retention policy to the recordings with the writer
+// paused, then updates the index and grouping indexes to match
+func (r *Recorder) Prune(policy RetentionPolicy, dryRun bool) (*PruneResult, error) {
+	if !r.enabled {
+		return nil, fmt.Errorf("recording is disabled")
+	}
+	if dryRun {
+		return Prune(r.path, r.keys, policy, time.Now(), true)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The active file may be rewritten, so the writer reopens it afterwards
+	if err := r.out.close(); err != nil {
+		return nil, err
+	}
+
+	result, err := Prune(r.path, r.keys, policy, time.Now(), false)
+	if result != nil && len(result.Files) > 0 {
+		if err := RebuildPrunedAudit(r.path, result, r.out.signer); err != nil {
+			slog.Error("failed to rebuild audit logs after pruning", "error", err)
+		}
+		if err := r.index.ReindexFiles(result.FileNames()); err != nil {
+			slog.Error("failed to update index after pruning", "error", err)
+		}
+		if r.groupManager != nil {
+			if err := r.groupManager.OnRecordingsRemoved(result.IDs); err != nil {
+				slog.Error("failed to update grouping indexes after pruning", "error", err)
+			}
+		}
+	}
+	return result, err
+}
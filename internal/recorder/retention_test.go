@@ -0,0 +1,221 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pruneNow = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// writeDay writes recordings to the recordings file for a day
+func writeDay(t *testing.T, dir, day string, recs ...Recording) {
+	t.Helper()
+	var lines []string
+	for _, rec := range recs {
+		data, err := json.Marshal(rec)
+		require.NoError(t, err)
+		lines = append(lines, string(data))
+	}
+	path := filepath.Join(dir, "recordings-"+day+".jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644))
+}
+
+func aged(id, provider string, days int, status int) Recording {
+	return Recording{
+		ID:        id,
+		Provider:  provider,
+		Timestamp: pruneNow.Add(-time.Duration(days)*24*time.Hour - time.Hour),
+		Response:  ResponseData{Status: status},
+	}
+}
+
+func TestPrune(t *testing.T) {
+	const day = 24 * time.Hour
+
+	tests := []struct {
+		name    string
+		policy  RetentionPolicy
+		removed []string
+	}{
+		{
+			name:    "max age",
+			policy:  RetentionPolicy{MaxAge: 30 * day},
+			removed: []string{"old-claude", "old-error", "old-openai"},
+		},
+		{
+			name:    "errors kept longer",
+			policy:  RetentionPolicy{MaxAge: 30 * day, ErrorMaxAge: 90 * day},
+			removed: []string{"old-claude", "old-openai"},
+		},
+		{
+			name:    "provider override",
+			policy:  RetentionPolicy{MaxAge: 30 * day, ProviderMaxAge: map[string]time.Duration{"openai": 5 * day, "claude": 0}},
+			removed: []string{"mid-openai", "old-openai"},
+		},
+		{
+			name:    "max size keeps the newest file",
+			policy:  RetentionPolicy{MaxTotalSize: 1},
+			removed: []string{"mid-openai", "old-claude", "old-error", "old-openai"},
+		},
+		{
+			name:   "disabled",
+			policy: RetentionPolicy{ErrorMaxAge: day},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeDay(t, dir, "2025-01-01", aged("old-claude", "claude", 59, 200), aged("old-error", "claude", 59, 500), aged("old-openai", "openai", 59, 200))
+			writeDay(t, dir, "2025-02-20", aged("mid-openai", "openai", 9, 200))
+			writeDay(t, dir, "2025-03-01", aged("new-claude", "claude", 0, 200))
+
+			preview, err := Prune(dir, nil, tt.policy, pruneNow, true)
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.removed), preview.Recordings)
+			assert.Empty(t, preview.IDs)
+
+			result, err := Prune(dir, nil, tt.policy, pruneNow, false)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.removed, result.IDs)
+			assert.Equal(t, preview.Files, result.Files)
+
+			// What is left on disk matches the result
+			idx := NewIndex(dir)
+			require.NoError(t, idx.Rebuild())
+			assert.Equal(t, 5-len(tt.removed), idx.Size())
+			for _, id := range tt.removed {
+				_, found := idx.Get(id)
+				assert.False(t, found, id)
+			}
+		})
+	}
+}
+
+func TestPrune_Archive(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(t.TempDir(), "archive")
+	writeDay(t, dir, "2025-01-01", aged("old", "claude", 59, 200), aged("new", "claude", 0, 200))
+
+	result, err := Prune(dir, nil, RetentionPolicy{MaxAge: 30 * 24 * time.Hour, ArchiveDir: archive}, pruneNow, false)
+	require.NoError(t, err)
+	require.Len(t, result.Files, 1)
+	assert.False(t, result.Files[0].Deleted)
+
+	archived, err := os.ReadFile(filepath.Join(archive, "recordings-2025-01-01.jsonl"))
+	require.NoError(t, err)
+	assert.Contains(t, string(archived), `"id":"old"`)
+	assert.NotContains(t, string(archived), `"id":"new"`)
+}
+
+func TestRecorder_PruneUpdatesIndex(t *testing.T) {
+	dir := t.TempDir()
+	r := New(true, dir)
+	groups := &fakeGroups{}
+	r.SetGroupManager(groups)
+
+	// Recordings written by the recorder go to today's file, next to an old one
+	writeDay(t, dir, "2020-01-01", Recording{ID: "ancient", Timestamp: time.Now().AddDate(-5, 0, 0)})
+	require.NoError(t, r.GetIndex().Rebuild())
+	for i := 0; i < 3; i++ {
+		r.Record(Recording{ID: fmt.Sprintf("fresh-%d", i), Timestamp: time.Now()})
+	}
+	require.Eventually(t, func() bool { return r.GetIndex().Size() == 4 }, time.Second, time.Millisecond)
+
+	result, err := r.Prune(RetentionPolicy{MaxAge: 24 * time.Hour}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ancient"}, result.IDs)
+	assert.Equal(t, []string{"ancient"}, groups.removed)
+
+	// Writing continues after the prune and the index stays correct
+	r.Record(Recording{ID: "fresh-3", Timestamp: time.Now()})
+	require.NoError(t, r.Close())
+	idx := r.GetIndex()
+	assert.Equal(t, 4, idx.Size())
+	_, found := idx.Get("ancient")
+	assert.False(t, found)
+	rec, err := idx.ReadRecording("fresh-3")
+	require.NoError(t, err)
+	assert.Equal(t, "fresh-3", rec.ID)
+}
+
+type fakeGroups struct {
+	removed []string
+}
+
+func (g *fakeGroups) OnRecordingWrite(*Recording) error { return nil }
+
+func (g *fakeGroups) OnRecordingsRemoved(ids []string) error {
+	g.removed = append(g.removed, ids...)
+	return nil
+}
+
+func (g *fakeGroups) Close() error { return nil }
+
+// writeTurns records agent turns sharing their system prompt and tools, each
+// with its own message, and returns the recordings directory
+func writeTurns(t *testing.T, days ...int) string {
+	t.Helper()
+	dir := t.TempDir()
+	r := NewWithOptions(true, dir, Options{Fsync: FsyncAlways})
+	for _, days := range days {
+		id := fmt.Sprintf("turn-%d", days)
+		rec := agentTurn([]any{map[string]any{"role": "user", "content": strings.Repeat(id, 500)}})
+		rec.ID = id
+		rec.Timestamp = pruneNow.Add(-time.Duration(days) * 24 * time.Hour)
+		r.Record(*rec)
+	}
+	require.NoError(t, r.Close())
+	return dir
+}
+
+func TestPrune_RemovesUnusedBlobs(t *testing.T) {
+	dir := writeTurns(t, 59, 0)
+	require.Equal(t, 4, blobCount(t, dir))
+
+	preview, err := Prune(dir, nil, RetentionPolicy{MaxAge: 30 * 24 * time.Hour}, pruneNow, true)
+	require.NoError(t, err)
+	assert.Zero(t, preview.Blobs)
+	assert.Equal(t, 4, blobCount(t, dir))
+
+	// Only the pruned turn's own message goes
+	result, err := Prune(dir, nil, RetentionPolicy{MaxAge: 30 * 24 * time.Hour}, pruneNow, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"turn-59"}, result.IDs)
+	assert.Equal(t, 1, result.Blobs)
+	assert.Equal(t, 3, blobCount(t, dir))
+
+	// Archived recordings keep theirs
+	dir = writeTurns(t, 59, 0)
+	result, err = Prune(dir, nil, RetentionPolicy{MaxAge: 30 * 24 * time.Hour, ArchiveDir: filepath.Join(t.TempDir(), "archive")}, pruneNow, false)
+	require.NoError(t, err)
+	assert.Zero(t, result.Blobs)
+	assert.Equal(t, 4, blobCount(t, dir))
+}
+
+func TestPrune_MaxSizeCountsBlobs(t *testing.T) {
+	dir := writeTurns(t, 2, 0)
+	files, err := RecordingFiles(dir)
+	require.NoError(t, err)
+	var lines int64
+	for _, file := range files {
+		info, err := os.Stat(file)
+		require.NoError(t, err)
+		lines += info.Size()
+	}
+
+	// The lines fit, but not with the blobs they use
+	result, err := Prune(dir, nil, RetentionPolicy{MaxTotalSize: lines + 100}, pruneNow, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"turn-2"}, result.IDs)
+	assert.Equal(t, "size", result.Files[0].Reason)
+	assert.Equal(t, 1, result.Blobs)
+}
@@ -0,0 +1,133 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// RewriteFile passes every recording in a recordings file through fn and replaces
+// the file with the result. Numbers in bodies are kept exactly as recorded.
+// Lines that cannot be parsed are kept unchanged,
+// as are recordings from a newer schema version, whose fields this build
+// would drop.
+// Encrypted recordings are opened with keys for fn and sealed again; without
+// their key they are kept unchanged too.
+// The new file is written next to the old one and renamed over it, so readers
+// never see a partial file. The index must be rebuilt afterwards since
+// offsets change.
+func RewriteFile(path string, keys *Keyring, fn func(*Recording) error) error {
+	return rewriteLines(path, func(line []byte) ([]byte, error) {
+		var rec Recording
+		if err := DecodeRecording(line, &rec); err != nil {
+			slog.Warn("Keeping unparseable recording line", "file", path, "error", err)
+			return line, nil
+		}
+		if rec.SchemaVersion > SchemaVersion {
+			slog.Warn("Keeping recording from a newer schema version", "file", path, "id", rec.ID, "schema_version", rec.SchemaVersion)
+			return line, nil
+		}
+		sealed := rec.Sealed != nil
+		if err := keys.Open(&rec); err != nil {
+			slog.Warn("Keeping encrypted recording", "file", path, "error", err)
+			return line, nil
+		}
+
+		if err := fn(&rec); err != nil {
+			return nil, fmt.Errorf("failed to rewrite recording %s: %w", rec.ID, err)
+		}
+		if sealed {
+			if err := keys.Seal(&rec); err != nil {
+				return nil, err
+			}
+		}
+		out, err := json.Marshal(rec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal recording %s: %w", rec.ID, err)
+		}
+		return out, nil
+	})
+}
+
+// RekeyFile encrypts every recording in a recordings file with the keyring's
+// active key, sealing plain recordings and rewrapping the data keys of ones
+// sealed with another key, and returns how many changed. The file is only
+// rewritten if something changed; the index must be rebuilt afterwards.
+func RekeyFile(path string, keys *Keyring) (int, error) {
+	changed := 0
+	err := eachLine(path, func(line []byte) error {
+		var rec Recording
+		if err := DecodeRecording(line, &rec); err == nil && (rec.Sealed == nil || rec.Sealed.KeyID != keys.ActiveID() || plainIdentity(&rec)) {
+			changed++
+		}
+		return nil
+	})
+	if err != nil || changed == 0 {
+		return 0, err
+	}
+
+	err = rewriteLines(path, func(line []byte) ([]byte, error) {
+		var rec Recording
+		if err := DecodeRecording(line, &rec); err != nil {
+			slog.Warn("Keeping unparseable recording line", "file", path, "error", err)
+			return line, nil
+		}
+		if ok, err := keys.Rekey(&rec); err != nil || !ok {
+			return line, err
+		}
+		return json.Marshal(rec)
+	})
+	return changed, err
+}
+
+// rewriteLines passes every line of a recordings file through fn and
+// replaces the file with the result. Lines fn returns as nil are dropped.
+// Lines are read without a size limit, like eachLine, so an oversized line
+// does not stop the rewrite.
+func rewriteLines(path string, fn func([]byte) ([]byte, error)) error {
+	// Compressed files stay compressed
+	tmpPath := path + ".tmp"
+	out, err := createRecordings(tmpPath, IsCompressed(path))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	done := false
+	defer func() {
+		if !done {
+			out.Abort()
+		}
+	}()
+
+	// Errors from fn and the output are returned as they are
+	var stop error
+	err = eachLine(path, func(line []byte) error {
+		if line, stop = fn(line); stop != nil {
+			return stop
+		}
+		if line == nil {
+			return nil
+		}
+		if err := out.WriteLine(line); err != nil {
+			stop = fmt.Errorf("failed to write recording: %w", err)
+		}
+		return stop
+	})
+	if stop != nil {
+		return stop
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	done = true
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
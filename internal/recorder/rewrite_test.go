@@ -0,0 +1,72 @@
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recordings-2025-01-01.jsonl")
+	content := `{"id":"20250101-a","provider":"claude"}
+not json
+{"id":"20250101-b","provider":"openai"}
+`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	var seen []string
+	err := RewriteFile(path, nil, func(rec *Recording) error {
+		seen = append(seen, rec.ID)
+		rec.Project = "search"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"20250101-a", "20250101-b"}, seen)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], `"project":"search"`)
+	assert.Equal(t, "not json", lines[1])
+	assert.Contains(t, lines[2], `"id":"20250101-b"`)
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestRewriteFile_KeepsLargeIntegers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recordings-2025-01-01.jsonl")
+	// 2^53 + 1 cannot be represented as a float64
+	content := `{"id":"20250101-a","request":{"body":{"seed":9007199254740993,"temperature":0.7}}}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	require.NoError(t, RewriteFile(path, nil, func(rec *Recording) error {
+		rec.Project = "search"
+		return nil
+	}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"seed":9007199254740993`)
+	assert.Contains(t, string(data), `"temperature":0.7`)
+}
+
+func TestRewriteFile_OversizedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recordings-2025-01-01.jsonl")
+	big := `{"id":"20250101-a","error":"` + strings.Repeat("x", MaxLineSize) + `"}`
+	require.NoError(t, os.WriteFile(path, []byte(big+"\n"+`{"id":"20250101-b"}`+"\n"), 0644))
+
+	var seen []string
+	require.NoError(t, RewriteFile(path, nil, func(rec *Recording) error {
+		seen = append(seen, rec.ID)
+		return nil
+	}))
+	assert.Equal(t, []string{"20250101-a", "20250101-b"}, seen)
+}
@@ -0,0 +1,61 @@
+package recorder
+
+import (
+	"fmt"
+	"time"
+)
+
+// RotationPeriod decides how often the recorder starts a new file
+type RotationPeriod string
+
+const (
+	// RotateDaily writes recordings-YYYY-MM-DD.jsonl
+	RotateDaily RotationPeriod = "daily"
+	// RotateHourly writes recordings-YYYY-MM-DD-HH.jsonl
+	RotateHourly RotationPeriod = "hourly"
+)
+
+// Rotation decides which file a recording is written to. Files are named
+// after the period the recording's timestamp falls in, in Location, and a
+// period's file is continued as recordings-YYYY-MM-DD.1.jsonl and so on
+// once it reaches MaxSize.
+type Rotation struct {
+	Period   RotationPeriod
+	MaxSize  int64          // bytes per file, 0 for no limit
+	Location *time.Location // defaults to UTC
+}
+
+// ParseRotationPeriod parses a rotation period, "" meaning daily
+func ParseRotationPeriod(s string) (RotationPeriod, error) {
+	switch RotationPeriod(s) {
+	case RotateDaily, "":
+		return RotateDaily, nil
+	case RotateHourly:
+		return RotateHourly, nil
+	default:
+		return "", fmt.Errorf("unknown rotation %q, expected daily or hourly", s)
+	}
+}
+
+func (rot Rotation) location() *time.Location {
+	if rot.Location == nil {
+		return time.UTC
+	}
+	return rot.Location
+}
+
+// period returns the period a timestamp falls in, as it appears in file
+// names
+func (rot Rotation) period(t time.Time) string {
+	t = t.In(rot.location())
+	if rot.Period == RotateHourly {
+		return t.Format("2006-01-02-15")
+	}
+	return t.Format("2006-01-02")
+}
+
+// idPrefix returns the date prefix for recording IDs, which names the day of
+// the file the recording is written to
+func (rot Rotation) idPrefix(t time.Time) string {
+	return t.In(rot.location()).Format("20060102")
+}
@@ -0,0 +1,130 @@
+package recorder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_Rotation(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	// Just before midnight UTC, and after midnight in Tokyo
+	late := time.Date(2025, 1, 1, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		rotation Rotation
+		times    []time.Time
+		files    []string
+	}{
+		{
+			name:     "daily in UTC",
+			rotation: Rotation{},
+			times:    []time.Time{late, late.Add(2 * time.Second)},
+			files:    []string{"recordings-2025-01-01.jsonl", "recordings-2025-01-02.jsonl"},
+		},
+		{
+			name:     "daily in another timezone",
+			rotation: Rotation{Location: tokyo},
+			times:    []time.Time{late.Add(-10 * time.Hour), late},
+			files:    []string{"recordings-2025-01-01.jsonl", "recordings-2025-01-02.jsonl"},
+		},
+		{
+			name:     "hourly",
+			rotation: Rotation{Period: RotateHourly},
+			times:    []time.Time{late.Add(-time.Hour), late, late.Add(-time.Minute)},
+			files:    []string{"recordings-2025-01-01-22.jsonl", "recordings-2025-01-01-23.jsonl"},
+		},
+		{
+			name:     "by size",
+			rotation: Rotation{MaxSize: 700}, // two recordings per file
+			times:    []time.Time{late, late, late, late, late},
+			files:    []string{"recordings-2025-01-01.jsonl", "recordings-2025-01-01.1.jsonl", "recordings-2025-01-01.2.jsonl"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			r := NewWithOptions(true, dir, Options{Rotation: tt.rotation})
+
+			// Written one at a time, the way a slow request finishes after
+			// the period it started in
+			for i, ts := range tt.times {
+				r.Record(Recording{ID: fmt.Sprintf("%s-%d", tt.rotation.idPrefix(ts), i), Timestamp: ts})
+				require.Eventually(t, func() bool { return r.GetIndex().Size() == i+1 }, time.Second, time.Millisecond)
+			}
+			require.NoError(t, r.Close())
+
+			files, err := RecordingFiles(dir)
+			require.NoError(t, err)
+			var names []string
+			for _, f := range files {
+				names = append(names, filepath.Base(f))
+			}
+			assert.Equal(t, tt.files, names)
+
+			// Every recording is in the file for its own period, whose day
+			// matches the ID
+			for i, ts := range tt.times {
+				id := fmt.Sprintf("%s-%d", tt.rotation.idPrefix(ts), i)
+				entry, found := r.GetIndex().Get(id)
+				require.True(t, found, id)
+				file, ok := ParseRecordingFile(entry.Filename)
+				require.True(t, ok)
+				assert.Equal(t, tt.rotation.period(ts), file.period())
+				assert.Equal(t, id[:8], strings.ReplaceAll(file.Date, "-", ""))
+			}
+			if tt.rotation.MaxSize > 0 {
+				for _, f := range files {
+					info, err := os.Stat(f)
+					require.NoError(t, err)
+					assert.LessOrEqual(t, info.Size(), tt.rotation.MaxSize)
+				}
+			}
+		})
+	}
+}
+
+func TestRecorder_NewRecordingIDMatchesFile(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	r := NewWithOptions(false, t.TempDir(), Options{Rotation: Rotation{Location: tokyo}})
+
+	rec := r.NewRecording("claude", "POST", "/v1/messages", "", time.Now())
+	assert.Equal(t, rec.Timestamp.In(tokyo).Format("20060102"), rec.ID[:8])
+
+	// The package function uses UTC
+	rec = NewRecording("claude", "POST", "/v1/messages", "", time.Now())
+	assert.Equal(t, rec.Timestamp.UTC().Format("20060102"), rec.ID[:8])
+}
+
+func TestFileWriter_ContinuesLastFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+	write("recordings-2025-01-01.jsonl", "{}\n")
+	write("recordings-2025-01-01.1.jsonl", "{}\n")
+	write("recordings-2025-01-02.jsonl.zst", "")
+	write("recordings-2025-01-01-05.3.jsonl", "{}\n")
+
+	fw := newFileWriter(dir, FsyncNever, 0)
+	defer fw.close()
+
+	name, offset, err := fw.append("2025-01-01", []byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, "recordings-2025-01-01.1.jsonl", name)
+	assert.Equal(t, int64(3), offset)
+
+	// A compressed file is never appended to
+	name, offset, err = fw.append("2025-01-02", []byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, "recordings-2025-01-02.1.jsonl", name)
+	assert.Zero(t, offset)
+}
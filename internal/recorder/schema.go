@@ -0,0 +1,66 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the version of the recording format written by this
+// build. Recordings without a schema_version predate versioning and are
+// version 0.
+const SchemaVersion = 1
+
+// upgrades brings a recording from the version at its index to the next one.
+// Adding a field that needs old recordings changed means bumping
+// SchemaVersion and appending its upgrade here.
+var upgrades = []func(*Recording) error{
+	// 0 → 1: response bodies stored as base64 of the compressed bytes
+	func(rec *Recording) error {
+		_, err := DecodeLegacyBody(rec)
+		return err
+	},
+}
+
+func init() {
+	if len(upgrades) != SchemaVersion {
+		panic(fmt.Sprintf("recorder: %d schema upgrades for schema version %d", len(upgrades), SchemaVersion))
+	}
+}
+
+// Upgrade brings a recording written by an older version to the current
+// schema in memory and reports whether it changed. Sealed recordings must be
+// opened first. Recordings from newer versions are left as they are. If an
+// upgrade fails the recording stays at the last version it reached.
+func Upgrade(rec *Recording) (bool, error) {
+	if rec.Sealed != nil {
+		return false, nil
+	}
+	if rec.SchemaVersion < 0 {
+		return false, fmt.Errorf("recording %s has invalid schema version %d", rec.ID, rec.SchemaVersion)
+	}
+	changed := false
+	for rec.SchemaVersion < SchemaVersion {
+		if err := upgrades[rec.SchemaVersion](rec); err != nil {
+			return changed, fmt.Errorf("failed to upgrade recording %s to schema version %d: %w", rec.ID, rec.SchemaVersion+1, err)
+		}
+		rec.SchemaVersion++
+		changed = true
+	}
+	return changed, nil
+}
+
+// OutdatedRecordings counts the recordings in a file that are below the
+// current schema version, so files already up to date need not be rewritten
+func OutdatedRecordings(path string) (int, error) {
+	outdated := 0
+	err := eachLine(path, func(line []byte) error {
+		var partial struct {
+			SchemaVersion int `json:"schema_version"`
+		}
+		if err := json.Unmarshal(line, &partial); err == nil && partial.SchemaVersion < SchemaVersion {
+			outdated++
+		}
+		return nil
+	})
+	return outdated, err
+}
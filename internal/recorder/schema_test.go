@@ -0,0 +1,107 @@
+package recorder
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// legacyLine is a recording from before schema versioning, with its
+// response body stored as base64 of the gzipped bytes
+func legacyLine(t *testing.T, id string) string {
+	t.Helper()
+	body := LegacyEncodedPrefix + base64.StdEncoding.EncodeToString(encode(t, "gzip", []byte(`{"id":"msg_1"}`)))
+	return fmt.Sprintf(`{"id":%q,"provider":"claude","response":{"status":200,"headers":{"Content-Encoding":["gzip"]},"body":%q}}`, id, body)
+}
+
+func TestUpgrade(t *testing.T) {
+	rec := &Recording{Response: ResponseData{
+		Headers: map[string][]string{"Content-Encoding": {"gzip"}},
+		Body:    LegacyEncodedPrefix + base64.StdEncoding.EncodeToString(encode(t, "gzip", []byte(`{"id":"msg_1"}`))),
+	}}
+
+	changed, err := Upgrade(rec)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, SchemaVersion, rec.SchemaVersion)
+	assert.Equal(t, map[string]any{"id": "msg_1"}, rec.Response.Body)
+
+	// Current and newer recordings are left alone
+	changed, err = Upgrade(rec)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	newer := &Recording{SchemaVersion: SchemaVersion + 1, Response: ResponseData{Body: LegacyEncodedPrefix + "AAAA"}}
+	changed, err = Upgrade(newer)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, SchemaVersion+1, newer.SchemaVersion)
+
+	// A failed upgrade stays at the last version reached
+	broken := &Recording{ID: "20250101-broken", Response: ResponseData{Body: LegacyEncodedPrefix + "not base64"}}
+	_, err = Upgrade(broken)
+	assert.ErrorContains(t, err, "20250101-broken")
+	assert.Zero(t, broken.SchemaVersion)
+
+	_, err = Upgrade(&Recording{SchemaVersion: -1})
+	assert.Error(t, err)
+}
+
+func TestSchema_RecordingsWritten(t *testing.T) {
+	dir := t.TempDir()
+	r := NewWithOptions(true, dir, Options{Fsync: FsyncAlways})
+	r.Record(Recording{ID: "20250101-a", Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)})
+	require.NoError(t, r.Close())
+
+	lines := readLines(t, filepath.Join(dir, "recordings-2025-01-01.jsonl"))
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], fmt.Sprintf(`"schema_version":%d`, SchemaVersion))
+}
+
+func TestSchema_ReadAndMigrate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "recordings-2025-01-01.jsonl")
+	newer := fmt.Sprintf(`{"schema_version":%d,"id":"20250101-c","provider":"claude","outcome":"ok"}`, SchemaVersion+1)
+	writeLines(t, path, []string{
+		legacyLine(t, "20250101-a"),
+		fmt.Sprintf(`{"schema_version":%d,"id":"20250101-b","provider":"openai"}`, SchemaVersion),
+		newer,
+	})
+
+	outdated, err := OutdatedRecordings(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, outdated)
+
+	// Readers upgrade in memory
+	idx := NewIndex(dir)
+	defer idx.Close()
+	require.NoError(t, idx.Rebuild())
+	rec, err := idx.ReadRecording("20250101-a")
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion, rec.SchemaVersion)
+	assert.Equal(t, map[string]any{"id": "msg_1"}, rec.Response.Body)
+
+	// Rewriting stores the upgrade and keeps newer recordings byte for byte
+	require.NoError(t, RewriteFile(path, nil, func(rec *Recording) error {
+		_, err := Upgrade(rec)
+		return err
+	}))
+	lines := readLines(t, path)
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], fmt.Sprintf(`"schema_version":%d`, SchemaVersion))
+	assert.Contains(t, lines[0], `"body":{"id":"msg_1"}`)
+	assert.Equal(t, newer, lines[2])
+
+	outdated, err = OutdatedRecordings(path)
+	require.NoError(t, err)
+	assert.Zero(t, outdated)
+
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
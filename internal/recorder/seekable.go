@@ -0,0 +1,188 @@
+package recorder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressed recordings use the zstd seekable format: lines are grouped into
+// independent zstd frames, never splitting a line, followed by a skippable
+// frame holding the size of every frame. Any zstd tool can decompress the
+// file, and a line can be read by decompressing only its frame, so index
+// offsets into the uncompressed stream keep working.
+const (
+	seekableFrameSize = 1 << 20 // uncompressed bytes per frame
+	skippableMagic    = 0x184D2A5E
+	seekableMagic     = 0x8F92EAB1
+	seekFooterSize    = 9
+)
+
+// zstdDecoder decodes whole frames; DecodeAll is safe for concurrent use
+var zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+
+type seekFrame struct {
+	compressed   uint32
+	decompressed uint32
+}
+
+// seekableWriter compresses lines into seekable frames
+type seekableWriter struct {
+	w      io.Writer
+	enc    *zstd.Encoder
+	buf    []byte
+	frames []seekFrame
+}
+
+func newSeekableWriter(w io.Writer) (*seekableWriter, error) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return nil, err
+	}
+	return &seekableWriter{w: w, enc: enc}, nil
+}
+
+// WriteLine adds a line, starting a new frame once the current one is full
+func (sw *seekableWriter) WriteLine(line []byte) error {
+	sw.buf = append(sw.buf, line...)
+	sw.buf = append(sw.buf, '\n')
+	if len(sw.buf) >= seekableFrameSize {
+		return sw.flush()
+	}
+	return nil
+}
+
+func (sw *seekableWriter) flush() error {
+	if len(sw.buf) == 0 {
+		return nil
+	}
+	frame := sw.enc.EncodeAll(sw.buf, nil)
+	if _, err := sw.w.Write(frame); err != nil {
+		return err
+	}
+	sw.frames = append(sw.frames, seekFrame{compressed: uint32(len(frame)), decompressed: uint32(len(sw.buf))})
+	sw.buf = sw.buf[:0]
+	return nil
+}
+
+// Close writes the last frame and the seek table
+func (sw *seekableWriter) Close() error {
+	defer sw.enc.Close()
+	if err := sw.flush(); err != nil {
+		return err
+	}
+
+	size := len(sw.frames)*8 + seekFooterSize
+	table := make([]byte, 8, 8+size)
+	binary.LittleEndian.PutUint32(table[0:], skippableMagic)
+	binary.LittleEndian.PutUint32(table[4:], uint32(size))
+	for _, f := range sw.frames {
+		table = binary.LittleEndian.AppendUint32(table, f.compressed)
+		table = binary.LittleEndian.AppendUint32(table, f.decompressed)
+	}
+	table = binary.LittleEndian.AppendUint32(table, uint32(len(sw.frames)))
+	table = append(table, 0) // descriptor: no checksums
+	table = binary.LittleEndian.AppendUint32(table, seekableMagic)
+
+	_, err := sw.w.Write(table)
+	return err
+}
+
+// seekTable locates frames in a seekable file
+type seekTable struct {
+	frames   []seekFrame
+	starts   []int64 // compressed offset of each frame
+	logical  []int64 // uncompressed offset of each frame
+	dataSize int64   // compressed bytes before the seek table
+}
+
+func readSeekTable(f *os.File) (*seekTable, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < 8+seekFooterSize {
+		return nil, errors.New("not a seekable zstd file")
+	}
+
+	footer := make([]byte, seekFooterSize)
+	if _, err := f.ReadAt(footer, info.Size()-seekFooterSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekableMagic {
+		return nil, errors.New("not a seekable zstd file")
+	}
+	if footer[4]&0x80 != 0 {
+		return nil, errors.New("seekable zstd checksums are not supported")
+	}
+
+	count := int64(binary.LittleEndian.Uint32(footer[0:]))
+	tableSize := 8 + count*8 + seekFooterSize
+	if tableSize > info.Size() {
+		return nil, errors.New("corrupt seek table")
+	}
+	entries := make([]byte, count*8)
+	if _, err := f.ReadAt(entries, info.Size()-seekFooterSize-count*8); err != nil {
+		return nil, err
+	}
+
+	t := &seekTable{dataSize: info.Size() - tableSize}
+	var start, logical int64
+	for i := int64(0); i < count; i++ {
+		frame := seekFrame{
+			compressed:   binary.LittleEndian.Uint32(entries[i*8:]),
+			decompressed: binary.LittleEndian.Uint32(entries[i*8+4:]),
+		}
+		t.frames = append(t.frames, frame)
+		t.starts = append(t.starts, start)
+		t.logical = append(t.logical, logical)
+		start += int64(frame.compressed)
+		logical += int64(frame.decompressed)
+	}
+	if start != t.dataSize {
+		return nil, errors.New("corrupt seek table")
+	}
+	return t, nil
+}
+
+// readCompressedLine returns the line at an uncompressed offset
+func readCompressedLine(path string, offset int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	table, err := readSeekTable(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	i := sort.Search(len(table.frames), func(i int) bool {
+		return table.logical[i]+int64(table.frames[i].decompressed) > offset
+	})
+	if i == len(table.frames) || offset < 0 {
+		return nil, fmt.Errorf("offset %d is past the end of %s", offset, path)
+	}
+
+	compressed := make([]byte, table.frames[i].compressed)
+	if _, err := f.ReadAt(compressed, table.starts[i]); err != nil {
+		return nil, err
+	}
+	frame, err := zstdDecoder.DecodeAll(compressed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+
+	line := frame[offset-table.logical[i]:]
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	return line, nil
+}
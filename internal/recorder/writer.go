@@ -0,0 +1,254 @@
+package recorder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FsyncPolicy decides when written recordings are flushed to stable storage
+type FsyncPolicy string
+
+const (
+	// FsyncAlways syncs after every group commit
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncInterval syncs at most once per interval
+	FsyncInterval FsyncPolicy = "interval"
+	// FsyncNever leaves syncing to the operating system
+	FsyncNever FsyncPolicy = "never"
+)
+
+// DefaultFsyncInterval is how often FsyncInterval syncs
+const DefaultFsyncInterval = time.Second
+
+// maxBatch caps how many queued recordings are written in one group commit
+const maxBatch = 256
+
+// fileWriter keeps the active recordings file open with a buffered writer
+// and tracks the offset of the next line for the index. It is only used by
+// the recorder's worker.
+type fileWriter struct {
+	dir     string
+	policy  FsyncPolicy
+	maxSize int64 // bytes per file, 0 for no limit
+
+	audit  bool         // chain lines in the file's audit log
+	signer *AuditSigner // signs audit checkpoints, nil to leave them out
+	log    *auditLog
+
+	period    string
+	seq       int
+	name      string
+	file      *os.File
+	buf       *bufio.Writer
+	offset    int64
+	committed int64 // size of the file at the last commit
+	dirty     bool  // written since the last sync
+}
+
+func newFileWriter(dir string, policy FsyncPolicy, maxSize int64) *fileWriter {
+	return &fileWriter{dir: dir, policy: policy, maxSize: maxSize}
+}
+
+// append buffers one line for a period's file and returns the file's name
+// and the line's offset. The line is not visible to readers until commit.
+func (fw *fileWriter) append(period string, line []byte) (string, int64, error) {
+	if period != fw.period || fw.file == nil {
+		seq, err := fw.lastSeq(period)
+		if err != nil {
+			return "", 0, err
+		}
+		if err := fw.open(period, seq); err != nil {
+			return "", 0, err
+		}
+	}
+	if fw.maxSize > 0 && fw.offset > 0 && fw.offset+int64(len(line))+1 > fw.maxSize {
+		if err := fw.open(period, fw.seq+1); err != nil {
+			return "", 0, err
+		}
+	}
+
+	offset := fw.offset
+	if _, err := fw.buf.Write(line); err != nil {
+		return "", 0, fw.fail(fmt.Errorf("failed to write recording: %w", err))
+	}
+	if err := fw.buf.WriteByte('\n'); err != nil {
+		return "", 0, fw.fail(fmt.Errorf("failed to write recording: %w", err))
+	}
+	fw.offset += int64(len(line)) + 1
+	fw.dirty = true
+	if fw.log != nil {
+		if err := fw.log.add(line); err != nil {
+			return "", 0, fw.fail(err)
+		}
+	}
+	return fw.name, offset, nil
+}
+
+// lastSeq returns the sequence number of the file to continue a period in:
+// the newest one, or the next if the newest has been compressed
+func (fw *fileWriter) lastSeq(period string) (int, error) {
+	files, err := ListRecordingFiles(fw.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list recordings: %w", err)
+	}
+	seq := 0
+	for _, file := range files {
+		if file.period() != period {
+			continue
+		}
+		seq = file.Seq
+		if file.Compressed {
+			seq++
+		}
+	}
+	return seq, nil
+}
+
+// commit writes buffered lines to the file, syncing if the policy says so
+func (fw *fileWriter) commit() error {
+	if fw.file == nil {
+		return nil
+	}
+	if err := fw.buf.Flush(); err != nil {
+		return fw.fail(fmt.Errorf("failed to write recordings: %w", err))
+	}
+	// The audit log follows the recordings, so a crash in between leaves
+	// lines that are not logged rather than entries without lines
+	if fw.log != nil {
+		if err := fw.log.flush(); err != nil {
+			return fw.fail(err)
+		}
+	}
+	fw.committed = fw.offset
+	if fw.policy == FsyncAlways {
+		return fw.sync()
+	}
+	return nil
+}
+
+// sync flushes committed lines to stable storage
+func (fw *fileWriter) sync() error {
+	if fw.file == nil || !fw.dirty {
+		return nil
+	}
+	if err := fw.file.Sync(); err != nil {
+		return fw.fail(fmt.Errorf("failed to sync recordings: %w", err))
+	}
+	if fw.log != nil {
+		if err := fw.log.sync(); err != nil {
+			return fw.fail(err)
+		}
+	}
+	fw.dirty = false
+	return nil
+}
+
+// open switches to a period's file, finishing the previous one
+func (fw *fileWriter) open(period string, seq int) error {
+	if err := fw.close(); err != nil {
+		return err
+	}
+
+	name := recordingsName(period, seq)
+	f, err := os.OpenFile(filepath.Join(fw.dir, name), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	size := info.Size()
+
+	// A line torn by a crash is left as is, but new recordings must start
+	// on a line of their own
+	if size > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, size-1); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		if last[0] != '\n' {
+			if _, err := f.Write([]byte{'\n'}); err != nil {
+				_ = f.Close()
+				return fmt.Errorf("failed to repair file: %w", err)
+			}
+			size++
+		}
+	}
+
+	if fw.audit {
+		if fw.log, err = openAuditLog(f.Name(), fw.signer); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+
+	fw.period = period
+	fw.seq = seq
+	fw.name = name
+	fw.file = f
+	fw.offset = size
+	fw.committed = size
+	if fw.buf == nil {
+		fw.buf = bufio.NewWriterSize(f, 256*1024)
+	} else {
+		fw.buf.Reset(f)
+	}
+	return nil
+}
+
+// close commits and closes the active file
+func (fw *fileWriter) close() error {
+	if fw.file == nil {
+		return nil
+	}
+	if err := fw.buf.Flush(); err != nil {
+		return fw.fail(fmt.Errorf("failed to close recordings file: %w", err))
+	}
+	var err error
+	if fw.policy != FsyncNever {
+		err = fw.sync()
+	}
+	if closeErr := fw.file.Close(); err == nil {
+		err = closeErr
+	}
+	if fw.log != nil {
+		// Signs a final checkpoint for the file
+		if logErr := fw.log.close(); err == nil {
+			err = logErr
+		}
+		fw.log = nil
+	}
+	fw.file = nil
+	fw.period = ""
+	fw.name = ""
+	fw.dirty = false
+	if err != nil {
+		return fmt.Errorf("failed to close recordings file: %w", err)
+	}
+	return nil
+}
+
+// fail drops the active file after an error, so the next write reopens it
+// and takes its offset from the file's real size. Lines written since the
+// last commit are cut off, along with their audit entries, since they were
+// never indexed.
+func (fw *fileWriter) fail(err error) error {
+	_ = fw.file.Truncate(fw.committed)
+	_ = fw.file.Close()
+	if fw.log != nil {
+		_ = fw.log.file.Truncate(fw.log.committed)
+		_ = fw.log.file.Close()
+		fw.log = nil
+	}
+	fw.file = nil
+	fw.period = ""
+	fw.name = ""
+	fw.dirty = false
+	return err
+}
@@ -0,0 +1,139 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWriter_Offsets(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "recordings-2025-01-01.jsonl")
+	require.NoError(t, os.WriteFile(a, []byte("existing\n"), 0644))
+
+	fw := newFileWriter(dir, FsyncAlways, 0)
+	_, first, err := fw.append("2025-01-01", []byte(`{"n":1}`))
+	require.NoError(t, err)
+	_, second, err := fw.append("2025-01-01", []byte(`{"n":22}`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), first)
+	assert.Equal(t, int64(17), second)
+
+	// Nothing is visible before the commit
+	data, err := os.ReadFile(a)
+	require.NoError(t, err)
+	assert.Equal(t, "existing\n", string(data))
+
+	require.NoError(t, fw.commit())
+	data, err = os.ReadFile(a)
+	require.NoError(t, err)
+	assert.Equal(t, `{"n":22}`, string(data[second:second+8]))
+
+	// Switching files finishes the previous one
+	name, offset, err := fw.append("2025-01-02", []byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, "recordings-2025-01-02.jsonl", name)
+	assert.Zero(t, offset)
+	require.NoError(t, fw.close())
+	data, err = os.ReadFile(filepath.Join(dir, name))
+	require.NoError(t, err)
+	assert.Equal(t, "{}\n", string(data))
+}
+
+func TestRecorder_BatchedWritesIndexCorrectly(t *testing.T) {
+	for _, policy := range []FsyncPolicy{FsyncAlways, FsyncInterval, FsyncNever} {
+		t.Run(string(policy), func(t *testing.T) {
+			dir := t.TempDir()
+			r := NewWithOptions(true, dir, Options{QueueSize: 1000, Fsync: policy, FsyncInterval: time.Millisecond})
+
+			const n = 500
+			for i := 0; i < n; i++ {
+				r.Record(Recording{ID: fmt.Sprintf("20250101-%04d", i), Provider: "claude", Request: RequestData{Body: map[string]any{"i": i}}})
+			}
+			require.NoError(t, r.Close())
+			assert.Equal(t, int64(n), r.Stats().Queued)
+
+			idx := r.GetIndex()
+			require.Equal(t, n, idx.Size())
+			for _, i := range []int{0, 1, n / 2, n - 1} {
+				rec, err := idx.ReadRecording(fmt.Sprintf("20250101-%04d", i))
+				require.NoError(t, err)
+				assert.Equal(t, json.Number(fmt.Sprint(i)), rec.Request.Body.(map[string]any)["i"])
+			}
+		})
+	}
+}
+
+func BenchmarkRecorder_Record(b *testing.B) {
+	body := map[string]any{
+		"model":      "claude-sonnet-4",
+		"max_tokens": 1024,
+		"messages":   []any{map[string]any{"role": "user", "content": "Summarise the design document in three bullet points."}},
+	}
+
+	for _, policy := range []FsyncPolicy{FsyncNever, FsyncInterval, FsyncAlways} {
+		b.Run(string(policy), func(b *testing.B) {
+			r := NewWithOptions(true, b.TempDir(), Options{QueueSize: 4096, QueuePolicy: QueueBlock, Fsync: policy})
+			b.ResetTimer()
+
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				r.Record(Recording{ID: fmt.Sprintf("20250101-%d", i), Provider: "claude", Request: RequestData{Body: body}})
+			}
+			if err := r.Close(); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "recordings/s")
+		})
+	}
+}
+
+func TestRecorder_WriteFailureMidBatch(t *testing.T) {
+	dir := t.TempDir()
+	r := NewWithOptions(true, dir, Options{Fsync: FsyncNever, Audit: true})
+	r.SetInlineThreshold(-1)
+	require.NoError(t, r.writeBatch([]Recording{{ID: "20250101-first"}}))
+
+	// Closing the file under the writer makes the buffer fail to flush once
+	// the second large line no longer fits, half way through the batch
+	r.mu.Lock()
+	require.NoError(t, r.out.file.Close())
+	r.mu.Unlock()
+
+	body := strings.Repeat("a", 150*1024)
+	var batch []Recording
+	for i := range 3 {
+		batch = append(batch, Recording{ID: fmt.Sprintf("20250101-big%d", i), Request: RequestData{Body: body}})
+	}
+	err := r.writeBatch(batch)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "spilled 3 recordings")
+	assert.Equal(t, int64(3), r.Stats().Spilled)
+	assert.FileExists(t, filepath.Join(dir, spillFile))
+
+	// Closing drains the spill file through a reopened writer
+	require.NoError(t, r.Close())
+	idx := r.GetIndex()
+	require.Equal(t, 4, idx.Size())
+	for _, rec := range batch {
+		read, err := idx.ReadRecording(rec.ID)
+		require.NoError(t, err)
+		assert.Equal(t, body, read.Request.Body)
+	}
+	assert.Equal(t, 4, countRecordings(t, dir))
+
+	files, err := filepath.Glob(filepath.Join(dir, "recordings-*.jsonl"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	report, err := VerifyAudit(files[0], nil)
+	require.NoError(t, err)
+	assert.Empty(t, report.Problems)
+	assert.Equal(t, 4, report.Entries)
+}
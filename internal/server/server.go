@@ -2,13 +2,17 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/jpoz/mirra/internal/api"
 	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/detect"
 	"github.com/jpoz/mirra/internal/grouping"
 	"github.com/jpoz/mirra/internal/proxy"
 	"github.com/jpoz/mirra/internal/recorder"
@@ -22,19 +26,92 @@ type Server struct {
 	groupManager *grouping.Manager
 	log          *slog.Logger
 	uiManager    *ui.Manager
+	lock         *recorder.DirLock
+	adminToken   string
 }
 
-func New(cfg *config.Config, log *slog.Logger, uiManager *ui.Manager) *Server {
-	rec := recorder.New(cfg.Recording.Enabled, cfg.Recording.Path)
+func New(cfg *config.Config, log *slog.Logger, uiManager *ui.Manager) (*Server, error) {
+	rotation, err := cfg.Recording.RotationPolicy()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := cfg.Recording.Keyring()
+	if err != nil {
+		return nil, err
+	}
+	signer, err := cfg.Recording.AuditSigner()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Recording.ValidateRules(); err != nil {
+		return nil, err
+	}
+
+	// Only one server may write to a recordings directory
+	var lock *recorder.DirLock
+	if cfg.Recording.Enabled {
+		lock, err = recorder.LockWriter(cfg.Recording.Path, recorder.LockOwner{
+			PID:     os.Getpid(),
+			Command: "start",
+			Addr:    fmt.Sprintf("http://localhost:%d", cfg.Port),
+			Started: time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Admin endpoints delete recordings, so proxy clients must not reach
+	// them without a token
+	adminToken := cfg.AdminToken
+	if adminToken == "" && cfg.Recording.Enabled {
+		if adminToken, err = recorder.NewAdminToken(cfg.Recording.Path); err != nil {
+			_ = lock.Unlock()
+			return nil, err
+		}
+	}
+
+	rec := recorder.NewWithOptions(cfg.Recording.Enabled, cfg.Recording.Path, recorder.Options{
+		QueueSize:     cfg.Recording.QueueSize,
+		QueuePolicy:   recorder.QueuePolicy(cfg.Recording.QueuePolicy),
+		Fsync:         recorder.FsyncPolicy(cfg.Recording.Fsync),
+		FsyncInterval: time.Duration(cfg.Recording.FsyncIntervalMs) * time.Millisecond,
+		Rotation:      rotation,
+		Audit:         cfg.Recording.Audit,
+		AuditSigner:   signer,
+	})
+	rec.SetInlineThreshold(cfg.Recording.InlineThreshold)
+	rec.SetDedupeThreshold(cfg.Recording.DedupeThreshold)
+	if keys != nil {
+		rec.SetKeyring(keys)
+		slog.Info("recording encryption enabled", "key", keys.ActiveID())
+	}
+	if signer != nil {
+		slog.Info("audit log signing enabled", "key", signer.KeyID())
+	} else if cfg.Recording.Audit {
+		slog.Warn("audit log enabled without a signing key, checkpoints are not signed")
+	}
 
 	// Initialize grouping manager if recording is enabled
 	var groupMgr *grouping.Manager
 	if cfg.Recording.Enabled {
-		groupMgr = grouping.NewManager(cfg.Recording.Path, true)
+		groupMgr = grouping.NewManager(cfg.Recording.Path, true, keys)
 		rec.SetGroupManager(groupMgr)
 		slog.Info("grouping enabled")
 	}
 
+	if cfg.Recording.Enabled && cfg.Detection.Enabled {
+		scanner, err := detect.NewScanner(cfg.Detection.InjectionPatterns)
+		if err != nil {
+			slog.Error("failed to create detectors, findings disabled", "error", err)
+		} else {
+			rec.SetScanner(scanner)
+		}
+	}
+
+	// Write recordings spilled by a previous run now that the recorder is set up
+	rec.DrainSpill()
+
 	return &Server{
 		cfg:          cfg,
 		recorder:     rec,
@@ -42,17 +119,62 @@ func New(cfg *config.Config, log *slog.Logger, uiManager *ui.Manager) *Server {
 		proxy:        proxy.New(cfg, rec),
 		log:          log,
 		uiManager:    uiManager,
-	}
+		lock:         lock,
+		adminToken:   adminToken,
+	}, nil
 }
 
 func (s *Server) Start(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.cfg.Port),
+		Handler: s.loggingMiddleware(s.routes()),
+	}
+
+	policy := s.cfg.Recording.Retention.Policy()
+	if s.cfg.Recording.Enabled && (policy.Enabled() || s.cfg.Recording.CompressAfter > 0) {
+		go s.maintenanceLoop(ctx, policy)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		slog.Info("𝕄𝕀ℝℝ𝔸 started", "port", s.cfg.Port)
+		errChan <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errChan:
+		s.closeRecorder()
+		return err
+	case <-ctx.Done():
+		slog.Info("shutting down gracefully")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Error("server shutdown error", "error", err)
+		}
+
+		s.closeRecorder()
+
+		slog.Info("shutdown complete")
+		return nil
+	}
+}
+
+// routes registers the API, UI and proxy handlers
+func (s *Server) routes() http.Handler {
 	mux := http.NewServeMux()
 
 	// API handlers
 	apiHandlers := api.NewHandlers(s.cfg, s.log, s.recorder)
 	mux.Handle("GET /api/recordings", http.HandlerFunc(apiHandlers.ListRecordings))
 	mux.Handle("GET /api/recordings/{id}/parse", http.HandlerFunc(apiHandlers.ParseRecording))
+	mux.Handle("GET /api/recordings/{id}/blobs/{ref}", http.HandlerFunc(apiHandlers.GetRecordingBlob))
 	mux.Handle("GET /api/recordings/{id}", http.HandlerFunc(apiHandlers.GetRecording))
+	mux.Handle("DELETE /api/recordings/{id}", s.requireAdmin(apiHandlers.DeleteRecording))
+	mux.Handle("GET /api/findings", http.HandlerFunc(apiHandlers.ListFindings))
+	mux.Handle("POST /api/index/rebuild", s.requireAdmin(apiHandlers.RebuildIndex))
+	mux.Handle("POST /api/prune", s.requireAdmin(apiHandlers.PruneRecordings))
 
 	// Group API handlers
 	if s.groupManager != nil {
@@ -63,6 +185,7 @@ func (s *Server) Start(ctx context.Context) error {
 
 	// Health check endpoint
 	mux.Handle("GET /health", http.HandlerFunc(s.healthHandler))
+	mux.Handle("GET /metrics", http.HandlerFunc(s.metricsHandler))
 
 	// UI source files
 	mux.Handle("GET /src/", s.uiManager.SrcHandler("/src"))
@@ -72,42 +195,65 @@ func (s *Server) Start(ctx context.Context) error {
 
 	// Proxy catch-all (all other requests)
 	mux.HandleFunc("/", s.proxy.Handle)
+	return mux
+}
 
-	// Wrap mux with logging middleware
-	handler := s.loggingMiddleware(mux)
+// requireAdmin rejects requests without the admin token as a bearer token
+func (s *Server) requireAdmin(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mirra admin"`)
+			http.Error(w, "Admin token required", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	})
+}
 
-	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.cfg.Port),
-		Handler: handler,
+// maintenanceLoop applies the retention policy and compresses old day files
+// on startup and then periodically. Pruning goes first so expired recordings
+// are not compressed only to be rewritten.
+func (s *Server) maintenanceLoop(ctx context.Context, policy recorder.RetentionPolicy) {
+	interval := time.Duration(s.cfg.Recording.Retention.IntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
 	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	errChan := make(chan error, 1)
-	go func() {
-		slog.Info("𝕄𝕀ℝℝ𝔸 started", "port", s.cfg.Port)
-		errChan <- srv.ListenAndServe()
-	}()
-
-	select {
-	case err := <-errChan:
-		if closeErr := s.recorder.Close(); closeErr != nil {
-			slog.Error("recorder close error", "error", closeErr)
+	for {
+		if policy.Enabled() {
+			if _, err := s.recorder.Prune(policy, false); err != nil {
+				slog.Error("failed to prune recordings", "error", err)
+			}
 		}
-		return err
-	case <-ctx.Done():
-		slog.Info("shutting down gracefully")
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		if err := srv.Shutdown(shutdownCtx); err != nil {
-			slog.Error("server shutdown error", "error", err)
+		if _, err := s.recorder.CompressOld(s.cfg.Recording.CompressAfter); err != nil {
+			slog.Error("failed to compress recordings", "error", err)
 		}
 
-		if err := s.recorder.Close(); err != nil {
-			slog.Error("recorder close error", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
+	}
+}
 
-		slog.Info("shutdown complete")
-		return nil
+// closeRecorder flushes the recorder and releases the recordings directory
+func (s *Server) closeRecorder() {
+	if err := s.recorder.Close(); err != nil {
+		slog.Error("recorder close error", "error", err)
+	}
+	if s.cfg.AdminToken == "" && s.cfg.Recording.Enabled {
+		if err := recorder.RemoveAdminToken(s.cfg.Recording.Path); err != nil {
+			slog.Error("failed to remove admin token", "error", err)
+		}
+	}
+	if s.lock != nil {
+		if err := s.lock.Unlock(); err != nil {
+			slog.Error("failed to unlock recordings directory", "error", err)
+		}
 	}
 }
 
@@ -116,6 +262,28 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("OK"))
 }
 
+// metricsHandler reports recorder queue counters in the Prometheus text format
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := s.recorder.Stats()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics := []struct {
+		name  string
+		kind  string
+		help  string
+		value int64
+	}{
+		{"mirra_recorder_queued_total", "counter", "Recordings accepted into the write queue.", stats.Queued},
+		{"mirra_recorder_dropped_total", "counter", "Recordings discarded because the queue was full.", stats.Dropped},
+		{"mirra_recorder_spilled_total", "counter", "Recordings written to the spill file because the queue was full.", stats.Spilled},
+		{"mirra_recorder_queue_depth", "gauge", "Recordings waiting to be written.", int64(stats.Depth)},
+		{"mirra_recorder_queue_capacity", "gauge", "Size of the write queue.", int64(stats.Capacity)},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+}
+
 // GetRecorder returns the server's recorder instance
 func (s *Server) GetRecorder() *recorder.Recorder {
 	return s.recorder
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jpoz/mirra/internal/config"
+	"github.com/jpoz/mirra/internal/recorder"
+	"github.com/jpoz/mirra/internal/ui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, adminToken string) (*Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Recording:  config.RecordingConfig{Enabled: true, Path: dir},
+		Providers:  map[string]config.Provider{"claude": {UpstreamURL: "http://127.0.0.1:1"}},
+		AdminToken: adminToken,
+	}
+	s, err := New(cfg, slog.Default(), ui.NewManager())
+	require.NoError(t, err)
+	return s, dir
+}
+
+func TestServer_AdminEndpointsRequireToken(t *testing.T) {
+	s, dir := newTestServer(t, "")
+	handler := s.routes()
+
+	token, err := recorder.ReadAdminToken(dir)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+
+	endpoints := []struct{ method, path string }{
+		{http.MethodDelete, "/api/recordings/20250101-missing"},
+		{http.MethodPost, "/api/prune"},
+		{http.MethodPost, "/api/index/rebuild"},
+	}
+	for _, e := range endpoints {
+		for _, auth := range []string{"", "Bearer sk-mirra-virtual", "Bearer " + token + "x", token} {
+			r := httptest.NewRequest(e.method, e.path, nil)
+			if auth != "" {
+				r.Header.Set("Authorization", auth)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusUnauthorized, w.Code, "%s %s with %q", e.method, e.path, auth)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/recordings/20250101-missing", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// The generated token only lives as long as the server
+	s.closeRecorder()
+	_, err = recorder.ReadAdminToken(dir)
+	assert.Error(t, err)
+}
+
+func TestServer_ConfiguredAdminToken(t *testing.T) {
+	s, dir := newTestServer(t, "secret")
+	defer s.closeRecorder()
+
+	_, err := recorder.ReadAdminToken(dir)
+	assert.Error(t, err, "a configured token is not written to disk")
+
+	for auth, want := range map[string]int{"": http.StatusUnauthorized, "Bearer secret": http.StatusOK} {
+		r := httptest.NewRequest(http.MethodPost, "/api/index/rebuild", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		s.routes().ServeHTTP(w, r)
+		assert.Equal(t, want, w.Code, auth)
+	}
+}
@@ -0,0 +1,34 @@
+import React from "react";
+import { RecordedBlob, blobURL } from "@/lib/api";
+
+interface BlobPreviewProps {
+  recordingId: string;
+  blobRef: string;
+  blob: RecordedBlob;
+  filename?: string;
+}
+
+/**
+ * Plays or shows binary content (audio, images, uploads) recorded as a blob
+ */
+export function BlobPreview({ recordingId, blobRef, blob, filename }: BlobPreviewProps) {
+  const url = blobURL(recordingId, blobRef);
+  const type = blob.content_type || "application/octet-stream";
+
+  return (
+    <div className="space-y-2">
+      <div className="text-xs text-muted-foreground font-mono">
+        {filename ? `${filename} · ` : ""}
+        {type} · {blob.size.toLocaleString()} bytes
+      </div>
+      {type.startsWith("audio/") && <audio controls src={url} className="w-full" />}
+      {type.startsWith("image/") && (
+        <img src={url} alt={filename || blobRef} className="max-h-96 rounded-md border" />
+      )}
+      {type.startsWith("video/") && <video controls src={url} className="max-h-96 rounded-md" />}
+      <a href={url} download={filename} className="text-xs underline">
+        Download
+      </a>
+    </div>
+  );
+}
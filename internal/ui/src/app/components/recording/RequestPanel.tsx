@@ -3,6 +3,7 @@ import { Copy, Check, ChevronRight, ChevronDown } from "lucide-react";
 import { Button } from "@/components/ui/button";
 import { Recording } from "@/lib/api";
 import { formatJSON, formatBody } from "@/lib/formatters";
+import { BlobPreview } from "./BlobPreview";
 
 interface RequestPanelProps {
   recording: Recording;
@@ -80,9 +81,33 @@ export function RequestPanel({ recording }: RequestPanelProps) {
           <label className="text-sm font-medium text-muted-foreground">
             Body
           </label>
-          <pre className="text-xs bg-muted p-3 rounded-md overflow-x-auto mt-1 font-mono max-h-96">
-            {formatBody(recording.request.body)}
-          </pre>
+          {recording.request.blob ? (
+            <div className="mt-1">
+              <BlobPreview recordingId={recording.id} blobRef="request" blob={recording.request.blob} />
+            </div>
+          ) : recording.request.multipart ? (
+            <div className="mt-1 space-y-3">
+              {recording.request.multipart.map((part, i) => (
+                <div key={i}>
+                  <div className="text-xs font-medium">{part.name}</div>
+                  {part.blob ? (
+                    <BlobPreview
+                      recordingId={recording.id}
+                      blobRef={`multipart[${i}]`}
+                      blob={part.blob}
+                      filename={part.filename}
+                    />
+                  ) : (
+                    <pre className="text-xs bg-muted p-2 rounded-md font-mono">{part.value}</pre>
+                  )}
+                </div>
+              ))}
+            </div>
+          ) : (
+            <pre className="text-xs bg-muted p-3 rounded-md overflow-x-auto mt-1 font-mono max-h-96">
+              {formatBody(recording.request.body)}
+            </pre>
+          )}
         </div>
       </div>
     </div>
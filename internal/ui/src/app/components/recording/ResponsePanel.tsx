@@ -3,6 +3,7 @@ import { Copy, Check, ChevronRight, ChevronDown } from "lucide-react";
 import { Button } from "@/components/ui/button";
 import { Recording } from "@/lib/api";
 import { formatJSON, formatBody } from "@/lib/formatters";
+import { BlobPreview } from "./BlobPreview";
 
 interface ResponsePanelProps {
   recording: Recording;
@@ -68,9 +69,15 @@ export function ResponsePanel({ recording }: ResponsePanelProps) {
           <label className="text-sm font-medium text-muted-foreground">
             Body
           </label>
-          <pre className="text-xs bg-muted p-3 rounded-md overflow-x-auto mt-1 font-mono max-h-96">
-            {formatBody(recording.response.body)}
-          </pre>
+          {recording.response.blob ? (
+            <div className="mt-1">
+              <BlobPreview recordingId={recording.id} blobRef="response" blob={recording.response.blob} />
+            </div>
+          ) : (
+            <pre className="text-xs bg-muted p-3 rounded-md overflow-x-auto mt-1 font-mono max-h-96">
+              {formatBody(recording.response.body)}
+            </pre>
+          )}
         </div>
       </div>
     </div>
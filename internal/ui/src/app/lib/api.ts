@@ -18,6 +18,21 @@ export interface RecordingListResponse {
   hasMore: boolean;
 }
 
+export interface RecordedBlob {
+  content_type?: string;
+  size: number;
+  sha256: string;
+  data?: string;
+}
+
+export interface MultipartPart {
+  name: string;
+  filename?: string;
+  content_type?: string;
+  value?: string;
+  blob?: RecordedBlob;
+}
+
 export interface Recording {
   id: string;
   timestamp: string;
@@ -28,12 +43,19 @@ export interface Recording {
     query: string;
     headers: Record<string, string[]>;
     body: any;
+    multipart?: MultipartPart[];
+    blob?: RecordedBlob;
+    raw?: RecordedBlob;
+    encoding?: string;
   };
   response: {
     status: number;
     headers: Record<string, string[]>;
     body: any;
     streaming: boolean;
+    blob?: RecordedBlob;
+    raw?: RecordedBlob;
+    encoding?: string;
   };
   timing: {
     startedAt: string;
@@ -49,6 +71,10 @@ export interface ParsedStream {
   eventCounts: Record<string, number>;
 }
 
+export function blobURL(recordingId: string, ref: string): string {
+  return `/api/recordings/${recordingId}/blobs/${encodeURIComponent(ref)}`;
+}
+
 export async function fetchRecordings(
   page: number,
   limit: number,
@@ -52,11 +52,66 @@ func main() {
 			slog.Error("reindex failed", "error", err)
 			os.Exit(1)
 		}
+	case "compact":
+		if err := commands.Compact(args); err != nil {
+			slog.Error("compact failed", "error", err)
+			os.Exit(1)
+		}
+	case "migrate":
+		if err := commands.Migrate(args); err != nil {
+			slog.Error("migrate failed", "error", err)
+			os.Exit(1)
+		}
+	case "verify":
+		if err := commands.Verify(args); err != nil {
+			slog.Error("verify failed", "error", err)
+			os.Exit(1)
+		}
+	case "delete":
+		if err := commands.Delete(args); err != nil {
+			slog.Error("delete failed", "error", err)
+			os.Exit(1)
+		}
+	case "subject":
+		if err := commands.Subject(args); err != nil {
+			slog.Error("subject failed", "error", err)
+			os.Exit(1)
+		}
+	case "fsck":
+		if err := commands.Fsck(args); err != nil {
+			slog.Error("fsck failed", "error", err)
+			os.Exit(1)
+		}
+	case "rekey":
+		if err := commands.Rekey(args); err != nil {
+			slog.Error("rekey failed", "error", err)
+			os.Exit(1)
+		}
+	case "prune":
+		if err := commands.Prune(args); err != nil {
+			slog.Error("prune failed", "error", err)
+			os.Exit(1)
+		}
 	case "groups":
 		if err := commands.Groups(args); err != nil {
 			slog.Error("groups failed", "error", err)
 			os.Exit(1)
 		}
+	case "findings":
+		if err := commands.Findings(args); err != nil {
+			slog.Error("findings failed", "error", err)
+			os.Exit(1)
+		}
+	case "keys":
+		if err := commands.Keys(args); err != nil {
+			slog.Error("keys failed", "error", err)
+			os.Exit(1)
+		}
+	case "audit":
+		if err := commands.Audit(args); err != nil {
+			slog.Error("audit failed", "error", err)
+			os.Exit(1)
+		}
 	case "clear":
 		if err := commands.Clear(args); err != nil {
 			slog.Error("clear failed", "error", err)
@@ -96,7 +151,11 @@ func startCommand(args []string) {
 	slog.SetDefault(log)
 
 	uiManager := ui.NewManager(ui.WithLogger(log))
-	srv := server.New(cfg, log, uiManager)
+	srv, err := server.New(cfg, log, uiManager)
+	if err != nil {
+		slog.Error("failed to start server", "error", err)
+		os.Exit(1)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -121,11 +180,27 @@ func printUsage() {
 
 Usage:
   mirra start [--port 4567] [--config ./config.json]
-  mirra export [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--provider claude|openai|gemini] [--output file.jsonl]
-  mirra stats [--from YYYY-MM-DD] [--provider claude|openai|gemini]
+  mirra export [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--provider claude|openai|gemini] [--project <name>] [--tags a,b] [--anonymize [--salt <salt>]] [--output file.jsonl]
+  mirra stats [--from YYYY-MM-DD] [--provider claude|openai|gemini] [--project <name>] [--tags a,b]
   mirra view <recording-id>
   mirra reindex [--recordings ./recordings]
+  mirra compact [--recordings ./recordings] [--dedupe-threshold 1024] [--inline-threshold 16384]
+  mirra migrate [--recordings ./recordings]
+  mirra verify [--recordings ./recordings] [--from YYYY-MM-DD] [--to YYYY-MM-DD]
+  mirra delete [--id <id-or-prefix>,...] [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--provider <provider>] [--session <id>] [--status 4xx] [--tags a,b] [--dry-run]
+  mirra subject export [--user <id>,...] [--tag <tag>,...] [--key <fingerprint>,...] [--output subject-export.zip]
+  mirra subject erase [--user <id>,...] [--tag <tag>,...] [--key <fingerprint>,...] [--anonymize] [--dry-run]
+  mirra subject fingerprint < api-key.txt
+  mirra fsck [--recordings ./recordings] [--repair]
+  mirra rekey [--recordings ./recordings] [--generate-key]
+  mirra prune [--config ./config.json] [--max-age-days 30] [--max-size-mb 10240] [--archive ./archive] [--dry-run]
   mirra groups sessions [--limit 20] [--provider <provider>] [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--errors]
+  mirra findings [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--detector pii|secret|prompt_injection] [--severity high]
+  mirra keys create [--owner <name>] [--project <name>] [--providers claude,openai] [--models 'claude-*'] [--expires 720h]
+  mirra keys list [--all]
+  mirra keys revoke <key-id>
+  mirra audit verify [--recordings ./recordings] [--public-key ./mirra-audit.key.pub] [--from YYYY-MM-DD] [--to YYYY-MM-DD]
+  mirra audit keygen [--out ./mirra-audit.key]
   mirra clear [--recordings ./recordings] [--force]
   mirra help
 
@@ -135,7 +210,18 @@ Commands:
   stats    - Show statistics about recordings
   view     - View a specific recording
   reindex  - Rebuild the recording index for faster lookups
+  compact  - Deduplicate prompts and tools in existing recordings
+  migrate  - Upgrade recordings to the current schema version
+  verify   - Check parsed bodies against the raw bytes they were recorded from
+  delete   - Delete selected recordings
+  subject  - Export or erase everything recorded about one user
+  fsck     - Check recording files and indexes for damage, --repair to fix them
+  rekey    - Encrypt recordings with the active encryption key
+  prune    - Remove recordings past the retention policy
   groups   - List and view session groups
+  findings - List secrets, PII and prompt injections found in traffic
+  keys     - Manage virtual API keys
+  audit    - Verify recordings against their hash-chained audit logs
   clear    - Delete all recordings and reset the database
   help     - Show this help message`
 	_, _ = fmt.Fprintln(os.Stdout, usage)